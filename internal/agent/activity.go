@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// ActivitySignals selects which live signals can keep an environment awake
+// An environment past its idle timeout is only stopped if none of them report activity
+type ActivitySignals struct {
+	ExecSessions bool    // Open `sili enter` shells and `sili run` commands
+	CPUThreshold float64 // CPU usage in percent at or above which the env is busy (0 disables)
+	Connections  bool    // Established TCP connections on mapped container ports
+	Processes    bool    // Processes besides the container's init process; skipped for stack services with their own command
+}
+
+// DefaultActivitySignals enables every signal with a 5% CPU threshold
+func DefaultActivitySignals() ActivitySignals {
+	return ActivitySignals{
+		ExecSessions: true,
+		CPUThreshold: 5,
+		Connections:  true,
+		Processes:    true,
+	}
+}
+
+// Enabled reports whether any signal is turned on
+func (s ActivitySignals) Enabled() bool {
+	return s.ExecSessions || s.CPUThreshold > 0 || s.Connections || s.Processes
+}
+
+// Activity is the result of probing an environment
+type Activity struct {
+	Active  bool
+	Reasons []string // Why the env is active, or why each signal found it idle
+}
+
+// String joins the reasons for logging
+func (a Activity) String() string {
+	return strings.Join(a.Reasons, ", ")
+}
+
+// activityProbe reads live signals for a container; replaced in tests
+type activityProbe interface {
+	execSessions(name string) (int, error)
+	cpuPercent(name string) (float64, error)
+	tcpTables(name string) (string, error)
+	processCount(name string) (int, error)
+}
+
+var probe activityProbe = podmanProbe{}
+
+// DetectActivity probes the enabled signals for env
+// A signal that fails to probe is reported but doesn't count as activity
+func DetectActivity(env *state.EnvInfo, signals ActivitySignals) Activity {
+	var busy, quiet []string
+	active := func(reason string) { busy = append(busy, reason) }
+	idle := func(reason string) { quiet = append(quiet, reason) }
+
+	if signals.ExecSessions {
+		if n, err := probe.execSessions(env.Name); err != nil {
+			idle(fmt.Sprintf("exec sessions unknown (%v)", err))
+		} else if n > 0 {
+			active(fmt.Sprintf("%d exec session(s) open", n))
+		} else {
+			idle("no exec sessions")
+		}
+	}
+
+	if signals.CPUThreshold > 0 {
+		if cpu, err := probe.cpuPercent(env.Name); err != nil {
+			idle(fmt.Sprintf("CPU unknown (%v)", err))
+		} else if cpu >= signals.CPUThreshold {
+			active(fmt.Sprintf("CPU %.1f%% >= %.1f%%", cpu, signals.CPUThreshold))
+		} else {
+			idle(fmt.Sprintf("CPU %.1f%% < %.1f%%", cpu, signals.CPUThreshold))
+		}
+	}
+
+	if signals.Connections && len(env.Ports) > 0 {
+		ports := make([]int, 0, len(env.Ports))
+		for _, p := range env.Ports {
+			if p.Protocol == "" || p.Protocol == "tcp" {
+				ports = append(ports, p.ContainerPort)
+			}
+		}
+		if tables, err := probe.tcpTables(env.Name); err != nil {
+			idle(fmt.Sprintf("connections unknown (%v)", err))
+		} else if n := countEstablished(tables, ports); n > 0 {
+			active(fmt.Sprintf("%d connection(s) on mapped ports", n))
+		} else {
+			idle("no connections")
+		}
+	}
+
+	// A service running its own command, e.g. postgres or nginx with their worker
+	// processes, has more than one process whether or not it is in use
+	if signals.Processes && (env.ImageCommand || len(env.Command) > 0) {
+		idle("processes not tracked for a service's own command")
+	} else if signals.Processes {
+		if n, err := probe.processCount(env.Name); err != nil {
+			idle(fmt.Sprintf("processes unknown (%v)", err))
+		} else if n > 1 {
+			active(fmt.Sprintf("%d process(es) besides init", n-1))
+		} else {
+			idle("no processes besides init")
+		}
+	}
+
+	// When active, only what kept the env awake is worth reporting
+	if len(busy) > 0 {
+		return Activity{Active: true, Reasons: busy}
+	}
+	return Activity{Reasons: quiet}
+}
+
+// tcpEstablished is the state code of an established socket in /proc/net/tcp
+const tcpEstablished = "01"
+
+// countEstablished counts established connections whose local port is in ports
+// tables is the content of /proc/net/tcp and /proc/net/tcp6
+func countEstablished(tables string, ports []int) int {
+	wanted := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		wanted[p] = true
+	}
+
+	count := 0
+	for _, line := range strings.Split(tables, "\n") {
+		fields := strings.Fields(line)
+		// sl local_address rem_address st ...
+		if len(fields) < 4 || fields[3] != tcpEstablished {
+			continue
+		}
+		_, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseInt(portHex, 16, 32)
+		if err != nil {
+			continue
+		}
+		if wanted[int(port)] {
+			count++
+		}
+	}
+	return count
+}
+
+// parseCPUPercent parses podman's CPU percentage, e.g. "12.34%"
+func parseCPUPercent(s string) (float64, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "%")
+	if s == "" || s == "--" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// podmanProbe reads signals through podman inside the VM
+type podmanProbe struct{}
+
+func podmanOutput(args ...string) (string, error) {
+	cmd := exec.Command("limactl", append([]string{"shell", lima.Instance, "--"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w (output: %s)", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (podmanProbe) execSessions(name string) (int, error) {
+	out, err := podmanOutput("podman", "inspect", "--format", "{{len .ExecIDs}}", name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+// podman stats without streaming reports usage since the previous sample
+func (podmanProbe) cpuPercent(name string) (float64, error) {
+	out, err := podmanOutput("podman", "stats", "--no-stream", "--format", "{{.CPUPerc}}", name)
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUPercent(out)
+}
+
+// The tables are read from the container's network namespace through its init process
+// rather than with podman exec, which would itself open an exec session
+func (podmanProbe) tcpTables(name string) (string, error) {
+	pid, err := podmanOutput("podman", "inspect", "--format", "{{.State.Pid}}", name)
+	if err != nil {
+		return "", err
+	}
+	return podmanOutput("podman", "unshare", "sh", "-c",
+		fmt.Sprintf("cat /proc/%s/net/tcp /proc/%s/net/tcp6 2>/dev/null; true", pid, pid))
+}
+
+func (podmanProbe) processCount(name string) (int, error) {
+	out, err := podmanOutput("podman", "top", name, "pid")
+	if err != nil {
+		return 0, err
+	}
+	// First line is the header
+	lines := strings.Split(out, "\n")
+	return len(lines) - 1, nil
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+type fakeProbe struct {
+	execs     int
+	cpu       float64
+	tables    string
+	processes int
+	err       error
+}
+
+func (p fakeProbe) execSessions(name string) (int, error)   { return p.execs, p.err }
+func (p fakeProbe) cpuPercent(name string) (float64, error) { return p.cpu, p.err }
+func (p fakeProbe) tcpTables(name string) (string, error)   { return p.tables, p.err }
+func (p fakeProbe) processCount(name string) (int, error)   { return p.processes, p.err }
+
+// tcpTable has an established connection on :3000 (0x0BB8) and a listener on :8080 (0x1F90)
+const tcpTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0BB8 0100007F:D2F0 01 00000000:00000000 00:00000000 00000000  1000        0 2 1 0000000000000000 20 4 30 10 -1
+`
+
+func TestDetectActivity(t *testing.T) {
+	env := &state.EnvInfo{
+		Name:  "web",
+		Ports: []state.PortMapping{{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"}},
+	}
+	all := DefaultActivitySignals()
+
+	tests := []struct {
+		name       string
+		env        *state.EnvInfo // Defaults to web
+		probe      fakeProbe
+		signals    ActivitySignals
+		wantActive bool
+		wantReason string
+	}{
+		{
+			name:       "quiet",
+			probe:      fakeProbe{processes: 1},
+			signals:    all,
+			wantReason: "no exec sessions, CPU 0.0% < 5.0%, no connections, no processes besides init",
+		},
+		{
+			name:       "open shell",
+			probe:      fakeProbe{execs: 1, processes: 2},
+			signals:    all,
+			wantActive: true,
+			wantReason: "1 exec session(s) open, 1 process(es) besides init",
+		},
+		{
+			name:       "busy cpu",
+			probe:      fakeProbe{cpu: 42, processes: 1},
+			signals:    all,
+			wantActive: true,
+			wantReason: "CPU 42.0% >= 5.0%",
+		},
+		{
+			name:       "connection on mapped port",
+			probe:      fakeProbe{tables: tcpTable, processes: 1},
+			signals:    all,
+			wantActive: true,
+			wantReason: "1 connection(s) on mapped ports",
+		},
+		{
+			name:       "signals disabled",
+			probe:      fakeProbe{execs: 3, cpu: 99, processes: 5},
+			signals:    ActivitySignals{},
+			wantReason: "",
+		},
+		{
+			name:       "service command processes",
+			env:        &state.EnvInfo{Name: "shop-db", ImageCommand: true},
+			probe:      fakeProbe{processes: 8},
+			signals:    ActivitySignals{Processes: true},
+			wantReason: "processes not tracked for a service's own command",
+		},
+		{
+			name:       "probe errors don't keep env awake",
+			probe:      fakeProbe{err: errors.New("VM unreachable")},
+			signals:    ActivitySignals{ExecSessions: true},
+			wantReason: "exec sessions unknown (VM unreachable)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := probe
+			probe = tt.probe
+			defer func() { probe = old }()
+
+			e := env
+			if tt.env != nil {
+				e = tt.env
+			}
+			a := DetectActivity(e, tt.signals)
+			if a.Active != tt.wantActive {
+				t.Errorf("Active = %v, want %v", a.Active, tt.wantActive)
+			}
+			if a.String() != tt.wantReason {
+				t.Errorf("reasons = %q, want %q", a.String(), tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCountEstablished(t *testing.T) {
+	if n := countEstablished(tcpTable, []int{3000}); n != 1 {
+		t.Errorf("countEstablished(3000) = %d, want 1", n)
+	}
+	// Listening sockets are not connections
+	if n := countEstablished(tcpTable, []int{8080}); n != 0 {
+		t.Errorf("countEstablished(8080) = %d, want 0", n)
+	}
+	if n := countEstablished(strings.Repeat("garbage\n", 3), []int{3000}); n != 0 {
+		t.Errorf("countEstablished(garbage) = %d, want 0", n)
+	}
+}
+
+func TestParseCPUPercent(t *testing.T) {
+	tests := map[string]float64{"12.34%": 12.34, "0.00%": 0, "--": 0, "": 0}
+	for in, want := range tests {
+		got, err := parseCPUPercent(in)
+		if err != nil || got != want {
+			t.Errorf("parseCPUPercent(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseCPUPercent("n/a"); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
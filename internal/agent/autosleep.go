@@ -2,23 +2,54 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/coheez/silibox/internal/ca"
 	"github.com/coheez/silibox/internal/container"
-	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/forward"
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/metrics"
+	"github.com/coheez/silibox/internal/proxy"
 	"github.com/coheez/silibox/internal/state"
+	"github.com/coheez/silibox/internal/vm"
+	"github.com/coheez/silibox/internal/wake"
 )
 
 // AutosleepConfig configures the autosleep agent behavior
 type AutosleepConfig struct {
-	ContainerIdleTimeout time.Duration // How long before stopping idle containers
-	VMIdleTimeout        time.Duration // How long before stopping idle VM
-	PollInterval         time.Duration // How often to check for idle resources
-	StopVM               bool          // Whether to stop VM when fully idle
+	ContainerIdleTimeout time.Duration   // How long before stopping idle containers
+	VMIdleTimeout        time.Duration   // How long before stopping idle VM
+	PollInterval         time.Duration   // How often to check for idle resources
+	StopVM               bool            // Whether to stop VM when fully idle
+	Activity             ActivitySignals // Live signals that keep an idle env awake
+	WakeOnConnect        bool            // Listen on sleeping envs' ports and wake them on connect
+	AutoForward          bool            // Forward ports containers start listening on to the host
+	Policy               Policy          // Per-env rules and schedules; DefaultTimeout comes from ContainerIdleTimeout
+	DryRun               bool            // Log what would be stopped without stopping anything
+	StopGrace            time.Duration   // Grace period for podman stop; a project's stop_grace wins
+	Memory               MemoryPressure  // Stop envs before their idle timeout when memory runs low
+	Notify               NotifyConfig    // Where to report stops, and heads-ups before them
+	MetricsListen        string          // Serve Prometheus metrics on this address; empty disables, not reloadable
+	ProxyListen          string          // Serve the .localhost proxy on this address; empty disables, not reloadable
+	ProxyTLSListen       string          // Serve it over HTTPS on this address once the CA exists; not reloadable
+
+	// Reload re-reads the config for `sili agent reload`; nil disables reloading
+	Reload func() (AutosleepConfig, error)
+}
+
+// EffectivePolicy returns the policy with the container idle timeout as its default
+func (c AutosleepConfig) EffectivePolicy() Policy {
+	p := c.Policy
+	p.DefaultTimeout = c.ContainerIdleTimeout
+	return p
 }
 
 // DefaultAutosleepConfig returns sensible defaults for autosleep
@@ -28,19 +59,81 @@ func DefaultAutosleepConfig() AutosleepConfig {
 		VMIdleTimeout:        30 * time.Minute,
 		PollInterval:         30 * time.Second,
 		StopVM:               true,
+		Activity:             DefaultActivitySignals(),
+		WakeOnConnect:        true,
+		AutoForward:          true,
+		Memory:               DefaultMemoryPressure(),
+		Notify:               NotifyConfig{LeadTime: 2 * time.Minute},
 	}
 }
 
 // RunAutosleep runs the autosleep agent with the given configuration
 // It polls periodically and stops idle containers (and optionally the VM)
 // The agent runs until the context is cancelled or a signal is received
+// While running it serves the control socket used by `sili agent status|pause|resume|reload`
 func RunAutosleep(ctx context.Context, cfg AutosleepConfig) error {
+	events.SetSource("autosleep")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a := newAutosleeper(ctx, cfg)
+
+	// Without its socket the agent still works, it just can't be controlled
+	if path, err := ControlSocketPath(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: control socket unavailable: %v\n", err)
+	} else if stop, err := serveControl(a, path); errors.Is(err, ErrAlreadyRunning) {
+		return err
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: control socket unavailable: %v\n", err)
+	} else {
+		defer stop()
+	}
+
+	if cfg.MetricsListen != "" {
+		addr, stop, err := metrics.Start(cfg.MetricsListen)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		a.metricsAddr = addr.String()
+	}
+
+	// Port 80 may be taken or need privileges; the agent is still useful without the proxy
+	if cfg.ProxyListen != "" {
+		if addr, stop, err := proxy.Start(cfg.ProxyListen); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: .localhost proxy unavailable: %v (set autosleep.proxy_listen to another address, e.g. 127.0.0.1:8080)\n", err)
+		} else {
+			defer stop()
+			a.proxyAddr = addr.String()
+		}
+	}
+	if cfg.ProxyTLSListen != "" {
+		if addr, stop, err := startProxyTLS(cfg.ProxyTLSListen); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: .localhost HTTPS proxy unavailable: %v (set autosleep.proxy_tls_listen to another address, e.g. 127.0.0.1:8443)\n", err)
+		} else if stop != nil {
+			defer stop()
+			a.proxyTLSAddr = addr
+		}
+	}
+
 	fmt.Fprintf(os.Stderr, "🌙 Autosleep agent starting...\n")
-	fmt.Fprintf(os.Stderr, "   Container idle timeout: %s\n", cfg.ContainerIdleTimeout)
-	fmt.Fprintf(os.Stderr, "   VM idle timeout: %s\n", cfg.VMIdleTimeout)
-	fmt.Fprintf(os.Stderr, "   Poll interval: %s\n", cfg.PollInterval)
-	fmt.Fprintf(os.Stderr, "   Auto-stop VM: %v\n", cfg.StopVM)
-	fmt.Fprintf(os.Stderr, "\n")
+	printConfig(cfg)
+	if a.metricsAddr != "" {
+		fmt.Fprintf(os.Stderr, "📈 Serving metrics on http://%s/metrics\n\n", a.metricsAddr)
+	}
+	if a.proxyAddr != "" {
+		fmt.Fprintf(os.Stderr, "🌐 Serving .localhost routes on %s\n", a.proxyAddr)
+	}
+	if a.proxyTLSAddr != "" {
+		fmt.Fprintf(os.Stderr, "🔒 Serving .localhost routes over HTTPS on %s\n", a.proxyTLSAddr)
+	}
+	if a.proxyAddr != "" || a.proxyTLSAddr != "" {
+		fmt.Fprintln(os.Stderr)
+	}
+	printPlan(cfg)
+	a.setWake(cfg.WakeOnConnect && !cfg.DryRun)
+	a.setForward(cfg.AutoForward && !cfg.DryRun)
 
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
@@ -50,9 +143,7 @@ func RunAutosleep(ctx context.Context, cfg AutosleepConfig) error {
 	defer ticker.Stop()
 
 	// Run initial check immediately
-	if err := checkAndStopIdle(cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: initial check failed: %v\n", err)
-	}
+	a.check()
 
 	for {
 		select {
@@ -65,39 +156,397 @@ func RunAutosleep(ctx context.Context, cfg AutosleepConfig) error {
 			return nil
 
 		case <-ticker.C:
-			if err := checkAndStopIdle(cfg); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: check failed: %v\n", err)
-			}
+			a.check()
+
+		case done := <-a.triggers:
+			done <- a.check()
+			ticker.Reset(a.config().PollInterval)
+
+		case <-a.reloads:
+			ticker.Reset(a.config().PollInterval)
+			a.scheduleNext()
+		}
+	}
+}
+
+// printConfig logs the settings the agent runs with
+func printConfig(cfg AutosleepConfig) {
+	fmt.Fprintf(os.Stderr, "   Container idle timeout: %s\n", cfg.ContainerIdleTimeout)
+	fmt.Fprintf(os.Stderr, "   VM idle timeout: %s\n", cfg.VMIdleTimeout)
+	fmt.Fprintf(os.Stderr, "   Poll interval: %s\n", cfg.PollInterval)
+	fmt.Fprintf(os.Stderr, "   Auto-stop VM: %v\n", cfg.StopVM)
+	fmt.Fprintf(os.Stderr, "   Wake on connect: %v\n", cfg.WakeOnConnect && !cfg.DryRun)
+	fmt.Fprintf(os.Stderr, "   Auto-forward ports: %v\n", cfg.AutoForward && !cfg.DryRun)
+	if cfg.Memory.Enabled() {
+		fmt.Fprintf(os.Stderr, "   Memory pressure: host >= %.0f%%, VM >= %.0f%%\n", cfg.Memory.HostThreshold, cfg.Memory.VMThreshold)
+	}
+	if cfg.Notify.Enabled() {
+		fmt.Fprintf(os.Stderr, "   Notifications: %s (heads-up %s)\n", strings.Join(notifyTargets(cfg.Notify), ", "), cfg.Notify.LeadTime)
+	}
+	fmt.Fprintf(os.Stderr, "   Rules: %d, schedules: %d\n", len(cfg.Policy.Rules), len(cfg.Policy.Schedules))
+	if cfg.DryRun {
+		fmt.Fprintf(os.Stderr, "   🔍 Dry run: nothing will be stopped, woken or forwarded\n")
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
+// autosleeper is the state of a running agent shared with the control socket
+type autosleeper struct {
+	ctx context.Context
+
+	mu          sync.Mutex
+	cfg         AutosleepConfig
+	startedAt   time.Time
+	paused      bool
+	pausedUntil time.Time // Zero when paused until resumed
+	lastCheck   time.Time
+	lastError   string
+	nextCheck   time.Time
+	waker       *wake.Waker
+	stopWaker   context.CancelFunc
+	// Cancels the port forwarder; nil when forwarding is off
+	stopForwarder context.CancelFunc
+
+	triggers chan chan error // Checks requested through the socket
+	reloads  chan struct{}   // Signals a new poll interval to the main loop
+	headsUps *headsUps       // Only used by checks, which run on the main loop
+
+	metricsAddr  string // Set before the main loop starts
+	proxyAddr    string // Set before the main loop starts
+	proxyTLSAddr string // Set before the main loop starts
+}
+
+// startProxyTLS serves the proxy over HTTPS if `sili ca init` has created the CA
+// HTTPS is opt-in because the CA has to be trusted by hand; without it stop is nil
+func startProxyTLS(listen string) (string, func(), error) {
+	authority, err := ca.Load()
+	if errors.Is(err, ca.ErrNotInitialized) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	addr, stop, err := proxy.StartTLS(listen, ca.NewIssuer(authority))
+	if err != nil {
+		return "", nil, err
+	}
+	return addr.String(), stop, nil
+}
+
+func newAutosleeper(ctx context.Context, cfg AutosleepConfig) *autosleeper {
+	now := time.Now()
+	return &autosleeper{
+		ctx:       ctx,
+		cfg:       cfg,
+		startedAt: now,
+		nextCheck: now,
+		triggers:  make(chan chan error),
+		reloads:   make(chan struct{}, 1),
+		headsUps:  newHeadsUps(),
+	}
+}
+
+func (a *autosleeper) config() AutosleepConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg
+}
+
+// check runs one autosleep pass unless paused
+func (a *autosleeper) check() error {
+	now := time.Now()
+	a.mu.Lock()
+	cfg := a.cfg
+	paused := a.pausedLocked(now)
+	a.nextCheck = now.Add(cfg.PollInterval)
+	a.mu.Unlock()
+
+	if paused {
+		return nil
+	}
+
+	err := checkAndStopIdle(cfg, a.headsUps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: check failed: %v\n", err)
+	}
+
+	a.mu.Lock()
+	a.lastCheck = now
+	a.lastError = ""
+	if err != nil {
+		a.lastError = err.Error()
+	}
+	a.mu.Unlock()
+	return err
+}
+
+func (a *autosleeper) scheduleNext() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nextCheck = time.Now().Add(a.cfg.PollInterval)
+}
+
+// pausedLocked reports whether checks are paused, ending an expired pause
+// Must be called with a.mu held
+func (a *autosleeper) pausedLocked(now time.Time) bool {
+	if a.paused && !a.pausedUntil.IsZero() && !now.Before(a.pausedUntil) {
+		a.paused, a.pausedUntil = false, time.Time{}
+		fmt.Fprintf(os.Stderr, "▶️  Autosleep resumed (pause expired)\n")
+		events.Record(events.Event{Type: events.AutosleepResume, Message: "pause expired"})
+	}
+	return a.paused
+}
+
+func (a *autosleeper) isPaused() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pausedLocked(time.Now())
+}
+
+// pause skips checks until resumed, or for d if it's positive
+func (a *autosleeper) pause(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.paused, a.pausedUntil = true, time.Time{}
+	msg := "paused until resumed"
+	if d > 0 {
+		a.pausedUntil = time.Now().Add(d)
+		msg = fmt.Sprintf("paused for %s", d)
+	}
+	fmt.Fprintf(os.Stderr, "⏸️  Autosleep %s\n", msg)
+	events.Record(events.Event{Type: events.AutosleepPause, Message: msg})
+}
+
+func (a *autosleeper) resume() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.paused {
+		return
+	}
+	a.paused, a.pausedUntil = false, time.Time{}
+	fmt.Fprintf(os.Stderr, "▶️  Autosleep resumed\n")
+	events.Record(events.Event{Type: events.AutosleepResume, Message: "resumed"})
+}
+
+// reload replaces the config with the one returned by cfg.Reload
+func (a *autosleeper) reload() error {
+	reloadFn := a.config().Reload
+	if reloadFn == nil {
+		return fmt.Errorf("this agent can't reload its config")
+	}
+	cfg, err := reloadFn()
+	if err != nil {
+		return err
+	}
+	cfg.Reload = reloadFn
+
+	a.mu.Lock()
+	a.cfg = cfg
+	a.mu.Unlock()
+	a.setWake(cfg.WakeOnConnect && !cfg.DryRun)
+	a.setForward(cfg.AutoForward && !cfg.DryRun)
+
+	fmt.Fprintf(os.Stderr, "🔄 Config reloaded\n")
+	printConfig(cfg)
+
+	select {
+	case a.reloads <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// setWake starts or stops wake-on-connect
+func (a *autosleeper) setWake(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if enabled == (a.waker != nil) {
+		return
+	}
+	if !enabled {
+		a.stopWaker()
+		a.waker, a.stopWaker = nil, nil
+		return
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.waker, a.stopWaker = wake.New(wake.DefaultOptions()), cancel
+	go a.waker.Run(ctx)
+}
+
+// releasePorts lets go of the wake-on-connect listeners of env, or of every env for ""
+func (a *autosleeper) releasePorts(env string) {
+	a.mu.Lock()
+	waker := a.waker
+	a.mu.Unlock()
+	if waker != nil {
+		waker.Release(env)
+	}
+}
+
+// setForward starts or stops automatic port forwarding
+// Forwards already set up stay until their env stops
+func (a *autosleeper) setForward(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if enabled == (a.stopForwarder != nil) {
+		return
+	}
+	if !enabled {
+		a.stopForwarder()
+		a.stopForwarder = nil
+		return
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.stopForwarder = cancel
+	go forward.New(forward.DefaultOptions()).Run(ctx)
+}
+
+// status returns a snapshot of the agent and the plan for every env
+func (a *autosleeper) status() (*Status, error) {
+	now := time.Now()
+
+	a.mu.Lock()
+	cfg := a.cfg
+	st := &Status{
+		PID:           os.Getpid(),
+		StartedAt:     a.startedAt,
+		Paused:        a.pausedLocked(now),
+		LastError:     a.lastError,
+		NextCheck:     a.nextCheck,
+		ContainerIdle: cfg.ContainerIdleTimeout.String(),
+		VMIdle:        cfg.VMIdleTimeout.String(),
+		PollInterval:  cfg.PollInterval.String(),
+		StopVM:        cfg.StopVM,
+		WakeOnConnect: cfg.WakeOnConnect && !cfg.DryRun,
+		AutoForward:   cfg.AutoForward && !cfg.DryRun,
+		DryRun:        cfg.DryRun,
+		Metrics:       a.metricsAddr,
+		Proxy:         a.proxyAddr,
+		ProxyTLS:      a.proxyTLSAddr,
+		Envs:          []EnvStatus{},
+	}
+	if !a.pausedUntil.IsZero() {
+		until := a.pausedUntil
+		st.PausedUntil = &until
+	}
+	if !a.lastCheck.IsZero() {
+		last := a.lastCheck
+		st.LastCheck = &last
+	}
+	waker := a.waker
+	a.mu.Unlock()
+
+	if waker != nil {
+		st.WakePorts = waker.Ports()
+	}
+
+	s, err := state.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	if vm := s.GetVM(); vm != nil {
+		st.VMStatus = vm.Status
+		if vm.Status == "running" {
+			st.VMIdleFor = now.Sub(vm.LastActive).Round(time.Second).String()
+		}
+	}
+	for _, pa := range cfg.EffectivePolicy().Plan(s, now) {
+		es := EnvStatus{PlannedAction: pa}
+		if env := s.GetEnv(pa.Env); env != nil && env.Status == "running" {
+			es.Idle = now.Sub(env.LastActive).Round(time.Second).String()
 		}
+		st.Envs = append(st.Envs, es)
+	}
+	return st, nil
+}
+
+// printPlan logs the next planned action of every environment
+func printPlan(cfg AutosleepConfig) {
+	st, err := state.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load state: %v\n", err)
+		return
+	}
+	plan := cfg.EffectivePolicy().Plan(st, time.Now())
+	if len(plan) == 0 {
+		return
 	}
+	fmt.Fprintf(os.Stderr, "📋 Plan:\n")
+	for _, pa := range plan {
+		fmt.Fprintf(os.Stderr, "   %s: %s\n", pa.Env, pa.Describe())
+	}
+	fmt.Fprintf(os.Stderr, "\n")
 }
 
-// checkAndStopIdle checks for idle containers and stops them
+// checkAndStopIdle stops environments whose planned stop is due
 // Also checks if VM should be stopped when fully idle
-func checkAndStopIdle(cfg AutosleepConfig) error {
-	// Get idle environments
-	idleEnvs, err := GetIdleEnvironments(cfg.ContainerIdleTimeout)
+func checkAndStopIdle(cfg AutosleepConfig, heads *headsUps) error {
+	st, err := state.Load()
 	if err != nil {
-		return fmt.Errorf("failed to get idle environments: %w", err)
+		return fmt.Errorf("failed to load state: %w", err)
 	}
 
-	// Stop each idle environment
-	for _, env := range idleEnvs {
-		idleDuration := GetIdleDuration(env)
-		fmt.Fprintf(os.Stderr, "💤 Stopping idle container '%s' (idle for %s)...\n", 
-			env.Name, formatDuration(idleDuration))
+	now := time.Now()
+	verdicts := Evaluate(cfg, st, now)
+	stackStopOrder(st, verdicts)
+	for _, v := range verdicts {
+		stop, warn := heads.track(cfg.Notify, v, now)
+		if warn != nil {
+			sendWarning(cfg, *warn)
+		}
 
-		if err := container.Stop(env.Name); err != nil {
-			fmt.Fprintf(os.Stderr, "   ⚠️  Failed to stop '%s': %v\n", env.Name, err)
-			continue
+		switch v.Verdict {
+		case VerdictInUse:
+			fmt.Fprintf(os.Stderr, "👀 '%s' has no recent sili activity but is still in use (%s)\n", v.Env, v.Detail)
+			if !cfg.DryRun {
+				markActive(v.Env, v.Detail)
+			}
+
+		case VerdictStop:
+			// Waiting out the heads-up
+			if !stop {
+				continue
+			}
+			if cfg.DryRun {
+				fmt.Fprintf(os.Stderr, "🔍 [dry-run] Would stop idle container '%s' (%s)\n", v.Env, v.Detail)
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "💤 Stopping idle container '%s' (%s)...\n", v.Env, v.Detail)
+			recordAutosleep(events.Event{
+				Type:    events.AutosleepStop,
+				Env:     v.Env,
+				Message: v.Detail,
+			})
+
+			grace := stopGrace(cfg, st.GetEnv(v.Env))
+			if err := container.StopWithOptions(v.Env, container.StopOptions{Grace: grace}); err != nil {
+				fmt.Fprintf(os.Stderr, "   ⚠️  Failed to stop '%s': %v\n", v.Env, err)
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "   ✅ Stopped '%s'\n", v.Env)
+			notify(cfg, Notification{
+				Kind:    NotifyStop,
+				Env:     v.Env,
+				Message: fmt.Sprintf("'%s' went to sleep (%s)", v.Env, v.Detail),
+			})
 		}
+	}
 
-		fmt.Fprintf(os.Stderr, "   ✅ Stopped '%s'\n", env.Name)
+	// Under memory pressure, free memory before idle timeouts run out
+	var pressure Pressure
+	if cfg.Memory.Enabled() {
+		pressure = relieveMemoryPressure(cfg)
 	}
 
 	// Check if VM should be stopped
 	if cfg.StopVM {
-		if err := checkAndStopVM(cfg); err != nil {
+		if err := checkAndStopVM(cfg, pressure); err != nil {
 			return fmt.Errorf("failed to check/stop VM: %w", err)
 		}
 	}
@@ -105,41 +554,216 @@ func checkAndStopIdle(cfg AutosleepConfig) error {
 	return nil
 }
 
-// checkAndStopVM checks if the VM is idle and stops it if needed
-func checkAndStopVM(cfg AutosleepConfig) error {
-	// Check if VM is idle
-	idle, err := IsVMIdle(cfg.VMIdleTimeout)
+// stackStopOrder reorders the envs of each stack among their own positions, so the
+// services that depend on others stop first
+func stackStopOrder(st *state.State, verdicts []Verdict) {
+	positions := make(map[string][]int) // Stack -> indexes of its envs
+	for i, v := range verdicts {
+		if env := st.GetEnv(v.Env); env.Stack != "" {
+			positions[env.Stack] = append(positions[env.Stack], i)
+		}
+	}
+	for stack, indexes := range positions {
+		byEnv := make(map[string]Verdict, len(indexes))
+		for _, i := range indexes {
+			byEnv[verdicts[i].Env] = verdicts[i]
+		}
+		next := 0
+		for _, name := range container.StackStopOrder(st, stack) {
+			if v, ok := byEnv[name]; ok {
+				verdicts[indexes[next]] = v
+				next++
+			}
+		}
+	}
+}
+
+// relieveMemoryPressure stops the least recently active env when memory runs low
+// One env is stopped per check so memory is measured again before stopping the next
+func relieveMemoryPressure(cfg AutosleepConfig) Pressure {
+	// Reloaded so envs stopped by this check don't count
+	st, err := state.Load()
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "Warning: failed to load state: %v\n", err)
+		return Pressure{}
+	}
+	info := st.GetVM()
+	if info == nil || info.Status != "running" {
+		return Pressure{}
+	}
+
+	p := DetectPressure(cfg.Memory, true)
+	if !p.Under {
+		return p
 	}
 
-	if !idle {
-		// VM not idle yet
+	now := time.Now()
+	for _, env := range PressureCandidates(cfg, st, now) {
+		if env.Status != "running" {
+			continue
+		}
+		reason := fmt.Sprintf("%s; least recently active, idle for %s", p.Reason, formatDuration(now.Sub(env.LastActive)))
+
+		// A stack sleeps as one unit
+		names := []string{env.Name}
+		if env.Stack != "" {
+			names = container.StackStopOrder(st, env.Stack)
+		}
+
+		// Memory pressure doesn't stop an env that is in use
+		if cfg.Activity.Enabled() && inUseUnderPressure(st, names, cfg.Activity) {
+			continue
+		}
+
+		if cfg.DryRun {
+			fmt.Fprintf(os.Stderr, "🔍 [dry-run] Would stop '%s' to relieve memory pressure (%s)\n", strings.Join(names, "', '"), reason)
+			return p
+		}
+
+		stopped := false
+		for _, name := range names {
+			member := st.GetEnv(name)
+			if member.Status != "running" {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "🧠 Stopping '%s' to relieve memory pressure (%s)...\n", name, reason)
+			recordAutosleep(events.Event{
+				Type:    events.AutosleepStop,
+				Env:     name,
+				Message: reason,
+			})
+			if err := container.StopWithOptions(name, container.StopOptions{Grace: stopGrace(cfg, member)}); err != nil {
+				fmt.Fprintf(os.Stderr, "   ⚠️  Failed to stop '%s': %v\n", name, err)
+				continue
+			}
+			stopped = true
+			fmt.Fprintf(os.Stderr, "   ✅ Stopped '%s'\n", name)
+			notify(cfg, Notification{
+				Kind:    NotifyStop,
+				Env:     name,
+				Message: fmt.Sprintf("'%s' went to sleep (%s)", name, reason),
+			})
+		}
+		if stopped {
+			return p
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "🧠 %s, but no environment can be stopped\n", p.Reason)
+	return p
+}
+
+// inUseUnderPressure reports whether one of the running envs is in use
+func inUseUnderPressure(st *state.State, names []string, signals ActivitySignals) bool {
+	for _, name := range names {
+		env := st.GetEnv(name)
+		if env.Status != "running" {
+			continue
+		}
+		if activity := DetectActivity(env, signals); activity.Active {
+			fmt.Fprintf(os.Stderr, "👀 Under memory pressure but '%s' is in use (%s)\n", name, activity)
+			return true
+		}
+	}
+	return false
+}
+
+// recordAutosleep records one of the agent's stops or heads-ups in the event log and
+// counts it for the metrics it serves
+func recordAutosleep(e events.Event) {
+	events.Record(e)
+	metrics.CountAutosleep(e)
+}
+
+// sendWarning logs, records and sends a heads-up before a planned stop
+func sendWarning(cfg AutosleepConfig, n Notification) {
+	if cfg.DryRun {
+		fmt.Fprintf(os.Stderr, "🔍 [dry-run] Would warn: %s\n", n.Message)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "📣 %s\n", n.Message)
+	recordAutosleep(events.Event{
+		Type:    events.AutosleepWarn,
+		Env:     n.Env,
+		Message: fmt.Sprintf("stop at %s", n.StopAt.Format("15:04:05")),
+	})
+	notify(cfg, n)
+}
+
+// notifyTargets lists the configured notification targets for logs
+func notifyTargets(c NotifyConfig) []string {
+	var targets []string
+	if c.Desktop {
+		targets = append(targets, "desktop")
+	}
+	if c.Webhook != "" {
+		targets = append(targets, "webhook")
+	}
+	if c.Command != "" {
+		targets = append(targets, "command")
+	}
+	return targets
+}
+
+// stopGrace returns the project's stop_grace for env, or the configured one
+func stopGrace(cfg AutosleepConfig, env *state.EnvInfo) time.Duration {
+	if m, _ := manifest.ForProject(env.ProjectPath, env.Service); m != nil && m.StopGrace > 0 {
+		return m.StopGrace
+	}
+	return cfg.StopGrace
+}
+
+// markActive resets the idle timer of an env that live signals found in use
+func markActive(name, reason string) {
+	if err := state.WithLockedState(func(s *state.State) error {
+		s.TouchEnvActivity(name)
+		s.TouchVMActivity()
 		return nil
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "   ⚠️  Failed to update activity for '%s': %v\n", name, err)
 	}
+	events.Record(events.Event{
+		Type:    events.AutosleepActive,
+		Env:     name,
+		Message: "still in use: " + reason,
+	})
+}
 
-	// Get VM info for logging
+// checkAndStopVM checks if the VM is idle and stops it if needed
+// State is reloaded so environments stopped by this check count
+func checkAndStopVM(cfg AutosleepConfig, pressure Pressure) error {
 	st, err := state.Load()
 	if err != nil {
 		return err
 	}
 
-	vm := st.GetVM()
-	if vm == nil {
-		// No VM to stop
+	v := EvaluateVM(cfg, st, time.Now(), pressure)
+	if v.Verdict != VerdictStop {
+		return nil
+	}
+
+	if cfg.DryRun {
+		fmt.Fprintf(os.Stderr, "🔍 [dry-run] Would stop idle VM (%s)\n", v.Detail)
 		return nil
 	}
 
-	// VM is idle - stop it
-	idleDuration := GetVMIdleDuration(vm)
-	fmt.Fprintf(os.Stderr, "💤 Stopping idle VM (idle for %s)...\n", formatDuration(idleDuration))
+	fmt.Fprintf(os.Stderr, "💤 Stopping idle VM (%s)...\n", v.Detail)
+	recordAutosleep(events.Event{
+		Type:    events.AutosleepVM,
+		Message: v.Detail,
+	})
 
-	if err := lima.Stop(); err != nil {
+	// Waits for pre-stop hooks still running in other processes
+	if err := vm.Stop(container.StopOptions{Grace: cfg.StopGrace}); err != nil {
 		fmt.Fprintf(os.Stderr, "   ⚠️  Failed to stop VM: %v\n", err)
 		return err
 	}
 
 	fmt.Fprintf(os.Stderr, "   ✅ VM stopped\n")
+	notify(cfg, Notification{
+		Kind:    NotifyVMStop,
+		Message: fmt.Sprintf("The Silibox VM went to sleep (%s)", v.Detail),
+	})
 	return nil
 }
 
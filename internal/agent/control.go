@@ -0,0 +1,289 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ControlSocketFile is the agent's control socket in ~/.sili
+const ControlSocketFile = "agent.sock"
+
+var (
+	// ErrNotRunning is returned by the client when no agent listens on the socket
+	ErrNotRunning = errors.New("autosleep agent is not running")
+	// ErrAlreadyRunning is returned when another agent already owns the socket
+	ErrAlreadyRunning = errors.New("another autosleep agent is already running")
+)
+
+// ControlSocketPath returns the location of the control socket (~/.sili/agent.sock)
+func ControlSocketPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sili", ControlSocketFile), nil
+}
+
+// Status is a snapshot of a running agent
+type Status struct {
+	PID           int              `json:"pid"`
+	StartedAt     time.Time        `json:"started_at"`
+	Paused        bool             `json:"paused"`
+	PausedUntil   *time.Time       `json:"paused_until,omitempty"` // Unset when paused until resumed
+	LastCheck     *time.Time       `json:"last_check,omitempty"`
+	LastError     string           `json:"last_error,omitempty"` // Error of the last check, if it failed
+	NextCheck     time.Time        `json:"next_check"`
+	ContainerIdle string           `json:"container_timeout"`
+	VMIdle        string           `json:"vm_timeout"`
+	PollInterval  string           `json:"poll_interval"`
+	StopVM        bool             `json:"stop_vm"`
+	WakeOnConnect bool             `json:"wake_on_connect"`
+	AutoForward   bool             `json:"auto_forward"`
+	DryRun        bool             `json:"dry_run"`
+	Metrics       string           `json:"metrics,omitempty"`    // Address metrics are served on
+	Proxy         string           `json:"proxy,omitempty"`      // Address the .localhost proxy is served on
+	ProxyTLS      string           `json:"proxy_tls,omitempty"`  // Address it is served on over HTTPS
+	WakePorts     map[string][]int `json:"wake_ports,omitempty"` // Ports listened on for sleeping envs
+	VMStatus      string           `json:"vm_status,omitempty"`
+	VMIdleFor     string           `json:"vm_idle,omitempty"`
+	Envs          []EnvStatus      `json:"envs"`
+}
+
+// EnvStatus is the planned action of an env and how long it has been idle
+type EnvStatus struct {
+	PlannedAction
+	Idle string `json:"idle,omitempty"` // Time since last activity, for running envs
+}
+
+// errorResponse is the body of a failed control request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// serveControl serves the control API on the socket at path until the returned func is called
+//
+//	GET  /v1/status          agent status, next check and per-env plan
+//	POST /v1/pause?for=30m   skip checks, optionally for a duration
+//	POST /v1/resume          resume checks
+//	POST /v1/reload          re-read the config
+//	POST /v1/trigger         run a check now
+//	POST /v1/release?env=    free an env's wake-on-connect ports before it starts; all without env
+func serveControl(a *autosleeper, path string) (func(), error) {
+	ln, err := listenControl(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, a)
+	})
+	mux.HandleFunc("POST /v1/pause", func(w http.ResponseWriter, r *http.Request) {
+		var d time.Duration
+		if v := r.URL.Query().Get("for"); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pause duration %q", v))
+				return
+			}
+			d = parsed
+		}
+		a.pause(d)
+		writeStatus(w, a)
+	})
+	mux.HandleFunc("POST /v1/resume", func(w http.ResponseWriter, r *http.Request) {
+		a.resume()
+		writeStatus(w, a)
+	})
+	mux.HandleFunc("POST /v1/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := a.reload(); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("reload failed: %w", err))
+			return
+		}
+		writeStatus(w, a)
+	})
+	mux.HandleFunc("POST /v1/trigger", func(w http.ResponseWriter, r *http.Request) {
+		if a.isPaused() {
+			writeError(w, http.StatusConflict, errors.New("autosleep is paused; resume it first"))
+			return
+		}
+		done := make(chan error, 1)
+		select {
+		case a.triggers <- done:
+		case <-r.Context().Done():
+			return
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("check failed: %w", err))
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		writeStatus(w, a)
+	})
+
+	mux.HandleFunc("POST /v1/release", func(w http.ResponseWriter, r *http.Request) {
+		a.releasePorts(r.URL.Query().Get("env"))
+		writeStatus(w, a)
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+
+	return func() {
+		srv.Close()
+		os.Remove(path)
+	}, nil
+}
+
+// listenControl binds the socket, replacing a stale one left by a crashed agent
+func listenControl(path string) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, ErrAlreadyRunning
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+func writeStatus(w http.ResponseWriter, a *autosleeper) {
+	st, err := a.status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
+
+// Client talks to a running agent over its control socket
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the agent's default socket
+func NewClient() (*Client, error) {
+	path, err := ControlSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return newClient(path), nil
+}
+
+func newClient(path string) *Client {
+	return &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+		// A triggered check waits for containers to stop
+		Timeout: 5 * time.Minute,
+	}}
+}
+
+// Status returns the agent's current status
+func (c *Client) Status() (*Status, error) {
+	return c.do(http.MethodGet, "/v1/status", nil)
+}
+
+// Pause stops the agent from stopping anything; d of 0 pauses until resumed
+func (c *Client) Pause(d time.Duration) (*Status, error) {
+	query := url.Values{}
+	if d > 0 {
+		query.Set("for", d.String())
+	}
+	return c.do(http.MethodPost, "/v1/pause", query)
+}
+
+// Resume lets the agent stop idle environments again
+func (c *Client) Resume() (*Status, error) {
+	return c.do(http.MethodPost, "/v1/resume", nil)
+}
+
+// Reload makes the agent re-read its config
+func (c *Client) Reload() (*Status, error) {
+	return c.do(http.MethodPost, "/v1/reload", nil)
+}
+
+// Trigger runs a check now and returns once it's done
+func (c *Client) Trigger() (*Status, error) {
+	return c.do(http.MethodPost, "/v1/trigger", nil)
+}
+
+// Release frees the host ports the agent listens on for env, or for every env if env
+// is empty, so Lima can forward them once the env or the VM starts
+func (c *Client) Release(env string) (*Status, error) {
+	query := url.Values{}
+	if env != "" {
+		query.Set("env", env)
+	}
+	return c.do(http.MethodPost, "/v1/release", query)
+}
+
+func (c *Client) do(method, endpoint string, query url.Values) (*Status, error) {
+	u := "http://agent" + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, ErrNotRunning
+		}
+		return nil, fmt.Errorf("failed to reach autosleep agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return nil, fmt.Errorf("autosleep agent returned %s", resp.Status)
+		}
+		return nil, errors.New(e.Error)
+	}
+
+	var st Status
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, fmt.Errorf("failed to decode agent status: %w", err)
+	}
+	return &st, nil
+}
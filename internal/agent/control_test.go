@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+// startControl serves a test agent on a short socket path (macOS limits them to 104 bytes)
+func startControl(t *testing.T, cfg AutosleepConfig) (*autosleeper, *Client, string) {
+	t.Helper()
+	_, cleanup := setupTestState(t)
+	t.Cleanup(cleanup)
+
+	dir, err := os.MkdirTemp("", "sili")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, ControlSocketFile)
+
+	a := newAutosleeper(context.Background(), cfg)
+	stop, err := serveControl(a, path)
+	if err != nil {
+		t.Fatalf("serveControl: %v", err)
+	}
+	t.Cleanup(stop)
+	return a, newClient(path), path
+}
+
+func testAgentConfig() AutosleepConfig {
+	cfg := DefaultAutosleepConfig()
+	cfg.StopVM = false
+	cfg.WakeOnConnect = false
+	cfg.Activity = ActivitySignals{}
+	cfg.Memory = MemoryPressure{}
+	return cfg
+}
+
+func TestControlStatus(t *testing.T) {
+	_, client, _ := startControl(t, testAgentConfig())
+
+	if err := state.WithLockedState(func(s *state.State) error {
+		s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running", LastActive: time.Now().Add(-5 * time.Minute)})
+		s.UpsertEnv(&state.EnvInfo{Name: "db", Status: "stopped", LastActive: time.Now().Add(-time.Hour)})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := client.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if st.PID != os.Getpid() || st.Paused || st.PollInterval != "30s" {
+		t.Errorf("unexpected status: %+v", st)
+	}
+	if len(st.Envs) != 2 || st.Envs[0].Env != "db" || st.Envs[1].Env != "web" {
+		t.Fatalf("envs = %+v, want db and web", st.Envs)
+	}
+	if st.Envs[0].Idle != "" || st.Envs[0].Action != ActionNone {
+		t.Errorf("stopped env = %+v, want no idle time and no action", st.Envs[0])
+	}
+	if st.Envs[1].Idle != "5m0s" || st.Envs[1].Action != ActionStopAt {
+		t.Errorf("running env = %+v, want idle 5m0s and a planned stop", st.Envs[1])
+	}
+}
+
+func TestControlPauseResume(t *testing.T) {
+	a, client, _ := startControl(t, testAgentConfig())
+
+	st, err := client.Pause(time.Hour)
+	if err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if !st.Paused || st.PausedUntil == nil {
+		t.Fatalf("status after pause = %+v, want paused with an end time", st)
+	}
+
+	if _, err := client.Trigger(); err == nil || !strings.Contains(err.Error(), "paused") {
+		t.Errorf("Trigger while paused: err = %v, want paused error", err)
+	}
+
+	st, err = client.Resume()
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if st.Paused || st.PausedUntil != nil {
+		t.Errorf("status after resume = %+v, want running", st)
+	}
+
+	// An expired pause ends on its own
+	a.pause(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if a.isPaused() {
+		t.Error("expected pause to expire")
+	}
+}
+
+func TestControlTrigger(t *testing.T) {
+	a, client, _ := startControl(t, testAgentConfig())
+
+	// Stand in for RunAutosleep's main loop
+	go func() {
+		done := <-a.triggers
+		done <- a.check()
+	}()
+
+	st, err := client.Trigger()
+	if err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	if st.LastCheck == nil || st.LastError != "" {
+		t.Errorf("status after trigger = %+v, want a successful check", st)
+	}
+}
+
+func TestControlRelease(t *testing.T) {
+	a, client, _ := startControl(t, testAgentConfig())
+
+	// No waker, nothing to release
+	if _, err := client.Release("api"); err != nil {
+		t.Fatalf("Release without wake-on-connect: %v", err)
+	}
+
+	port := freeTCPPort(t)
+	if err := state.WithLockedState(func(s *state.State) error {
+		s.SetVM(&state.VMInfo{Status: "running"})
+		s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "stopped", Ports: []state.PortMapping{{HostPort: port, ContainerPort: 8080}}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	a.setWake(true)
+	defer a.setWake(false)
+	waitFor(t, func() bool { return len(a.waker.Ports()["api"]) == 1 })
+
+	if _, err := client.Release("api"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if got := a.waker.Ports(); len(got) != 0 {
+		t.Errorf("wake ports after release = %v, want none", got)
+	}
+}
+
+// freeTCPPort returns a loopback port that is free right now
+func freeTCPPort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// waitFor polls cond for up to 5 seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+	}
+}
+
+func TestControlReload(t *testing.T) {
+	cfg := testAgentConfig()
+	a, client, _ := startControl(t, cfg)
+
+	if _, err := client.Reload(); err == nil {
+		t.Error("expected reload without a Reload func to fail")
+	}
+
+	setReload := func(fn func() (AutosleepConfig, error)) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.cfg.Reload = fn
+	}
+
+	setReload(func() (AutosleepConfig, error) {
+		next := testAgentConfig()
+		next.PollInterval = 10 * time.Second
+		return next, nil
+	})
+	st, err := client.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if st.PollInterval != "10s" {
+		t.Errorf("poll interval after reload = %s, want 10s", st.PollInterval)
+	}
+	if a.config().Reload == nil {
+		t.Error("reload func was lost after reloading")
+	}
+
+	setReload(func() (AutosleepConfig, error) {
+		return AutosleepConfig{}, errors.New("bad yaml")
+	})
+	if _, err := client.Reload(); err == nil || !strings.Contains(err.Error(), "bad yaml") {
+		t.Errorf("Reload with broken config: err = %v", err)
+	}
+	if a.config().PollInterval != 10*time.Second {
+		t.Error("failed reload replaced the config")
+	}
+}
+
+func TestControlSocketOwnership(t *testing.T) {
+	_, _, path := startControl(t, testAgentConfig())
+
+	if _, err := listenControl(path); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second listen: err = %v, want ErrAlreadyRunning", err)
+	}
+
+	// No agent behind a socket path
+	if _, err := newClient(filepath.Join(filepath.Dir(path), "missing.sock")).Status(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Status without agent: err = %v, want ErrNotRunning", err)
+	}
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+// Verdicts of a check
+const (
+	VerdictStop  = "stop"   // Would be stopped now
+	VerdictInUse = "in_use" // Past its timeout but kept awake by live activity signals
+	VerdictWait  = "wait"   // Not due yet
+	VerdictSkip  = "skip"   // Never stopped (stopped already, persistent or auto-stop disabled)
+)
+
+// Verdict is what a check decides for one environment and why
+type Verdict struct {
+	PlannedAction
+	Idle    string `json:"idle,omitempty"` // Time since last activity, for running envs
+	Verdict string `json:"verdict"`
+	Detail  string `json:"detail"`
+}
+
+// VMVerdict is what a check decides for the VM and why
+type VMVerdict struct {
+	Status      string `json:"status"`
+	Idle        string `json:"idle,omitempty"`
+	IdleTimeout string `json:"idle_timeout"`
+	Verdict     string `json:"verdict"`
+	Detail      string `json:"detail"`
+}
+
+// Explanation is a one-shot evaluation of every environment and the VM
+type Explanation struct {
+	Envs   []Verdict `json:"envs"`
+	VM     VMVerdict `json:"vm"`
+	Memory *Pressure `json:"memory,omitempty"` // Unset when memory pressure is disabled
+}
+
+// Evaluate decides what a check at now does to each environment
+// Live activity signals are probed for environments whose stop is due
+func Evaluate(cfg AutosleepConfig, st *state.State, now time.Time) []Verdict {
+	plan := cfg.EffectivePolicy().Plan(st, now)
+	verdicts := make([]Verdict, 0, len(plan))
+
+	for _, pa := range plan {
+		env := st.GetEnv(pa.Env)
+		v := Verdict{PlannedAction: pa}
+		if env.Status == "running" {
+			v.Idle = now.Sub(env.LastActive).Round(time.Second).String()
+		}
+
+		switch pa.Action {
+		case ActionNone:
+			v.Verdict, v.Detail = VerdictSkip, pa.Reason
+		case ActionStopAt:
+			v.Verdict = VerdictWait
+			v.Detail = fmt.Sprintf("stops in %s (%s)", formatDuration(pa.At.Sub(now)), pa.Reason)
+		default:
+			v.Verdict, v.Detail = VerdictStop, pa.Reason
+
+			// LastActive only covers run/enter; check the live signals before stopping
+			// Scheduled stops are deliberate and aren't vetoed
+			if cfg.Activity.Enabled() && !pa.Scheduled {
+				activity := DetectActivity(env, cfg.Activity)
+				if activity.Active {
+					v.Verdict, v.Detail = VerdictInUse, activity.String()
+				} else {
+					v.Detail += "; " + activity.String()
+				}
+			}
+		}
+		verdicts = append(verdicts, v)
+	}
+	holdStacks(st, verdicts)
+	return verdicts
+}
+
+// holdStacks keeps every env of a stack up while one of them stays up, so a stack
+// sleeps as one unit
+func holdStacks(st *state.State, verdicts []Verdict) {
+	keepers := make(map[string]string) // Stack -> env keeping it up
+	for _, v := range verdicts {
+		env := st.GetEnv(v.Env)
+		if env.Stack == "" || env.Status != "running" || v.Verdict == VerdictStop {
+			continue
+		}
+		if _, ok := keepers[env.Stack]; !ok {
+			keepers[env.Stack] = v.Env
+		}
+	}
+	for i, v := range verdicts {
+		keeper, ok := keepers[st.GetEnv(v.Env).Stack]
+		if ok && v.Verdict == VerdictStop {
+			verdicts[i].Verdict = VerdictWait
+			verdicts[i].Detail = fmt.Sprintf("stays up with '%s' from the same stack (%s)", keeper, v.Detail)
+		}
+	}
+}
+
+// EvaluateVM decides whether a check at now stops the VM
+// The VM is only stopped once every environment is stopped and it has been idle long enough,
+// or right away under memory pressure
+func EvaluateVM(cfg AutosleepConfig, st *state.State, now time.Time, pressure Pressure) VMVerdict {
+	v := VMVerdict{Status: "none", IdleTimeout: cfg.VMIdleTimeout.String(), Verdict: VerdictSkip}
+
+	vm := st.GetVM()
+	if vm == nil {
+		v.Detail = "no VM"
+		return v
+	}
+	v.Status = vm.Status
+	if vm.Status != "running" {
+		v.Detail = "not running"
+		return v
+	}
+
+	idle := now.Sub(vm.LastActive)
+	v.Idle = idle.Round(time.Second).String()
+	if !cfg.StopVM {
+		v.Detail = "auto-stop disabled"
+		return v
+	}
+
+	running := 0
+	for _, env := range st.ListEnvs() {
+		if env.Status != "stopped" {
+			running++
+		}
+	}
+
+	switch {
+	case running > 0:
+		v.Verdict = VerdictWait
+		v.Detail = fmt.Sprintf("%d environment(s) still running", running)
+	case pressure.Under:
+		v.Verdict = VerdictStop
+		v.Detail = "all environments stopped, " + pressure.Reason
+	case idle > cfg.VMIdleTimeout:
+		v.Verdict = VerdictStop
+		v.Detail = fmt.Sprintf("all environments stopped, idle for %s (timeout %s)", formatDuration(idle), cfg.VMIdleTimeout)
+	default:
+		v.Verdict = VerdictWait
+		v.Detail = fmt.Sprintf("all environments stopped, stops in %s", formatDuration(cfg.VMIdleTimeout-idle))
+	}
+	return v
+}
+
+// Explain evaluates the current state without stopping anything
+func Explain(cfg AutosleepConfig) (*Explanation, error) {
+	st, err := state.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	now := time.Now()
+	exp := &Explanation{Envs: Evaluate(cfg, st, now)}
+	var pressure Pressure
+	if cfg.Memory.Enabled() {
+		info := st.GetVM()
+		pressure = DetectPressure(cfg.Memory, info != nil && info.Status == "running")
+		exp.Memory = &pressure
+	}
+	exp.VM = EvaluateVM(cfg, st, now, pressure)
+	return exp, nil
+}
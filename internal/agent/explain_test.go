@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "busy", Status: "running", LastActive: now.Add(-time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "db", Status: "running", Persistent: true, LastActive: now.Add(-time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "fresh", Status: "running", LastActive: now.Add(-time.Minute)})
+	s.UpsertEnv(&state.EnvInfo{Name: "off", Status: "stopped", LastActive: now.Add(-time.Hour)})
+
+	cfg := DefaultAutosleepConfig()
+	cfg.Activity = ActivitySignals{ExecSessions: true}
+
+	old := probe
+	probe = fakeProbe{execs: 1}
+	defer func() { probe = old }()
+
+	want := map[string]string{
+		"busy":  VerdictInUse,
+		"db":    VerdictSkip,
+		"fresh": VerdictWait,
+		"off":   VerdictSkip,
+	}
+	for _, v := range Evaluate(cfg, s, now) {
+		if v.Verdict != want[v.Env] {
+			t.Errorf("%s: verdict = %s (%s), want %s", v.Env, v.Verdict, v.Detail, want[v.Env])
+		}
+	}
+
+	// Without live signals the idle env is stopped
+	cfg.Activity = ActivitySignals{}
+	for _, v := range Evaluate(cfg, s, now) {
+		if v.Env == "busy" && v.Verdict != VerdictStop {
+			t.Errorf("busy without signals: verdict = %s, want stop", v.Verdict)
+		}
+	}
+}
+
+func TestEvaluateStack(t *testing.T) {
+	now := time.Now()
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-app", Status: "running", Stack: "shop", DependsOn: []string{"shop-db"}, LastActive: now.Add(-time.Minute)})
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-db", Status: "running", Stack: "shop", LastActive: now.Add(-time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "blog-db", Status: "running", Stack: "blog", LastActive: now.Add(-time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "blog-web", Status: "running", Stack: "blog", DependsOn: []string{"blog-db"}, LastActive: now.Add(-time.Hour)})
+
+	verdicts := Evaluate(DefaultAutosleepConfig(), s, now)
+	want := map[string]string{
+		"shop-app": VerdictWait,
+		"shop-db":  VerdictWait, // Held up by shop-app
+		"blog-db":  VerdictStop,
+		"blog-web": VerdictStop,
+	}
+	for _, v := range verdicts {
+		if v.Verdict != want[v.Env] {
+			t.Errorf("%s: verdict = %s (%s), want %s", v.Env, v.Verdict, v.Detail, want[v.Env])
+		}
+		if v.Env == "shop-db" && !strings.Contains(v.Detail, "shop-app") {
+			t.Errorf("shop-db: detail = %q, want it to name shop-app", v.Detail)
+		}
+	}
+
+	// Dependents stop before the services they depend on
+	stackStopOrder(s, verdicts)
+	var stops []string
+	for _, v := range verdicts {
+		if v.Verdict == VerdictStop {
+			stops = append(stops, v.Env)
+		}
+	}
+	if !slices.Equal(stops, []string{"blog-web", "blog-db"}) {
+		t.Errorf("stop order = %v, want [blog-web blog-db]", stops)
+	}
+}
+
+// A database service forks workers, which must not keep its stack awake
+func TestEvaluateStackServiceProcesses(t *testing.T) {
+	now := time.Now()
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-app", Status: "running", Stack: "shop", DependsOn: []string{"shop-db"}, LastActive: now.Add(-time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-db", Status: "running", Stack: "shop", ImageCommand: true, LastActive: now.Add(-time.Hour)})
+
+	cfg := DefaultAutosleepConfig()
+	cfg.Activity = ActivitySignals{Processes: true}
+
+	// postgres with its checkpointer, walwriter and friends
+	old := probe
+	probe = processesByEnv{"shop-app": 1, "shop-db": 7}
+	defer func() { probe = old }()
+
+	for _, v := range Evaluate(cfg, s, now) {
+		if v.Verdict != VerdictStop {
+			t.Errorf("%s: verdict = %s (%s), want stop", v.Env, v.Verdict, v.Detail)
+		}
+	}
+	if inUseUnderPressure(s, []string{"shop-app", "shop-db"}, cfg.Activity) {
+		t.Error("inUseUnderPressure() = true, want the stack to be stoppable")
+	}
+}
+
+// processesByEnv reports a process count per env and no other activity
+type processesByEnv map[string]int
+
+func (p processesByEnv) execSessions(name string) (int, error)   { return 0, nil }
+func (p processesByEnv) cpuPercent(name string) (float64, error) { return 0, nil }
+func (p processesByEnv) tcpTables(name string) (string, error)   { return "", nil }
+func (p processesByEnv) processCount(name string) (int, error)   { return p[name], nil }
+
+func TestEvaluateVM(t *testing.T) {
+	now := time.Now()
+	cfg := DefaultAutosleepConfig()
+
+	tests := []struct {
+		name   string
+		vm     *state.VMInfo
+		envs   []*state.EnvInfo
+		stopVM bool
+		want   string
+	}{
+		{"no vm", nil, nil, true, VerdictSkip},
+		{"vm stopped", &state.VMInfo{Status: "stopped"}, nil, true, VerdictSkip},
+		{"env running", &state.VMInfo{Status: "running", LastActive: now.Add(-time.Hour)},
+			[]*state.EnvInfo{{Name: "web", Status: "running"}}, true, VerdictWait},
+		{"idle long enough", &state.VMInfo{Status: "running", LastActive: now.Add(-time.Hour)},
+			[]*state.EnvInfo{{Name: "web", Status: "stopped"}}, true, VerdictStop},
+		{"recently active", &state.VMInfo{Status: "running", LastActive: now.Add(-time.Minute)}, nil, true, VerdictWait},
+		{"auto-stop disabled", &state.VMInfo{Status: "running", LastActive: now.Add(-time.Hour)}, nil, false, VerdictSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state.NewState()
+			if tt.vm != nil {
+				s.SetVM(tt.vm)
+			}
+			for _, env := range tt.envs {
+				s.UpsertEnv(env)
+			}
+			cfg.StopVM = tt.stopVM
+			if got := EvaluateVM(cfg, s, now, Pressure{}); got.Verdict != tt.want {
+				t.Errorf("verdict = %s (%s), want %s", got.Verdict, got.Detail, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+// MemoryPressure configures stopping environments early when memory runs low
+// Under pressure the least recently active envs are stopped before their idle timeout
+type MemoryPressure struct {
+	HostThreshold float64 // Host memory use in percent at or above which the host is under pressure (0 disables)
+	VMThreshold   float64 // VM memory use in percent at or above which the VM is under pressure (0 disables)
+}
+
+// DefaultMemoryPressure treats 90% memory use on the host or in the VM as pressure
+func DefaultMemoryPressure() MemoryPressure {
+	return MemoryPressure{HostThreshold: 90, VMThreshold: 90}
+}
+
+// Enabled reports whether any threshold is set
+func (m MemoryPressure) Enabled() bool {
+	return m.HostThreshold > 0 || m.VMThreshold > 0
+}
+
+// Pressure is the result of measuring memory use
+type Pressure struct {
+	HostUsed *float64 `json:"host_used_percent,omitempty"` // Unset when not measured
+	VMUsed   *float64 `json:"vm_used_percent,omitempty"`   // Unset when not measured or the VM isn't running
+	Under    bool     `json:"under_pressure"`
+	Reason   string   `json:"reason"`
+}
+
+// memoryProbe measures memory use in percent; replaced in tests
+type memoryProbe interface {
+	hostUsed() (float64, error)
+	vmUsed() (float64, error)
+}
+
+var memProbe memoryProbe = systemMemory{}
+
+// DetectPressure measures the memory use the thresholds care about
+// The VM is only measured while it runs; a failed measurement never counts as pressure
+func DetectPressure(m MemoryPressure, vmRunning bool) Pressure {
+	var p Pressure
+	var over, ok []string
+
+	measure := func(what string, threshold float64, used func() (float64, error)) *float64 {
+		pct, err := used()
+		switch {
+		case err != nil:
+			ok = append(ok, fmt.Sprintf("%s memory unknown (%v)", what, err))
+			return nil
+		case pct >= threshold:
+			over = append(over, fmt.Sprintf("%s memory %.0f%% >= %.0f%%", what, pct, threshold))
+		default:
+			ok = append(ok, fmt.Sprintf("%s memory %.0f%% < %.0f%%", what, pct, threshold))
+		}
+		return &pct
+	}
+
+	if m.HostThreshold > 0 {
+		p.HostUsed = measure("host", m.HostThreshold, memProbe.hostUsed)
+	}
+	if m.VMThreshold > 0 && vmRunning {
+		p.VMUsed = measure("VM", m.VMThreshold, memProbe.vmUsed)
+	}
+
+	// Only what caused the pressure is worth reporting
+	p.Under = len(over) > 0
+	if p.Under {
+		p.Reason = "memory pressure: " + strings.Join(over, ", ")
+	} else {
+		p.Reason = strings.Join(ok, ", ")
+	}
+	return p
+}
+
+// PressureCandidates returns the envs memory pressure may stop, least recently active first
+// Stopped, persistent and envs inside a keep-awake window are never candidates
+func PressureCandidates(cfg AutosleepConfig, st *state.State, now time.Time) []*state.EnvInfo {
+	policy := cfg.EffectivePolicy()
+
+	var envs []*state.EnvInfo
+	for _, pa := range policy.Plan(st, now) {
+		if pa.Action == ActionNone {
+			continue
+		}
+		if _, kept := policy.KeptAwake(pa.Env, now); kept {
+			continue
+		}
+		envs = append(envs, st.GetEnv(pa.Env))
+	}
+
+	sort.SliceStable(envs, func(i, j int) bool { return envs[i].LastActive.Before(envs[j].LastActive) })
+	return envs
+}
+
+// systemMemory reads memory use from the host OS and from the VM's /proc/meminfo
+type systemMemory struct{}
+
+func (systemMemory) hostUsed() (float64, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		// The percentage of memory the kernel considers free
+		out, err := exec.Command("sysctl", "-n", "kern.memorystatus_level").Output()
+		if err != nil {
+			return 0, fmt.Errorf("sysctl kern.memorystatus_level: %w", err)
+		}
+		free, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected memorystatus_level %q", strings.TrimSpace(string(out)))
+		}
+		return 100 - free, nil
+	case "linux":
+		data, err := os.ReadFile("/proc/meminfo")
+		if err != nil {
+			return 0, err
+		}
+		return meminfoUsed(string(data))
+	default:
+		return 0, fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+}
+
+func (systemMemory) vmUsed() (float64, error) {
+	out, err := podmanOutput("cat", "/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	return meminfoUsed(out)
+}
+
+// meminfoUsed computes memory use in percent from /proc/meminfo
+// Memory the kernel can reclaim (MemAvailable) doesn't count as used
+func meminfoUsed(meminfo string) (float64, error) {
+	var total, available float64
+	var haveTotal, haveAvailable bool
+	for _, line := range strings.Split(meminfo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, haveTotal = kb, true
+		case "MemAvailable:":
+			available, haveAvailable = kb, true
+		}
+	}
+	if !haveTotal || !haveAvailable || total == 0 {
+		return 0, fmt.Errorf("MemTotal or MemAvailable missing from /proc/meminfo")
+	}
+	return (total - available) / total * 100, nil
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+type fakeMemory struct {
+	host, vm       float64
+	hostErr, vmErr error
+}
+
+func (f fakeMemory) hostUsed() (float64, error) { return f.host, f.hostErr }
+func (f fakeMemory) vmUsed() (float64, error)   { return f.vm, f.vmErr }
+
+func TestMeminfoUsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		meminfo string
+		want    float64
+		wantErr bool
+	}{
+		{"quarter used", "MemTotal:       8000000 kB\nMemFree:         1000000 kB\nMemAvailable:    6000000 kB\n", 25, false},
+		{"fully used", "MemTotal: 4000 kB\nMemAvailable: 0 kB\n", 100, false},
+		{"no MemAvailable", "MemTotal: 4000 kB\nMemFree: 100 kB\n", 0, true},
+		{"empty", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := meminfoUsed(tt.meminfo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("meminfoUsed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("meminfoUsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectPressure(t *testing.T) {
+	tests := []struct {
+		name      string
+		mem       fakeMemory
+		vmRunning bool
+		want      bool
+	}{
+		{"below thresholds", fakeMemory{host: 60, vm: 50}, true, false},
+		{"host over", fakeMemory{host: 95, vm: 50}, true, true},
+		{"vm over", fakeMemory{host: 60, vm: 92}, true, true},
+		{"vm over but not running", fakeMemory{host: 60, vm: 92}, false, false},
+		{"probe failures", fakeMemory{hostErr: errors.New("boom"), vmErr: errors.New("boom")}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := memProbe
+			memProbe = tt.mem
+			defer func() { memProbe = old }()
+
+			p := DetectPressure(DefaultMemoryPressure(), tt.vmRunning)
+			if p.Under != tt.want {
+				t.Errorf("Under = %v (%s), want %v", p.Under, p.Reason, tt.want)
+			}
+			if !tt.vmRunning && p.VMUsed != nil {
+				t.Error("measured the VM while it isn't running")
+			}
+		})
+	}
+}
+
+func TestPressureCandidates(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.Local) // Monday
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "recent", Status: "running", LastActive: now.Add(-time.Minute)})
+	s.UpsertEnv(&state.EnvInfo{Name: "oldest", Status: "running", LastActive: now.Add(-time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "middle", Status: "running", LastActive: now.Add(-10 * time.Minute)})
+	s.UpsertEnv(&state.EnvInfo{Name: "db", Status: "running", Persistent: true, LastActive: now.Add(-2 * time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "off", Status: "stopped", LastActive: now.Add(-3 * time.Hour)})
+	s.UpsertEnv(&state.EnvInfo{Name: "demo", Status: "running", LastActive: now.Add(-4 * time.Hour)})
+
+	cfg := DefaultAutosleepConfig()
+	sched, err := ParseSchedule("demo", "demo", nil, "09:00", "18:00", "keep_awake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Policy.Schedules = []Schedule{sched}
+
+	var got []string
+	for _, env := range PressureCandidates(cfg, s, now) {
+		got = append(got, env.Name)
+	}
+	want := []string{"oldest", "middle", "recent"}
+	if len(got) != len(want) {
+		t.Fatalf("candidates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candidates = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEvaluateVMUnderPressure(t *testing.T) {
+	now := time.Now()
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Status: "running", LastActive: now.Add(-time.Minute)})
+	s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "stopped"})
+
+	cfg := DefaultAutosleepConfig()
+	pressure := Pressure{Under: true, Reason: "memory pressure: host memory 95% >= 90%"}
+	if v := EvaluateVM(cfg, s, now, pressure); v.Verdict != VerdictStop {
+		t.Errorf("verdict = %s (%s), want stop before the idle timeout", v.Verdict, v.Detail)
+	}
+
+	// Pressure never stops the VM under a running env
+	s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running"})
+	if v := EvaluateVM(cfg, s, now, pressure); v.Verdict != VerdictWait {
+		t.Errorf("verdict = %s (%s), want wait", v.Verdict, v.Detail)
+	}
+}
@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/container"
+)
+
+// Notification kinds
+const (
+	NotifyWarning = "warning" // An env will be stopped after the lead time
+	NotifyStop    = "stop"    // An env was stopped
+	NotifyVMStop  = "vm_stop" // The VM was stopped
+)
+
+// NotifyConfig selects where the agent reports what it does
+type NotifyConfig struct {
+	Desktop  bool          // Native desktop notifications
+	Webhook  string        // URL that receives each notification as a JSON POST
+	Command  string        // Shell command run with the notification in SILI_NOTIFY_* variables and on stdin
+	LeadTime time.Duration // Heads-up this long before a planned stop; 0 disables heads-ups
+}
+
+// Enabled reports whether any target is configured
+func (c NotifyConfig) Enabled() bool {
+	return c.Desktop || c.Webhook != "" || c.Command != ""
+}
+
+// headsUp reports whether stops wait for a heads-up
+func (c NotifyConfig) headsUp() bool {
+	return c.Enabled() && c.LeadTime > 0
+}
+
+// Notification is what the agent sends to each target
+type Notification struct {
+	Kind    string     `json:"kind"`
+	Env     string     `json:"env,omitempty"`
+	Message string     `json:"message"`
+	StopAt  *time.Time `json:"stop_at,omitempty"` // For warnings
+	Time    time.Time  `json:"time"`
+}
+
+// notifyTimeout bounds webhook and command deliveries
+const notifyTimeout = 10 * time.Second
+
+// deliver sends a notification to every target in the background; replaced in tests
+// A failed delivery is logged and never affects what the agent does
+var deliver = func(cfg NotifyConfig, n Notification) {
+	send := func(target string, fn func() error) {
+		go func() {
+			if err := fn(); err != nil {
+				fmt.Fprintf(os.Stderr, "   ⚠️  %s notification failed: %v\n", target, err)
+			}
+		}()
+	}
+	if cfg.Desktop {
+		send("desktop", func() error { return notifyDesktop(n, cfg.LeadTime) })
+	}
+	if cfg.Webhook != "" {
+		send("webhook", func() error { return notifyWebhook(cfg.Webhook, n) })
+	}
+	if cfg.Command != "" {
+		send("command", func() error { return notifyCommand(cfg.Command, n) })
+	}
+}
+
+// notify sends n unless notifications are off or this is a dry run
+func notify(cfg AutosleepConfig, n Notification) {
+	if !cfg.Notify.Enabled() || cfg.DryRun {
+		return
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	deliver(cfg.Notify, n)
+}
+
+// headsUps gates due stops behind a warning sent at least the lead time earlier
+// It is only used from the agent's check loop
+type headsUps struct {
+	stopAfter map[string]time.Time // Envs warned about, and when they may be stopped
+}
+
+func newHeadsUps() *headsUps {
+	return &headsUps{stopAfter: make(map[string]time.Time)}
+}
+
+// track follows an env's verdict and returns whether a due stop may go ahead now,
+// and a warning to send if the env just entered the lead time
+// Planned stops are warned about the lead time ahead; an env that is due without a
+// warning (e.g. right after the agent started) is warned and stopped a lead time later
+func (h *headsUps) track(cfg NotifyConfig, v Verdict, now time.Time) (bool, *Notification) {
+	if !cfg.headsUp() {
+		return true, nil
+	}
+
+	switch v.Verdict {
+	case VerdictWait:
+		if v.At == nil || v.At.Sub(now) > cfg.LeadTime {
+			delete(h.stopAfter, v.Env)
+			return false, nil
+		}
+		if _, warned := h.stopAfter[v.Env]; warned {
+			return false, nil
+		}
+		h.stopAfter[v.Env] = *v.At
+		return false, warning(v.Env, *v.At, now)
+
+	case VerdictStop:
+		at, warned := h.stopAfter[v.Env]
+		if !warned {
+			at = now.Add(cfg.LeadTime)
+			h.stopAfter[v.Env] = at
+			return false, warning(v.Env, at, now)
+		}
+		if now.Before(at) {
+			return false, nil
+		}
+		delete(h.stopAfter, v.Env)
+		return true, nil
+
+	default:
+		// Used again, or never stopped
+		delete(h.stopAfter, v.Env)
+		return false, nil
+	}
+}
+
+// warning builds the heads-up for env
+func warning(env string, at, now time.Time) *Notification {
+	return &Notification{
+		Kind:    NotifyWarning,
+		Env:     env,
+		Message: fmt.Sprintf("'%s' will sleep in %s. Run 'sili env touch --name %s' to keep it awake.", env, formatDuration(at.Sub(now)), env),
+		StopAt:  &at,
+		Time:    now,
+	}
+}
+
+// notifyDesktop shows a native notification
+// On Linux a warning offers a "Keep awake" action that resets the env's idle timer
+func notifyDesktop(n Notification, lead time.Duration) error {
+	title := "Silibox"
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(n.Message), appleScriptString(title))
+		if out, err := exec.Command("osascript", "-e", script).CombinedOutput(); err != nil {
+			return fmt.Errorf("osascript: %w (output: %s)", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+
+	case "linux":
+		if n.Kind != NotifyWarning || n.Env == "" {
+			if out, err := exec.Command("notify-send", title, n.Message).CombinedOutput(); err != nil {
+				return fmt.Errorf("notify-send: %w (output: %s)", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}
+
+		// Wait for the action until the env would be stopped anyway
+		ctx, cancel := context.WithTimeout(context.Background(), lead)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "notify-send", "--wait", "--action=keep=Keep awake", title, n.Message).Output()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("notify-send: %w", err)
+		}
+		if strings.TrimSpace(string(out)) == "keep" {
+			return container.Touch(n.Env, "kept awake from notification")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+}
+
+// appleScriptString quotes s for AppleScript
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// notifyWebhook POSTs the notification as JSON
+func notifyWebhook(url string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// notifyCommand runs a shell command with the notification in its environment and on stdin
+func notifyCommand(command string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"SILI_NOTIFY_KIND="+n.Kind,
+		"SILI_NOTIFY_ENV="+n.Env,
+		"SILI_NOTIFY_MESSAGE="+n.Message,
+	)
+	if n.StopAt != nil {
+		cmd.Env = append(cmd.Env, "SILI_NOTIFY_STOP_AT="+n.StopAt.Format(time.RFC3339))
+	}
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w (output: %s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeadsUps(t *testing.T) {
+	cfg := NotifyConfig{Command: "true", LeadTime: 2 * time.Minute}
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time { t := now.Add(d); return &t }
+	wait := func(d time.Duration) Verdict {
+		return Verdict{PlannedAction: PlannedAction{Env: "web", At: at(d)}, Verdict: VerdictWait}
+	}
+	due := Verdict{PlannedAction: PlannedAction{Env: "web"}, Verdict: VerdictStop}
+
+	steps := []struct {
+		name     string
+		elapsed  time.Duration
+		verdict  Verdict
+		wantStop bool
+		wantWarn bool
+	}{
+		{"outside the lead time", 0, wait(10 * time.Minute), false, false},
+		{"enters the lead time", 8 * time.Minute, wait(2 * time.Minute), false, true},
+		{"warned once", 9 * time.Minute, wait(time.Minute), false, false},
+		{"due after the warning", 10 * time.Minute, due, true, false},
+		{"due without a warning", 20 * time.Minute, due, false, true},
+		{"still within the lead time", 21 * time.Minute, due, false, false},
+		{"lead time over", 22 * time.Minute, due, true, false},
+	}
+
+	h := newHeadsUps()
+	for _, s := range steps {
+		stop, warn := h.track(cfg, s.verdict, now.Add(s.elapsed))
+		if stop != s.wantStop || (warn != nil) != s.wantWarn {
+			t.Errorf("%s: stop = %v, warning = %v; want %v, %v", s.name, stop, warn != nil, s.wantStop, s.wantWarn)
+		}
+	}
+
+	// Without notifications nothing waits
+	if stop, warn := newHeadsUps().track(NotifyConfig{LeadTime: time.Minute}, due, now); !stop || warn != nil {
+		t.Errorf("without targets: stop = %v, warning = %v; want an immediate stop", stop, warn)
+	}
+
+	// Activity in between starts over
+	h = newHeadsUps()
+	h.track(cfg, due, now)
+	h.track(cfg, Verdict{PlannedAction: PlannedAction{Env: "web"}, Verdict: VerdictInUse}, now.Add(time.Minute))
+	if _, warn := h.track(cfg, due, now.Add(20*time.Minute)); warn == nil {
+		t.Error("expected a new warning after the env was used")
+	}
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	var got Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	n := Notification{Kind: NotifyStop, Env: "web", Message: "'web' went to sleep", Time: time.Now()}
+	if err := notifyWebhook(srv.URL, n); err != nil {
+		t.Fatalf("notifyWebhook: %v", err)
+	}
+	if got.Kind != NotifyStop || got.Env != "web" {
+		t.Errorf("received %+v", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := notifyWebhook(failing.URL, n); err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+}
+
+func TestNotifyCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	stopAt := time.Date(2025, 1, 6, 12, 2, 0, 0, time.UTC)
+	n := Notification{Kind: NotifyWarning, Env: "web", Message: "'web' will sleep in 2 minutes", StopAt: &stopAt}
+
+	cmd := `echo "$SILI_NOTIFY_KIND $SILI_NOTIFY_ENV $SILI_NOTIFY_STOP_AT" > ` + out + ` && cat >> ` + out
+	if err := notifyCommand(cmd, n); err != nil {
+		t.Fatalf("notifyCommand: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if lines[0] != "warning web 2025-01-06T12:02:00Z" {
+		t.Errorf("environment = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], `"message":"'web' will sleep in 2 minutes"`) {
+		t.Errorf("stdin = %q, want the notification as JSON", lines[1])
+	}
+
+	if err := notifyCommand("exit 3", n); err == nil {
+		t.Error("expected an error for a failing command")
+	}
+}
@@ -0,0 +1,348 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// Rule overrides autosleep settings for environments whose name matches a glob
+type Rule struct {
+	Match       string
+	IdleTimeout time.Duration // 0 keeps the default
+	Persistent  *bool         // nil keeps the default
+}
+
+// ParseRule validates a rule from its config representation
+func ParseRule(match string, idleTimeout time.Duration, persistent *bool) (Rule, error) {
+	if match == "" {
+		return Rule{}, fmt.Errorf("rule: match is required")
+	}
+	if _, err := path.Match(match, ""); err != nil {
+		return Rule{}, fmt.Errorf("rule %s: invalid match: %w", match, err)
+	}
+	if idleTimeout < 0 {
+		return Rule{}, fmt.Errorf("rule %s: idle_timeout must not be negative", match)
+	}
+	return Rule{Match: match, IdleTimeout: idleTimeout, Persistent: persistent}, nil
+}
+
+// ScheduleAction is what a schedule window does while it's open
+type ScheduleAction string
+
+const (
+	ScheduleKeepAwake ScheduleAction = "keep_awake" // Never stop matching envs inside the window
+	ScheduleStop      ScheduleAction = "stop"       // Stop matching envs not used since the window opened
+)
+
+// Schedule is a recurring daily time window
+type Schedule struct {
+	Name   string
+	Match  string // Glob on the env name; empty matches all
+	Days   map[time.Weekday]bool
+	From   time.Duration // Offset from midnight
+	To     time.Duration // Offset from midnight; <= From wraps past midnight
+	Action ScheduleAction
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule validates a schedule from its config representation
+func ParseSchedule(name, match string, days []string, from, to, action string) (Schedule, error) {
+	sched := Schedule{Name: name, Match: match, Action: ScheduleAction(action)}
+	if sched.Name == "" {
+		sched.Name = fmt.Sprintf("%s-%s", from, to)
+	}
+
+	switch sched.Action {
+	case ScheduleKeepAwake, ScheduleStop:
+	default:
+		return Schedule{}, fmt.Errorf("schedule %s: invalid action %q (must be keep_awake or stop)", sched.Name, action)
+	}
+	if match != "" {
+		if _, err := path.Match(match, ""); err != nil {
+			return Schedule{}, fmt.Errorf("schedule %s: invalid match %q: %w", sched.Name, match, err)
+		}
+	}
+
+	var err error
+	if sched.From, err = parseClock(from); err != nil {
+		return Schedule{}, fmt.Errorf("schedule %s: invalid from: %w", sched.Name, err)
+	}
+	if sched.To, err = parseClock(to); err != nil {
+		return Schedule{}, fmt.Errorf("schedule %s: invalid to: %w", sched.Name, err)
+	}
+
+	if len(days) > 0 {
+		sched.Days = make(map[time.Weekday]bool, len(days))
+		for _, d := range days {
+			wd, ok := parseWeekday(d)
+			if !ok {
+				return Schedule{}, fmt.Errorf("schedule %s: invalid day %q", sched.Name, d)
+			}
+			sched.Days[wd] = true
+		}
+	}
+	return sched, nil
+}
+
+// parseWeekday accepts short or full day names (mon, Monday)
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) < 3 {
+		return 0, false
+	}
+	wd, ok := weekdays[s[:3]]
+	return wd, ok
+}
+
+// parseClock parses HH:MM into an offset from midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (s Schedule) matches(env string) bool {
+	if s.Match == "" {
+		return true
+	}
+	ok, _ := path.Match(s.Match, env)
+	return ok
+}
+
+func (s Schedule) onDay(day time.Time) bool {
+	return len(s.Days) == 0 || s.Days[day.Weekday()]
+}
+
+// windowOn returns the window that starts on the given day
+func (s Schedule) windowOn(day time.Time) (time.Time, time.Time) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	start := midnight.Add(s.From)
+	end := midnight.Add(s.To)
+	if s.To <= s.From {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// Active returns the window containing now, if any
+// Days refer to the day a window starts, so a "fri 22:00-07:00" window covers Saturday morning
+func (s Schedule) Active(now time.Time) (start, end time.Time, ok bool) {
+	for _, offset := range []int{0, -1} {
+		day := now.AddDate(0, 0, offset)
+		if !s.onDay(day) {
+			continue
+		}
+		start, end := s.windowOn(day)
+		if !now.Before(start) && now.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// Next returns the first window starting after now
+func (s Schedule) Next(now time.Time) (start, end time.Time, ok bool) {
+	for offset := 0; offset <= 7; offset++ {
+		day := now.AddDate(0, 0, offset)
+		if !s.onDay(day) {
+			continue
+		}
+		start, end := s.windowOn(day)
+		if start.After(now) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// Policy decides when environments are stopped
+type Policy struct {
+	DefaultTimeout time.Duration
+	Rules          []Rule
+	Schedules      []Schedule
+}
+
+// Settings are the effective autosleep settings of one environment
+type Settings struct {
+	IdleTimeout      time.Duration
+	TimeoutSource    string // env, manifest, rule <match> or default
+	Persistent       bool
+	PersistentSource string
+}
+
+// Settings resolves the settings for env
+// Precedence: the env itself (create flags, `sili env set`), the project manifest,
+// the first matching config rule, then the global default
+func (p Policy) Settings(env *state.EnvInfo, m *manifest.Manifest) Settings {
+	st := Settings{IdleTimeout: p.DefaultTimeout, TimeoutSource: "default", PersistentSource: "default"}
+
+	var rule *Rule
+	for i := range p.Rules {
+		if ok, _ := path.Match(p.Rules[i].Match, env.Name); ok {
+			rule = &p.Rules[i]
+			break
+		}
+	}
+
+	switch {
+	case env.IdleTimeout > 0:
+		st.IdleTimeout, st.TimeoutSource = env.IdleTimeout, "env"
+	case m != nil && m.Autosleep.IdleTimeout > 0:
+		st.IdleTimeout, st.TimeoutSource = m.Autosleep.IdleTimeout, "manifest"
+	case rule != nil && rule.IdleTimeout > 0:
+		st.IdleTimeout, st.TimeoutSource = rule.IdleTimeout, "rule "+rule.Match
+	}
+
+	switch {
+	case env.Persistent:
+		st.Persistent, st.PersistentSource = true, "env"
+	case m != nil && m.Autosleep.Persistent != nil:
+		st.Persistent, st.PersistentSource = *m.Autosleep.Persistent, "manifest"
+	case rule != nil && rule.Persistent != nil:
+		st.Persistent, st.PersistentSource = *rule.Persistent, "rule "+rule.Match
+	}
+	return st
+}
+
+// KeptAwake returns the keep-awake schedule env is inside at now, if any
+func (p Policy) KeptAwake(env string, now time.Time) (string, bool) {
+	for _, s := range p.Schedules {
+		if s.Action != ScheduleKeepAwake || !s.matches(env) {
+			continue
+		}
+		if _, _, ok := s.Active(now); ok {
+			return s.Name, true
+		}
+	}
+	return "", false
+}
+
+// Planned actions
+const (
+	ActionNone   = "none"    // Nothing planned (stopped or persistent)
+	ActionStop   = "stop"    // Due now
+	ActionStopAt = "stop_at" // Planned for At
+)
+
+// PlannedAction is the next thing autosleep will do to an environment
+type PlannedAction struct {
+	Env           string     `json:"env"`
+	Status        string     `json:"status"`
+	IdleTimeout   string     `json:"idle_timeout"`
+	TimeoutSource string     `json:"timeout_source"`
+	Action        string     `json:"action"`
+	At            *time.Time `json:"at,omitempty"` // Unset when nothing is planned
+	Reason        string     `json:"reason"`
+	Scheduled     bool       `json:"scheduled"` // Driven by a schedule; not vetoed by activity signals
+}
+
+// Describe renders the action for logs and tables
+func (pa PlannedAction) Describe() string {
+	switch pa.Action {
+	case ActionStop:
+		return fmt.Sprintf("stop now (%s)", pa.Reason)
+	case ActionStopAt:
+		return fmt.Sprintf("stop at %s (%s)", pa.At.Format("Mon 15:04"), pa.Reason)
+	default:
+		return fmt.Sprintf("none (%s)", pa.Reason)
+	}
+}
+
+// Decide returns the next action for env at now
+func (p Policy) Decide(env *state.EnvInfo, st Settings, now time.Time) PlannedAction {
+	pa := PlannedAction{
+		Env:           env.Name,
+		Status:        env.Status,
+		IdleTimeout:   st.IdleTimeout.String(),
+		TimeoutSource: st.TimeoutSource,
+		Action:        ActionNone,
+	}
+
+	if env.Status == "stopped" {
+		pa.Reason = "stopped"
+		return pa
+	}
+	if st.Persistent {
+		pa.Reason = fmt.Sprintf("persistent (%s)", st.PersistentSource)
+		return pa
+	}
+
+	// A stop window stops envs that haven't been used since it opened; using an env
+	// during the window brings back the normal idle timeout
+	for _, s := range p.Schedules {
+		if s.Action != ScheduleStop || !s.matches(env.Name) {
+			continue
+		}
+		if start, _, ok := s.Active(now); ok && env.LastActive.Before(start) {
+			pa.Action, pa.At, pa.Scheduled = ActionStop, &now, true
+			pa.Reason = fmt.Sprintf("schedule %s", s.Name)
+			return pa
+		}
+	}
+
+	deadline := env.LastActive.Add(st.IdleTimeout)
+	reason := fmt.Sprintf("idle timeout %s (%s)", st.IdleTimeout, st.TimeoutSource)
+
+	// Keep-awake windows push the deadline to the end of the window
+	for _, s := range p.Schedules {
+		if s.Action != ScheduleKeepAwake || !s.matches(env.Name) {
+			continue
+		}
+		if _, end, ok := s.Active(now); ok && end.After(deadline) {
+			deadline = end
+			reason = fmt.Sprintf("kept awake by schedule %s, then %s", s.Name, reason)
+		} else if start, end, ok := s.Next(now); ok && !deadline.Before(start) && end.After(deadline) {
+			deadline = end
+			reason = fmt.Sprintf("kept awake by schedule %s, then %s", s.Name, reason)
+		}
+	}
+
+	// An upcoming stop window may come first
+	for _, s := range p.Schedules {
+		if s.Action != ScheduleStop || !s.matches(env.Name) {
+			continue
+		}
+		if start, _, ok := s.Next(now); ok && start.Before(deadline) {
+			deadline = start
+			reason = fmt.Sprintf("schedule %s", s.Name)
+			pa.Scheduled = true
+		}
+	}
+
+	pa.At, pa.Reason = &deadline, reason
+	if !deadline.After(now) {
+		pa.Action = ActionStop
+		if !pa.Scheduled {
+			pa.Reason = fmt.Sprintf("idle for %s, %s", formatDuration(now.Sub(env.LastActive)), reason)
+		}
+	} else {
+		pa.Action = ActionStopAt
+	}
+	return pa
+}
+
+// Plan returns the next action for every environment, loading project manifests
+func (p Policy) Plan(s *state.State, now time.Time) []PlannedAction {
+	envs := s.ListEnvs()
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+	plan := make([]PlannedAction, 0, len(envs))
+	for _, env := range envs {
+		// A broken manifest leaves the configured settings
+		m, _ := manifest.ForProject(env.ProjectPath, env.Service)
+		plan = append(plan, p.Decide(env, p.Settings(env, m), now))
+	}
+	return plan
+}
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+func mustSchedule(t *testing.T, name, match string, days []string, from, to, action string) Schedule {
+	t.Helper()
+	s, err := ParseSchedule(name, match, days, from, to, action)
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	return s
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    []string
+		from    string
+		to      string
+		action  string
+		wantErr bool
+	}{
+		{"valid", []string{"mon", "Friday"}, "09:00", "18:00", "keep_awake", false},
+		{"every day", nil, "22:00", "06:00", "stop", false},
+		{"bad action", nil, "09:00", "18:00", "sleep", true},
+		{"bad clock", nil, "9am", "18:00", "stop", true},
+		{"bad day", []string{"mo"}, "09:00", "18:00", "stop", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchedule(tt.name, "", tt.days, tt.from, tt.to, tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	// 2025-01-06 is a Monday
+	at := func(day, hour, min int) time.Time { return time.Date(2025, 1, day, hour, min, 0, 0, time.Local) }
+
+	workday := mustSchedule(t, "workday", "", []string{"mon", "tue", "wed", "thu", "fri"}, "09:00", "18:00", "keep_awake")
+	friNight := mustSchedule(t, "fri-night", "", []string{"fri"}, "22:00", "07:00", "stop")
+
+	tests := []struct {
+		name  string
+		sched Schedule
+		now   time.Time
+		want  bool
+	}{
+		{"monday inside", workday, at(6, 10, 0), true},
+		{"monday before", workday, at(6, 8, 59), false},
+		{"monday at end", workday, at(6, 18, 0), false},
+		{"saturday", workday, at(11, 10, 0), false},
+		{"friday night", friNight, at(10, 23, 0), true},
+		{"wraps into saturday", friNight, at(11, 6, 30), true},
+		{"saturday night", friNight, at(11, 23, 0), false},
+		{"thursday night", friNight, at(9, 23, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := tt.sched.Active(tt.now); ok != tt.want {
+				t.Errorf("Active(%s) = %v, want %v", tt.now, ok, tt.want)
+			}
+		})
+	}
+
+	start, _, ok := workday.Next(at(10, 19, 0))
+	if !ok || !start.Equal(at(13, 9, 0)) {
+		t.Errorf("Next after friday evening = %s, %v; want monday 09:00", start, ok)
+	}
+}
+
+func TestPolicySettings(t *testing.T) {
+	policy := Policy{
+		DefaultTimeout: 15 * time.Minute,
+		Rules: []Rule{
+			{Match: "db-*", IdleTimeout: 2 * time.Hour},
+			{Match: "db-*", IdleTimeout: 3 * time.Hour},
+			{Match: "cache", Persistent: boolPtr(true)},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		env            *state.EnvInfo
+		manifest       *manifest.Manifest
+		wantTimeout    time.Duration
+		wantSource     string
+		wantPersistent bool
+	}{
+		{"default", &state.EnvInfo{Name: "web"}, nil, 15 * time.Minute, "default", false},
+		{"first rule wins", &state.EnvInfo{Name: "db-main"}, nil, 2 * time.Hour, "rule db-*", false},
+		{"manifest beats rule", &state.EnvInfo{Name: "db-main"},
+			&manifest.Manifest{Autosleep: manifest.Autosleep{IdleTimeout: time.Hour}}, time.Hour, "manifest", false},
+		{"env beats manifest", &state.EnvInfo{Name: "db-main", IdleTimeout: 5 * time.Minute},
+			&manifest.Manifest{Autosleep: manifest.Autosleep{IdleTimeout: time.Hour}}, 5 * time.Minute, "env", false},
+		{"rule persistent", &state.EnvInfo{Name: "cache"}, nil, 15 * time.Minute, "default", true},
+		{"manifest not persistent", &state.EnvInfo{Name: "cache"},
+			&manifest.Manifest{Autosleep: manifest.Autosleep{Persistent: boolPtr(false)}}, 15 * time.Minute, "default", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Settings(tt.env, tt.manifest)
+			if got.IdleTimeout != tt.wantTimeout || got.TimeoutSource != tt.wantSource {
+				t.Errorf("timeout = %s (%s), want %s (%s)", got.IdleTimeout, got.TimeoutSource, tt.wantTimeout, tt.wantSource)
+			}
+			if got.Persistent != tt.wantPersistent {
+				t.Errorf("persistent = %v, want %v", got.Persistent, tt.wantPersistent)
+			}
+		})
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	// Monday 2025-01-06
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.Local)
+	settings := Settings{IdleTimeout: 15 * time.Minute, TimeoutSource: "default"}
+
+	workday := mustSchedule(t, "workday", "", []string{"mon"}, "09:00", "18:00", "keep_awake")
+	lunch := mustSchedule(t, "lunch", "web", nil, "11:30", "13:00", "stop")
+	evening := mustSchedule(t, "evening", "", nil, "12:10", "23:00", "stop")
+
+	tests := []struct {
+		name          string
+		schedules     []Schedule
+		env           *state.EnvInfo
+		settings      Settings
+		wantAction    string
+		wantAt        time.Time
+		wantScheduled bool
+	}{
+		{
+			name:       "stopped",
+			env:        &state.EnvInfo{Name: "web", Status: "stopped", LastActive: now.Add(-time.Hour)},
+			settings:   settings,
+			wantAction: ActionNone,
+		},
+		{
+			name:       "persistent",
+			env:        &state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-time.Hour)},
+			settings:   Settings{IdleTimeout: 15 * time.Minute, Persistent: true},
+			wantAction: ActionNone,
+		},
+		{
+			name:       "idle past timeout",
+			env:        &state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-20 * time.Minute)},
+			settings:   settings,
+			wantAction: ActionStop,
+			wantAt:     now.Add(-5 * time.Minute),
+		},
+		{
+			name:       "stop planned",
+			env:        &state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-5 * time.Minute)},
+			settings:   settings,
+			wantAction: ActionStopAt,
+			wantAt:     now.Add(10 * time.Minute),
+		},
+		{
+			name:       "kept awake until window ends",
+			schedules:  []Schedule{workday},
+			env:        &state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-time.Hour)},
+			settings:   settings,
+			wantAction: ActionStopAt,
+			wantAt:     time.Date(2025, 1, 6, 18, 0, 0, 0, time.Local),
+		},
+		{
+			name:          "stop window opened after last use",
+			schedules:     []Schedule{lunch},
+			env:           &state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-time.Hour)},
+			settings:      Settings{IdleTimeout: 4 * time.Hour},
+			wantAction:    ActionStop,
+			wantAt:        now,
+			wantScheduled: true,
+		},
+		{
+			name:       "used during stop window",
+			schedules:  []Schedule{lunch},
+			env:        &state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-5 * time.Minute)},
+			settings:   settings,
+			wantAction: ActionStopAt,
+			wantAt:     now.Add(10 * time.Minute),
+		},
+		{
+			name:       "stop window for other env",
+			schedules:  []Schedule{lunch},
+			env:        &state.EnvInfo{Name: "api", Status: "running", LastActive: now.Add(-5 * time.Minute)},
+			settings:   settings,
+			wantAction: ActionStopAt,
+			wantAt:     now.Add(10 * time.Minute),
+		},
+		{
+			name:          "upcoming stop window comes first",
+			schedules:     []Schedule{evening},
+			env:           &state.EnvInfo{Name: "web", Status: "running", LastActive: now},
+			settings:      Settings{IdleTimeout: time.Hour},
+			wantAction:    ActionStopAt,
+			wantAt:        time.Date(2025, 1, 6, 12, 10, 0, 0, time.Local),
+			wantScheduled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{Schedules: tt.schedules}
+			got := policy.Decide(tt.env, tt.settings, now)
+			if got.Action != tt.wantAction {
+				t.Fatalf("Action = %s, want %s (reason %s)", got.Action, tt.wantAction, got.Reason)
+			}
+			if tt.wantAction == ActionNone {
+				if got.At != nil {
+					t.Errorf("At = %s, want unset", got.At)
+				}
+				return
+			}
+			if got.At == nil || !got.At.Equal(tt.wantAt) {
+				t.Errorf("At = %v, want %s", got.At, tt.wantAt)
+			}
+			if got.Scheduled != tt.wantScheduled {
+				t.Errorf("Scheduled = %v, want %v", got.Scheduled, tt.wantScheduled)
+			}
+		})
+	}
+}
+
+func TestPolicyPlanReadsManifest(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, manifest.FileName), []byte("autosleep:\n  idle_timeout: 2h\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running", ProjectPath: project, LastActive: now})
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "running", LastActive: now})
+
+	plan := Policy{DefaultTimeout: 15 * time.Minute}.Plan(s, now)
+	if len(plan) != 2 || plan[0].Env != "api" || plan[1].Env != "web" {
+		t.Fatalf("plan = %+v, want api then web", plan)
+	}
+	if plan[1].TimeoutSource != "manifest" || plan[1].IdleTimeout != "2h0m0s" {
+		t.Errorf("web timeout = %s (%s), want 2h0m0s (manifest)", plan[1].IdleTimeout, plan[1].TimeoutSource)
+	}
+	if plan[0].TimeoutSource != "default" {
+		t.Errorf("api timeout source = %s, want default", plan[0].TimeoutSource)
+	}
+}
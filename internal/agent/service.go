@@ -0,0 +1,414 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// ServiceLabel is the launchd label of the autosleep service
+	ServiceLabel = "dev.silibox.autosleep"
+	// ServiceUnit is the systemd user unit of the autosleep service
+	ServiceUnit = "sili-autosleep.service"
+	// ServiceLogFile is the agent log file in ~/.sili
+	ServiceLogFile = "autosleep.log"
+)
+
+// ServiceSpec describes how the service manager runs the agent
+type ServiceSpec struct {
+	Executable string   // Absolute path to the sili binary
+	Args       []string // Arguments after the executable
+	LogPath    string   // File receiving stdout and stderr
+	Path       string   // PATH for the agent so it can find limactl
+}
+
+// ServiceStatus describes the installed service
+type ServiceStatus struct {
+	Manager   string `json:"manager"` // launchd or systemd
+	Installed bool   `json:"installed"`
+	Running   bool   `json:"running"`
+	PID       int    `json:"pid,omitempty"`
+	UnitPath  string `json:"unit_path"`
+	LogPath   string `json:"log_path"`
+}
+
+// DefaultServiceSpec runs `sili agent autosleep` from the current binary
+// The agent reads ~/.sili/config.yaml on start, so no settings are baked into the unit
+func DefaultServiceSpec() (ServiceSpec, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return ServiceSpec{}, fmt.Errorf("failed to locate sili binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	logPath, err := ServiceLogPath()
+	if err != nil {
+		return ServiceSpec{}, err
+	}
+
+	return ServiceSpec{
+		Executable: exe,
+		Args:       []string{"agent", "autosleep"},
+		LogPath:    logPath,
+		Path:       os.Getenv("PATH"),
+	}, nil
+}
+
+// ServiceLogPath returns the log file of the agent service (~/.sili/autosleep.log)
+func ServiceLogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sili", ServiceLogFile), nil
+}
+
+// serviceManager installs and controls the agent with the platform's service manager
+type serviceManager interface {
+	name() string
+	unitPath() (string, error)
+	render(spec ServiceSpec) (string, error)
+	load(path string) error
+	unload(path string) error
+	status() (running bool, pid int, err error)
+}
+
+func newServiceManager() (serviceManager, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return launchd{}, nil
+	case "linux":
+		return systemd{}, nil
+	default:
+		return nil, fmt.Errorf("installing the agent as a service is not supported on %s", runtime.GOOS)
+	}
+}
+
+// InstallService writes the service definition and (re)starts the agent
+// Installing again replaces the definition, e.g. after moving the sili binary
+func InstallService(spec ServiceSpec) (string, error) {
+	m, err := newServiceManager()
+	if err != nil {
+		return "", err
+	}
+	path, err := m.unitPath()
+	if err != nil {
+		return "", err
+	}
+
+	content, err := m.render(spec)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.MkdirAll(filepath.Dir(spec.LogPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// Unload any previous definition so the new one takes effect
+	if _, err := os.Stat(path); err == nil {
+		_ = m.unload(path)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := m.load(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// UninstallService stops the agent and removes the service definition
+func UninstallService() (string, error) {
+	m, err := newServiceManager()
+	if err != nil {
+		return "", err
+	}
+	path, err := m.unitPath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", fmt.Errorf("agent service is not installed")
+	}
+
+	if err := m.unload(path); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// GetServiceStatus reports whether the agent service is installed and running
+func GetServiceStatus() (ServiceStatus, error) {
+	m, err := newServiceManager()
+	if err != nil {
+		return ServiceStatus{}, err
+	}
+	path, err := m.unitPath()
+	if err != nil {
+		return ServiceStatus{}, err
+	}
+	logPath, err := ServiceLogPath()
+	if err != nil {
+		return ServiceStatus{}, err
+	}
+
+	st := ServiceStatus{Manager: m.name(), UnitPath: path, LogPath: logPath}
+	if _, err := os.Stat(path); err != nil {
+		return st, nil
+	}
+	st.Installed = true
+	st.Running, st.PID, err = m.status()
+	return st, err
+}
+
+func runServiceCommand(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("%s %s failed: %w (output: %s)", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// launchd runs the agent as a per-user LaunchAgent
+type launchd struct{}
+
+var launchdTemplate = template.Must(template.New("plist").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Spec.Executable}}</string>
+{{- range .Spec.Args}}
+		<string>{{.}}</string>
+{{- end}}
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>PATH</key>
+		<string>{{.Spec.Path}}</string>
+	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+	<key>ProcessType</key>
+	<string>Background</string>
+	<key>StandardOutPath</key>
+	<string>{{.Spec.LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{.Spec.LogPath}}</string>
+</dict>
+</plist>
+`))
+
+func (launchd) name() string { return "launchd" }
+
+func (launchd) unitPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", ServiceLabel+".plist"), nil
+}
+
+// KeepAlive with SuccessfulExit=false restarts the agent only when it crashes,
+// so stopping it with a signal (clean exit) doesn't bring it back
+func (launchd) render(spec ServiceSpec) (string, error) {
+	escaped := ServiceSpec{
+		Executable: xmlEscape(spec.Executable),
+		LogPath:    xmlEscape(spec.LogPath),
+		Path:       xmlEscape(spec.Path),
+	}
+	for _, arg := range spec.Args {
+		escaped.Args = append(escaped.Args, xmlEscape(arg))
+	}
+
+	var buf bytes.Buffer
+	if err := launchdTemplate.Execute(&buf, struct {
+		Label string
+		Spec  ServiceSpec
+	}{ServiceLabel, escaped}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func launchdDomain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+func (launchd) load(path string) error {
+	_, err := runServiceCommand("launchctl", "bootstrap", launchdDomain(), path)
+	return err
+}
+
+func (launchd) unload(path string) error {
+	_, err := runServiceCommand("launchctl", "bootout", launchdDomain()+"/"+ServiceLabel)
+	return err
+}
+
+func (launchd) status() (bool, int, error) {
+	out, err := runServiceCommand("launchctl", "print", launchdDomain()+"/"+ServiceLabel)
+	if err != nil {
+		// Not loaded
+		return false, 0, nil
+	}
+	running, pid := parseLaunchctlPrint(out)
+	return running, pid, nil
+}
+
+// parseLaunchctlPrint extracts the state and pid from `launchctl print` output
+func parseLaunchctlPrint(out string) (bool, int) {
+	running, pid := false, 0
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " = ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "state":
+			running = value == "running"
+		case "pid":
+			pid, _ = strconv.Atoi(value)
+		}
+	}
+	return running, pid
+}
+
+// systemd runs the agent as a user unit
+type systemd struct{}
+
+var systemdTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Silibox autosleep agent
+After=default.target
+
+[Service]
+Type=simple
+ExecStart={{.ExecStart}}
+Environment="PATH={{.Spec.Path}}"
+Restart=on-failure
+RestartSec=10
+StandardOutput=append:{{.Spec.LogPath}}
+StandardError=append:{{.Spec.LogPath}}
+
+[Install]
+WantedBy=default.target
+`))
+
+func (systemd) name() string { return "systemd" }
+
+func (systemd) unitPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "systemd", "user", ServiceUnit), nil
+}
+
+func (systemd) render(spec ServiceSpec) (string, error) {
+	args := append([]string{spec.Executable}, spec.Args...)
+	for i, arg := range args {
+		args[i] = systemdQuote(arg)
+	}
+
+	var buf bytes.Buffer
+	if err := systemdTemplate.Execute(&buf, struct {
+		ExecStart string
+		Spec      ServiceSpec
+	}{strings.Join(args, " "), ServiceSpec{
+		Path:    strings.ReplaceAll(spec.Path, "%", "%%"),
+		LogPath: strings.ReplaceAll(spec.LogPath, "%", "%%"),
+	}}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (systemd) load(path string) error {
+	if _, err := runServiceCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	_, err := runServiceCommand("systemctl", "--user", "enable", "--now", ServiceUnit)
+	return err
+}
+
+func (systemd) unload(path string) error {
+	_, err := runServiceCommand("systemctl", "--user", "disable", "--now", ServiceUnit)
+	return err
+}
+
+func (systemd) status() (bool, int, error) {
+	out, err := runServiceCommand("systemctl", "--user", "show", ServiceUnit, "--property=ActiveState,MainPID")
+	if err != nil {
+		return false, 0, err
+	}
+	running, pid := parseSystemctlShow(out)
+	return running, pid, nil
+}
+
+// parseSystemctlShow extracts the state and pid from `systemctl show` output
+func parseSystemctlShow(out string) (bool, int) {
+	running, pid := false, 0
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ActiveState":
+			running = value == "active"
+		case "MainPID":
+			pid, _ = strconv.Atoi(value)
+		}
+	}
+	return running, pid
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// systemdQuote quotes an ExecStart argument when it contains spaces or quotes
+// and escapes % so systemd doesn't treat it as a specifier
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderLaunchd(t *testing.T) {
+	spec := ServiceSpec{
+		Executable: "/Users/me/My Tools/sili",
+		Args:       []string{"agent", "autosleep"},
+		LogPath:    "/Users/me/.sili/autosleep.log",
+		Path:       "/opt/homebrew/bin:/usr/bin",
+	}
+
+	out, err := launchd{}.render(spec)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"<string>" + ServiceLabel + "</string>",
+		"<string>/Users/me/My Tools/sili</string>",
+		"<string>autosleep</string>",
+		"<key>SuccessfulExit</key>",
+		"<string>/opt/homebrew/bin:/usr/bin</string>",
+		"<key>StandardErrorPath</key>\n\t<string>/Users/me/.sili/autosleep.log</string>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plist missing %q:\n%s", want, out)
+		}
+	}
+
+	spec.Executable = "/tmp/a&b/sili"
+	out, _ = launchd{}.render(spec)
+	if !strings.Contains(out, "/tmp/a&amp;b/sili") {
+		t.Errorf("expected executable to be XML-escaped:\n%s", out)
+	}
+}
+
+func TestRenderSystemd(t *testing.T) {
+	spec := ServiceSpec{
+		Executable: "/home/me/my bin/sili",
+		Args:       []string{"agent", "autosleep"},
+		LogPath:    "/home/me/.sili/autosleep.log",
+		Path:       "/usr/local/bin:/usr/bin",
+	}
+
+	out, err := systemd{}.render(spec)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`ExecStart="/home/me/my bin/sili" agent autosleep`,
+		"Restart=on-failure",
+		`Environment="PATH=/usr/local/bin:/usr/bin"`,
+		"StandardOutput=append:/home/me/.sili/autosleep.log",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("unit missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestParseServiceStatus(t *testing.T) {
+	launchctl := `gui/501/dev.silibox.autosleep = {
+	active count = 1
+	path = /Users/me/Library/LaunchAgents/dev.silibox.autosleep.plist
+	state = running
+	pid = 4242
+}`
+	if running, pid := parseLaunchctlPrint(launchctl); !running || pid != 4242 {
+		t.Errorf("parseLaunchctlPrint() = %v, %d", running, pid)
+	}
+	if running, _ := parseLaunchctlPrint("state = not running\n"); running {
+		t.Error("expected not running")
+	}
+
+	if running, pid := parseSystemctlShow("ActiveState=active\nMainPID=99\n"); !running || pid != 99 {
+		t.Errorf("parseSystemctlShow() = %v, %d", running, pid)
+	}
+	if running, pid := parseSystemctlShow("ActiveState=failed\nMainPID=0\n"); running || pid != 0 {
+		t.Errorf("parseSystemctlShow() = %v, %d", running, pid)
+	}
+}
@@ -0,0 +1,269 @@
+// Package ca manages the local development CA that signs certificates for .localhost hostnames
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File names under the CA directory
+const (
+	CertFile = "ca.pem"
+	KeyFile  = "ca-key.pem"
+)
+
+// Validity of the CA and of the certificates it issues
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 30 * 24 * time.Hour
+	renewBefore  = 24 * time.Hour
+)
+
+// ErrNotInitialized is returned when the CA hasn't been created with `sili ca init`
+var ErrNotInitialized = errors.New("the silibox CA isn't set up; run 'sili ca init'")
+
+// CA is the development certificate authority
+type CA struct {
+	Cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+// Dir returns the CA directory (~/.sili/ca)
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sili", "ca"), nil
+}
+
+// CertPath returns the path of the CA certificate, whether or not it exists
+func CertPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CertFile), nil
+}
+
+// Load reads the CA from ~/.sili/ca, returning ErrNotInitialized if it doesn't exist
+func Load() (*CA, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return load(dir)
+}
+
+func load(dir string) (*CA, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, CertFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotInitialized
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, KeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("no certificate in %s", filepath.Join(dir, CertFile))
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no key in %s", filepath.Join(dir, KeyFile))
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+	return &CA{Cert: cert, key: key, dir: dir}, nil
+}
+
+// Ensure loads the CA, creating it first if it doesn't exist
+// created reports whether it was just created and still needs to be trusted
+func Ensure() (authority *CA, created bool, err error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, false, err
+	}
+	authority, err = load(dir)
+	if !errors.Is(err, ErrNotInitialized) {
+		return authority, false, err
+	}
+	authority, err = create(dir, time.Now())
+	return authority, err == nil, err
+}
+
+// create generates a CA that may only sign names under .localhost
+func create(dir string, now time.Time) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	name := "silibox development CA"
+	if owner := ownerName(); owner != "" {
+		name += " " + owner
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"silibox development CA"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		// A leaked key can't be used to impersonate real sites
+		PermittedDNSDomains: []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	// The key is written first so a certificate never exists without one
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, CertFile), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	return &CA{Cert: cert, key: key, dir: dir}, nil
+}
+
+// ownerName tells CAs of different users and machines apart in trust stores
+func ownerName() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return u.Username
+	}
+	return u.Username + "@" + host
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// CertPath returns the path of the CA certificate
+func (c *CA) CertPath() string {
+	return filepath.Join(c.dir, CertFile)
+}
+
+// Fingerprint is the SHA-256 fingerprint of the CA certificate
+func (c *CA) Fingerprint() string {
+	sum := sha256.Sum256(c.Cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Issue signs a certificate for hostname, valid for 30 days
+func (c *CA) Issue(hostname string, now time.Time) (*tls.Certificate, error) {
+	if hostname != "localhost" && !strings.HasSuffix(hostname, ".localhost") {
+		return nil, fmt.Errorf("%s isn't under .localhost", hostname)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.Cert, &key.PublicKey, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate for %s: %w", hostname, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate for %s: %w", hostname, err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der, c.Cert.Raw}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// Issuer hands out certificates per hostname, issuing them on first use and again
+// shortly before they expire
+type Issuer struct {
+	ca    *CA
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+	now   func() time.Time
+}
+
+// NewIssuer returns an issuer signing with c
+func NewIssuer(c *CA) *Issuer {
+	return &Issuer{ca: c, certs: make(map[string]*tls.Certificate), now: time.Now}
+}
+
+// Certificate returns a valid certificate for hostname
+func (i *Issuer) Certificate(hostname string) (*tls.Certificate, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	if cert, ok := i.certs[hostname]; ok && now.Add(renewBefore).Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	cert, err := i.ca.Issue(hostname, now)
+	if err != nil {
+		return nil, err
+	}
+	i.certs[hostname] = cert
+	return cert, nil
+}
@@ -0,0 +1,104 @@
+package ca
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+	if _, err := load(dir); !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("load() of a missing CA = %v, want ErrNotInitialized", err)
+	}
+
+	created, err := create(dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, KeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Fingerprint() != created.Fingerprint() {
+		t.Error("loaded CA differs from the created one")
+	}
+	if !loaded.Cert.IsCA || len(loaded.Cert.PermittedDNSDomains) != 1 {
+		t.Errorf("CA certificate = IsCA %v, permitted %v", loaded.Cert.IsCA, loaded.Cert.PermittedDNSDomains)
+	}
+}
+
+func TestIssue(t *testing.T) {
+	now := time.Now()
+	authority, err := create(t.TempDir(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Cert)
+
+	cert, err := authority.Issue("api.web.localhost", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "api.web.localhost", Roots: roots}); err != nil {
+		t.Errorf("issued certificate doesn't verify: %v", err)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "web.localhost", Roots: roots}); err == nil {
+		t.Error("certificate verified for another hostname")
+	}
+
+	if _, err := authority.Issue("example.com", now); err == nil {
+		t.Error("expected an error for a hostname outside .localhost")
+	}
+}
+
+func TestIssuerRenews(t *testing.T) {
+	authority, err := create(t.TempDir(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	issuer := NewIssuer(authority)
+	issuer.now = func() time.Time { return now }
+
+	first, err := issuer.Certificate("web.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := issuer.Certificate("web.localhost")
+	if again != first {
+		t.Error("certificate was issued again while still valid")
+	}
+
+	now = now.Add(leafValidity - time.Hour)
+	renewed, _ := issuer.Certificate("web.localhost")
+	if renewed == first {
+		t.Error("certificate wasn't renewed before expiring")
+	}
+}
+
+func TestTrustInstructions(t *testing.T) {
+	for goos, want := range map[string]string{
+		"darwin":  "security add-trusted-cert",
+		"linux":   "update-ca-certificates",
+		"windows": "trusted root certificates",
+	} {
+		got := trustInstructions(goos, "/home/u/.sili/ca/ca.pem")
+		if !strings.Contains(got, want) || !strings.Contains(got, "NODE_EXTRA_CA_CERTS=/home/u/.sili/ca/ca.pem") {
+			t.Errorf("%s instructions missing %q:\n%s", goos, want, got)
+		}
+	}
+}
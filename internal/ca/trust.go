@@ -0,0 +1,30 @@
+package ca
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// TrustInstructions explains how to make the host trust the CA certificate at certPath
+func TrustInstructions(certPath string) string {
+	return trustInstructions(runtime.GOOS, certPath)
+}
+
+func trustInstructions(goos, certPath string) string {
+	var b strings.Builder
+	b.WriteString("To trust the CA on this machine:\n")
+	switch goos {
+	case "darwin":
+		fmt.Fprintf(&b, "  sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %s\n", certPath)
+		b.WriteString("Firefox: set security.enterprise_roots.enabled to true in about:config\n")
+	case "linux":
+		fmt.Fprintf(&b, "  sudo cp %s /usr/local/share/ca-certificates/silibox-ca.crt && sudo update-ca-certificates\n", certPath)
+		fmt.Fprintf(&b, "  (Fedora: sudo cp %s /etc/pki/ca-trust/source/anchors/ && sudo update-ca-trust)\n", certPath)
+		fmt.Fprintf(&b, "Chrome and Firefox: import %s under Settings > Certificates > Authorities\n", certPath)
+	default:
+		fmt.Fprintf(&b, "  Add %s to the system's trusted root certificates\n", certPath)
+	}
+	fmt.Fprintf(&b, "Node.js doesn't use the system store: export NODE_EXTRA_CA_CERTS=%s\n", certPath)
+	return b.String()
+}
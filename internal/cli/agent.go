@@ -2,11 +2,19 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coheez/silibox/internal/agent"
 	"github.com/coheez/silibox/internal/config"
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/proxy"
+	"github.com/coheez/silibox/internal/state"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +23,13 @@ var (
 	agentVMTimeout        time.Duration
 	agentPollInterval     time.Duration
 	agentNoStopVM         bool
+	agentNoWake           bool
+	agentNoForward        bool
+	agentDryRun           bool
+	agentStopGrace        time.Duration
+	agentMetricsListen    string
+	agentProxyListen      string
+	agentProxyTLSListen   string
 )
 
 var agentCmd = &cobra.Command{
@@ -34,6 +49,13 @@ configured timeout. Persistent containers (marked with --persistent) are never s
 If all containers are stopped and the VM has been idle, it can also be stopped to save
 resources.
 
+While an environment sleeps the agent keeps listening on its host ports. The first
+connection starts the VM and container and is then passed through, so a sleeping
+database or API wakes up when something connects to it.
+
+Ports a running container starts listening on are forwarded to the host automatically,
+like an editor's port forwarding; 'sili ports' lists them as "auto".
+
 Configuration:
   Settings can be configured in ~/.sili/config.yaml:
     autosleep:
@@ -41,6 +63,31 @@ Configuration:
       vm_timeout: 30m
       poll_interval: 30s
       no_stop_vm: false
+      wake_on_connect: true  # start sleeping envs when their ports are hit
+      auto_forward: true     # forward ports containers start listening on
+      metrics_listen: 127.0.0.1:9464  # serve Prometheus metrics, empty disables
+      activity:              # live signals that keep an env awake past its timeout
+        exec_sessions: true
+        cpu_threshold: 5     # percent, 0 disables
+        connections: true
+        processes: true
+      rules:                 # per-env overrides by name, first match wins
+        - match: "db-*"
+          idle_timeout: 2h
+      schedules:             # recurring windows in local time
+        - name: workday
+          days: [mon, tue, wed, thu, fri]
+          from: "09:00"
+          to: "18:00"
+          action: keep_awake
+        - name: night
+          from: "22:00"
+          to: "06:00"
+          action: stop
+
+  Per-env timeouts set with 'sili create --idle-timeout', 'sili env set' or the
+  project's silibox.yaml take precedence over rules. Run 'sili agent plan' to see
+  what will happen next.
 
   Command-line flags override config file settings.
 
@@ -55,46 +102,511 @@ Examples:
   sili agent autosleep --poll-interval 10s
 
   # Don't stop the VM, only containers
-  sili agent autosleep --no-stop-vm`,
+  sili agent autosleep --no-stop-vm
+
+  # Log what would be stopped and why, without stopping anything
+  sili agent autosleep --dry-run`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agentCfg, err := loadAutosleepConfig(cmd)
+		if err != nil {
+			return err
+		}
+		// Reloads re-read the file and re-apply the same flags
+		agentCfg.Reload = func() (agent.AutosleepConfig, error) {
+			return loadAutosleepConfig(cmd)
+		}
+
+		// Run the agent (blocks until interrupted)
+		ctx := context.Background()
+		return agent.RunAutosleep(ctx, agentCfg)
+	},
+}
+
+// loadAutosleepConfig reads the config file and applies the flags that were set
+func loadAutosleepConfig(cmd *cobra.Command) (agent.AutosleepConfig, error) {
+	// Load config file (defaults if not found)
+	cfg, err := config.Load()
+	if err != nil {
+		return agent.AutosleepConfig{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Override with flags if they were explicitly set
+	if cmd.Flags().Changed("container-timeout") {
+		cfg.Autosleep.ContainerTimeout = agentContainerTimeout
+	}
+	if cmd.Flags().Changed("vm-timeout") {
+		cfg.Autosleep.VMTimeout = agentVMTimeout
+	}
+	if cmd.Flags().Changed("poll-interval") {
+		cfg.Autosleep.PollInterval = agentPollInterval
+	}
+	if cmd.Flags().Changed("no-stop-vm") {
+		cfg.Autosleep.NoStopVM = agentNoStopVM
+	}
+	if cmd.Flags().Changed("stop-grace") {
+		cfg.Autosleep.StopGrace = agentStopGrace
+	}
+	if cmd.Flags().Changed("metrics-listen") {
+		cfg.Autosleep.MetricsListen = agentMetricsListen
+	}
+	if cmd.Flags().Changed("proxy-listen") {
+		cfg.Autosleep.ProxyListen = agentProxyListen
+	}
+	if cmd.Flags().Changed("proxy-tls-listen") {
+		cfg.Autosleep.ProxyTLSListen = agentProxyTLSListen
+	}
+	if cmd.Flags().Changed("no-wake") {
+		cfg.Autosleep.WakeOnConnect = !agentNoWake
+	}
+	if cmd.Flags().Changed("no-forward") {
+		cfg.Autosleep.AutoForward = !agentNoForward
+	}
+
+	agentCfg, err := autosleepConfigFrom(cfg)
+	if err != nil {
+		return agent.AutosleepConfig{}, err
+	}
+	agentCfg.DryRun = agentDryRun
+	return agentCfg, nil
+}
+
+var agentPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show what autosleep will do next to each environment",
+	Long: `Show the next planned autosleep action for each environment, with the idle
+timeout that applies and where it comes from (env, manifest, rule or default).
+
+The plan is computed from ~/.sili/config.yaml, each project's silibox.yaml and the
+recorded activity; live activity signals are only checked when a stop is due.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Load config file (defaults if not found)
 		cfg, err := config.Load()
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		agentCfg, err := autosleepConfigFrom(cfg)
+		if err != nil {
+			return err
+		}
+		st, err := state.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
 
-		// Override with flags if they were explicitly set
-		if cmd.Flags().Changed("container-timeout") {
-			cfg.Autosleep.ContainerTimeout = agentContainerTimeout
+		plan := agentCfg.EffectivePolicy().Plan(st, time.Now())
+		if structuredOutput() {
+			return writeOutput(plan)
+		}
+		if len(plan) == 0 {
+			fmt.Println("No environments found")
+			return nil
 		}
-		if cmd.Flags().Changed("vm-timeout") {
-			cfg.Autosleep.VMTimeout = agentVMTimeout
+
+		fmt.Printf("%-20s %-10s %-28s %s\n", "ENV", "STATUS", "TIMEOUT", "NEXT ACTION")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, pa := range plan {
+			timeout := fmt.Sprintf("%s (%s)", pa.IdleTimeout, pa.TimeoutSource)
+			fmt.Printf("%-20s %-10s %-28s %s\n", pa.Env, pa.Status, timeout, pa.Describe())
 		}
-		if cmd.Flags().Changed("poll-interval") {
-			cfg.Autosleep.PollInterval = agentPollInterval
+		return nil
+	},
+}
+
+var agentExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain what autosleep would do to each environment right now",
+	Long: `Evaluate every environment and the VM once, the same way the agent's next check
+would, and show each one's idle time, threshold and verdict. Nothing is stopped.
+
+Live activity signals are probed for environments that are past their timeout, so
+this needs the VM running to tell whether they're really idle. Host and VM memory
+use is measured too; under memory pressure the agent also stops the least recently
+active environment before its timeout, and the VM once nothing runs.
+
+Verdicts:
+  stop     would be stopped now
+  in_use   past its timeout but kept awake by live activity
+  wait     not due yet
+  skip     never stopped (already stopped, persistent or auto-stop disabled)`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
 		}
-		if cmd.Flags().Changed("no-stop-vm") {
-			cfg.Autosleep.NoStopVM = agentNoStopVM
+		agentCfg, err := autosleepConfigFrom(cfg)
+		if err != nil {
+			return err
 		}
 
-		// Build agent config
-		agentCfg := agent.AutosleepConfig{
-			ContainerIdleTimeout: cfg.Autosleep.ContainerTimeout,
-			VMIdleTimeout:        cfg.Autosleep.VMTimeout,
-			PollInterval:         cfg.Autosleep.PollInterval,
-			StopVM:               !cfg.Autosleep.NoStopVM,
+		ex, err := agent.Explain(agentCfg)
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return writeOutput(ex)
 		}
 
-		// Run the agent (blocks until interrupted)
-		ctx := context.Background()
-		return agent.RunAutosleep(ctx, agentCfg)
+		fmt.Printf("%-20s %-10s %-10s %-26s %-8s %s\n", "NAME", "STATUS", "IDLE", "THRESHOLD", "VERDICT", "DETAIL")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, v := range ex.Envs {
+			threshold := fmt.Sprintf("%s (%s)", v.IdleTimeout, v.TimeoutSource)
+			fmt.Printf("%-20s %-10s %-10s %-26s %-8s %s\n", v.Env, v.Status, dashIfEmpty(v.Idle), threshold, v.Verdict, v.Detail)
+		}
+		fmt.Printf("%-20s %-10s %-10s %-26s %-8s %s\n", "(vm)", ex.VM.Status, dashIfEmpty(ex.VM.Idle), ex.VM.IdleTimeout, ex.VM.Verdict, ex.VM.Detail)
+		if ex.Memory != nil {
+			icon := "🧠"
+			if ex.Memory.Under {
+				icon = "⚠️ "
+			}
+			fmt.Printf("\n%s %s\n", icon, ex.Memory.Reason)
+		}
+		return nil
 	},
 }
 
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// autosleepConfigFrom builds the agent config from the config file
+func autosleepConfigFrom(cfg config.Config) (agent.AutosleepConfig, error) {
+	agentCfg := agent.AutosleepConfig{
+		ContainerIdleTimeout: cfg.Autosleep.ContainerTimeout,
+		VMIdleTimeout:        cfg.Autosleep.VMTimeout,
+		PollInterval:         cfg.Autosleep.PollInterval,
+		StopVM:               !cfg.Autosleep.NoStopVM,
+		WakeOnConnect:        cfg.Autosleep.WakeOnConnect,
+		AutoForward:          cfg.Autosleep.AutoForward,
+		StopGrace:            cfg.Autosleep.StopGrace,
+		MetricsListen:        cfg.Autosleep.MetricsListen,
+		ProxyListen:          cfg.Autosleep.ProxyListen,
+		ProxyTLSListen:       cfg.Autosleep.ProxyTLSListen,
+		Activity: agent.ActivitySignals{
+			ExecSessions: cfg.Autosleep.Activity.ExecSessions,
+			CPUThreshold: cfg.Autosleep.Activity.CPUThreshold,
+			Connections:  cfg.Autosleep.Activity.Connections,
+			Processes:    cfg.Autosleep.Activity.Processes,
+		},
+		Memory: agent.MemoryPressure{
+			HostThreshold: cfg.Autosleep.Memory.HostThreshold,
+			VMThreshold:   cfg.Autosleep.Memory.VMThreshold,
+		},
+		Notify: agent.NotifyConfig{
+			Desktop:  cfg.Autosleep.Notify.Desktop,
+			Webhook:  cfg.Autosleep.Notify.Webhook,
+			Command:  cfg.Autosleep.Notify.Command,
+			LeadTime: cfg.Autosleep.Notify.LeadTime,
+		},
+	}
+	if w := agentCfg.Notify.Webhook; w != "" {
+		if u, err := url.Parse(w); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return agent.AutosleepConfig{}, fmt.Errorf("invalid autosleep config: notify.webhook %q must be an http(s) URL", w)
+		}
+	}
+	if agentCfg.Notify.LeadTime < 0 {
+		return agent.AutosleepConfig{}, fmt.Errorf("invalid autosleep config: notify.lead_time must not be negative")
+	}
+	for _, t := range []float64{agentCfg.Memory.HostThreshold, agentCfg.Memory.VMThreshold} {
+		if t < 0 || t > 100 {
+			return agent.AutosleepConfig{}, fmt.Errorf("invalid autosleep config: memory thresholds must be between 0 and 100")
+		}
+	}
+
+	for _, r := range cfg.Autosleep.Rules {
+		rule, err := agent.ParseRule(r.Match, r.IdleTimeout, r.Persistent)
+		if err != nil {
+			return agent.AutosleepConfig{}, fmt.Errorf("invalid autosleep config: %w", err)
+		}
+		agentCfg.Policy.Rules = append(agentCfg.Policy.Rules, rule)
+	}
+	for _, sc := range cfg.Autosleep.Schedules {
+		sched, err := agent.ParseSchedule(sc.Name, sc.Match, sc.Days, sc.From, sc.To, sc.Action)
+		if err != nil {
+			return agent.AutosleepConfig{}, fmt.Errorf("invalid autosleep config: %w", err)
+		}
+		agentCfg.Policy.Schedules = append(agentCfg.Policy.Schedules, sched)
+	}
+	return agentCfg, nil
+}
+
+var agentInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the autosleep agent as a background service",
+	Long: `Install the autosleep agent as a user service so it keeps running after the
+terminal closes and starts again at login.
+
+On macOS a LaunchAgent is written to ~/Library/LaunchAgents; on Linux a systemd user
+unit is written to ~/.config/systemd/user. The service runs 'sili agent autosleep' with
+the settings from ~/.sili/config.yaml, is restarted if it crashes and logs to
+~/.sili/autosleep.log.
+
+Run install again after changing the config or moving the sili binary to restart the
+agent with the new settings.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Fail early on a broken config instead of a crash-looping service
+		if _, err := config.Load(); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		spec, err := agent.DefaultServiceSpec()
+		if err != nil {
+			return err
+		}
+		path, err := agent.InstallService(spec)
+		if err != nil {
+			return fmt.Errorf("failed to install agent service: %w", err)
+		}
+
+		fmt.Printf("✅ Autosleep agent installed and started\n")
+		fmt.Printf("   Service: %s\n", path)
+		fmt.Printf("   Logs:    %s\n", spec.LogPath)
+		return nil
+	},
+}
+
+var agentUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove the autosleep agent service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := agent.UninstallService()
+		if err != nil {
+			return fmt.Errorf("failed to uninstall agent service: %w", err)
+		}
+		fmt.Printf("✅ Autosleep agent stopped and removed (%s)\n", path)
+		return nil
+	},
+}
+
+var agentStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the autosleep agent's state, next check and planned actions",
+	Long: `Show whether the autosleep agent is installed and running and, when it is,
+ask it over its control socket (~/.sili/agent.sock) for its live state: paused or
+not, when it last checked and checks next, how long each environment has been idle
+and what it plans to do with it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := AgentStatusOutput{}
+		svc, err := agent.GetServiceStatus()
+		if err == nil {
+			out.Service = &svc
+		}
+		live, liveErr := agentClientCall((*agent.Client).Status)
+		if liveErr == nil {
+			out.Agent = live
+		} else if !errors.Is(liveErr, agent.ErrNotRunning) {
+			return liveErr
+		}
+
+		if structuredOutput() {
+			return writeOutput(out)
+		}
+
+		switch {
+		case live != nil:
+			fmt.Printf("Autosleep agent: %s (pid %d, up %s)\n", agentState(live), live.PID, time.Since(live.StartedAt).Round(time.Second))
+		case svc.Running:
+			fmt.Printf("Autosleep agent: running (pid %d, %s) but its control socket isn't answering\n", svc.PID, svc.Manager)
+		case svc.Installed:
+			fmt.Printf("Autosleep agent: installed but not running (%s)\n", svc.Manager)
+		default:
+			fmt.Println("Autosleep agent: not running (start it with 'sili agent install' or 'sili agent autosleep')")
+		}
+		if svc.Installed {
+			fmt.Printf("   Service: %s\n", svc.UnitPath)
+			fmt.Printf("   Logs:    %s\n", svc.LogPath)
+		}
+		if live == nil {
+			return nil
+		}
+
+		if live.LastCheck != nil {
+			fmt.Printf("   Last check: %s ago", time.Since(*live.LastCheck).Round(time.Second))
+			if live.LastError != "" {
+				fmt.Printf(" (failed: %s)", live.LastError)
+			}
+			fmt.Println()
+		}
+		if !live.Paused {
+			fmt.Printf("   Next check: in %s\n", time.Until(live.NextCheck).Round(time.Second))
+		}
+		fmt.Printf("   Timeouts:   container %s, VM %s (poll every %s)\n", live.ContainerIdle, live.VMIdle, live.PollInterval)
+		if live.Metrics != "" {
+			fmt.Printf("   Metrics:    http://%s/metrics\n", live.Metrics)
+		}
+		if live.Proxy != "" {
+			fmt.Printf("   Proxy:      %s\n", live.Proxy)
+		}
+		if live.ProxyTLS != "" {
+			fmt.Printf("   HTTPS:      %s\n", live.ProxyTLS)
+		}
+		if live.VMStatus != "" {
+			vmLine := live.VMStatus
+			if live.VMIdleFor != "" {
+				vmLine += ", idle " + live.VMIdleFor
+			}
+			fmt.Printf("   VM:         %s\n", vmLine)
+		}
+		if len(live.Envs) == 0 {
+			return nil
+		}
+
+		fmt.Println()
+		fmt.Printf("%-20s %-10s %-10s %-28s %s\n", "ENV", "STATUS", "IDLE", "TIMEOUT", "NEXT ACTION")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, env := range live.Envs {
+			idle := dashIfEmpty(env.Idle)
+			timeout := fmt.Sprintf("%s (%s)", env.IdleTimeout, env.TimeoutSource)
+			next := env.Describe()
+			if ports := live.WakePorts[env.Env]; len(ports) > 0 {
+				next += fmt.Sprintf("; wakes on %s", joinInts(ports))
+			}
+			fmt.Printf("%-20s %-10s %-10s %-28s %s\n", env.Env, env.Status, idle, timeout, next)
+		}
+		return nil
+	},
+}
+
+var agentPauseFor time.Duration
+
+var agentPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Stop the running agent from stopping anything until resumed",
+	Long: `Pause the running autosleep agent without killing it, e.g. during a demo.
+Environments and the VM are left alone until 'sili agent resume', or until --for
+has passed. Wake-on-connect keeps working while paused.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := agentClientCall(func(c *agent.Client) (*agent.Status, error) {
+			return c.Pause(agentPauseFor)
+		})
+		if err != nil {
+			return err
+		}
+		if st.PausedUntil != nil {
+			fmt.Printf("⏸️  Autosleep paused until %s\n", st.PausedUntil.Format("15:04:05"))
+		} else {
+			fmt.Println("⏸️  Autosleep paused until 'sili agent resume'")
+		}
+		return nil
+	},
+}
+
+var agentResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := agentClientCall((*agent.Client).Resume)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("▶️  Autosleep resumed (next check in %s)\n", time.Until(st.NextCheck).Round(time.Second))
+		return nil
+	},
+}
+
+var agentReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Make the running agent re-read ~/.sili/config.yaml",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := agentClientCall((*agent.Client).Reload)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🔄 Config reloaded (container %s, VM %s, poll every %s)\n", st.ContainerIdle, st.VMIdle, st.PollInterval)
+		return nil
+	},
+}
+
+var agentTriggerCmd = &cobra.Command{
+	Use:   "trigger",
+	Short: "Make the running agent check for idle environments now",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := agentClientCall((*agent.Client).Trigger); err != nil {
+			return err
+		}
+		fmt.Println("✅ Check complete (see 'sili agent status' or 'sili events' for what was stopped)")
+		return nil
+	},
+}
+
+// agentClientCall runs fn against the agent's control socket
+func agentClientCall(fn func(*agent.Client) (*agent.Status, error)) (*agent.Status, error) {
+	client, err := agent.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	st, err := fn(client)
+	if errors.Is(err, agent.ErrNotRunning) {
+		return nil, fmt.Errorf("%w (start it with 'sili agent install' or 'sili agent autosleep')", err)
+	}
+	return st, err
+}
+
+// releaseHostPorts asks a running agent to free the ports it listens on for env, or
+// for every env if env is empty; without an agent there is nothing to free
+func releaseHostPorts(env string) {
+	client, err := agent.NewClient()
+	if err != nil {
+		return
+	}
+	if _, err := client.Release(env); err != nil && !errors.Is(err, agent.ErrNotRunning) {
+		which := "'" + env + "'"
+		if env == "" {
+			which = "every environment"
+		}
+		fmt.Fprintf(os.Stderr, "Warning: the autosleep agent may still hold the ports of %s: %v\n", which, err)
+	}
+}
+
+// agentState describes whether the agent is paused or in dry-run mode
+func agentState(st *agent.Status) string {
+	state := "running"
+	switch {
+	case !st.Paused:
+	case st.PausedUntil != nil:
+		state = "paused until " + st.PausedUntil.Format("15:04:05")
+	default:
+		state = "paused"
+	}
+	if st.DryRun {
+		state += ", dry run"
+	}
+	return state
+}
+
+func joinInts(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
+
 func init() {
+	container.ReleaseHostPorts = releaseHostPorts
+
 	// Add agent command to root
 	rootCmd.AddCommand(agentCmd)
 	agentCmd.AddCommand(agentAutosleepCmd)
+	agentCmd.AddCommand(agentInstallCmd)
+	agentCmd.AddCommand(agentUninstallCmd)
+	agentCmd.AddCommand(agentStatusCmd)
+	agentCmd.AddCommand(agentPlanCmd)
+	agentCmd.AddCommand(agentExplainCmd)
+	agentCmd.AddCommand(agentPauseCmd)
+	agentCmd.AddCommand(agentResumeCmd)
+	agentCmd.AddCommand(agentReloadCmd)
+	agentCmd.AddCommand(agentTriggerCmd)
 
 	// Flags for autosleep
 	agentAutosleepCmd.Flags().DurationVar(&agentContainerTimeout, "container-timeout", 15*time.Minute,
@@ -105,4 +617,19 @@ func init() {
 		"How often to check for idle resources")
 	agentAutosleepCmd.Flags().BoolVar(&agentNoStopVM, "no-stop-vm", false,
 		"Don't stop the VM, only stop idle containers")
+	agentAutosleepCmd.Flags().BoolVar(&agentDryRun, "dry-run", false,
+		"Log what would be stopped and why without stopping anything; wake on connect and auto-forwarding stay off")
+	agentAutosleepCmd.Flags().DurationVar(&agentStopGrace, "stop-grace", 0,
+		"How long podman waits after SIGTERM before killing an idle container (default: stop_grace from silibox.yaml, else 10s)")
+	agentAutosleepCmd.Flags().StringVar(&agentMetricsListen, "metrics-listen", "",
+		"Serve Prometheus metrics on this address, e.g. 127.0.0.1:9464 (default: off)")
+	agentAutosleepCmd.Flags().StringVar(&agentProxyListen, "proxy-listen", proxy.DefaultListen,
+		"Serve <host>.<env>.localhost routes on this address; empty disables")
+	agentAutosleepCmd.Flags().StringVar(&agentProxyTLSListen, "proxy-tls-listen", proxy.DefaultTLSListen,
+		"Serve the routes over HTTPS on this address once 'sili ca init' has run; empty disables")
+	agentPauseCmd.Flags().DurationVar(&agentPauseFor, "for", 0, "Resume automatically after this long (default: until 'sili agent resume')")
+	agentAutosleepCmd.Flags().BoolVar(&agentNoWake, "no-wake", false,
+		"Don't wake sleeping environments when a connection arrives on their ports")
+	agentAutosleepCmd.Flags().BoolVar(&agentNoForward, "no-forward", false,
+		"Don't forward ports containers start listening on to the host")
 }
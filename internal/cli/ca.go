@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/spf13/cobra"
+)
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the local development CA for HTTPS on .localhost",
+	Long: `silibox can serve its .localhost routes over HTTPS with certificates from a local
+development CA kept in ~/.sili/ca. The CA can only sign names under .localhost.
+
+Once the CA exists, the proxy issues a certificate for each routed hostname on first
+use. 'sili create --trust-ca' (or ca.trust_containers in ~/.sili/config.yaml) adds the
+CA to a new container's trust store, so code in it accepts the CA's certificates.
+Environments still reach each other over plain HTTP; the CA signs no names for them.`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the development CA and explain how to trust it",
+	Long: `Create the development CA in ~/.sili/ca if it doesn't exist yet, and print how to
+add it to this machine's trust store. Restart the autosleep agent afterwards so it
+serves HTTPS.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		authority, created, err := ca.Ensure()
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("✅ Created the silibox CA in %s\n", authority.CertPath())
+		} else {
+			fmt.Printf("The silibox CA already exists in %s\n", authority.CertPath())
+		}
+		fmt.Printf("   SHA-256 fingerprint: %s\n\n", authority.Fingerprint())
+		fmt.Print(ca.TrustInstructions(authority.CertPath()))
+		if created {
+			fmt.Println("\nRestart the autosleep agent to serve .localhost routes over HTTPS.")
+		}
+		return nil
+	},
+}
+
+var caShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the development CA and how to trust it",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		authority, err := ca.Load()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Certificate: %s\n", authority.CertPath())
+		fmt.Printf("Subject:     %s\n", authority.Cert.Subject.CommonName)
+		fmt.Printf("Expires:     %s\n", authority.Cert.NotAfter.Format("2006-01-02"))
+		fmt.Printf("SHA-256:     %s\n\n", authority.Fingerprint())
+		fmt.Print(ca.TrustInstructions(authority.CertPath()))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(caCmd)
+	caCmd.AddCommand(caInitCmd)
+	caCmd.AddCommand(caShowCmd)
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/config"
 	"github.com/coheez/silibox/internal/container"
 	"github.com/coheez/silibox/internal/state"
 	"github.com/coheez/silibox/internal/vm"
@@ -23,14 +25,20 @@ var (
 	createDetectVolumes bool
 	createNoMigrate     bool
 	createPersistent    bool
+	createIdleTimeout   time.Duration
+	createTrustCA       bool
+	createNetwork       string
 	enterName           string
 	enterShell          string
 	runName             string
 	runNoPolling        bool
 	runForcePolling     bool
+	startName           string
 	stopName            string
+	stopTime            int
 	rmName              string
 	rmForce             bool
+	lsStack             string
 )
 
 var createCmd = &cobra.Command{
@@ -38,12 +46,7 @@ var createCmd = &cobra.Command{
 	Short: "Create a named Podman container in the VM",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Pass through common environment variables
-		env := make(map[string]string)
-		for _, key := range []string{"PATH", "HOME", "USER", "SHELL", "TERM", "LANG", "LC_ALL"} {
-			if value := os.Getenv(key); value != "" {
-				env[key] = value
-			}
-		}
+		env := hostEnvironment()
 
 		cfg := container.CreateConfig{
 			Name:                    createName,
@@ -56,6 +59,24 @@ var createCmd = &cobra.Command{
 			DetectAndPrepareVolumes: createDetectVolumes,
 			NoMigrate:               createNoMigrate,
 			Persistent:              createPersistent,
+			IdleTimeout:             createIdleTimeout,
+			TrustCA:                 createTrustCA,
+			Network:                 createNetwork,
+		}
+		if !cmd.Flags().Changed("trust-ca") {
+			if c, err := config.Load(); err == nil {
+				cfg.TrustCA = c.CA.TrustContainers
+			}
+		}
+		if cfg.TrustCA {
+			authority, created, err := ca.Ensure()
+			if err != nil {
+				return err
+			}
+			if created {
+				fmt.Printf("✅ Created the silibox CA in %s\n", authority.CertPath())
+				fmt.Print(ca.TrustInstructions(authority.CertPath()))
+			}
 		}
 		return container.Create(cfg)
 	},
@@ -121,13 +142,23 @@ var lsCmd = &cobra.Command{
 		}
 
 		envs := st.ListEnvs()
-		if len(envs) == 0 {
+		if lsStack != "" {
+			envs = st.StackEnvs(lsStack)
+			if len(envs) == 0 && !structuredOutput() {
+				fmt.Printf("No environments in stack '%s'. Bring it up with 'sili up'.\n", lsStack)
+				return nil
+			}
+		}
+		if len(envs) == 0 && !structuredOutput() {
 			fmt.Println("No environments found. Create one with 'sili create'.")
 			return nil
 		}
 
-		// Sort environments by name for consistent output
+		// Sort environments by stack, then name, so stacks are listed together
 		sort.Slice(envs, func(i, j int) bool {
+			if envs[i].Stack != envs[j].Stack {
+				return envs[i].Stack < envs[j].Stack
+			}
 			return envs[i].Name < envs[j].Name
 		})
 
@@ -142,9 +173,40 @@ var lsCmd = &cobra.Command{
 			runningMap[name] = true
 		}
 
+		if structuredOutput() {
+			items := make([]EnvListItem, 0, len(envs))
+			for _, env := range envs {
+				status := "stopped"
+				if runningMap[env.Name] {
+					status = "running"
+				}
+				idleTimeout := ""
+				if env.IdleTimeout > 0 {
+					idleTimeout = env.IdleTimeout.String()
+				}
+				items = append(items, EnvListItem{
+					Name:        env.Name,
+					Status:      status,
+					StateStatus: env.Status,
+					Image:       env.Image,
+					ProjectPath: env.ProjectPath,
+					Persistent:  env.Persistent,
+					IdleTimeout: idleTimeout,
+					Network:     env.Network,
+					Peers:       container.Peers(st, env.Name),
+					Stack:       env.Stack,
+					Service:     env.Service,
+					DependsOn:   env.DependsOn,
+					Volumes:     env.Volumes,
+					LastActive:  env.LastActive,
+				})
+			}
+			return writeOutput(items)
+		}
+
 		// Print header
-		fmt.Printf("%-20s %-15s %-30s %-12s %s\n", "NAME", "STATUS", "IMAGE", "PERSISTENT", "LAST ACTIVE")
-		fmt.Println(strings.Repeat("-", 100))
+		fmt.Printf("%-20s %-15s %-30s %-12s %-20s %-24s %s\n", "NAME", "STATUS", "IMAGE", "PERSISTENT", "STACK", "NETWORK", "LAST ACTIVE")
+		fmt.Println(strings.Repeat("-", 146))
 
 		// Print each environment
 		for _, env := range envs {
@@ -169,13 +231,29 @@ var lsCmd = &cobra.Command{
 				persistent = "yes"
 			}
 
-			fmt.Printf("%-20s %-15s %-30s %-12s %s\n", env.Name, status, image, persistent, lastActive)
+			fmt.Printf("%-20s %-15s %-30s %-12s %-20s %-24s %s\n", env.Name, status, image, persistent, stackSummary(env), networkSummary(st, env), lastActive)
 		}
 
 		return nil
 	},
 }
 
+var startCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a stopped container",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Ensure VM is running (auto-wake)
+		if err := vm.EnsureVMRunning(); err != nil {
+			return err
+		}
+		if err := container.Start(startName); err != nil {
+			return err
+		}
+		fmt.Printf("Started environment: %s\n", startName)
+		return nil
+	},
+}
+
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop a running container",
@@ -184,7 +262,8 @@ var stopCmd = &cobra.Command{
 		if err := vm.EnsureVMRunning(); err != nil {
 			return err
 		}
-		if err := container.Stop(stopName); err != nil {
+		opts := container.StopOptions{Grace: time.Duration(stopTime) * time.Second}
+		if err := container.StopWithOptions(stopName, opts); err != nil {
 			return err
 		}
 		fmt.Printf("Stopped environment: %s\n", stopName)
@@ -208,6 +287,17 @@ var rmCmd = &cobra.Command{
 	},
 }
 
+// hostEnvironment returns the common host environment variables passed through to containers
+func hostEnvironment() map[string]string {
+	env := make(map[string]string)
+	for _, key := range []string{"PATH", "HOME", "USER", "SHELL", "TERM", "LANG", "LC_ALL"} {
+		if value := os.Getenv(key); value != "" {
+			env[key] = value
+		}
+	}
+	return env
+}
+
 // formatRelativeTime formats a time as a relative string (e.g., "2 hours ago")
 func formatRelativeTime(t time.Time) string {
 	if t.IsZero() {
@@ -250,22 +340,28 @@ func formatRelativeTime(t time.Time) string {
 }
 
 func init() {
-	rootCmd.AddCommand(createCmd, enterCmd, runCmd, lsCmd, stopCmd, rmCmd)
+	rootCmd.AddCommand(createCmd, enterCmd, runCmd, lsCmd, startCmd, stopCmd, rmCmd)
 	createCmd.Flags().StringVarP(&createName, "name", "n", "silibox-dev", "Container name")
 	createCmd.Flags().StringVarP(&createImage, "image", "i", "ubuntu:22.04", "Container image")
 	createCmd.Flags().StringVarP(&createDir, "dir", "d", ".", "Project directory to bind mount")
 	createCmd.Flags().StringVarP(&createWork, "workdir", "w", "/workspace", "Working directory inside container")
 	createCmd.Flags().StringVarP(&createUser, "user", "u", "", "User to run as (default: current user)")
-	createCmd.Flags().StringArrayVarP(&createPorts, "ports", "p", []string{}, "Port mappings (format: 3000 or 8080:80 or 8080:80/tcp)")
+	createCmd.Flags().StringArrayVarP(&createPorts, "ports", "p", []string{}, "Port mappings (format: 3000, 8080:80, :80, 8000-8010:8000-8010, 127.0.0.1:8080:80, with optional /tcp or /udp)")
 	createCmd.Flags().BoolVar(&createDetectVolumes, "detect-volumes", false, "[Experimental] Enable automatic project stack detection and volume creation")
 	createCmd.Flags().BoolVar(&createNoMigrate, "no-migrate", false, "Skip migration prompts for existing directories when using --detect-volumes")
 	createCmd.Flags().BoolVar(&createPersistent, "persistent", false, "Mark environment as persistent (never auto-stopped by autosleep agent)")
+	createCmd.Flags().DurationVar(&createIdleTimeout, "idle-timeout", 0, "Autosleep idle timeout for this environment (default: from silibox.yaml, config rules or the agent)")
+	createCmd.Flags().StringVar(&createNetwork, "network", container.DefaultNetwork, "Network group; environments in the same group reach each other by name")
+	createCmd.Flags().BoolVar(&createTrustCA, "trust-ca", false, "Add the silibox CA to the container's trust store, creating the CA if needed (default: ca.trust_containers from the config)")
 	enterCmd.Flags().StringVarP(&enterName, "name", "n", "silibox-dev", "Container name to enter")
 	enterCmd.Flags().StringVarP(&enterShell, "shell", "s", "bash", "Shell to use (bash, sh, zsh, etc.)")
 	runCmd.Flags().StringVarP(&runName, "name", "n", "silibox-dev", "Container name to run command in")
 	runCmd.Flags().BoolVar(&runNoPolling, "no-polling", false, "Disable automatic polling mode for file watchers")
 	runCmd.Flags().BoolVar(&runForcePolling, "force-polling", false, "Force polling mode even if not detected as watcher")
+	startCmd.Flags().StringVarP(&startName, "name", "n", "silibox-dev", "Container name to start")
 	stopCmd.Flags().StringVarP(&stopName, "name", "n", "silibox-dev", "Container name to stop")
+	stopCmd.Flags().IntVarP(&stopTime, "time", "t", 0, "Seconds to wait before killing the container (default: stop_grace from silibox.yaml, else 10)")
 	rmCmd.Flags().StringVarP(&rmName, "name", "n", "silibox-dev", "Container name to remove")
 	rmCmd.Flags().BoolVarP(&rmForce, "force", "f", false, "Force remove even if running")
+	lsCmd.Flags().StringVar(&lsStack, "stack", "", "Only list the environments of a stack")
 }
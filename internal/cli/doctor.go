@@ -2,309 +2,210 @@ package cli
 
 import (
 	"fmt"
-	"os/exec"
-	"runtime"
+	"os"
 	"strings"
 
-	"github.com/coheez/silibox/internal/container"
-	"github.com/coheez/silibox/internal/lima"
-	"github.com/coheez/silibox/internal/state"
+	"github.com/coheez/silibox/internal/doctor"
 	"github.com/spf13/cobra"
 )
 
 var (
-	doctorFix bool
+	doctorFix    bool
+	doctorDryRun bool
+	doctorChecks []string
+	doctorSkip   []string
+	doctorList   bool
+	doctorBundle string
 )
 
 var doctorCmd = &cobra.Command{
 	Use:   "doctor",
 	Short: "Diagnose environment and dependencies",
-	Long:  "Diagnose environment and dependencies. Use --fix to automatically repair common issues.",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		issues := []string{}
-		warnings := []string{}
+	Long: `Diagnose environment and dependencies. Use --fix to automatically repair common issues.
 
-		fmt.Println("🔍 Silibox Doctor - Environment Diagnostics")
-		fmt.Println(strings.Repeat("=", 50))
+Each diagnostic is a named check that can be run on its own with --check or skipped with
+--skip. Use --list to see all checks. With --output json the full report is emitted for
+automation.
 
-		// Check system info
-		fmt.Printf("System: %s %s\n", runtime.GOOS, runtime.GOARCH)
+Examples:
+  # Run all checks
+  sili doctor
 
-		// Check Lima installation
-		if err := checkLimaInstallation(); err != nil {
-			issues = append(issues, err.Error())
-		} else {
-			fmt.Println("✓ Lima is installed")
-		}
+  # Only check podman
+  sili doctor --check podman
 
-		// Check VM status
-		if err := checkVMStatus(); err != nil {
-			issues = append(issues, err.Error())
-		}
+  # Preview what --fix would change
+  sili doctor --fix --dry-run
 
-		// Check Podman inside VM (if VM is running)
-		if err := checkPodmanInVM(); err != nil {
-			warnings = append(warnings, err.Error())
-		}
+  # Machine-readable report
+  sili doctor -o json
 
-		// Check state consistency
-		if err := checkStateConsistency(); err != nil {
-			warnings = append(warnings, err.Error())
-		}
-
-		// Check for orphaned or desynced containers
-		if desyncWarnings := checkContainerDesync(); len(desyncWarnings) > 0 {
-			warnings = append(warnings, desyncWarnings...)
+  # Collect a redacted support bundle to attach to a bug report
+  sili doctor --bundle sili-support.tar.gz`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if doctorList {
+			return listDoctorChecks()
 		}
-
-		// Check Apple Silicon specific requirements
-		if runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" {
-			fmt.Println("• Apple Silicon detected - Virtualization.framework (vz) required")
+		if doctorDryRun && !doctorFix {
+			return fmt.Errorf("--dry-run requires --fix")
 		}
-
-		// Print results
-		fmt.Println("\n" + strings.Repeat("=", 50))
-		if len(issues) > 0 {
-			fmt.Println("❌ Issues found:")
-			for _, issue := range issues {
-				fmt.Printf("  • %s\n", issue)
+		if doctorBundle != "" {
+			if doctorFix {
+				return fmt.Errorf("--bundle can't be combined with --fix")
 			}
+			return writeDoctorBundle(doctorBundle)
 		}
 
-		if len(warnings) > 0 {
-			fmt.Println("⚠️  Warnings:")
-			for _, warning := range warnings {
-				fmt.Printf("  • %s\n", warning)
-			}
+		report, err := doctor.Run(doctor.Options{
+			Only:   doctorChecks,
+			Skip:   doctorSkip,
+			Fix:    doctorFix,
+			DryRun: doctorDryRun,
+		})
+		if err != nil {
+			return err
 		}
 
-		if len(issues) == 0 && len(warnings) == 0 {
-			fmt.Println("✅ All checks passed! Silibox is ready to use.")
-		} else if len(issues) == 0 {
-			fmt.Println("✅ No critical issues found. Silibox should work.")
+		if structuredOutput() {
+			if err := writeOutput(report); err != nil {
+				return err
+			}
+		} else {
+			printDoctorReport(report)
 		}
 
-		if len(issues) > 0 {
-			return fmt.Errorf("doctor found %d issue(s) that need to be fixed", len(issues))
+		if len(report.Issues) > 0 {
+			return fmt.Errorf("doctor found %d issue(s) that need to be fixed", len(report.Issues))
 		}
-
 		return nil
 	},
 }
 
-func init() {
-	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Automatically fix common issues")
-}
+func printDoctorReport(report *doctor.Report) {
+	fmt.Println("🔍 Silibox Doctor - Environment Diagnostics")
+	fmt.Println(strings.Repeat("=", 50))
 
-func checkLimaInstallation() error {
-	if _, err := exec.LookPath("limactl"); err != nil {
-		return fmt.Errorf("lima not found - install with: brew install lima")
+	for _, c := range report.Checks {
+		switch c.Status {
+		case doctor.StatusPass:
+			if c.Severity == doctor.SeverityInfo {
+				fmt.Printf("• %s\n", c.Message)
+			} else {
+				fmt.Printf("✓ %s\n", c.Message)
+			}
+		case doctor.StatusSkip:
+			fmt.Printf("- %s: skipped (%s)\n", c.ID, c.Message)
+		case doctor.StatusFixed:
+			fmt.Printf("✅ %s: fixed\n", c.ID)
+		case doctor.StatusFail:
+			icon := "⚠️ "
+			if c.Severity == doctor.SeverityError {
+				icon = "❌"
+			}
+			fmt.Printf("%s %s: %s\n", icon, c.ID, c.Message)
+		}
+		for _, detail := range c.Details {
+			fmt.Printf("    • %s\n", detail)
+		}
+		if c.Fix != nil {
+			verb := "🔧"
+			if c.Fix.DryRun {
+				verb = "🔧 would"
+			}
+			for _, action := range c.Fix.Actions {
+				fmt.Printf("   %s %s\n", verb, action)
+			}
+			if c.Fix.Error != "" {
+				fmt.Printf("   ⚠️  fix failed: %s\n", c.Fix.Error)
+			}
+		}
 	}
-	return nil
-}
 
-func checkVMStatus() error {
-	// Check if VM exists and is running
-	inst, found, err := lima.GetInstance()
-	if err != nil {
-		return fmt.Errorf("failed to check VM status: %v", err)
+	// Print results
+	fmt.Println("\n" + strings.Repeat("=", 50))
+	if len(report.Issues) > 0 {
+		fmt.Println("❌ Issues found:")
+		for _, issue := range report.Issues {
+			fmt.Printf("  • %s\n", issue)
+		}
 	}
 
-	if !found {
-		fmt.Println("• VM not found - Run 'sili vm up' to create it")
-		return nil
+	if len(report.Warnings) > 0 {
+		fmt.Println("⚠️  Warnings:")
+		for _, warning := range report.Warnings {
+			fmt.Printf("  • %s\n", warning)
+		}
 	}
 
-	switch inst.Status {
-	case "Running":
-		fmt.Println("✓ VM is running")
-		return nil
-	case "Stopped":
-		fmt.Println("• VM exists but is stopped - Run 'sili vm up' to start it")
-		return nil
-	case "Error", "Broken":
-		return fmt.Errorf("VM is in %s state - try 'sili vm stop' then 'sili vm up' to recreate", inst.Status)
-	default:
-		fmt.Printf("• VM status: %s\n", inst.Status)
-		return nil
+	if len(report.Issues) == 0 && len(report.Warnings) == 0 {
+		fmt.Println("✅ All checks passed! Silibox is ready to use.")
+	} else if len(report.Issues) == 0 {
+		fmt.Println("✅ No critical issues found. Silibox should work.")
 	}
 }
 
-func checkPodmanInVM() error {
-	// Only check if VM is running
-	inst, found, err := lima.GetInstance()
-	if err != nil || !found || inst.Status != "Running" {
-		return nil // Skip check if VM not running
+func writeDoctorBundle(path string) error {
+	fmt.Fprintln(os.Stderr, "📦 Collecting support bundle...")
+	info, err := doctor.WriteBundle(path, doctor.BundleOptions{
+		Version: fmt.Sprintf("%s (commit %s, built %s)", version, commit, buildDate),
+		Checks:  doctor.Options{Only: doctorChecks, Skip: doctorSkip},
+	})
+	if err != nil {
+		return err
 	}
 
-	// Check if podman is installed inside VM
-	cmd := exec.Command("limactl", "shell", "silibox", "--", "which", "podman")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("podman not found in VM - run 'sili vm up' to install it")
+	if structuredOutput() {
+		return writeOutput(info)
 	}
-
-	// Check if podman works
-	cmd = exec.Command("limactl", "shell", "silibox", "--", "podman", "--version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("podman in VM is not working - run 'sili vm up' to reinstall")
+	fmt.Printf("✅ Wrote %s (%d files)\n", path, len(info.Files))
+	for _, e := range info.Errors {
+		fmt.Printf("   ⚠️  not collected: %s\n", e)
 	}
-
-	fmt.Println("✓ Podman is installed and working in VM")
+	fmt.Println("   Secrets, your home directory and user name are redacted; review the archive before sharing it.")
 	return nil
 }
 
-func checkStateConsistency() error {
-	// Load state and check for consistency
-	s, err := state.Load()
-	if err != nil {
-		return fmt.Errorf("state file corrupted - run 'sili state show' to check")
-	}
+// DoctorCheckItem is one entry of `sili doctor --list`
+type DoctorCheckItem struct {
+	ID          string          `json:"id"`
+	Description string          `json:"description"`
+	Severity    doctor.Severity `json:"severity"`
+	Fixable     bool            `json:"fixable"`
+}
 
-	vm := s.GetVM()
-	if vm == nil {
-		return nil // No VM in state, that's ok
+func listDoctorChecks() error {
+	items := make([]DoctorCheckItem, 0)
+	for _, c := range doctor.Checks() {
+		_, fixable := c.(doctor.Fixer)
+		items = append(items, DoctorCheckItem{
+			ID:          c.ID(),
+			Description: c.Description(),
+			Severity:    c.Severity(),
+			Fixable:     fixable,
+		})
 	}
 
-	// Check if state matches actual VM status
-	inst, found, err := lima.GetInstance()
-	if err != nil {
-		return fmt.Errorf("cannot verify state consistency - lima error: %v", err)
-	}
-
-	if !found {
-		if vm.Status == "running" {
-			if doctorFix {
-				fmt.Println("🔧 Fixing stale state (VM not found, updating state to stopped)...")
-				if err := state.WithLockedState(func(s *state.State) error {
-					s.UpdateVMStatus("stopped")
-					return nil
-				}); err != nil {
-					return fmt.Errorf("failed to fix state: %w", err)
-				}
-				fmt.Println("   ✅ State updated")
-				return nil
-			}
-			return fmt.Errorf("state says VM is running but lima shows no VM - state may be stale (run with --fix to repair)")
-		}
-		return nil
+	if structuredOutput() {
+		return writeOutput(items)
 	}
 
-	// Normalize status for comparison
-	stateStatus := strings.ToLower(vm.Status)
-	actualStatus := strings.ToLower(inst.Status)
-
-	if stateStatus != actualStatus {
-		if doctorFix {
-			fmt.Printf("🔧 Fixing state inconsistency (updating state from '%s' to '%s')...\n", vm.Status, inst.Status)
-			if err := state.WithLockedState(func(s *state.State) error {
-				s.UpdateVMStatus(strings.ToLower(inst.Status))
-				return nil
-			}); err != nil {
-				return fmt.Errorf("failed to fix state: %w", err)
-			}
-			fmt.Println("   ✅ State updated")
-			return nil
+	fmt.Printf("%-16s %-10s %-8s %s\n", "CHECK", "SEVERITY", "FIXABLE", "DESCRIPTION")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, item := range items {
+		fixable := ""
+		if item.Fixable {
+			fixable = "yes"
 		}
-		return fmt.Errorf("state inconsistency - state says '%s' but lima shows '%s' (run with --fix to repair)", vm.Status, inst.Status)
+		fmt.Printf("%-16s %-10s %-8s %s\n", item.ID, item.Severity, fixable, item.Description)
 	}
-
-	fmt.Println("✓ State is consistent with lima")
 	return nil
 }
 
-func checkContainerDesync() []string {
-	warnings := []string{}
-
-	// Only check if VM is running
-	inst, found, err := lima.GetInstance()
-	if err != nil || !found || inst.Status != "Running" {
-		return warnings // Skip check if VM not running
-	}
-
-	// Load state
-	s, err := state.Load()
-	if err != nil {
-		return warnings // Can't check without state
-	}
-
-	// Get all environments from state
-	envs := s.ListEnvs()
-	if len(envs) == 0 {
-		fmt.Println("✓ No environments to check")
-		return warnings
-	}
-
-	// Get all running containers from Podman
-	runningContainers, err := container.List()
-	if err != nil {
-		warnings = append(warnings, fmt.Sprintf("failed to list containers: %v", err))
-		return warnings
-	}
-
-	// Create map for quick lookup
-	runningMap := make(map[string]bool)
-	for _, name := range runningContainers {
-		runningMap[name] = true
-	}
-
-	// Check each environment for desync
-	desyncCount := 0
-	fixedCount := 0
-	for _, env := range envs {
-		isRunning := runningMap[env.Name]
-
-		// Case 1: State says running but container doesn't exist or is stopped
-		if env.Status == "running" && !isRunning {
-			if doctorFix {
-				fmt.Printf("🔧 Fixing desync: '%s' marked as running but not found (updating to stopped)...\n", env.Name)
-				if err := state.WithLockedState(func(s *state.State) error {
-					env := s.GetEnv(env.Name)
-					if env != nil {
-						env.Status = "stopped"
-						s.UpsertEnv(env)
-					}
-					return nil
-				}); err != nil {
-					warnings = append(warnings, fmt.Sprintf("Failed to fix '%s': %v", env.Name, err))
-				} else {
-					fmt.Println("   ✅ Fixed")
-					fixedCount++
-				}
-			} else {
-				warnings = append(warnings, fmt.Sprintf("Environment '%s' marked as running in state but not found in Podman (run with --fix to repair)", env.Name))
-			}
-			desyncCount++
-		}
-
-		// Case 2: Container is running but state says stopped (less critical)
-		if env.Status == "stopped" && isRunning {
-			if doctorFix {
-				fmt.Printf("🔧 Fixing desync: '%s' is running but marked as stopped (updating to running)...\n", env.Name)
-				if err := state.WithLockedState(func(s *state.State) error {
-					env := s.GetEnv(env.Name)
-					if env != nil {
-						env.Status = "running"
-						s.UpsertEnv(env)
-					}
-					return nil
-				}); err != nil {
-					warnings = append(warnings, fmt.Sprintf("Failed to fix '%s': %v", env.Name, err))
-				} else {
-					fmt.Println("   ✅ Fixed")
-					fixedCount++
-				}
-			} else {
-				warnings = append(warnings, fmt.Sprintf("Environment '%s' is running but marked as stopped in state (run with --fix to repair)", env.Name))
-			}
-			desyncCount++
-		}
-	}
-
-	if desyncCount == 0 {
-		fmt.Printf("✓ All %d environment(s) in sync with Podman\n", len(envs))
-	} else if doctorFix && fixedCount > 0 {
-		fmt.Printf("✅ Fixed %d/%d desync issue(s)\n", fixedCount, desyncCount)
-	}
-
-	return warnings
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Automatically fix common issues")
+	doctorCmd.Flags().BoolVar(&doctorDryRun, "dry-run", false, "With --fix, show what would be fixed without changing anything")
+	doctorCmd.Flags().StringArrayVar(&doctorChecks, "check", []string{}, "Run only this check (repeatable)")
+	doctorCmd.Flags().StringArrayVar(&doctorSkip, "skip", []string{}, "Skip this check (repeatable)")
+	doctorCmd.Flags().BoolVar(&doctorList, "list", false, "List available checks")
+	doctorCmd.Flags().StringVar(&doctorBundle, "bundle", "", "Write a redacted support bundle (.tar.gz) to this path")
 }
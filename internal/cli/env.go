@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envSetName        string
+	envSetIdleTimeout string
+	envSetPersistent  bool
+	envTouchName      string
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environment settings",
+}
+
+var envSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Change the autosleep settings of an environment",
+	Long: `Change the autosleep settings of an existing environment.
+
+--idle-timeout takes a duration (e.g. 45m, 2h) or "default" to clear the override and
+fall back to silibox.yaml, config rules or the agent's timeout.
+
+Examples:
+  sili env set --name web --idle-timeout 2h
+  sili env set --name web --idle-timeout default
+  sili env set --name db --persistent`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setTimeout := cmd.Flags().Changed("idle-timeout")
+		setPersistent := cmd.Flags().Changed("persistent")
+		if !setTimeout && !setPersistent {
+			return fmt.Errorf("nothing to set: use --idle-timeout or --persistent")
+		}
+
+		var timeout time.Duration
+		if setTimeout && envSetIdleTimeout != "default" {
+			d, err := time.ParseDuration(envSetIdleTimeout)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid --idle-timeout %q: must be a positive duration or \"default\"", envSetIdleTimeout)
+			}
+			timeout = d
+		}
+
+		err := state.WithLockedState(func(s *state.State) error {
+			env := s.GetEnv(envSetName)
+			if env == nil {
+				return fmt.Errorf("environment %s not found", envSetName)
+			}
+			if setTimeout {
+				env.IdleTimeout = timeout
+			}
+			if setPersistent {
+				env.Persistent = envSetPersistent
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if setTimeout {
+			if timeout > 0 {
+				fmt.Printf("✅ Idle timeout for '%s' set to %s\n", envSetName, timeout)
+			} else {
+				fmt.Printf("✅ Idle timeout for '%s' reset to the default\n", envSetName)
+			}
+		}
+		if setPersistent {
+			fmt.Printf("✅ '%s' persistent: %v\n", envSetName, envSetPersistent)
+		}
+		return nil
+	},
+}
+
+var envTouchCmd = &cobra.Command{
+	Use:   "touch",
+	Short: "Reset an environment's idle timer",
+	Long: `Mark an environment as just used so autosleep leaves it running for another full
+idle timeout, e.g. after a "will sleep in 2 minutes" notification.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := container.Touch(envTouchName, ""); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Idle timer for '%s' reset\n", envTouchName)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envSetCmd, envTouchCmd)
+	envSetCmd.Flags().StringVarP(&envSetName, "name", "n", "silibox-dev", "Environment name")
+	envSetCmd.Flags().StringVar(&envSetIdleTimeout, "idle-timeout", "", "Autosleep idle timeout (duration, or \"default\" to clear)")
+	envSetCmd.Flags().BoolVar(&envSetPersistent, "persistent", false, "Never auto-stop this environment")
+	envTouchCmd.Flags().StringVarP(&envTouchName, "name", "n", "silibox-dev", "Environment name")
+}
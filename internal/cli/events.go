@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/spf13/cobra"
+)
+
+var (
+	eventsFollow bool
+	eventsEnv    string
+	eventsSince  string
+	eventsTail   int
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Show the log of silibox operations",
+	Long: `Show the append-only log of what silibox did and why.
+
+Events are recorded for environment create/stop/remove, VM up/stop, autosleep decisions
+and doctor --fix repairs. The log lives in ~/.sili/events.log and is rotated by size.
+
+Examples:
+  # Show all events
+  sili events
+
+  # Why did my env stop?
+  sili events --env dev --since 2h
+
+  # Stream new events as they happen
+  sili events --follow`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := events.Filter{Env: eventsEnv}
+		if eventsSince != "" {
+			since, err := parseSince(eventsSince)
+			if err != nil {
+				return err
+			}
+			filter.Since = since
+		}
+
+		past, err := events.Read(filter)
+		if err != nil {
+			return fmt.Errorf("failed to read event log: %w", err)
+		}
+		if eventsTail > 0 && len(past) > eventsTail {
+			past = past[len(past)-eventsTail:]
+		}
+
+		if len(past) == 0 && !eventsFollow && !structuredOutput() {
+			fmt.Println("No events recorded.")
+			return nil
+		}
+		for _, e := range past {
+			printEvent(e)
+		}
+
+		if !eventsFollow {
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return events.Follow(ctx, filter, time.Second, printEvent)
+	},
+}
+
+// parseSince accepts a relative duration (e.g. "2h") or an absolute time
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q (use a duration like 2h or a date like 2006-01-02)", value)
+}
+
+func printEvent(e events.Event) {
+	// Structured output is one document per event so it works with --follow
+	if structuredOutput() {
+		if outputFormat == formatJSON {
+			data, err := json.Marshal(e)
+			if err == nil {
+				fmt.Println(string(data))
+			}
+			return
+		}
+		fmt.Println("---")
+		writeOutput(e)
+		return
+	}
+
+	env := e.Env
+	if env == "" {
+		env = "-"
+	}
+	msg := e.Message
+	if e.Error != "" {
+		msg = strings.TrimSpace(msg + " error: " + e.Error)
+	}
+	fmt.Printf("%s  %-10s %-18s %-20s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Source, e.Type, env, msg)
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().BoolVarP(&eventsFollow, "follow", "f", false, "Stream new events as they are recorded")
+	eventsCmd.Flags().StringVarP(&eventsEnv, "env", "e", "", "Filter by environment name")
+	eventsCmd.Flags().StringVar(&eventsSince, "since", "", "Only show events since a duration ago (e.g. 2h) or a date")
+	eventsCmd.Flags().IntVarP(&eventsTail, "tail", "n", 0, "Only show the last N events")
+}
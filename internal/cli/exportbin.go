@@ -149,7 +149,7 @@ func listShims() error {
 	}
 
 	shims := st.ListShims()
-	if len(shims) == 0 {
+	if len(shims) == 0 && !structuredOutput() {
 		fmt.Println("No shims registered.")
 		fmt.Println("Create shims with: sili export-bin --name <env> --bin <command>")
 		return nil
@@ -175,6 +175,14 @@ func listShims() error {
 		return entries[i].name < entries[j].name
 	})
 
+	if structuredOutput() {
+		items := make([]ShimListItem, 0, len(entries))
+		for _, entry := range entries {
+			items = append(items, ShimListItem{Name: entry.name, Env: entry.env, Target: entry.target})
+		}
+		return writeOutput(items)
+	}
+
 	// Print header
 	fmt.Printf("%-20s %-15s %s\n", "SHIM", "ENV", "TARGET")
 	fmt.Println(strings.Repeat("-", 60))
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/proxy"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exposeName   string
+	exposePort   int
+	exposeHost   string
+	exposeRemove bool
+)
+
+var exposeCmd = &cobra.Command{
+	Use:   "expose",
+	Short: "Serve a container port on <host>.<env>.localhost",
+	Long: `Route a hostname to a container port through the silibox proxy.
+
+--host api serves the port on http://api.<env>.localhost; without --host it is served
+on http://<env>.localhost. A container port that isn't mapped to the host yet is added
+as with 'sili ports add'. Exposing a host again replaces its port, and overrides the
+same host from the project's silibox.yaml.
+
+Examples:
+  sili expose --name web --port 3000 --host api
+  sili expose --name web --port 5173
+  sili expose --name web --host api --rm`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exposeRemove {
+			if _, err := container.Unexpose(exposeName, exposeHost); err != nil {
+				return fmt.Errorf("failed to remove route: %w", err)
+			}
+			route := proxy.Route{Env: exposeName, Host: exposeHost}
+			fmt.Printf("✅ Stopped serving %s\n", route.Hostname())
+			return nil
+		}
+		if !cmd.Flags().Changed("port") {
+			return fmt.Errorf("--port is required")
+		}
+
+		added, err := container.Expose(exposeName, state.Route{Host: exposeHost, Port: exposePort})
+		if err != nil {
+			return fmt.Errorf("failed to expose port %d: %w", exposePort, err)
+		}
+		for _, pm := range added {
+			fmt.Printf("✅ Mapped localhost:%d to '%s' port %d\n", pm.HostPort, exposeName, pm.ContainerPort)
+		}
+
+		route := proxy.Route{Env: exposeName, Host: exposeHost, Port: exposePort}
+		listeners := configuredProxy()
+		fmt.Printf("🌐 %s -> '%s' port %d\n", listeners.url(route), exposeName, exposePort)
+		if listeners.HTTP == "" && listeners.HTTPS == "" {
+			fmt.Println("   The proxy is disabled (autosleep.proxy_listen is empty); run 'sili proxy serve' to serve it.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exposeCmd)
+	exposeCmd.Flags().StringVarP(&exposeName, "name", "n", "silibox-dev", "Environment name")
+	exposeCmd.Flags().IntVarP(&exposePort, "port", "p", 0, "Container port to serve")
+	exposeCmd.Flags().StringVar(&exposeHost, "host", "", "Label before the env name, e.g. api for api.<env>.localhost")
+	exposeCmd.Flags().BoolVar(&exposeRemove, "rm", false, "Remove the route for --host")
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/coheez/silibox/internal/metrics"
+	"github.com/spf13/cobra"
+)
+
+var (
+	metricsListen      string
+	metricsOpenMetrics bool
+)
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Print silibox resource usage in the Prometheus text format",
+	Long: `Print per-env CPU, memory and network usage from podman stats, VM uptime and
+memory, idle times, autosleep stop counts and state lock wait times once, in the
+Prometheus text format.
+
+To scrape them, run 'sili metrics serve' or set autosleep.metrics_listen so the
+autosleep agent serves them. Autosleep stop counts and lock wait times cover the
+serving process only, so the agent is the place to serve from.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		families, err := metrics.Collect()
+		if err != nil {
+			return err
+		}
+		return metrics.Write(os.Stdout, families, metricsOpenMetrics)
+	},
+}
+
+var metricsServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve metrics on /metrics for Prometheus",
+	Long: `Serve metrics over HTTP on /metrics until interrupted.
+
+Scrapers that accept application/openmetrics-text get the OpenMetrics format.
+
+Examples:
+  sili metrics serve
+  sili metrics serve --listen 0.0.0.0:9464`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, stop, err := metrics.Start(metricsListen)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		fmt.Fprintf(os.Stderr, "📈 Serving metrics on http://%s/metrics\n", addr)
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		<-ctx.Done()
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+	metricsCmd.AddCommand(metricsServeCmd)
+	metricsCmd.Flags().BoolVar(&metricsOpenMetrics, "openmetrics", false, "Print in the OpenMetrics format")
+	metricsServeCmd.Flags().StringVar(&metricsListen, "listen", metrics.DefaultListen, "Address to serve metrics on")
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	networkConnectName  string
+	networkConnectGroup string
+)
+
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Manage the networks environments reach each other on",
+	Long: `Environments join a Podman network with DNS, where the others reach them by env
+name: an API env connects to postgres://db:5432 instead of a host port. Container
+ports are reachable directly, whether or not they are mapped to the host.
+
+All environments share the "default" group unless created with --network, e.g.
+'sili create --name db --network backend'. Environments in different groups can't
+reach each other.`,
+}
+
+var networkLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List network groups and their environments",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := state.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		groups := make(map[string][]string)
+		for _, env := range st.Envs {
+			groups[env.Network] = append(groups[env.Network], env.Name)
+		}
+		names := make([]string, 0, len(groups))
+		for name, envs := range groups {
+			sort.Strings(envs)
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		if structuredOutput() {
+			items := make([]NetworkListItem, 0, len(names))
+			for _, name := range names {
+				items = append(items, NetworkListItem{
+					Name:          name,
+					PodmanNetwork: container.NetworkName(name),
+					Envs:          groups[name],
+				})
+			}
+			return writeOutput(items)
+		}
+
+		if len(groups) == 0 {
+			fmt.Println("No environments found. Create one with 'sili create'.")
+			return nil
+		}
+		if len(names) > 0 {
+			fmt.Printf("%-20s %-24s %s\n", "NETWORK", "PODMAN NETWORK", "ENVIRONMENTS")
+			fmt.Println(strings.Repeat("-", 80))
+			for _, name := range names {
+				fmt.Printf("%-20s %-24s %s\n", name, container.NetworkName(name), strings.Join(groups[name], ", "))
+			}
+		}
+		if unattached := groups[""]; len(unattached) > 0 {
+			if len(names) > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Not on a silibox network: %s\n", strings.Join(unattached, ", "))
+			fmt.Println("Attach them with: sili network connect --name <env>")
+		}
+		return nil
+	},
+}
+
+var networkConnectCmd = &cobra.Command{
+	Use:   "connect",
+	Short: "Move an environment to a network group",
+	Long: `Attach an environment to a network group, leaving the group it was on. Use it for
+environments created before silibox managed networks, or to isolate one from the others.
+
+Podman can't attach every existing container to a network; if connecting fails,
+recreate the environment with 'sili rm' and 'sili create --network <group>'.
+
+Examples:
+  sili network connect --name api
+  sili network connect --name db --network backend`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		previous, err := container.Connect(networkConnectName, networkConnectGroup)
+		if err != nil {
+			return fmt.Errorf("failed to connect '%s': %w", networkConnectName, err)
+		}
+		if previous == networkConnectGroup {
+			fmt.Printf("'%s' is already on network '%s'\n", networkConnectName, networkConnectGroup)
+			return nil
+		}
+		fmt.Printf("✅ '%s' is on network '%s'", networkConnectName, networkConnectGroup)
+		if previous != "" {
+			fmt.Printf(" (left '%s')", previous)
+		}
+		fmt.Println()
+		fmt.Printf("   Other environments there reach it as %s\n", networkConnectName)
+		return nil
+	},
+}
+
+// networkSummary shows an env's network group and who it reaches there for `sili ls`
+func networkSummary(st *state.State, env *state.EnvInfo) string {
+	if env.Network == "" {
+		return "-"
+	}
+	summary := env.Network
+	if peers := container.Peers(st, env.Name); len(peers) > 0 {
+		summary += " -> " + strings.Join(peers, ", ")
+	}
+	if len(summary) > 24 {
+		summary = summary[:21] + "..."
+	}
+	return summary
+}
+
+func init() {
+	rootCmd.AddCommand(networkCmd)
+	networkCmd.AddCommand(networkLsCmd)
+	networkCmd.AddCommand(networkConnectCmd)
+	networkConnectCmd.Flags().StringVarP(&networkConnectName, "name", "n", "silibox-dev", "Environment name")
+	networkConnectCmd.Flags().StringVar(&networkConnectGroup, "network", container.DefaultNetwork, "Network group to join")
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/probe"
+	"github.com/coheez/silibox/internal/proxy"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	openName    string
+	openWait    bool
+	openTimeout time.Duration
+	openPrint   bool
+)
+
+var openCmd = &cobra.Command{
+	Use:   "open [port]",
+	Short: "Open an environment's web service in the browser",
+	Long: `Open a service of an environment in the host's browser.
+
+The port is a host or container port. Ports routed through the proxy open their
+.localhost URL; others open localhost with the scheme the service answers on. Without
+a port, the env's route opens, or else the port that answers HTTP.
+
+Connecting wakes an environment the autosleep agent stopped. --wait waits for the
+service to answer first, e.g. right after 'sili start'.
+
+Examples:
+  sili open --name web
+  sili open --name web 5173 --wait`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := state.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		env, ok := st.Envs[openName]
+		if !ok {
+			return fmt.Errorf("environment '%s' not found", openName)
+		}
+
+		ports := httpCandidates(env)
+		if len(ports) == 0 {
+			return fmt.Errorf("'%s' has no tcp ports mapped; add one with 'sili ports add --name %s <port>'", openName, openName)
+		}
+
+		var pm *state.PortMapping
+		if len(args) == 1 {
+			port, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid port %s: %w", args[0], err)
+			}
+			for i := range ports {
+				if ports[i].HostPort == port || ports[i].ContainerPort == port {
+					pm = &ports[i]
+					break
+				}
+			}
+			if pm == nil {
+				return fmt.Errorf("'%s' has no tcp port %d; mapped: %s", openName, port, describePorts(ports))
+			}
+		}
+
+		// A route serves the same port under a stable name; <env>.localhost wins
+		listeners := configuredProxy()
+		var route *proxy.Route
+		if listeners.HTTP != "" || listeners.HTTPS != "" {
+			for _, r := range proxy.Routes(st) {
+				if r.Env != openName || pm != nil && r.Port != pm.ContainerPort || mappingFor(ports, r.Port) == nil {
+					continue
+				}
+				if route == nil || r.Host == "" {
+					route = &r
+				}
+			}
+		}
+		var routeURL string
+		if route != nil {
+			routeURL = listeners.url(*route)
+			pm = mappingFor(ports, route.Port)
+		}
+
+		var result probe.Result
+		switch {
+		case pm != nil:
+			result, err = probeForOpen(pm)
+		default:
+			pm, result, err = pickHTTPPort(ports)
+		}
+		if err != nil {
+			return err
+		}
+
+		url := routeURL
+		if url == "" {
+			if result.Scheme != "http" && result.Scheme != "https" {
+				return fmt.Errorf("'%s' port %d doesn't answer HTTP or HTTPS", openName, pm.HostPort)
+			}
+			url = probe.URL(result.Scheme, "localhost", pm.HostPort)
+		}
+
+		if openPrint {
+			fmt.Println(url)
+			return nil
+		}
+		fmt.Printf("🌐 Opening %s\n", url)
+		return openBrowser(url)
+	},
+}
+
+// httpCandidates are the env's tcp mappings, declared ones first, then by container port
+func httpCandidates(env *state.EnvInfo) []state.PortMapping {
+	var ports []state.PortMapping
+	for _, pm := range env.Ports {
+		if pm.Protocol == "tcp" {
+			ports = append(ports, pm)
+		}
+	}
+	sort.SliceStable(ports, func(i, j int) bool {
+		if ports[i].Auto != ports[j].Auto {
+			return !ports[i].Auto
+		}
+		return ports[i].ContainerPort < ports[j].ContainerPort
+	})
+	return ports
+}
+
+func mappingFor(ports []state.PortMapping, containerPort int) *state.PortMapping {
+	for i := range ports {
+		if ports[i].ContainerPort == containerPort {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+func describePorts(ports []state.PortMapping) string {
+	var parts []string
+	for _, pm := range ports {
+		parts = append(parts, portSpecString(pm))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// portSpecString shows a mapping like a --ports spec, e.g. 8080:80
+func portSpecString(pm state.PortMapping) string {
+	if pm.HostPort == pm.ContainerPort {
+		return strconv.Itoa(pm.HostPort)
+	}
+	return fmt.Sprintf("%d:%d", pm.HostPort, pm.ContainerPort)
+}
+
+// probeForOpen probes pm, waiting for it to become healthy with --wait
+func probeForOpen(pm *state.PortMapping) (probe.Result, error) {
+	addr := loopbackAddress(pm.HostIP, pm.HostPort)
+	if !openWait {
+		result := probe.Port(addr, probe.DefaultTimeout)
+		if !result.Listening {
+			return result, fmt.Errorf("nothing listens on '%s' port %d; use --wait to wait for it", openName, pm.HostPort)
+		}
+		return result, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "⏳ Waiting up to %s for '%s' port %d...\n", openTimeout, openName, pm.HostPort)
+	ctx, cancel := context.WithTimeout(context.Background(), openTimeout)
+	defer cancel()
+	result, err := probe.Wait(ctx, addr, waitInterval, probe.DefaultTimeout)
+	if err != nil {
+		return result, fmt.Errorf("timed out after %s waiting for '%s' port %d (%s)", openTimeout, openName, pm.HostPort, result)
+	}
+	return result, nil
+}
+
+// pickHTTPPort finds the port to open when none was given: the first that answers
+// HTTP, or the only one
+func pickHTTPPort(ports []state.PortMapping) (*state.PortMapping, probe.Result, error) {
+	if len(ports) == 1 {
+		result, err := probeForOpen(&ports[0])
+		return &ports[0], result, err
+	}
+	if openWait {
+		return nil, probe.Result{}, fmt.Errorf("'%s' maps several ports (%s); name the one to wait for", openName, describePorts(ports))
+	}
+	for i := range ports {
+		result := probe.Port(loopbackAddress(ports[i].HostIP, ports[i].HostPort), probe.DefaultTimeout)
+		if result.Scheme == "http" || result.Scheme == "https" {
+			return &ports[i], result, nil
+		}
+	}
+	return nil, probe.Result{}, fmt.Errorf("no port of '%s' answers HTTP; mapped: %s", openName, describePorts(ports))
+}
+
+// openBrowser opens url in the host's default browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "linux":
+		cmd = exec.Command("xdg-open", url)
+	default:
+		return fmt.Errorf("opening a browser isn't supported on %s; visit %s", runtime.GOOS, url)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to open browser: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+	openCmd.Flags().StringVarP(&openName, "name", "n", "silibox-dev", "Environment name")
+	openCmd.Flags().BoolVar(&openWait, "wait", false, "Wait until the service answers before opening it")
+	openCmd.Flags().DurationVar(&openTimeout, "timeout", 2*time.Minute, "How long --wait waits")
+	openCmd.Flags().BoolVar(&openPrint, "print", false, "Print the URL instead of opening it")
+}
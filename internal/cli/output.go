@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/coheez/silibox/internal/agent"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by the global --output flag
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+var outputFormat string
+
+// validateOutputFormat rejects unknown --output values before any command runs
+func validateOutputFormat(cmd *cobra.Command, args []string) error {
+	switch outputFormat {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid --output %q (must be table, json or yaml)", outputFormat)
+	}
+}
+
+// structuredOutput reports whether the command should emit machine-readable output
+func structuredOutput() bool {
+	return outputFormat == formatJSON || outputFormat == formatYAML
+}
+
+// writeOutput encodes v to stdout in the selected structured format
+func writeOutput(v any) error {
+	return encodeOutput(os.Stdout, outputFormat, v)
+}
+
+// encodeOutput encodes v as JSON or YAML
+// YAML is produced from the JSON encoding so both formats share the same field names
+func encodeOutput(w io.Writer, format string, v any) error {
+	switch format {
+	case formatYAML:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic any
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(generic); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+}
+
+// The types below are the documented, stable shapes of structured output.
+// Fields may be added over time but existing fields are not renamed or removed.
+// See docs/OUTPUT.md.
+
+// EnvListItem is one entry of `sili ls`
+type EnvListItem struct {
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`       // Live status from Podman: running or stopped
+	StateStatus string            `json:"state_status"` // Status recorded in state
+	Image       string            `json:"image"`
+	ProjectPath string            `json:"project_path"`
+	Persistent  bool              `json:"persistent"`
+	IdleTimeout string            `json:"idle_timeout,omitempty"` // Per-env autosleep timeout, if set
+	Network     string            `json:"network,omitempty"`      // Network group; unset for envs created before silibox networks
+	Peers       []string          `json:"peers,omitempty"`        // Envs on the same network group, reachable by name
+	Stack       string            `json:"stack,omitempty"`        // Stack brought up with `sili up`
+	Service     string            `json:"service,omitempty"`      // Service of the stack
+	DependsOn   []string          `json:"depends_on,omitempty"`   // Envs of the stack this one starts after
+	Volumes     map[string]string `json:"volumes,omitempty"`      // Podman volume of each project directory kept in one
+	LastActive  time.Time         `json:"last_active"`
+}
+
+// NetworkListItem is one entry of `sili network ls`
+type NetworkListItem struct {
+	Name          string   `json:"name"`           // Network group
+	PodmanNetwork string   `json:"podman_network"` // Podman network backing the group
+	Envs          []string `json:"envs"`
+}
+
+// PortListItem is one entry of `sili ports`
+type PortListItem struct {
+	Env           string      `json:"env"`
+	HostIP        string      `json:"host_ip,omitempty"`
+	HostPort      int         `json:"host_port"`
+	ContainerPort int         `json:"container_port"`
+	Protocol      string      `json:"protocol"`
+	URL           string      `json:"url"`
+	Auto          bool        `json:"auto"`             // Forwarded automatically by the autosleep agent
+	Health        *PortHealth `json:"health,omitempty"` // Unset for ports that weren't probed
+}
+
+// PortHealth is what probing a port found
+type PortHealth struct {
+	Listening  bool   `json:"listening"`
+	Healthy    bool   `json:"healthy"`               // Listening, and no 5xx from HTTP services
+	Scheme     string `json:"scheme,omitempty"`      // http, https or tcp
+	HTTPStatus int    `json:"http_status,omitempty"` // Unset for services that don't speak HTTP
+	LatencyMS  int64  `json:"latency_ms,omitempty"`
+}
+
+// RouteListItem is one entry of `sili proxy routes`
+type RouteListItem struct {
+	Env      string `json:"env"`
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`   // Container port
+	Source   string `json:"source"` // manifest or expose
+	URL      string `json:"url"`
+	HTTPSURL string `json:"https_url,omitempty"` // Set once `sili ca init` has run
+}
+
+// ShimListItem is one entry of `sili export-bin --list`
+type ShimListItem struct {
+	Name   string `json:"name"`
+	Env    string `json:"env"`
+	Target string `json:"target"`
+}
+
+// AgentStatusOutput is the output of `sili agent status`
+// Service is unset where no service manager is supported; Agent is unset when the agent isn't running
+type AgentStatusOutput struct {
+	Service *agent.ServiceStatus `json:"service,omitempty"`
+	Agent   *agent.Status        `json:"agent,omitempty"`
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", formatTable, "Output format: table, json or yaml")
+	rootCmd.PersistentPreRunE = validateOutputFormat
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateOutputFormat(t *testing.T) {
+	old := outputFormat
+	defer func() { outputFormat = old }()
+
+	for _, format := range []string{"table", "json", "yaml"} {
+		outputFormat = format
+		if err := validateOutputFormat(nil, nil); err != nil {
+			t.Errorf("expected %q to be valid, got %v", format, err)
+		}
+	}
+
+	outputFormat = "xml"
+	if err := validateOutputFormat(nil, nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestEncodeOutput(t *testing.T) {
+	items := []PortListItem{
+		{Env: "web", HostPort: 8080, ContainerPort: 80, Protocol: "tcp", URL: "http://localhost:8080"},
+	}
+
+	var jsonBuf bytes.Buffer
+	if err := encodeOutput(&jsonBuf, formatJSON, items); err != nil {
+		t.Fatalf("json encode failed: %v", err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(jsonBuf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if decoded[0]["host_port"] != float64(8080) {
+		t.Errorf("expected host_port field, got %v", decoded[0])
+	}
+
+	// YAML must use the same field names as JSON
+	var yamlBuf bytes.Buffer
+	if err := encodeOutput(&yamlBuf, formatYAML, items); err != nil {
+		t.Fatalf("yaml encode failed: %v", err)
+	}
+	out := yamlBuf.String()
+	for _, want := range []string{"env: web", "host_port: 8080", "container_port: 80"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in yaml output:\n%s", want, out)
+		}
+	}
+}
@@ -2,21 +2,69 @@ package cli
 
 import (
 	"fmt"
+	"net"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/probe"
+	"github.com/coheez/silibox/internal/proxy"
 	"github.com/coheez/silibox/internal/state"
 	"github.com/spf13/cobra"
 )
 
 var (
-	portsEnv string
+	portsEnv     string
+	portsNoProbe bool
+	portsWait    bool
+	portsTimeout time.Duration
+	portsAddName string
+	portsRmName  string
 )
 
+// waitInterval is how often --wait probes ports that aren't healthy yet
+const waitInterval = 500 * time.Millisecond
+
 var portsCmd = &cobra.Command{
-	Use:   "ports",
+	Use:   "ports [port]...",
 	Short: "List active port mappings",
+	Long: `List the port mappings of each environment.
+
+Ports declared with --ports or added with 'sili ports add' are listed as "declared".
+While the autosleep agent runs, ports a container starts listening on are forwarded to
+the host automatically and listed as "auto"; they are removed again once the socket
+closes or the env stops.
+
+Ports are bound to localhost unless their spec names a host IP, e.g. 0.0.0.0:8080:80.
+Ports routed with 'sili expose' or the manifest's expose: list their .localhost URL.
+
+The tcp ports of running environments are probed: STATUS shows whether something
+listens and, for services that answer HTTP, the status code and latency. The URL
+scheme comes from what the service speaks (a TLS handshake, then an HTTP request).
+Stopped environments aren't probed, since connecting would wake them.
+
+Ports given as arguments, by host or container port, limit the list. --wait blocks
+until they (or all listed ports) listen and don't answer with a 5xx, which is useful in
+scripts:
+
+  sili ports --env web --wait 3000 && npm run e2e`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		selected := make(map[int]bool)
+		for _, arg := range args {
+			port, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid port %s: %w", arg, err)
+			}
+			selected[port] = true
+		}
+		if portsWait && portsNoProbe {
+			return fmt.Errorf("--wait can't be combined with --no-probe")
+		}
+
 		// Load state
 		st, err := state.Load()
 		if err != nil {
@@ -26,14 +74,31 @@ var portsCmd = &cobra.Command{
 		// Collect all port mappings
 		type portInfo struct {
 			envName       string
+			hostIP        string
 			hostPort      int
 			containerPort int
 			protocol      string
 			url           string
+			auto          bool
+			routed        bool
+			running       bool
+			health        *probe.Result // Unset for ports that weren't probed
 		}
 
 		var allPorts []portInfo
 
+		// Ports served by the proxy show their hostname instead of a guessed URL
+		listeners := configuredProxy()
+		routeURLs := make(map[string]string)
+		if listeners.HTTP != "" || listeners.HTTPS != "" {
+			for _, r := range proxy.Routes(st) {
+				key := r.Env + "/" + strconv.Itoa(r.Port)
+				if _, ok := routeURLs[key]; !ok {
+					routeURLs[key] = listeners.url(r)
+				}
+			}
+		}
+
 		for envName, env := range st.Envs {
 			// Filter by environment if specified
 			if portsEnv != "" && envName != portsEnv {
@@ -41,26 +106,37 @@ var portsCmd = &cobra.Command{
 			}
 
 			for _, pm := range env.Ports {
-				// Generate URL
-				url := generateURL(pm.HostPort, pm.Protocol)
+				if len(selected) > 0 && !selected[pm.HostPort] && !selected[pm.ContainerPort] {
+					continue
+				}
+				url, routed := routeURLs[envName+"/"+strconv.Itoa(pm.ContainerPort)]
+				routed = routed && pm.Protocol == "tcp"
+				if !routed {
+					url = probe.URL(pm.Protocol, "localhost", pm.HostPort)
+				}
 
 				allPorts = append(allPorts, portInfo{
 					envName:       envName,
+					hostIP:        pm.HostIP,
 					hostPort:      pm.HostPort,
 					containerPort: pm.ContainerPort,
 					protocol:      pm.Protocol,
 					url:           url,
+					auto:          pm.Auto,
+					routed:        routed,
+					running:       env.Status == "running",
 				})
 			}
 		}
 
 		// Check if no ports found
-		if len(allPorts) == 0 {
+		if len(allPorts) == 0 && !structuredOutput() {
 			if portsEnv != "" {
 				fmt.Printf("No port mappings found for environment '%s'.\n", portsEnv)
 			} else {
 				fmt.Println("No port mappings found.")
 				fmt.Println("Add ports with: sili create --name <env> --ports <port> ...")
+				fmt.Println("With the autosleep agent running, ports containers listen on are forwarded automatically.")
 			}
 			return nil
 		}
@@ -73,17 +149,107 @@ var portsCmd = &cobra.Command{
 			return allPorts[i].hostPort < allPorts[j].hostPort
 		})
 
+		probeable := func(i int) bool {
+			return !portsNoProbe && allPorts[i].running && allPorts[i].protocol == "tcp"
+		}
+		probeAll := func() {
+			var wg sync.WaitGroup
+			for i := range allPorts {
+				if !probeable(i) {
+					continue
+				}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					r := probe.Port(loopbackAddress(allPorts[i].hostIP, allPorts[i].hostPort), probe.DefaultTimeout)
+					allPorts[i].health = &r
+				}(i)
+			}
+			wg.Wait()
+		}
+
+		if portsWait {
+			if len(allPorts) == 0 {
+				return fmt.Errorf("no port mappings to wait for")
+			}
+			for i, port := range allPorts {
+				if port.protocol != "tcp" {
+					return fmt.Errorf("can't wait for %s port %d: only tcp ports are probed", port.protocol, port.hostPort)
+				}
+				if !probeable(i) {
+					return fmt.Errorf("environment '%s' is stopped; start it with 'sili start --name %s'", port.envName, port.envName)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "⏳ Waiting up to %s for %d port(s) to become healthy...\n", portsTimeout, len(allPorts))
+			deadline := time.Now().Add(portsTimeout)
+			for {
+				probeAll()
+				var pending []string
+				for _, port := range allPorts {
+					if !port.health.Healthy() {
+						pending = append(pending, fmt.Sprintf("'%s' port %d (%s)", port.envName, port.hostPort, port.health))
+					}
+				}
+				if len(pending) == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					return fmt.Errorf("timed out after %s waiting for %s", portsTimeout, strings.Join(pending, ", "))
+				}
+				time.Sleep(waitInterval)
+			}
+		} else {
+			probeAll()
+		}
+
+		// The scheme of unrouted ports is whatever the service answered
+		for i, port := range allPorts {
+			if !port.routed && port.health != nil && port.health.Listening {
+				allPorts[i].url = probe.URL(port.health.Scheme, "localhost", port.hostPort)
+			}
+		}
+
+		if structuredOutput() {
+			items := make([]PortListItem, 0, len(allPorts))
+			for _, port := range allPorts {
+				items = append(items, PortListItem{
+					Env:           port.envName,
+					HostIP:        port.hostIP,
+					HostPort:      port.hostPort,
+					ContainerPort: port.containerPort,
+					Protocol:      port.protocol,
+					URL:           port.url,
+					Auto:          port.auto,
+					Health:        portHealth(port.health),
+				})
+			}
+			return writeOutput(items)
+		}
+
 		// Print header
-		fmt.Printf("%-20s %-12s %-16s %-10s %s\n", "ENV", "HOST PORT", "CONTAINER PORT", "PROTOCOL", "URL")
-		fmt.Println(strings.Repeat("-", 90))
+		fmt.Printf("%-20s %-18s %-16s %-10s %-10s %-16s %s\n", "ENV", "HOST PORT", "CONTAINER PORT", "PROTOCOL", "SOURCE", "STATUS", "URL")
+		fmt.Println(strings.Repeat("-", 123))
 
 		// Print each port mapping
 		for _, port := range allPorts {
-			fmt.Printf("%-20s %-12d %-16d %-10s %s\n",
+			source := "declared"
+			if port.auto {
+				source = "auto"
+			}
+			status := "-"
+			switch {
+			case port.health != nil:
+				status = port.health.String()
+			case !port.running:
+				status = "stopped"
+			}
+			fmt.Printf("%-20s %-18s %-16d %-10s %-10s %-16s %s\n",
 				port.envName,
-				port.hostPort,
+				hostAddress(port.hostIP, port.hostPort),
 				port.containerPort,
 				port.protocol,
+				source,
+				status,
 				port.url,
 			)
 		}
@@ -92,25 +258,106 @@ var portsCmd = &cobra.Command{
 	},
 }
 
-// generateURL creates a clickable URL from port and protocol
-func generateURL(port int, protocol string) string {
-	if protocol == "tcp" {
-		// Assume HTTP for common web ports
-		if port == 80 || port == 8080 || port == 3000 || port == 4200 || port == 5000 || port == 8000 {
-			return fmt.Sprintf("http://localhost:%d", port)
+var portsAddCmd = &cobra.Command{
+	Use:   "add <port>...",
+	Short: "Map ports on an existing environment",
+	Long: `Map more ports on an existing environment without recreating it.
+
+Ports take the same formats as 'sili create --ports', tcp only.
+Podman can't publish ports on a created container, so added ports are forwarded into
+the container's network namespace whenever the environment runs. An automatic forward
+of the same container port is replaced.
+
+Examples:
+  sili ports add --name web 5173
+  sili ports add --name web 8081:80 9229
+  sili ports add --name web :8080           # Next free host port
+  sili ports add --name web 9000-9005`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, spec := range args {
+			mappings, err := container.AddPort(portsAddName, spec)
+			if err != nil {
+				return fmt.Errorf("failed to add port %s: %w", spec, err)
+			}
+			for _, pm := range mappings {
+				addr := hostAddress(pm.HostIP, pm.HostPort)
+				if pm.HostIP == "" {
+					addr = "localhost:" + addr
+				}
+				fmt.Printf("✅ Mapped %s to '%s' port %d\n", addr, portsAddName, pm.ContainerPort)
+			}
 		}
-		// For HTTPS ports
-		if port == 443 || port == 8443 {
-			return fmt.Sprintf("https://localhost:%d", port)
+		return nil
+	},
+}
+
+var portsRmCmd = &cobra.Command{
+	Use:   "rm <port>...",
+	Short: "Unmap ports added with 'sili ports add'",
+	Long: `Unmap ports added with 'sili ports add', by host or container port.
+
+Ports published with 'sili create --ports' stay until the environment is recreated;
+automatic forwards go away by themselves once nothing listens on them.
+
+Examples:
+  sili ports rm --name web 5173`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, arg := range args {
+			port, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid port %s: %w", arg, err)
+			}
+			pm, err := container.RemovePort(portsRmName, port)
+			if err != nil {
+				return fmt.Errorf("failed to remove port %d: %w", port, err)
+			}
+			fmt.Printf("✅ Unmapped localhost:%d from '%s' port %d\n", pm.HostPort, portsRmName, pm.ContainerPort)
 		}
-		// Generic TCP
-		return fmt.Sprintf("tcp://localhost:%d", port)
+		return nil
+	},
+}
+
+// hostAddress shows the host port, prefixed with its address when bound to one explicitly
+func hostAddress(ip string, port int) string {
+	if ip == "" {
+		return strconv.Itoa(port)
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// loopbackAddress is where the host reaches a port bound to ip
+func loopbackAddress(ip string, port int) string {
+	if ip != "::1" {
+		ip = "127.0.0.1"
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// portHealth converts a probe result for structured output
+func portHealth(r *probe.Result) *PortHealth {
+	if r == nil {
+		return nil
+	}
+	return &PortHealth{
+		Listening:  r.Listening,
+		Healthy:    r.Healthy(),
+		Scheme:     r.Scheme,
+		HTTPStatus: r.Status,
+		LatencyMS:  r.Latency.Milliseconds(),
 	}
-	// UDP
-	return fmt.Sprintf("udp://localhost:%d", port)
 }
 
 func init() {
 	rootCmd.AddCommand(portsCmd)
 	portsCmd.Flags().StringVarP(&portsEnv, "env", "e", "", "Filter by environment name")
+	portsCmd.Flags().BoolVar(&portsNoProbe, "no-probe", false, "Don't probe whether services answer")
+	portsCmd.Flags().BoolVar(&portsWait, "wait", false, "Wait until the listed ports are healthy")
+	portsCmd.Flags().DurationVar(&portsTimeout, "timeout", 2*time.Minute, "How long --wait waits")
+
+	portsCmd.AddCommand(portsAddCmd)
+	portsCmd.AddCommand(portsRmCmd)
+	portsAddCmd.Flags().StringVarP(&portsAddName, "name", "n", "silibox-dev", "Environment name")
+	portsRmCmd.Flags().StringVarP(&portsRmName, "name", "n", "silibox-dev", "Environment name")
 }
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/config"
+	"github.com/coheez/silibox/internal/proxy"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	proxyListen    string
+	proxyTLSListen string
+	proxyRoutesEnv string
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Serve environments on <host>.<env>.localhost hostnames",
+	Long: `The silibox proxy serves each route on http://<host>.<env>.localhost and forwards
+requests to the container port the route names, so frontends get stable hostnames and
+host-scoped cookies no longer collide between environments.
+
+Routes come from the expose: section of a project's silibox.yaml and from
+'sili expose'. The autosleep agent serves the proxy on autosleep.proxy_listen
+(default 127.0.0.1:80); 'sili proxy serve' runs it without the agent.
+
+After 'sili ca init' the routes are also served over HTTPS on
+autosleep.proxy_tls_listen (default 127.0.0.1:443), with certificates from the
+silibox CA.`,
+}
+
+var proxyServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the .localhost proxy in the foreground",
+	Long: `Serve the .localhost proxy until interrupted.
+
+HTTPS is served too once 'sili ca init' has created the silibox CA.
+
+Examples:
+  sili proxy serve
+  sili proxy serve --listen 127.0.0.1:8080 --tls-listen 127.0.0.1:8443`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, stop, err := proxy.Start(proxyListen)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		fmt.Fprintf(os.Stderr, "🌐 Serving .localhost routes on %s\n", addr)
+
+		if proxyTLSListen != "" {
+			authority, err := ca.Load()
+			if errors.Is(err, ca.ErrNotInitialized) {
+				fmt.Fprintln(os.Stderr, "   Run 'sili ca init' to serve them over HTTPS too")
+			} else if err != nil {
+				return err
+			} else {
+				tlsAddr, stopTLS, err := proxy.StartTLS(proxyTLSListen, ca.NewIssuer(authority))
+				if err != nil {
+					return err
+				}
+				defer stopTLS()
+				fmt.Fprintf(os.Stderr, "🔒 Serving .localhost routes over HTTPS on %s\n", tlsAddr)
+			}
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		<-ctx.Done()
+		return nil
+	},
+}
+
+var proxyRoutesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "List the hostnames the proxy serves",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := state.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		listeners := configuredProxy()
+
+		var routes []proxy.Route
+		for _, r := range proxy.Routes(st) {
+			if proxyRoutesEnv == "" || r.Env == proxyRoutesEnv {
+				routes = append(routes, r)
+			}
+		}
+
+		if structuredOutput() {
+			items := make([]RouteListItem, 0, len(routes))
+			for _, r := range routes {
+				item := RouteListItem{
+					Env:      r.Env,
+					Hostname: r.Hostname(),
+					Port:     r.Port,
+					Source:   r.Source,
+					URL:      r.URL(listeners.HTTP),
+				}
+				if listeners.HTTPS != "" {
+					item.HTTPSURL = r.TLSURL(listeners.HTTPS)
+				}
+				items = append(items, item)
+			}
+			return writeOutput(items)
+		}
+
+		if len(routes) == 0 {
+			fmt.Println("No routes found.")
+			fmt.Println("Add one with: sili expose --name <env> --port <port> --host <host>")
+			return nil
+		}
+		fmt.Printf("%-20s %-16s %-10s %s\n", "ENV", "CONTAINER PORT", "SOURCE", "URL")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, r := range routes {
+			fmt.Printf("%-20s %-16d %-10s %s\n", r.Env, r.Port, r.Source, listeners.url(r))
+		}
+		if listeners.HTTP == "" && listeners.HTTPS == "" {
+			fmt.Println("\nThe proxy is disabled (autosleep.proxy_listen is empty); run 'sili proxy serve' to serve these routes.")
+		}
+		return nil
+	},
+}
+
+// proxyListeners are the addresses the agent serves the proxy on
+type proxyListeners struct {
+	HTTP  string
+	HTTPS string // Empty until 'sili ca init' has created the CA
+}
+
+// configuredProxy reads the proxy addresses from the config file
+func configuredProxy() proxyListeners {
+	l := proxyListeners{HTTP: proxy.DefaultListen, HTTPS: proxy.DefaultTLSListen}
+	if cfg, err := config.Load(); err == nil {
+		l = proxyListeners{HTTP: cfg.Autosleep.ProxyListen, HTTPS: cfg.Autosleep.ProxyTLSListen}
+	}
+	if _, err := ca.Load(); err != nil {
+		l.HTTPS = ""
+	}
+	return l
+}
+
+// url is the route's URL, preferring HTTPS
+func (l proxyListeners) url(r proxy.Route) string {
+	if l.HTTPS != "" {
+		return r.TLSURL(l.HTTPS)
+	}
+	return r.URL(l.HTTP)
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+	proxyCmd.AddCommand(proxyServeCmd)
+	proxyCmd.AddCommand(proxyRoutesCmd)
+	proxyServeCmd.Flags().StringVar(&proxyListen, "listen", proxy.DefaultListen, "Address to serve the proxy on")
+	proxyServeCmd.Flags().StringVar(&proxyTLSListen, "tls-listen", proxy.DefaultTLSListen, "Address to serve the proxy on over HTTPS; empty disables")
+	proxyRoutesCmd.Flags().StringVarP(&proxyRoutesEnv, "env", "e", "", "Filter by environment name")
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/config"
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/coheez/silibox/internal/vm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upName     string
+	upDir      string
+	upTrustCA  bool
+	downName   string
+	downDir    string
+	downRemove bool
+)
+
+var upCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Create or start the services of a project as a stack",
+	Long: `Bring up the services declared under services: in silibox.yaml, or in the project's
+compose.yaml when silibox.yaml has none. Each service becomes an environment named
+<stack>-<service> on a network of its own, where the services reach each other by
+service name: the app connects to postgres://db:5432.
+
+Services start after the ones they depend on, once those pass their healthcheck.
+Autosleep treats a stack as one unit: it stops the stack when all of its services
+are idle, and a connection to any of them wakes the whole stack.
+
+The stack is named after the project directory unless --name is given. A stack of
+that name brought up from another directory is refused; pick another name for it.
+
+Examples:
+  sili up
+  sili up --dir ~/code/shop --name shop
+  sili down --rm`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := filepath.Abs(upDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", upDir, err)
+		}
+		services, source, warnings, err := manifest.LoadServices(projectDir)
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", filepath.Base(source), w)
+		}
+
+		stack := upName
+		if stack == "" {
+			stack = container.StackName(projectDir)
+		}
+
+		trustCA := upTrustCA
+		if !cmd.Flags().Changed("trust-ca") {
+			if c, err := config.Load(); err == nil {
+				trustCA = c.CA.TrustContainers
+			}
+		}
+		if trustCA {
+			authority, created, err := ca.Ensure()
+			if err != nil {
+				return err
+			}
+			if created {
+				fmt.Printf("✅ Created the silibox CA in %s\n", authority.CertPath())
+				fmt.Print(ca.TrustInstructions(authority.CertPath()))
+			}
+		}
+
+		if err := vm.EnsureVMRunning(); err != nil {
+			return err
+		}
+		fmt.Printf("🚀 Bringing up stack '%s' from %s\n", stack, source)
+		err = container.Up(container.UpOptions{
+			Stack:       stack,
+			ProjectDir:  projectDir,
+			Services:    services,
+			Environment: hostEnvironment(),
+			TrustCA:     trustCA,
+			AnyProject:  cmd.Flags().Changed("name"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Stack '%s' is up\n", stack)
+		fmt.Printf("   Services reach each other by name on network '%s'; see 'sili ls --stack %s'\n", stack, stack)
+		return nil
+	},
+}
+
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Stop the services of a stack",
+	Long: `Stop the environments of a stack, each before the services it depends on.
+With --rm the environments are removed as well; 'sili up' recreates them.
+
+Without --name, the stack of the project directory is taken down; a stack of the
+same name brought up from another directory is refused.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := filepath.Abs(downDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", downDir, err)
+		}
+		stack := downName
+		if stack == "" {
+			stack = container.StackName(projectDir)
+		}
+		if err := vm.EnsureVMRunning(); err != nil {
+			return err
+		}
+		err = container.Down(container.DownOptions{
+			Stack:      stack,
+			ProjectDir: projectDir,
+			Remove:     downRemove,
+			AnyProject: cmd.Flags().Changed("name"),
+		})
+		if err != nil {
+			return err
+		}
+		if downRemove {
+			fmt.Printf("✅ Stack '%s' is removed\n", stack)
+		} else {
+			fmt.Printf("✅ Stack '%s' is down\n", stack)
+		}
+		return nil
+	},
+}
+
+// stackSummary shows an env's stack and service for `sili ls`
+func stackSummary(env *state.EnvInfo) string {
+	if env.Stack == "" {
+		return "-"
+	}
+	summary := env.Stack + "/" + env.Service
+	if len(summary) > 20 {
+		summary = summary[:17] + "..."
+	}
+	return summary
+}
+
+func init() {
+	rootCmd.AddCommand(upCmd, downCmd)
+	upCmd.Flags().StringVarP(&upName, "name", "n", "", "Stack name (default: from the project directory)")
+	upCmd.Flags().StringVarP(&upDir, "dir", "d", ".", "Project directory with silibox.yaml or compose.yaml")
+	upCmd.Flags().BoolVar(&upTrustCA, "trust-ca", false, "Add the silibox CA to the containers' trust stores (default: ca.trust_containers from the config)")
+	downCmd.Flags().StringVarP(&downName, "name", "n", "", "Stack name (default: from the project directory)")
+	downCmd.Flags().StringVarP(&downDir, "dir", "d", ".", "Project directory of the stack")
+	downCmd.Flags().BoolVar(&downRemove, "rm", false, "Remove the environments after stopping them")
+}
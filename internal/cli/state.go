@@ -1,10 +1,10 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/coheez/silibox/internal/portable"
 	"github.com/coheez/silibox/internal/state"
 	"github.com/spf13/cobra"
 )
@@ -23,13 +23,75 @@ var stateShowCmd = &cobra.Command{
 			return fmt.Errorf("failed to load state: %w", err)
 		}
 
-		enc := json.NewEncoder(os.Stdout)
-		enc.SetIndent("", "  ")
-		return enc.Encode(s)
+		// The full state has no table form; it's shown as JSON unless YAML is requested
+		if outputFormat == formatYAML {
+			return writeOutput(s)
+		}
+		return encodeOutput(os.Stdout, formatJSON, s)
+	},
+}
+
+var (
+	stateExportVolumes  bool
+	stateImportMapPaths []string
+	stateImportNoVolume bool
+)
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export environments, shims and port mappings to a portable bundle",
+	Long: `Export the current setup to a bundle that can be imported on another machine.
+
+The bundle contains environment definitions, port mappings and shims. With --volumes
+the contents of each environment's volumes are included as well.
+
+Examples:
+  # Export to silibox-export.tar.gz
+  sili state export
+
+  # Export including volume contents
+  sili state export --volumes ~/silibox-backup.tar.gz`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "silibox-export.tar.gz"
+		if len(args) == 1 {
+			path = args[0]
+		}
+		return portable.Export(path, portable.ExportOptions{IncludeVolumes: stateExportVolumes})
+	},
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Recreate environments and shims from an exported bundle",
+	Long: `Import a bundle created by 'sili state export'.
+
+Creates the VM if needed, pulls images, recreates each environment and re-exports its
+shims. Environments that already exist are skipped. Project paths under the source
+machine's home directory are rewritten to the current home directory; use --map-path
+for anything else.
+
+Examples:
+  sili state import silibox-export.tar.gz
+  sili state import backup.tar.gz --map-path /Users/old/code=/Users/new/src`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pathMap, err := portable.ParsePathMap(stateImportMapPaths)
+		if err != nil {
+			return err
+		}
+		return portable.Import(args[0], portable.ImportOptions{
+			PathMap:     pathMap,
+			Environment: hostEnvironment(),
+			SkipVolumes: stateImportNoVolume,
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(stateCmd)
-	stateCmd.AddCommand(stateShowCmd)
+	stateCmd.AddCommand(stateShowCmd, stateExportCmd, stateImportCmd)
+	stateExportCmd.Flags().BoolVar(&stateExportVolumes, "volumes", false, "Include volume contents in the bundle")
+	stateImportCmd.Flags().StringArrayVar(&stateImportMapPaths, "map-path", []string{}, "Rewrite project paths (format: old=new, repeatable)")
+	stateImportCmd.Flags().BoolVar(&stateImportNoVolume, "skip-volumes", false, "Don't restore volume contents from the bundle")
 }
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/coheez/silibox/internal/agent"
 	"github.com/coheez/silibox/internal/lima"
 	"github.com/spf13/cobra"
 )
@@ -31,6 +32,13 @@ By default this only removes the binary. Use --all to purge everything.`,
 			}
 		}
 
+		// Remove the agent service so it doesn't keep restarting a deleted binary
+		if st, err := agent.GetServiceStatus(); err == nil && st.Installed {
+			if _, err := agent.UninstallService(); err == nil {
+				fmt.Println("✓ removed autosleep agent service")
+			}
+		}
+
 		if uninstallAll {
 			// Stop VM if present (ignore errors)
 			_ = runSilent("limactl", "stop", lima.Instance)
@@ -1,12 +1,14 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/coheez/silibox/internal/container"
 	"github.com/coheez/silibox/internal/lima"
 	runtimex "github.com/coheez/silibox/internal/runtime"
+	"github.com/coheez/silibox/internal/vm"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +17,7 @@ var (
 	memory     string
 	disk       string
 	statusLive bool
+	vmStopTime int
 )
 
 var vmCmd = &cobra.Command{
@@ -26,6 +29,7 @@ var vmUpCmd = &cobra.Command{
 	Use:   "up",
 	Short: "Create/Start the Silibox VM",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		container.ReleaseHostPorts("")
 		return lima.Up(lima.Config{CPUs: cpus, Memory: memory, Disk: disk})
 	},
 }
@@ -47,15 +51,16 @@ var vmStatusCmd = &cobra.Command{
 			return err
 		}
 
-		if outputJSON {
-			// For JSON output, we need structured data
+		if outputJSON || structuredOutput() {
+			// For structured output, we need structured data
 			info, err := lima.GetStatus()
 			if err != nil {
 				return err
 			}
-			enc := json.NewEncoder(os.Stdout)
-			enc.SetIndent("", "  ")
-			return enc.Encode(info)
+			if outputJSON {
+				return encodeOutput(os.Stdout, formatJSON, info)
+			}
+			return writeOutput(info)
 		}
 
 		// Simple text output
@@ -67,8 +72,9 @@ var vmStatusCmd = &cobra.Command{
 var vmStopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop the Silibox VM",
+	Long:  "Stops running environments (running their pre_stop hooks), then stops the Silibox VM.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return lima.Stop()
+		return vm.Stop(vmStopOptions())
 	},
 }
 
@@ -78,7 +84,7 @@ var vmSleepCmd = &cobra.Command{
 	Long:  "Stops the Silibox VM to free up system resources. Use 'sili vm wake' to restart it.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("💤 Putting VM to sleep...")
-		if err := lima.Stop(); err != nil {
+		if err := vm.Stop(vmStopOptions()); err != nil {
 			return err
 		}
 		fmt.Println("✅ VM is now sleeping")
@@ -92,6 +98,7 @@ var vmWakeCmd = &cobra.Command{
 	Long:  "Starts the Silibox VM if it's stopped. Creates the VM if it doesn't exist.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("⏳ Waking VM...")
+		container.ReleaseHostPorts("")
 		if err := lima.Up(lima.Config{CPUs: cpus, Memory: memory, Disk: disk}); err != nil {
 			return err
 		}
@@ -110,6 +117,11 @@ var vmProbeCmd = &cobra.Command{
 
 var outputJSON bool
 
+// vmStopOptions builds the environment stop options from --time
+func vmStopOptions() container.StopOptions {
+	return container.StopOptions{Grace: time.Duration(vmStopTime) * time.Second}
+}
+
 func init() {
 	vmCmd.AddCommand(vmUpCmd, vmStatusCmd, vmStopCmd, vmSleepCmd, vmWakeCmd, vmProbeCmd)
 	vmUpCmd.Flags().IntVar(&cpus, "cpus", 4, "vCPUs")
@@ -118,6 +130,8 @@ func init() {
 	vmWakeCmd.Flags().IntVar(&cpus, "cpus", 4, "vCPUs")
 	vmWakeCmd.Flags().StringVar(&memory, "memory", "8GiB", "RAM (e.g., 8GiB)")
 	vmWakeCmd.Flags().StringVar(&disk, "disk", "60GiB", "Disk size")
-	vmStatusCmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "Output JSON")
+	vmStopCmd.Flags().IntVarP(&vmStopTime, "time", "t", 0, "Seconds to wait before killing each environment (default: stop_grace from silibox.yaml, else 10)")
+	vmSleepCmd.Flags().IntVarP(&vmStopTime, "time", "t", 0, "Seconds to wait before killing each environment (default: stop_grace from silibox.yaml, else 10)")
+	vmStatusCmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "Output JSON (same as --output json)")
 	vmStatusCmd.Flags().BoolVarP(&statusLive, "live", "l", false, "Get live status from lima (slower but always current)")
 }
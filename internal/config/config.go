@@ -12,14 +12,71 @@ import (
 // Config represents the silibox configuration file structure.
 type Config struct {
 	Autosleep AutosleepConfig `yaml:"autosleep"`
+	CA        CAConfig        `yaml:"ca"`
+}
+
+// CAConfig holds settings for the local development CA in ~/.sili/ca.
+type CAConfig struct {
+	TrustContainers bool `yaml:"trust_containers"` // Add the CA to new containers' trust stores, like sili create --trust-ca
 }
 
 // AutosleepConfig holds autosleep agent settings.
 type AutosleepConfig struct {
-	ContainerTimeout time.Duration `yaml:"container_timeout"`
-	VMTimeout        time.Duration `yaml:"vm_timeout"`
-	PollInterval     time.Duration `yaml:"poll_interval"`
-	NoStopVM         bool          `yaml:"no_stop_vm"`
+	ContainerTimeout time.Duration    `yaml:"container_timeout"`
+	VMTimeout        time.Duration    `yaml:"vm_timeout"`
+	PollInterval     time.Duration    `yaml:"poll_interval"`
+	NoStopVM         bool             `yaml:"no_stop_vm"`
+	WakeOnConnect    bool             `yaml:"wake_on_connect"`
+	AutoForward      bool             `yaml:"auto_forward"` // Forward ports containers start listening on to the host
+	StopGrace        time.Duration    `yaml:"stop_grace"`   // podman stop -t for autosleep stops; 0 uses podman's default
+	Activity         ActivityConfig   `yaml:"activity"`
+	Memory           MemoryConfig     `yaml:"memory"`
+	Notify           NotifyConfig     `yaml:"notify"`
+	MetricsListen    string           `yaml:"metrics_listen"`   // Serve Prometheus metrics on this address, empty disables
+	ProxyListen      string           `yaml:"proxy_listen"`     // Serve <host>.<env>.localhost routes on this address, empty disables
+	ProxyTLSListen   string           `yaml:"proxy_tls_listen"` // Serve them over HTTPS once `sili ca init` has run, empty disables
+	Rules            []RuleConfig     `yaml:"rules"`
+	Schedules        []ScheduleConfig `yaml:"schedules"`
+}
+
+// RuleConfig overrides autosleep settings for environments whose name matches a pattern.
+// The first matching rule wins.
+type RuleConfig struct {
+	Match       string        `yaml:"match"`        // Glob on the environment name, e.g. "db-*"
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // 0 keeps the default
+	Persistent  *bool         `yaml:"persistent"`   // nil keeps the default
+}
+
+// ScheduleConfig is a recurring time window that changes what autosleep does.
+type ScheduleConfig struct {
+	Name   string   `yaml:"name"`
+	Match  string   `yaml:"match"`  // Glob on the environment name; empty matches all
+	Days   []string `yaml:"days"`   // mon..sun; empty means every day
+	From   string   `yaml:"from"`   // HH:MM local time
+	To     string   `yaml:"to"`     // HH:MM; earlier than From wraps past midnight
+	Action string   `yaml:"action"` // keep_awake or stop
+}
+
+// ActivityConfig selects the live signals that keep an idle environment awake.
+type ActivityConfig struct {
+	ExecSessions bool    `yaml:"exec_sessions"` // Open enter/run sessions
+	CPUThreshold float64 `yaml:"cpu_threshold"` // CPU percent counted as busy, 0 disables
+	Connections  bool    `yaml:"connections"`   // Established connections on mapped ports
+	Processes    bool    `yaml:"processes"`     // Processes besides the container's init
+}
+
+// MemoryConfig sets when memory pressure stops environments before their idle timeout.
+type MemoryConfig struct {
+	HostThreshold float64 `yaml:"host_threshold"` // Host memory use in percent, 0 disables
+	VMThreshold   float64 `yaml:"vm_threshold"`   // VM memory use in percent, 0 disables
+}
+
+// NotifyConfig selects where the agent reports stops and how early it warns about them.
+type NotifyConfig struct {
+	Desktop  bool          `yaml:"desktop"`   // Native desktop notifications
+	Webhook  string        `yaml:"webhook"`   // URL that receives a JSON POST per notification
+	Command  string        `yaml:"command"`   // Shell command run per notification
+	LeadTime time.Duration `yaml:"lead_time"` // Heads-up before a planned stop, 0 disables
 }
 
 // DefaultConfig returns config with default values.
@@ -30,19 +87,44 @@ func DefaultConfig() Config {
 			VMTimeout:        30 * time.Minute,
 			PollInterval:     30 * time.Second,
 			NoStopVM:         false,
+			WakeOnConnect:    true,
+			AutoForward:      true,
+			ProxyListen:      "127.0.0.1:80",
+			ProxyTLSListen:   "127.0.0.1:443",
+			Activity: ActivityConfig{
+				ExecSessions: true,
+				CPUThreshold: 5,
+				Connections:  true,
+				Processes:    true,
+			},
+			Memory: MemoryConfig{
+				HostThreshold: 90,
+				VMThreshold:   90,
+			},
+			Notify: NotifyConfig{
+				LeadTime: 2 * time.Minute,
+			},
 		},
 	}
 }
 
+// Path returns the location of the config file (~/.sili/config.yaml).
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sili", "config.yaml"), nil
+}
+
 // Load reads configuration from ~/.sili/config.yaml.
 // If the file doesn't exist, returns default config without error.
 func Load() (Config, error) {
-	home, err := os.UserHomeDir()
+	configPath, err := Path()
 	if err != nil {
-		return Config{}, fmt.Errorf("failed to get home directory: %w", err)
+		return Config{}, err
 	}
 
-	configPath := filepath.Join(home, ".sili", "config.yaml")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -150,3 +150,91 @@ func TestLoad_InvalidYAML(t *testing.T) {
 		t.Fatal("expected error for invalid YAML, got nil")
 	}
 }
+
+func TestLoad_ActivityConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", oldHome)
+
+	siliDir := filepath.Join(tmpDir, ".sili")
+	if err := os.MkdirAll(siliDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only override some signals; the rest keep their defaults
+	configContent := `autosleep:
+  activity:
+    cpu_threshold: 20
+    connections: false
+`
+	if err := os.WriteFile(filepath.Join(siliDir, "config.yaml"), []byte(configContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	activity := cfg.Autosleep.Activity
+	if activity.CPUThreshold != 20 {
+		t.Errorf("expected cpu threshold 20, got %v", activity.CPUThreshold)
+	}
+	if activity.Connections {
+		t.Error("expected connections disabled")
+	}
+	if !activity.ExecSessions || !activity.Processes {
+		t.Errorf("expected other signals to keep defaults, got %+v", activity)
+	}
+}
+
+func TestLoad_RulesAndSchedules(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", oldHome)
+
+	siliDir := filepath.Join(tmpDir, ".sili")
+	if err := os.MkdirAll(siliDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	configContent := `autosleep:
+  rules:
+    - match: "db-*"
+      idle_timeout: 2h
+    - match: cache
+      persistent: true
+  schedules:
+    - name: workday
+      days: [mon, fri]
+      from: "09:00"
+      to: "18:00"
+      action: keep_awake
+`
+	if err := os.WriteFile(filepath.Join(siliDir, "config.yaml"), []byte(configContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rules := cfg.Autosleep.Rules
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].Match != "db-*" || rules[0].IdleTimeout != 2*time.Hour || rules[0].Persistent != nil {
+		t.Errorf("unexpected first rule: %+v", rules[0])
+	}
+	if rules[1].Persistent == nil || !*rules[1].Persistent {
+		t.Errorf("expected second rule to be persistent, got %+v", rules[1])
+	}
+
+	schedules := cfg.Autosleep.Schedules
+	if len(schedules) != 1 || schedules[0].Action != "keep_awake" || len(schedules[0].Days) != 2 {
+		t.Errorf("unexpected schedules: %+v", schedules)
+	}
+}
@@ -11,6 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/forward"
+	"github.com/coheez/silibox/internal/hostport"
 	"github.com/coheez/silibox/internal/lima"
 	"github.com/coheez/silibox/internal/shim"
 	"github.com/coheez/silibox/internal/stack"
@@ -28,11 +31,20 @@ type CreateConfig struct {
 	DetectAndPrepareVolumes bool     // Auto-detect project stack and create volumes for hot dirs
 	NoMigrate               bool     // Skip migration prompts for existing directories
 	Persistent              bool     // Mark as persistent (never auto-stopped by autosleep)
+	IdleTimeout             time.Duration // Per-env autosleep timeout (0 uses the default)
+	Volumes                 map[string]string // Existing volumes to mount (hot dir -> volume name)
+	TrustCA                 bool              // Add the silibox CA to the container's trust store
+	Network                 string            // Network group to join; empty joins DefaultNetwork
+	Command                 []string          // Replaces the idle `sleep infinity`, or the image's command with ImageCommand
+	ImageCommand            bool              // Run the image's own command and user without the project mount, e.g. for a database
+	Stack                   string            // Stack the environment belongs to, with `sili up`
+	Service                 string            // Service of the stack; also a name the environment is reachable by on its network
+	DependsOn               []string          // Environments of the stack started before this one
 }
 
 // Create pulls the image and starts a named Podman container with proper bind mounts and UID/GID mapping
 func Create(cfg CreateConfig) error {
-	return state.WithLockedState(func(s *state.State) error {
+	err := state.WithLockedState(func(s *state.State) error {
 		// Ensure VM is running
 		vm := s.GetVM()
 		if vm == nil || vm.Status != "running" {
@@ -51,21 +63,29 @@ func Create(cfg CreateConfig) error {
 			return fmt.Errorf("failed to get absolute project path: %w", err)
 		}
 
+		if cfg.Network == "" {
+			cfg.Network = DefaultNetwork
+		}
+		if err := ValidateNetwork(cfg.Network); err != nil {
+			return err
+		}
+
 		// Parse and validate port mappings
 		portMappings, err := ParsePortSpecs(cfg.Ports)
 		if err != nil {
 			return fmt.Errorf("invalid port specification: %w", err)
 		}
 
-		// Check for port conflicts
-		for _, pm := range portMappings {
-			if inUse, envName := s.IsPortInUse(pm.HostPort); inUse {
-				return fmt.Errorf("port %d is already in use by environment %s", pm.HostPort, envName)
-			}
+		// Check for port conflicts and allocate host ports left empty
+		if err := reservePorts(s, cfg.Name, portMappings, hostport.Free); err != nil {
+			return err
 		}
 
 	// Detect project stack and prepare volumes if requested
 	volumes := make(map[string]string)
+	for hotDir, volumeName := range cfg.Volumes {
+		volumes[hotDir] = volumeName
+	}
 	migratedDirs := make(map[string]string) // Track migrations for state
 	
 	if cfg.DetectAndPrepareVolumes {
@@ -146,10 +166,20 @@ func Create(cfg CreateConfig) error {
 			return fmt.Errorf("failed to pull image %s: %w", cfg.Image, err)
 		}
 
+		if err := ensureNetwork(cfg.Network); err != nil {
+			return err
+		}
+
 		// Create the container with volumes and ports
 		if err := createContainer(cfg, uid, gid, volumes, portMappings); err != nil {
 			return err
 		}
+		// The container exists now, so a failure here shouldn't lose it from state
+		if cfg.TrustCA {
+			if err := installCA(cfg.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to add the silibox CA to %s: %v\n", cfg.Name, err)
+			}
+		}
 
 	// Create environment info
 	envInfo := &state.EnvInfo{
@@ -174,6 +204,14 @@ func Create(cfg CreateConfig) error {
 			},
 			Status:        "running",
 			Persistent:    cfg.Persistent,
+			IdleTimeout:   cfg.IdleTimeout,
+			TrustCA:       cfg.TrustCA,
+			Network:       cfg.Network,
+			Stack:         cfg.Stack,
+			Service:       cfg.Service,
+			DependsOn:     cfg.DependsOn,
+			ImageCommand:  cfg.ImageCommand,
+			Command:       cfg.Command,
 			LastActive:    time.Now(),
 			ExportedShims: make([]string, 0),
 			MigratedDirs:  migratedDirs,
@@ -185,6 +223,12 @@ func Create(cfg CreateConfig) error {
 
 		return nil
 	})
+	events.RecordResult(events.EnvCreate, cfg.Name, fmt.Sprintf("image %s", cfg.Image), err)
+	if err != nil {
+		return err
+	}
+	mapExposedPorts(cfg.Name)
+	return nil
 }
 
 func getCurrentUserIDs() (int, int, error) {
@@ -230,32 +274,35 @@ func createContainer(cfg CreateConfig, uid, gid int, volumes map[string]string,
 		"shell", lima.Instance, "--", "podman", "run",
 		"-d", // detached
 		"--name", cfg.Name,
-		"--user", fmt.Sprintf("%d:%d", uid, gid),
 	}
 
-	// CRITICAL: Mount volumes for hot directories FIRST using --mount syntax
-	// The --mount syntax creates the mount point if it doesn't exist
-	// When we mount the project directory at /workspace later, these volume mounts
-	// will take precedence for their specific paths (e.g., /workspace/node_modules)
-	for hotDir, volumeName := range volumes {
-		mountPath := filepath.Join("/workspace", hotDir)
-		// Use --mount instead of -v for better control
-		args = append(args, "--mount", fmt.Sprintf("type=volume,source=%s,destination=%s", volumeName, mountPath))
-	}
+	// Services like databases run as the image's user, and keep their data out of the project
+	if !cfg.ImageCommand {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+
+		// CRITICAL: Mount volumes for hot directories FIRST using --mount syntax
+		// The --mount syntax creates the mount point if it doesn't exist
+		// When we mount the project directory at /workspace later, these volume mounts
+		// will take precedence for their specific paths (e.g., /workspace/node_modules)
+		for hotDir, volumeName := range volumes {
+			mountPath := filepath.Join("/workspace", hotDir)
+			// Use --mount instead of -v for better control
+			args = append(args, "--mount", fmt.Sprintf("type=volume,source=%s,destination=%s", volumeName, mountPath))
+		}
 
-	// Now mount the project directory at /workspace
-	// The volume mounts above will "punch through" and remain visible
-	args = append(args, "-v", fmt.Sprintf("%s:/workspace", projectDir)) // project dir (writable)
+		// Now mount the project directory at /workspace
+		// The volume mounts above will "punch through" and remain visible
+		args = append(args, "-v", fmt.Sprintf("%s:/workspace", projectDir)) // project dir (writable)
+	}
 	args = append(args, "-v", fmt.Sprintf("%s:/home/host:ro", homeDir)) // home dir (read-only)
-	args = append(args, "-w", cfg.WorkingDir)
+	if !cfg.ImageCommand {
+		args = append(args, "-w", cfg.WorkingDir)
+	}
+	args = append(args, networkArgs(cfg.Name, cfg.Network, cfg.Service)...)
 
 	// Add port mappings
 	for _, pm := range portMappings {
-		portSpec := fmt.Sprintf("%d:%d", pm.HostPort, pm.ContainerPort)
-		if pm.Protocol == "udp" {
-			portSpec += "/udp"
-		}
-		args = append(args, "-p", portSpec)
+		args = append(args, "-p", podmanPortSpec(pm))
 	}
 
 	// Add environment variables
@@ -263,8 +310,23 @@ func createContainer(cfg CreateConfig, uid, gid int, volumes map[string]string,
 		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
 	}
 
+	// Node.js ignores the system trust store
+	if cfg.TrustCA {
+		guestPath, err := caGuestPath(homeDir)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-e", "NODE_EXTRA_CA_CERTS="+guestPath)
+	}
+
 	// Add the image and a command to keep it running
-	args = append(args, cfg.Image, "sleep", "infinity")
+	args = append(args, cfg.Image)
+	switch {
+	case len(cfg.Command) > 0:
+		args = append(args, cfg.Command...)
+	case !cfg.ImageCommand:
+		args = append(args, "sleep", "infinity")
+	}
 
 	cmd := exec.Command("limactl", args...)
 	cmd.Stdout = os.Stdout
@@ -289,17 +351,129 @@ func List() ([]string, error) {
 	return names, nil
 }
 
+// Start starts a stopped container, updates state and runs the env's post-start hook
+func Start(name string) error {
+	// A stack service needs the services it depends on
+	if s, err := state.Load(); err == nil {
+		if env := s.GetEnv(name); env != nil && len(env.DependsOn) > 0 {
+			if err := startDependencies(env); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The autosleep agent may be listening on the env's ports to wake it on connect
+	ReleaseHostPorts(name)
+
+	var started *state.EnvInfo
+	err := state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(name)
+		if env == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+
+		cmd := exec.Command("limactl", "shell", lima.Instance, "--", "podman", "start", name)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if strings.Contains(stderr.String(), "no such container") {
+				return fmt.Errorf("container %s not found in Podman - recreate it with 'sili rm --name %s && sili create --name %s --image %s'", name, name, name, env.Image)
+			}
+			return fmt.Errorf("failed to start container: %w (output: %s)", err, strings.TrimSpace(stderr.String()))
+		}
+
+		s.UpdateEnvStatus(name, "running")
+		s.TouchEnvActivity(name)
+		s.TouchVMActivity()
+		started = env
+		return nil
+	})
+	events.RecordResult(events.EnvStart, name, "", err)
+	if err != nil {
+		return err
+	}
+	startProxiedPorts(started)
+
+	// The hook runs outside the state lock; a failing hook doesn't undo the start
+	if m := projectManifest(started); m != nil && m.Hooks.PostStart != nil {
+		runHook(name, HookPostStart, m.Hooks.PostStart)
+	}
+	return nil
+}
+
+// Touch resets an env's idle timer so autosleep leaves it running
+func Touch(name, reason string) error {
+	err := state.WithLockedState(func(s *state.State) error {
+		if s.GetEnv(name) == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+		s.TouchEnvActivity(name)
+		s.TouchVMActivity()
+		return nil
+	})
+	events.RecordResult(events.EnvTouch, name, reason, err)
+	return err
+}
+
+// graceSeconds rounds a grace period up to whole seconds for podman stop -t
+func graceSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// StopOptions configures how a container is stopped
+type StopOptions struct {
+	Grace time.Duration // Time podman waits after SIGTERM before killing; 0 uses the manifest's stop_grace, then podman's default
+}
+
 // Stop stops a named container and updates state
 func Stop(name string) error {
-	return state.WithLockedState(func(s *state.State) error {
-		// Check if environment exists in state
+	return StopWithOptions(name, StopOptions{})
+}
+
+// StopWithOptions runs the env's pre-stop hook, stops the container and updates state
+// Stops are serialized across processes, so a stop waits for a pre-stop hook already in progress
+func StopWithOptions(name string, opts StopOptions) error {
+	lock, err := lockStops()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	st, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	env := st.GetEnv(name)
+	if env == nil {
+		err := fmt.Errorf("environment %s not found in state", name)
+		events.RecordResult(events.EnvStop, name, "", err)
+		return err
+	}
+
+	// The hook runs outside the state lock; it may take a while
+	m := projectManifest(env)
+	if m != nil && m.Hooks.PreStop != nil && env.Status == "running" {
+		runHook(name, HookPreStop, m.Hooks.PreStop)
+	}
+
+	grace := opts.Grace
+	if grace == 0 && m != nil {
+		grace = m.StopGrace
+	}
+
+	err = state.WithLockedState(func(s *state.State) error {
+		// Check if environment still exists in state
 		env := s.GetEnv(name)
 		if env == nil {
 			return fmt.Errorf("environment %s not found in state", name)
 		}
 
 		// Stop the container
-		cmd := exec.Command("limactl", "shell", lima.Instance, "--", "podman", "stop", name)
+		args := []string{"shell", lima.Instance, "--", "podman", "stop"}
+		if grace > 0 {
+			args = append(args, "-t", strconv.Itoa(graceSeconds(grace)))
+		}
+		cmd := exec.Command("limactl", append(args, name)...)
 		var stderr bytes.Buffer
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = &stderr
@@ -308,6 +482,7 @@ func Stop(name string) error {
 			if strings.Contains(stderr.String(), "no such container") {
 				// Container doesn't exist but is in state - update state as stopped
 				fmt.Fprintf(os.Stderr, "Warning: container %s not found in Podman, updating state\n", name)
+				forward.StopAll(s, env, true)
 				s.UpdateEnvStatus(name, "stopped")
 				s.TouchVMActivity()
 				return nil
@@ -315,17 +490,22 @@ func Stop(name string) error {
 			return fmt.Errorf("failed to stop container: %w", err)
 		}
 
+		// Automatic forwards end with the processes listening on them
+		forward.StopAll(s, env, true)
+
 		// Update state
 		s.UpdateEnvStatus(name, "stopped")
 		s.TouchVMActivity()
 
 		return nil
 	})
+	events.RecordResult(events.EnvStop, name, "", err)
+	return err
 }
 
 // Remove removes a named container and cleans up state
 func Remove(name string, force bool) error {
-	return state.WithLockedState(func(s *state.State) error {
+	err := state.WithLockedState(func(s *state.State) error {
 		// Check if environment exists in state
 		env := s.GetEnv(name)
 		if env == nil {
@@ -369,11 +549,14 @@ func Remove(name string, force bool) error {
 		}
 
 		// Remove from state (this also releases ports)
+		forward.StopAll(s, env, true)
 		s.RemoveEnv(name)
 		s.TouchVMActivity()
 
 		return nil
 	})
+	events.RecordResult(events.EnvRemove, name, "", err)
+	return err
 }
 
 // Exec runs a command in a named container
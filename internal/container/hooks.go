@@ -0,0 +1,105 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/gofrs/flock"
+)
+
+// Hook names as used in silibox.yaml
+const (
+	HookPreStop   = "pre_stop"
+	HookPostStart = "post_start"
+)
+
+// stopLockFile serializes stops across processes so a VM stop waits for pre-stop hooks
+// another process (e.g. the autosleep agent) is still running
+const stopLockFile = "stop.lock"
+
+// hookExec runs command with sh -c in the container; replaced in tests
+var hookExec = func(ctx context.Context, name, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "limactl", "shell", lima.Instance, "--", "podman", "exec", name, "sh", "-c", command)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
+
+// projectManifest loads an env's project manifest, scoped to its service in a stack,
+// warning about a broken one
+func projectManifest(env *state.EnvInfo) *manifest.Manifest {
+	m, err := manifest.ForProject(env.ProjectPath, env.Service)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring %v\n", err)
+		return nil
+	}
+	return m
+}
+
+// runHook runs a lifecycle hook in the container and records the outcome
+// A failing or timed-out hook is reported but never blocks the stop or start
+func runHook(env, kind string, hook *manifest.Hook) error {
+	timeout := hook.EffectiveTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "🪝 Running %s hook for '%s': %s\n", kind, env, hook.Command)
+	start := time.Now()
+	out, err := hookExec(ctx, env, hook.Command)
+	took := time.Since(start).Round(100 * time.Millisecond)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s hook timed out after %s", kind, timeout)
+	} else if err != nil {
+		err = fmt.Errorf("%s hook failed: %w", kind, err)
+		if out != "" {
+			err = fmt.Errorf("%w (output: %s)", err, out)
+		}
+	}
+
+	events.RecordResult(events.EnvHook, env, fmt.Sprintf("%s: %s (took %s)", kind, hook.Command, took), err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "   ⚠️  %v\n", err)
+	}
+	return err
+}
+
+// LockStops waits for stops in progress in any process and holds off new ones until unlock
+// is called; the VM is stopped under this lock so no pre-stop hook is cut short
+func LockStops() (func(), error) {
+	lock, err := lockStops()
+	if err != nil {
+		return nil, err
+	}
+	return func() { lock.Unlock() }, nil
+}
+
+// lockStops takes the cross-process stop lock
+func lockStops() (*flock.Flock, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dir := filepath.Join(home, state.StateDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	lock := flock.New(filepath.Join(dir, stopLockFile))
+	if err := lock.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to acquire stop lock: %w", err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,81 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/manifest"
+)
+
+func TestRunHook(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		exec    func(ctx context.Context, name, command string) (string, error)
+		timeout time.Duration
+		wantErr string
+	}{
+		{
+			name: "success",
+			exec: func(ctx context.Context, name, command string) (string, error) {
+				return "flushed", nil
+			},
+		},
+		{
+			name: "failure includes output",
+			exec: func(ctx context.Context, name, command string) (string, error) {
+				return "pg_ctl: not running", errors.New("exit status 1")
+			},
+			wantErr: "pg_ctl: not running",
+		},
+		{
+			name: "timeout",
+			exec: func(ctx context.Context, name, command string) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+			timeout: 10 * time.Millisecond,
+			wantErr: "timed out after 10ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := hookExec
+			hookExec = tt.exec
+			defer func() { hookExec = old }()
+
+			err := runHook("db", HookPreStop, &manifest.Hook{Command: "pg_ctl stop", Timeout: tt.timeout})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("runHook() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("runHook() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGraceSeconds(t *testing.T) {
+	tests := []struct {
+		grace time.Duration
+		want  int
+	}{
+		{30 * time.Second, 30},
+		{1500 * time.Millisecond, 2},
+		{time.Millisecond, 1},
+		{2 * time.Minute, 120},
+	}
+	for _, tt := range tests {
+		if got := graceSeconds(tt.grace); got != tt.want {
+			t.Errorf("graceSeconds(%s) = %d, want %d", tt.grace, got, tt.want)
+		}
+	}
+}
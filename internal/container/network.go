@@ -0,0 +1,129 @@
+package container
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// DefaultNetwork is the network group environments join unless created with --network
+const DefaultNetwork = "default"
+
+// networkGroupPattern keeps group names valid in Podman network names
+var networkGroupPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+// ValidateNetwork checks a network group name
+func ValidateNetwork(group string) error {
+	if !networkGroupPattern.MatchString(group) {
+		return fmt.Errorf("invalid network %q: use up to 32 lowercase letters, digits and inner hyphens", group)
+	}
+	return nil
+}
+
+// NetworkName is the Podman network of a network group
+func NetworkName(group string) string {
+	if group == "" || group == DefaultNetwork {
+		return "silibox"
+	}
+	return "silibox-" + group
+}
+
+// Peers lists the other environments on name's network group, which it reaches by name
+func Peers(s *state.State, name string) []string {
+	env := s.GetEnv(name)
+	if env == nil || env.Network == "" {
+		return nil
+	}
+	var peers []string
+	for _, other := range s.Envs {
+		if other.Name != name && other.Network == env.Network {
+			peers = append(peers, other.Name)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// networkArgs are the podman run flags that attach a container to group's network,
+// resolvable by its env name, and its service name in a stack, from the other containers there
+func networkArgs(name, group, service string) []string {
+	args := []string{"--network", NetworkName(group), "--network-alias", name}
+	if service != "" && service != name {
+		args = append(args, "--network-alias", service)
+	}
+	return args
+}
+
+// ensureNetwork creates the Podman network of group if it doesn't exist yet
+// User-defined networks get Podman's DNS, which the default network lacks
+func ensureNetwork(group string) error {
+	network := NetworkName(group)
+	if exec.Command("limactl", "shell", lima.Instance, "--", "podman", "network", "exists", network).Run() == nil {
+		return nil
+	}
+	cmd := exec.Command("limactl", "shell", lima.Instance, "--",
+		"podman", "network", "create", "--label", "io.silibox.group="+group, network)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create network %s: %w (output: %s)", network, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Connect moves an environment to a network group, where the other environments reach
+// it by name. It returns the group the environment was on, if any
+// Containers created before silibox managed networks may use rootless networking that
+// Podman can't attach to a network; those need to be recreated
+func Connect(name, group string) (string, error) {
+	if group == "" {
+		group = DefaultNetwork
+	}
+	if err := ValidateNetwork(group); err != nil {
+		return "", err
+	}
+
+	var previous string
+	err := state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(name)
+		if env == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+		previous = env.Network
+		if previous == group {
+			return nil
+		}
+		if err := ensureNetwork(group); err != nil {
+			return err
+		}
+
+		// Join the new network before leaving the old one, so the container never
+		// loses outbound connectivity
+		args := []string{"shell", lima.Instance, "--", "podman", "network", "connect", "--alias", name}
+		if env.Service != "" {
+			args = append(args, "--alias", env.Service)
+		}
+		cmd := exec.Command("limactl", append(args, NetworkName(group), name)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to connect to %s: %w (output: %s); recreate the environment if it predates silibox networks",
+				NetworkName(group), err, strings.TrimSpace(string(output)))
+		}
+		if previous != "" {
+			cmd := exec.Command("limactl", "shell", lima.Instance, "--",
+				"podman", "network", "disconnect", NetworkName(previous), name)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to disconnect from %s: %w (output: %s)",
+					NetworkName(previous), err, strings.TrimSpace(string(output)))
+			}
+		}
+		env.Network = group
+		return nil
+	})
+	events.RecordResult(events.EnvConnect, name, "network "+group, err)
+	return previous, err
+}
@@ -0,0 +1,72 @@
+package container
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+func TestValidateNetwork(t *testing.T) {
+	tests := []struct {
+		group   string
+		wantErr bool
+	}{
+		{"default", false},
+		{"backend", false},
+		{"team-a2", false},
+		{"", true},
+		{"Backend", true},
+		{"-backend", true},
+		{"backend-", true},
+		{"back_end", true},
+		{"a23456789012345678901234567890123", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateNetwork(tt.group); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateNetwork(%q) error = %v, wantErr %v", tt.group, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNetworkName(t *testing.T) {
+	tests := map[string]string{
+		"":        "silibox",
+		"default": "silibox",
+		"backend": "silibox-backend",
+	}
+	for group, want := range tests {
+		if got := NetworkName(group); got != want {
+			t.Errorf("NetworkName(%q) = %q, want %q", group, got, want)
+		}
+	}
+}
+
+func TestPeers(t *testing.T) {
+	s := state.NewState()
+	for name, network := range map[string]string{
+		"api":    "default",
+		"db":     "default",
+		"web":    "default",
+		"vault":  "secure",
+		"legacy": "",
+		"old":    "",
+	} {
+		s.UpsertEnv(&state.EnvInfo{Name: name, Network: network})
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"api", []string{"db", "web"}},
+		{"vault", nil},
+		{"legacy", nil}, // Envs off silibox networks don't reach each other by name
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := Peers(s, tt.name); !slices.Equal(got, tt.want) {
+			t.Errorf("Peers(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,76 +2,182 @@ package container
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/forward"
+	"github.com/coheez/silibox/internal/hostport"
 	"github.com/coheez/silibox/internal/state"
 )
 
-// parsePortSpec parses a port specification string into a PortMapping
+// maxRangeSize bounds how many mappings a single port range expands to
+const maxRangeSize = 1000
+
+// portRange is a parsed port specification before ranges are expanded
+type portRange struct {
+	hostIP         string
+	hostStart      int // 0 when host ports are allocated from the ephemeral range
+	hostEnd        int
+	containerStart int
+	containerEnd   int
+	protocol       string
+}
+
+// mappings expands the range into one mapping per port
+func (r portRange) mappings() []state.PortMapping {
+	mappings := make([]state.PortMapping, 0, r.containerEnd-r.containerStart+1)
+	for i := 0; i <= r.containerEnd-r.containerStart; i++ {
+		pm := state.PortMapping{
+			HostIP:        r.hostIP,
+			ContainerPort: r.containerStart + i,
+			Protocol:      r.protocol,
+		}
+		if r.hostStart > 0 {
+			pm.HostPort = r.hostStart + i
+		}
+		mappings = append(mappings, pm)
+	}
+	return mappings
+}
+
+// parsePortRange parses a port specification, compatible with docker run -p
 // Supported formats:
 //   - "3000" -> host port 3000, container port 3000, tcp
 //   - "8080:80" -> host port 8080, container port 80, tcp
-//   - "8080:80/tcp" -> host port 8080, container port 80, tcp
-//   - "8080:80/udp" -> host port 8080, container port 80, udp
-func parsePortSpec(spec string) (state.PortMapping, error) {
+//   - ":3000" -> next free ephemeral host port, container port 3000
+//   - "8000-8010:8000-8010" or "8000-8010" -> one mapping per port of the range
+//   - "127.0.0.1:8080:80", "0.0.0.0::80" or "[::1]:8080:80" -> bound to a host address
+//   - any of the above with "/tcp" or "/udp"
+func parsePortRange(spec string) (portRange, error) {
 	// Default protocol is tcp
-	protocol := "tcp"
+	r := portRange{protocol: "tcp"}
 	portPart := spec
 
 	// Check for protocol suffix
 	if strings.Contains(spec, "/") {
 		parts := strings.Split(spec, "/")
 		if len(parts) != 2 {
-			return state.PortMapping{}, fmt.Errorf("invalid port spec format: %s", spec)
+			return portRange{}, fmt.Errorf("invalid port spec format: %s", spec)
 		}
 		portPart = parts[0]
-		protocol = strings.ToLower(parts[1])
-		if protocol != "tcp" && protocol != "udp" {
-			return state.PortMapping{}, fmt.Errorf("invalid protocol %s (must be tcp or udp)", protocol)
+		r.protocol = strings.ToLower(parts[1])
+		if r.protocol != "tcp" && r.protocol != "udp" {
+			return portRange{}, fmt.Errorf("invalid protocol %s (must be tcp or udp)", r.protocol)
 		}
 	}
 
-	// Parse port mapping
-	var hostPort, containerPort int
-	var err error
+	// An IPv6 host address is bracketed: [::1]:8080:80
+	if strings.HasPrefix(portPart, "[") {
+		end := strings.Index(portPart, "]:")
+		if end < 0 {
+			return portRange{}, fmt.Errorf("invalid port mapping format: %s", portPart)
+		}
+		r.hostIP = portPart[1:end]
+		portPart = portPart[end+2:]
+		if !strings.Contains(portPart, ":") {
+			return portRange{}, fmt.Errorf("invalid port mapping format: %s (missing container port)", spec)
+		}
+	}
 
-	if strings.Contains(portPart, ":") {
-		// Format: host:container
-		parts := strings.Split(portPart, ":")
-		if len(parts) != 2 {
-			return state.PortMapping{}, fmt.Errorf("invalid port mapping format: %s", portPart)
+	var hostPart, containerPart string
+	parts := strings.Split(portPart, ":")
+	switch len(parts) {
+	case 1:
+		// Format: same port on both sides
+		hostPart, containerPart = parts[0], parts[0]
+	case 2:
+		// Format: host:container, with an empty host for an allocated port
+		hostPart, containerPart = parts[0], parts[1]
+	case 3:
+		// Format: ip:host:container
+		if r.hostIP != "" {
+			return portRange{}, fmt.Errorf("invalid port mapping format: %s", portPart)
 		}
-		hostPort, err = strconv.Atoi(parts[0])
-		if err != nil {
-			return state.PortMapping{}, fmt.Errorf("invalid host port %s: %w", parts[0], err)
+		r.hostIP, hostPart, containerPart = parts[0], parts[1], parts[2]
+	default:
+		return portRange{}, fmt.Errorf("invalid port mapping format: %s", portPart)
+	}
+
+	if r.hostIP != "" {
+		if err := validateHostIP(r.hostIP); err != nil {
+			return portRange{}, err
 		}
-		containerPort, err = strconv.Atoi(parts[1])
+	}
+
+	var err error
+	r.containerStart, r.containerEnd, err = parseRange(containerPart)
+	if err != nil {
+		return portRange{}, fmt.Errorf("invalid container port %s: %w", containerPart, err)
+	}
+	if hostPart != "" {
+		r.hostStart, r.hostEnd, err = parseRange(hostPart)
 		if err != nil {
-			return state.PortMapping{}, fmt.Errorf("invalid container port %s: %w", parts[1], err)
+			return portRange{}, fmt.Errorf("invalid host port %s: %w", hostPart, err)
 		}
-	} else {
-		// Format: same port on both sides
-		hostPort, err = strconv.Atoi(portPart)
-		if err != nil {
-			return state.PortMapping{}, fmt.Errorf("invalid port %s: %w", portPart, err)
+		if r.hostEnd-r.hostStart != r.containerEnd-r.containerStart {
+			return portRange{}, fmt.Errorf("host range %s and container range %s must have the same size", hostPart, containerPart)
 		}
-		containerPort = hostPort
 	}
 
-	// Validate port ranges
-	if err := validatePort(hostPort); err != nil {
-		return state.PortMapping{}, fmt.Errorf("invalid host port: %w", err)
+	if size := r.containerEnd - r.containerStart + 1; size > maxRangeSize {
+		return portRange{}, fmt.Errorf("port range %s has %d ports; at most %d are supported", containerPart, size, maxRangeSize)
+	}
+	return r, nil
+}
+
+// parseRange parses "8000" or "8000-8010"
+func parseRange(s string) (int, int, error) {
+	startStr, endStr, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := validatePort(start); err != nil {
+		return 0, 0, err
 	}
-	if err := validatePort(containerPort); err != nil {
-		return state.PortMapping{}, fmt.Errorf("invalid container port: %w", err)
+	if !isRange {
+		return start, start, nil
 	}
+	end, err := strconv.Atoi(endStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := validatePort(end); err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("range %s ends before it starts", s)
+	}
+	return start, end, nil
+}
+
+// validateHostIP accepts the addresses Lima can forward from the VM to the host:
+// loopback, which stays on this machine, and all interfaces
+func validateHostIP(ip string) error {
+	switch ip {
+	case "127.0.0.1", "0.0.0.0", "::1", "::":
+		return nil
+	}
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid host IP %s", ip)
+	}
+	return fmt.Errorf("host IP %s isn't supported: ports can be bound to 127.0.0.1 or ::1 (this machine only) or 0.0.0.0 or :: (all interfaces)", ip)
+}
 
-	return state.PortMapping{
-		HostPort:      hostPort,
-		ContainerPort: containerPort,
-		Protocol:      protocol,
-	}, nil
+// parsePortSpec parses a port specification that maps a single port
+func parsePortSpec(spec string) (state.PortMapping, error) {
+	r, err := parsePortRange(spec)
+	if err != nil {
+		return state.PortMapping{}, err
+	}
+	if r.containerEnd != r.containerStart {
+		return state.PortMapping{}, fmt.Errorf("port spec %s is a range; expected a single port", spec)
+	}
+	return r.mappings()[0], nil
 }
 
 // validatePort checks if a port number is in valid range (1-65535)
@@ -82,15 +188,287 @@ func validatePort(port int) error {
 	return nil
 }
 
-// ParsePortSpecs parses multiple port specifications
+// ParsePortSpecs parses multiple port specifications, expanding ranges
+// Specs whose host ports overlap are rejected
 func ParsePortSpecs(specs []string) ([]state.PortMapping, error) {
 	mappings := make([]state.PortMapping, 0, len(specs))
+	seen := make(map[string]string) // "port/protocol" -> spec mapping it
 	for _, spec := range specs {
-		pm, err := parsePortSpec(spec)
+		r, err := parsePortRange(spec)
 		if err != nil {
 			return nil, err
 		}
-		mappings = append(mappings, pm)
+		for _, pm := range r.mappings() {
+			if pm.HostPort != 0 {
+				key := fmt.Sprintf("%d/%s", pm.HostPort, pm.Protocol)
+				if other, ok := seen[key]; ok {
+					return nil, fmt.Errorf("port specs %s and %s overlap on host port %s", other, spec, key)
+				}
+				seen[key] = spec
+			}
+			mappings = append(mappings, pm)
+		}
 	}
 	return mappings, nil
 }
+
+// PortConflictError reports a host port that is already taken, with a free one to use instead
+type PortConflictError struct {
+	Mapping   state.PortMapping
+	Owner     string // What holds the port, e.g. "environment db" or "postgres (pid 812)"
+	Reserved  bool   // Owner reserved the port rather than mapping it
+	Suggested int    // Free host port from the ephemeral range, 0 if none is left
+}
+
+func (e *PortConflictError) Error() string {
+	verb := "in use"
+	if e.Reserved {
+		verb = "reserved"
+	}
+	msg := fmt.Sprintf("host port %d is already %s by %s", e.Mapping.HostPort, verb, e.Owner)
+	if e.Suggested == 0 {
+		return msg
+	}
+	pm := e.Mapping
+	pm.HostPort = e.Suggested
+	return fmt.Sprintf("%s; use %s to map container port %d to a free port instead", msg, portSpec(pm), pm.ContainerPort)
+}
+
+// portSpec formats a mapping the way it is written on the command line
+func portSpec(pm state.PortMapping) string {
+	spec := fmt.Sprintf("%d:%d", pm.HostPort, pm.ContainerPort)
+	if strings.Contains(pm.HostIP, ":") {
+		spec = "[" + pm.HostIP + "]:" + spec
+	} else if pm.HostIP != "" {
+		spec = pm.HostIP + ":" + spec
+	}
+	if pm.Protocol == "udp" {
+		spec += "/udp"
+	}
+	return spec
+}
+
+// checkHostPorts is the pre-flight check of new mappings' explicit host ports, run
+// before anything is pulled or created: the ports must not be mapped or reserved by
+// another environment, nor used by a process on the host
+func checkHostPorts(s *state.State, name string, mappings []state.PortMapping, hostFree func(port int, protocol string) bool) error {
+	for _, pm := range mappings {
+		if pm.HostPort == 0 {
+			continue
+		}
+		conflict := &PortConflictError{Mapping: pm}
+		if inUse, envName := s.IsPortInUse(pm.HostPort); inUse {
+			conflict.Owner = "environment " + envName
+		} else if owner := s.ReservedBy(pm.HostPort); owner != "" && owner != name {
+			conflict.Owner, conflict.Reserved = "environment "+owner, true
+		} else if owner != name && hostFree != nil && !hostFree(pm.HostPort, pm.Protocol) {
+			conflict.Owner = hostport.Owner(pm.HostPort, pm.Protocol)
+			if conflict.Owner == "" {
+				conflict.Owner = "another process on the host"
+			}
+		} else {
+			continue
+		}
+		conflict.Suggested = s.SuggestPort(protocolFree(hostFree, pm.Protocol))
+		return conflict
+	}
+	return nil
+}
+
+// protocolFree adapts hostFree to the state's port allocator for one protocol
+func protocolFree(hostFree func(port int, protocol string) bool, protocol string) func(int) bool {
+	if hostFree == nil {
+		return nil
+	}
+	return func(port int) bool { return hostFree(port, protocol) }
+}
+
+// reservePorts reserves the host ports of new mappings for env name
+// Explicit host ports must pass checkHostPorts; mappings without a host port get the
+// next free ephemeral port
+func reservePorts(s *state.State, name string, mappings []state.PortMapping, hostFree func(port int, protocol string) bool) error {
+	if err := checkHostPorts(s, name, mappings, hostFree); err != nil {
+		return err
+	}
+	// Explicit ports first, so none of them is handed out below
+	for _, pm := range mappings {
+		if pm.HostPort == 0 || s.ReservedBy(pm.HostPort) == name {
+			continue
+		}
+		if _, err := s.ReservePort(name, pm.HostPort); err != nil {
+			return err
+		}
+	}
+	for i, pm := range mappings {
+		if pm.HostPort != 0 {
+			continue
+		}
+		port, err := s.AllocatePort(name, protocolFree(hostFree, pm.Protocol))
+		if err != nil {
+			return err
+		}
+		mappings[i].HostPort = port
+	}
+	return nil
+}
+
+// ReleaseHostPorts asks the autosleep agent to close the wake-on-connect listeners on
+// env's host ports, or every env's for "", before the env or the VM starts, so Lima's
+// port forwarder can bind them. The CLI points it at the agent's control socket
+var ReleaseHostPorts = func(env string) {}
+
+// podmanPortSpec formats a mapping for podman run -p
+// Mappings without a host IP bind to the VM's loopback, which Lima forwards to the
+// host's loopback only
+func podmanPortSpec(pm state.PortMapping) string {
+	hostIP := pm.HostIP
+	if hostIP == "" {
+		hostIP = "127.0.0.1"
+	}
+	if strings.Contains(hostIP, ":") {
+		hostIP = "[" + hostIP + "]"
+	}
+	spec := fmt.Sprintf("%s:%d:%d", hostIP, pm.HostPort, pm.ContainerPort)
+	if pm.Protocol == "udp" {
+		spec += "/udp"
+	}
+	return spec
+}
+
+// AddPort maps more ports on an existing environment
+// Podman can't publish ports on a created container, so the ports are proxied into the
+// container's network namespace while the environment runs instead; recreating the
+// environment would lose everything installed in it
+func AddPort(name, spec string) ([]state.PortMapping, error) {
+	var added []state.PortMapping
+	err := state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(name)
+		if env == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+		mappings, replaced, err := planAddPort(s, env, spec, hostport.Free)
+		if err != nil {
+			return err
+		}
+
+		if env.Status == "running" {
+			for _, r := range replaced {
+				if err := forward.Stop(r.HostPort); err != nil {
+					return fmt.Errorf("failed to stop the automatic forward of port %d: %w", r.ContainerPort, err)
+				}
+			}
+			for i, pm := range mappings {
+				if err := forward.Start(name, pm); err != nil {
+					for _, started := range mappings[:i] {
+						forward.Stop(started.HostPort)
+					}
+					return fmt.Errorf("failed to forward port %d: %w", pm.ContainerPort, err)
+				}
+			}
+		}
+		env.Ports = append(env.Ports, mappings...)
+		added = mappings
+		return nil
+	})
+	events.RecordResult(events.EnvPortAdd, name, spec, err)
+	return added, err
+}
+
+// planAddPort validates spec against env's mappings, other environments and the host,
+// and reserves host ports for it
+// It returns the mappings to add and the automatic forwards of the same container ports
+// they replace, which are dropped from env
+func planAddPort(s *state.State, env *state.EnvInfo, spec string, hostFree func(port int, protocol string) bool) ([]state.PortMapping, []state.PortMapping, error) {
+	mappings, err := ParsePortSpecs([]string{spec})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var replaced []state.PortMapping
+	for i, pm := range mappings {
+		if pm.Protocol == "udp" {
+			return nil, nil, fmt.Errorf("only tcp ports can be added to an existing environment; declare udp ports with 'sili create --ports'")
+		}
+		for _, p := range env.Ports {
+			if p.Protocol == "udp" || p.ContainerPort != pm.ContainerPort {
+				continue
+			}
+			if !p.Auto {
+				return nil, nil, fmt.Errorf("container port %d of %s is already mapped to host port %d", pm.ContainerPort, env.Name, p.HostPort)
+			}
+			replaced = append(replaced, p)
+		}
+		mappings[i].Proxied = true
+	}
+	// Automatic forwards give their host ports up to the new mappings
+	forward.Drop(s, env, replaced)
+
+	// The replaced forwards still listen on their ports until AddPort stops them
+	free := func(port int, protocol string) bool {
+		return slices.ContainsFunc(replaced, func(r state.PortMapping) bool { return r.HostPort == port }) || hostFree(port, protocol)
+	}
+	if err := reservePorts(s, env.Name, mappings, free); err != nil {
+		return nil, nil, err
+	}
+	return mappings, replaced, nil
+}
+
+// RemovePort unmaps a port added with AddPort
+// port is matched against host ports first, then container ports
+func RemovePort(name string, port int) (state.PortMapping, error) {
+	var removed state.PortMapping
+	err := state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(name)
+		if env == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+		i, err := findRemovablePort(env, port)
+		if err != nil {
+			return err
+		}
+		pm := env.Ports[i]
+
+		if env.Status == "running" {
+			if err := forward.Stop(pm.HostPort); err != nil {
+				return fmt.Errorf("failed to stop forwarding port %d: %w", pm.HostPort, err)
+			}
+		}
+		env.Ports = append(env.Ports[:i:i], env.Ports[i+1:]...)
+		s.ReleasePort(name, pm.HostPort)
+		removed = pm
+		return nil
+	})
+	events.RecordResult(events.EnvPortRemove, name, strconv.Itoa(port), err)
+	return removed, err
+}
+
+// findRemovablePort returns the index of the mapping port refers to
+func findRemovablePort(env *state.EnvInfo, port int) (int, error) {
+	i := slices.IndexFunc(env.Ports, func(p state.PortMapping) bool { return p.HostPort == port })
+	if i < 0 {
+		i = slices.IndexFunc(env.Ports, func(p state.PortMapping) bool { return p.ContainerPort == port })
+	}
+	if i < 0 {
+		return -1, fmt.Errorf("environment %s has no mapping for port %d", env.Name, port)
+	}
+
+	switch pm := env.Ports[i]; {
+	case pm.Auto:
+		return -1, fmt.Errorf("port %d is forwarded automatically and goes away once nothing in %s listens on it", port, env.Name)
+	case !pm.Proxied:
+		return -1, fmt.Errorf("port %d was published by podman when %s was created and can't be removed; recreate the environment without it", port, env.Name)
+	}
+	return i, nil
+}
+
+// startProxiedPorts forwards the ports added with AddPort after the container starts
+func startProxiedPorts(env *state.EnvInfo) {
+	for _, p := range env.Ports {
+		if !p.Proxied {
+			continue
+		}
+		if err := forward.Start(env.Name, p); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to forward port %d of '%s': %v\n", p.ContainerPort, env.Name, err)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package container
 
 import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/coheez/silibox/internal/manifest"
 	"github.com/coheez/silibox/internal/state"
 )
 
@@ -208,3 +213,275 @@ func TestParsePortSpecs(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanAddPort(t *testing.T) {
+	setup := func() (*state.State, *state.EnvInfo) {
+		s := state.NewState()
+		web := &state.EnvInfo{Name: "web", Ports: []state.PortMapping{
+			{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+			{HostPort: 5173, ContainerPort: 5173, Protocol: "tcp", Auto: true},
+		}}
+		s.UpsertEnv(web)
+		s.UpsertEnv(&state.EnvInfo{Name: "api", Ports: []state.PortMapping{{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"}}})
+		s.Ports.Reserved["web"] = []int{5173}
+		s.Ports.Reserved["db"] = []int{5432}
+		return s, web
+	}
+	hostFree := func(port int, _ string) bool { return port != 9000 && port != 51000 && port != 5173 }
+
+	tests := []struct {
+		name         string
+		spec         string
+		want         []state.PortMapping
+		wantReplaced bool
+		wantErr      bool
+	}{
+		{"new port", "4000", []state.PortMapping{{HostPort: 4000, ContainerPort: 4000, Protocol: "tcp", Proxied: true}}, false, false},
+		{"different host port", "4001:4000", []state.PortMapping{{HostPort: 4001, ContainerPort: 4000, Protocol: "tcp", Proxied: true}}, false, false},
+		{"allocated host port", ":4000", []state.PortMapping{{HostPort: 51001, ContainerPort: 4000, Protocol: "tcp", Proxied: true}}, false, false},
+		{"range", "4000-4001", []state.PortMapping{
+			{HostPort: 4000, ContainerPort: 4000, Protocol: "tcp", Proxied: true},
+			{HostPort: 4001, ContainerPort: 4001, Protocol: "tcp", Proxied: true},
+		}, false, false},
+		{"host IP", "0.0.0.0:4000:4000", []state.PortMapping{{HostIP: "0.0.0.0", HostPort: 4000, ContainerPort: 4000, Protocol: "tcp", Proxied: true}}, false, false},
+		{"replaces automatic forward", "5173", []state.PortMapping{{HostPort: 5173, ContainerPort: 5173, Protocol: "tcp", Proxied: true}}, true, false},
+		{"container port already mapped", "8081:80", nil, false, true},
+		{"host port of another env", "3000:4000", nil, false, true},
+		{"host port reserved", "5432", nil, false, true},
+		{"host port busy on the host", "9000", nil, false, true},
+		{"udp", "5353:53/udp", nil, false, true},
+		{"invalid spec", "nope", nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, web := setup()
+			got, replaced, err := planAddPort(s, web, tt.spec, hostFree)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("planAddPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planAddPort() = %+v, want %+v", got, tt.want)
+			}
+			if (len(replaced) > 0) != tt.wantReplaced {
+				t.Errorf("planAddPort() replaced = %+v, want replaced %v", replaced, tt.wantReplaced)
+			}
+			for _, pm := range got {
+				if s.ReservedBy(pm.HostPort) != "web" {
+					t.Errorf("host port %d not reserved for web", pm.HostPort)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePortSpecs_Docker(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    []state.PortMapping
+		wantErr bool
+	}{
+		{"allocated host port", []string{":3000"}, []state.PortMapping{{ContainerPort: 3000, Protocol: "tcp"}}, false},
+		{"range", []string{"8000-8002:9000-9002/udp"}, []state.PortMapping{
+			{HostPort: 8000, ContainerPort: 9000, Protocol: "udp"},
+			{HostPort: 8001, ContainerPort: 9001, Protocol: "udp"},
+			{HostPort: 8002, ContainerPort: 9002, Protocol: "udp"},
+		}, false},
+		{"range on both sides", []string{"8000-8001"}, []state.PortMapping{
+			{HostPort: 8000, ContainerPort: 8000, Protocol: "tcp"},
+			{HostPort: 8001, ContainerPort: 8001, Protocol: "tcp"},
+		}, false},
+		{"allocated range", []string{":8000-8001"}, []state.PortMapping{
+			{ContainerPort: 8000, Protocol: "tcp"},
+			{ContainerPort: 8001, Protocol: "tcp"},
+		}, false},
+		{"host IP", []string{"127.0.0.1:8080:80"}, []state.PortMapping{{HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}, false},
+		{"host IP with allocated port", []string{"0.0.0.0::80"}, []state.PortMapping{{HostIP: "0.0.0.0", ContainerPort: 80, Protocol: "tcp"}}, false},
+		{"IPv6 host IP", []string{"[::1]:8080:80"}, []state.PortMapping{{HostIP: "::1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}, false},
+		{"same port for tcp and udp", []string{"53/tcp", "53/udp"}, []state.PortMapping{
+			{HostPort: 53, ContainerPort: 53, Protocol: "tcp"},
+			{HostPort: 53, ContainerPort: 53, Protocol: "udp"},
+		}, false},
+		{"overlapping ranges", []string{"8000-8010", "8005-8020:9005-9020"}, nil, true},
+		{"duplicate port", []string{"3000", "3000:4000"}, nil, true},
+		{"range sizes differ", []string{"8000-8010:9000-9005"}, nil, true},
+		{"reversed range", []string{"8010-8000"}, nil, true},
+		{"range too large", []string{"1-5000"}, nil, true},
+		{"unsupported host IP", []string{"192.168.1.5:8080:80"}, nil, true},
+		{"invalid host IP", []string{"localhost:8080:80"}, nil, true},
+		{"IPv6 without container port", []string{"[::1]:8080"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePortSpecs(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortSpecs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePortSpecs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReservePorts(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Ports: []state.PortMapping{{HostPort: 51000, ContainerPort: 80, Protocol: "tcp"}}})
+
+	mappings := []state.PortMapping{
+		{ContainerPort: 3000, Protocol: "tcp"},
+		{HostPort: 51001, ContainerPort: 4000, Protocol: "tcp"},
+		{ContainerPort: 5000, Protocol: "tcp"},
+	}
+	if err := reservePorts(s, "web", mappings, func(port int, _ string) bool { return port != 51002 }); err != nil {
+		t.Fatal(err)
+	}
+	// 51000 is mapped by api, 51001 requested explicitly and 51002 busy on the host
+	if got := []int{mappings[0].HostPort, mappings[1].HostPort, mappings[2].HostPort}; !reflect.DeepEqual(got, []int{51003, 51001, 51004}) {
+		t.Errorf("host ports = %v", got)
+	}
+
+	if err := reservePorts(s, "db", []state.PortMapping{{HostPort: 51000, ContainerPort: 5432}}, nil); err == nil {
+		t.Error("expected a conflict with api")
+	}
+	if err := reservePorts(s, "db", []state.PortMapping{{HostPort: 51001, ContainerPort: 5432}}, nil); err == nil {
+		t.Error("expected a conflict with web's reservation")
+	}
+}
+
+func TestCheckHostPorts(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Ports: []state.PortMapping{{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"}}})
+	s.Ports.Reserved["api"] = []int{3000}
+	s.Ports.Reserved["web"] = []int{4000}
+	hostFree := func(port int, protocol string) bool {
+		return !(port == 5432 && protocol == "tcp") && port != 51000
+	}
+
+	tests := []struct {
+		name    string
+		pm      state.PortMapping
+		want    string // Error message, "" for no conflict
+		wantErr bool
+	}{
+		{"free", state.PortMapping{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}, "", false},
+		{"allocated later", state.PortMapping{ContainerPort: 80, Protocol: "tcp"}, "", false},
+		{"own reservation", state.PortMapping{HostPort: 4000, ContainerPort: 4000, Protocol: "tcp"}, "", false},
+		{"other environment", state.PortMapping{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"},
+			"host port 3000 is already in use by environment api; use 51001:3000 to map container port 3000 to a free port instead", true},
+		{"host process", state.PortMapping{HostIP: "0.0.0.0", HostPort: 5432, ContainerPort: 5432, Protocol: "tcp"},
+			"; use 0.0.0.0:51001:5432 to map container port 5432 to a free port instead", true},
+		{"other protocol", state.PortMapping{HostPort: 5432, ContainerPort: 5432, Protocol: "udp"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHostPorts(s, "web", []state.PortMapping{tt.pm}, hostFree)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkHostPorts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			var conflict *PortConflictError
+			if !errors.As(err, &conflict) || conflict.Suggested != 51001 {
+				t.Errorf("checkHostPorts() = %#v, want a PortConflictError suggesting 51001", err)
+			}
+			if !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("checkHostPorts() = %q, want suffix %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPodmanPortSpec(t *testing.T) {
+	tests := []struct {
+		pm   state.PortMapping
+		want string
+	}{
+		{state.PortMapping{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}, "127.0.0.1:8080:80"},
+		{state.PortMapping{HostIP: "0.0.0.0", HostPort: 5353, ContainerPort: 53, Protocol: "udp"}, "0.0.0.0:5353:53/udp"},
+		{state.PortMapping{HostIP: "::", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}, "[::]:8080:80"},
+	}
+	for _, tt := range tests {
+		if got := podmanPortSpec(tt.pm); got != tt.want {
+			t.Errorf("podmanPortSpec(%+v) = %q, want %q", tt.pm, got, tt.want)
+		}
+	}
+}
+
+func TestFindRemovablePort(t *testing.T) {
+	env := &state.EnvInfo{Name: "web", Ports: []state.PortMapping{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		{HostPort: 5173, ContainerPort: 5173, Protocol: "tcp", Auto: true},
+		{HostPort: 4001, ContainerPort: 4000, Protocol: "tcp", Proxied: true},
+	}}
+
+	tests := []struct {
+		name    string
+		port    int
+		want    int
+		wantErr bool
+	}{
+		{"by host port", 4001, 2, false},
+		{"by container port", 4000, 2, false},
+		{"published by podman", 8080, -1, true},
+		{"automatic forward", 5173, -1, true},
+		{"not mapped", 9999, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findRemovablePort(env, tt.port)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findRemovablePort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("findRemovablePort() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExposePortSpec(t *testing.T) {
+	env := &state.EnvInfo{Ports: []state.PortMapping{
+		{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"},
+		{HostPort: 51000, ContainerPort: 5173, Protocol: "tcp", Auto: true},
+		{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+	}}
+	tests := []struct {
+		port     int
+		wantSpec string
+		wantOK   bool
+	}{
+		{3000, "", false},
+		{5173, "51000:5173", true},
+		{53, ":53", true},
+		{8080, ":8080", true},
+	}
+	for _, tt := range tests {
+		spec, ok := exposePortSpec(env, tt.port)
+		if spec != tt.wantSpec || ok != tt.wantOK {
+			t.Errorf("exposePortSpec(%d) = %q, %v, want %q, %v", tt.port, spec, ok, tt.wantSpec, tt.wantOK)
+		}
+	}
+}
+
+func TestExposedPortSpecs(t *testing.T) {
+	env := &state.EnvInfo{Ports: []state.PortMapping{
+		{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"},
+		{HostPort: 51000, ContainerPort: 5173, Protocol: "tcp", Auto: true},
+	}}
+	expose := []manifest.Expose{
+		{Host: "api", Port: 3000},
+		{Host: "", Port: 5173},
+		{Host: "docs", Port: 8080},
+		{Host: "admin", Port: 8080},
+	}
+	got := exposedPortSpecs(env, expose)
+	want := []string{"51000:5173", ":8080"}
+	if !slices.Equal(got, want) {
+		t.Errorf("exposedPortSpecs() = %v, want %v", got, want)
+	}
+}
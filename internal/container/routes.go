@@ -0,0 +1,161 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// Expose routes route.Host to a container port of the environment through the silibox proxy
+// A container port that isn't mapped yet, or only forwarded automatically, is added
+// as with `sili ports add`, so the route keeps working when the port isn't listened on
+// It returns the mappings that were added
+func Expose(name string, route state.Route) ([]state.PortMapping, error) {
+	if err := manifest.ValidateHost(route.Host); err != nil {
+		return nil, err
+	}
+	if route.Port < 1 || route.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d: must be between 1 and 65535", route.Port)
+	}
+	target := fmt.Sprintf("%s -> port %d", routeLabel(route.Host), route.Port)
+
+	s, err := state.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	env := s.GetEnv(name)
+	if env == nil {
+		return nil, fmt.Errorf("environment %s not found in state", name)
+	}
+
+	var added []state.PortMapping
+	if spec, ok := exposePortSpec(env, route.Port); ok {
+		if added, err = AddPort(name, spec); err != nil {
+			events.RecordResult(events.EnvExpose, name, target, err)
+			return nil, fmt.Errorf("failed to map port %d: %w", route.Port, err)
+		}
+	}
+
+	err = state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(name)
+		if env == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+		env.Routes = slices.DeleteFunc(env.Routes, func(r state.Route) bool { return r.Host == route.Host })
+		env.Routes = append(env.Routes, route)
+		return nil
+	})
+	events.RecordResult(events.EnvExpose, name, target, err)
+	return added, err
+}
+
+// exposePortSpec returns the `sili ports add` spec that maps containerPort, if it needs one
+// An automatic forward keeps its host port
+func exposePortSpec(env *state.EnvInfo, containerPort int) (string, bool) {
+	auto := 0
+	for _, p := range env.Ports {
+		if p.ContainerPort != containerPort || p.Protocol == "udp" {
+			continue
+		}
+		if !p.Auto {
+			return "", false
+		}
+		auto = p.HostPort
+	}
+	if auto != 0 {
+		return fmt.Sprintf("%d:%d", auto, containerPort), true
+	}
+	return ":" + strconv.Itoa(containerPort), true
+}
+
+// MapExposedPorts maps the container ports routed in the environment's manifest `expose:`
+// section that aren't mapped yet, as Expose does, so their routes wake a sleeping
+// environment instead of failing once its automatic forwards are gone
+// It returns the mappings that were added
+func MapExposedPorts(name string) ([]state.PortMapping, error) {
+	s, err := state.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	env := s.GetEnv(name)
+	if env == nil {
+		return nil, fmt.Errorf("environment %s not found in state", name)
+	}
+	m := projectManifest(env)
+	if m == nil {
+		return nil, nil
+	}
+
+	var added []state.PortMapping
+	for _, spec := range exposedPortSpecs(env, m.Expose) {
+		mappings, err := AddPort(name, spec)
+		if err != nil {
+			return added, fmt.Errorf("failed to map port %s: %w", spec, err)
+		}
+		added = append(added, mappings...)
+	}
+	return added, nil
+}
+
+// mapExposedPorts runs MapExposedPorts for Create and Up, reporting what it mapped
+// A port it can't map leaves the environment as it is; its route answers 502 while stopped
+func mapExposedPorts(name string) {
+	added, err := MapExposedPorts(name)
+	for _, pm := range added {
+		fmt.Printf("Mapped port %d to host port %d for the routes in the manifest's expose: section\n", pm.ContainerPort, pm.HostPort)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// exposedPortSpecs returns the `sili ports add` specs that map the container ports of
+// manifest routes, once per port
+func exposedPortSpecs(env *state.EnvInfo, expose []manifest.Expose) []string {
+	var specs []string
+	var seen []int
+	for _, e := range expose {
+		if slices.Contains(seen, e.Port) {
+			continue
+		}
+		seen = append(seen, e.Port)
+		if spec, ok := exposePortSpec(env, e.Port); ok {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// Unexpose removes the route added for host with Expose
+// Ports mapped for the route stay; remove them with `sili ports rm`
+func Unexpose(name, host string) (state.Route, error) {
+	var removed state.Route
+	err := state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(name)
+		if env == nil {
+			return fmt.Errorf("environment %s not found in state", name)
+		}
+		i := slices.IndexFunc(env.Routes, func(r state.Route) bool { return r.Host == host })
+		if i < 0 {
+			return fmt.Errorf("%s isn't exposed with 'sili expose'", routeLabel(host))
+		}
+		removed = env.Routes[i]
+		env.Routes = slices.Delete(env.Routes, i, i+1)
+		return nil
+	})
+	events.RecordResult(events.EnvUnexpose, name, routeLabel(host), err)
+	return removed, err
+}
+
+// routeLabel names a route's host in messages
+func routeLabel(host string) string {
+	if host == "" {
+		return "the default host"
+	}
+	return "host " + host
+}
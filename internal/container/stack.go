@@ -0,0 +1,310 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// EnvName is the environment of a stack's service
+func EnvName(stack, service string) string {
+	return stack + "-" + service
+}
+
+// StackName derives a stack name from a project directory, e.g. "my-shop" for ~/code/My_Shop
+func StackName(projectDir string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(projectDir[strings.LastIndexAny(projectDir, `/\`)+1:]) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	name := strings.Trim(b.String(), "-")
+	if len(name) > 32 {
+		name = strings.TrimRight(name[:32], "-")
+	}
+	if name == "" {
+		return "stack"
+	}
+	return name
+}
+
+// UpOptions configures bringing up a stack
+type UpOptions struct {
+	Stack       string
+	ProjectDir  string
+	Services    map[string]manifest.Service
+	Environment map[string]string // Host variables passed to workspace services, below their own
+	TrustCA     bool
+	AnyProject  bool // The stack was named explicitly; skip checking it belongs to ProjectDir
+}
+
+// DownOptions configures taking down a stack
+type DownOptions struct {
+	Stack      string
+	ProjectDir string
+	Remove     bool
+	AnyProject bool // The stack was named explicitly; skip checking it belongs to ProjectDir
+}
+
+// Up creates or starts the services of a stack in dependency order, waiting for each
+// healthcheck before the services that depend on it start
+// Services that already exist are started as they are; changes to their spec apply
+// once they are recreated
+func Up(opts UpOptions) error {
+	if err := ValidateNetwork(opts.Stack); err != nil {
+		return fmt.Errorf("invalid stack name: %w", err)
+	}
+	m := manifest.Manifest{Services: opts.Services}
+	order, err := m.ServiceOrder()
+	if err != nil {
+		return err
+	}
+
+	s, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if !opts.AnyProject {
+		if err := checkStackProject(s, opts.Stack, opts.ProjectDir); err != nil {
+			return err
+		}
+	}
+	for _, env := range s.StackEnvs(opts.Stack) {
+		if _, ok := opts.Services[env.Service]; !ok {
+			fmt.Fprintf(os.Stderr, "Warning: '%s' is no longer a service of the stack; remove it with 'sili rm --name %s'\n", env.Name, env.Name)
+		}
+	}
+
+	for _, service := range order {
+		spec := opts.Services[service]
+		name := EnvName(opts.Stack, service)
+		switch env := s.GetEnv(name); {
+		case env == nil:
+			fmt.Printf("📦 Creating '%s' from %s...\n", name, spec.Image)
+			if err := Create(serviceConfig(opts, service, spec)); err != nil {
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+		case env.Stack != opts.Stack:
+			return fmt.Errorf("environment %s already exists outside stack %s", name, opts.Stack)
+		case env.Status != "running":
+			fmt.Printf("▶️  Starting '%s'...\n", name)
+			if err := Start(name); err != nil {
+				return fmt.Errorf("failed to start %s: %w", name, err)
+			}
+		default:
+			fmt.Printf("'%s' is already running\n", name)
+		}
+		if env := s.GetEnv(name); env != nil {
+			// Created services got theirs in Create; the manifest may have changed since
+			mapExposedPorts(name)
+		}
+
+		if spec.Healthcheck != nil {
+			if err := WaitHealthy(name, spec.Healthcheck); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// serviceConfig is how Up creates the environment of a service
+func serviceConfig(opts UpOptions, service string, spec manifest.Service) CreateConfig {
+	env := make(map[string]string)
+	if spec.Workspace {
+		for k, v := range opts.Environment {
+			env[k] = v
+		}
+	}
+	for k, v := range spec.Environment {
+		env[k] = v
+	}
+
+	dependsOn := make([]string, 0, len(spec.DependsOn))
+	for _, d := range spec.DependsOn {
+		dependsOn = append(dependsOn, EnvName(opts.Stack, d))
+	}
+
+	return CreateConfig{
+		Name:         EnvName(opts.Stack, service),
+		Image:        spec.Image,
+		ProjectDir:   opts.ProjectDir,
+		WorkingDir:   "/workspace",
+		Environment:  env,
+		Ports:        spec.Ports,
+		TrustCA:      opts.TrustCA,
+		Network:      opts.Stack,
+		Command:      spec.Command,
+		ImageCommand: !spec.Workspace,
+		Stack:        opts.Stack,
+		Service:      service,
+		DependsOn:    dependsOn,
+	}
+}
+
+// Down stops the environments of a stack, dependents first, and removes them with Remove
+// An environment that fails to stop is reported but doesn't keep the others up
+func Down(opts DownOptions) error {
+	s, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	order := StackStopOrder(s, opts.Stack)
+	if len(order) == 0 {
+		return fmt.Errorf("stack %s not found", opts.Stack)
+	}
+	if !opts.AnyProject {
+		if err := checkStackProject(s, opts.Stack, opts.ProjectDir); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, name := range order {
+		// Stopping before removing runs the pre-stop hooks
+		if s.GetEnv(name).Status == "running" {
+			fmt.Printf("⏹️  Stopping '%s'...\n", name)
+			if err := Stop(name); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+		if opts.Remove {
+			fmt.Printf("🗑️  Removing '%s'...\n", name)
+			if err := Remove(name, true); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkStackProject refuses a stack brought up from another project directory
+// Stack names default to the directory's base name, so ~/a/api and ~/b/api share one
+func checkStackProject(s *state.State, stack, projectDir string) error {
+	for _, env := range s.StackEnvs(stack) {
+		if filepath.Clean(env.ProjectPath) != filepath.Clean(projectDir) {
+			return fmt.Errorf("stack %s belongs to %s, not %s; name the stack explicitly with --name", stack, env.ProjectPath, projectDir)
+		}
+	}
+	return nil
+}
+
+// StackStopOrder lists the environments of a stack so each comes before the ones it depends on
+func StackStopOrder(s *state.State, stack string) []string {
+	envs := s.StackEnvs(stack)
+	deps := make(map[string][]string, len(envs))
+	for _, env := range envs {
+		deps[env.Name] = env.DependsOn
+	}
+	order, err := manifest.Order(deps)
+	if err != nil {
+		// Cycles can't be created through Up; fall back to names
+		order = order[:0]
+		for _, env := range envs {
+			order = append(order, env.Name)
+		}
+	}
+	slices.Reverse(order)
+	return order
+}
+
+// StartStack starts name and, if it belongs to a stack, the rest of the stack, so a
+// connection to any of its services wakes the whole stack
+func StartStack(name string) error {
+	s, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	env := s.GetEnv(name)
+	if env == nil || env.Stack == "" {
+		return Start(name)
+	}
+
+	order := StackStopOrder(s, env.Stack)
+	slices.Reverse(order)
+	for _, member := range order {
+		// Starting a member also starts its dependencies
+		s, err := state.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		if m := s.GetEnv(member); m == nil || m.Status == "running" {
+			continue
+		}
+		if err := Start(member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startDependencies starts the stopped environments env depends on, and waits until
+// they are healthy
+func startDependencies(env *state.EnvInfo) error {
+	for _, name := range env.DependsOn {
+		s, err := state.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		dep := s.GetEnv(name)
+		if dep == nil || dep.Status == "running" {
+			continue
+		}
+		if err := Start(name); err != nil {
+			return fmt.Errorf("failed to start %s, which %s depends on: %w", name, env.Name, err)
+		}
+		if hc := serviceHealthcheck(dep); hc != nil {
+			if err := WaitHealthy(name, hc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// serviceHealthcheck returns the healthcheck of a stack environment's service, if any
+func serviceHealthcheck(env *state.EnvInfo) *manifest.Healthcheck {
+	if env.Service == "" || env.ProjectPath == "" {
+		return nil
+	}
+	services, _, _, err := manifest.LoadServices(env.ProjectPath)
+	if err != nil {
+		return nil
+	}
+	return services[env.Service].Healthcheck
+}
+
+// WaitHealthy runs a service's healthcheck in the container until it passes or times out
+func WaitHealthy(name string, hc *manifest.Healthcheck) error {
+	timeout := hc.EffectiveTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "⏳ Waiting for '%s' to become healthy: %s\n", name, hc.Command)
+	for {
+		out, err := hookExec(ctx, name, hc.Command)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "   ✅ '%s' is healthy\n", name)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if out != "" {
+				err = fmt.Errorf("%w (output: %s)", err, out)
+			}
+			return fmt.Errorf("%s wasn't healthy after %s: %w", name, timeout, err)
+		case <-time.After(hc.EffectiveInterval()):
+		}
+	}
+}
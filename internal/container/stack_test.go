@@ -0,0 +1,119 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+func TestStackName(t *testing.T) {
+	tests := map[string]string{
+		"/Users/me/code/My_Shop":        "my-shop",
+		"/srv/api":                      "api",
+		"/tmp/--":                       "stack",
+		"/":                             "stack",
+		"/x/" + strings.Repeat("a", 40): strings.Repeat("a", 32),
+	}
+	for dir, want := range tests {
+		if got := StackName(dir); got != want {
+			t.Errorf("StackName(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestServiceConfig(t *testing.T) {
+	opts := UpOptions{
+		Stack:       "shop",
+		ProjectDir:  "/code/shop",
+		Environment: map[string]string{"HOME": "/Users/me", "TERM": "xterm"},
+	}
+
+	app := serviceConfig(opts, "app", manifest.Service{
+		Image:       "node:20",
+		Workspace:   true,
+		DependsOn:   []string{"db"},
+		Environment: map[string]string{"TERM": "dumb"},
+	})
+	if app.Name != "shop-app" || app.Network != "shop" || app.ImageCommand {
+		t.Errorf("app = %+v, want a workspace env shop-app on network shop", app)
+	}
+	if app.Environment["HOME"] != "/Users/me" || app.Environment["TERM"] != "dumb" {
+		t.Errorf("app.Environment = %v, want the host's overridden by the service's", app.Environment)
+	}
+	if !slices.Equal(app.DependsOn, []string{"shop-db"}) {
+		t.Errorf("app.DependsOn = %v, want [shop-db]", app.DependsOn)
+	}
+
+	db := serviceConfig(opts, "db", manifest.Service{Image: "postgres:16", Environment: map[string]string{"POSTGRES_PASSWORD": "dev"}})
+	if !db.ImageCommand || db.Service != "db" || db.Stack != "shop" {
+		t.Errorf("db = %+v, want an image-command service of stack shop", db)
+	}
+	if _, ok := db.Environment["HOME"]; ok {
+		t.Errorf("db.Environment = %v, want only the service's variables", db.Environment)
+	}
+}
+
+func TestStackStopOrder(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-app", Stack: "shop", DependsOn: []string{"shop-db", "shop-cache"}})
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-worker", Stack: "shop", DependsOn: []string{"shop-db"}})
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-db", Stack: "shop"})
+	s.UpsertEnv(&state.EnvInfo{Name: "shop-cache", Stack: "shop"})
+	s.UpsertEnv(&state.EnvInfo{Name: "blog-db", Stack: "blog"})
+
+	want := []string{"shop-worker", "shop-app", "shop-db", "shop-cache"}
+	if got := StackStopOrder(s, "shop"); !slices.Equal(got, want) {
+		t.Errorf("StackStopOrder() = %v, want %v", got, want)
+	}
+	if got := StackStopOrder(s, "none"); len(got) != 0 {
+		t.Errorf("StackStopOrder(none) = %v, want none", got)
+	}
+}
+
+func TestCheckStackProject(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "api-db", Stack: "api", ProjectPath: "/home/me/a/api"})
+	s.UpsertEnv(&state.EnvInfo{Name: "api-app", Stack: "api", ProjectPath: "/home/me/a/api"})
+
+	if err := checkStackProject(s, "api", "/home/me/a/api/"); err != nil {
+		t.Errorf("same project: error = %v", err)
+	}
+	if err := checkStackProject(s, "api", "/home/me/b/api"); err == nil || !strings.Contains(err.Error(), "belongs to /home/me/a/api") {
+		t.Errorf("other project: error = %v, want it refused", err)
+	}
+	if err := checkStackProject(s, "new", "/home/me/b/api"); err != nil {
+		t.Errorf("new stack: error = %v", err)
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	old := hookExec
+	defer func() { hookExec = old }()
+
+	attempts := 0
+	hookExec = func(ctx context.Context, name, command string) (string, error) {
+		if attempts++; attempts < 3 {
+			return "no response", errors.New("exit status 2")
+		}
+		return "", nil
+	}
+	hc := &manifest.Healthcheck{Command: "pg_isready", Interval: time.Millisecond, Timeout: time.Second}
+	if err := WaitHealthy("shop-db", hc); err != nil || attempts != 3 {
+		t.Errorf("WaitHealthy() = %v after %d attempts, want success after 3", err, attempts)
+	}
+
+	hookExec = func(ctx context.Context, name, command string) (string, error) {
+		return "no response", errors.New("exit status 2")
+	}
+	hc.Timeout = 20 * time.Millisecond
+	err := WaitHealthy("shop-db", hc)
+	if err == nil || !strings.Contains(err.Error(), "wasn't healthy after 20ms") || !strings.Contains(err.Error(), "no response") {
+		t.Errorf("WaitHealthy() error = %v, want a timeout with the output", err)
+	}
+}
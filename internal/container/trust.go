@@ -0,0 +1,72 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/lima"
+)
+
+// installCAScript adds the PEM on stdin to the container's trust store
+// Debian, Ubuntu and Alpine use update-ca-certificates, Fedora and RHEL update-ca-trust;
+// images without either get the certificate appended to their bundle
+const installCAScript = `set -e
+cert=$(cat)
+if command -v update-ca-certificates >/dev/null 2>&1; then
+  mkdir -p /usr/local/share/ca-certificates
+  printf '%s\n' "$cert" > /usr/local/share/ca-certificates/silibox-ca.crt
+  update-ca-certificates >/dev/null 2>&1 && exit 0
+fi
+if command -v update-ca-trust >/dev/null 2>&1; then
+  printf '%s\n' "$cert" > /etc/pki/ca-trust/source/anchors/silibox-ca.pem
+  update-ca-trust extract && exit 0
+fi
+for bundle in /etc/ssl/certs/ca-certificates.crt /etc/pki/tls/certs/ca-bundle.crt /etc/ssl/cert.pem; do
+  if [ -f "$bundle" ]; then
+    printf '%s\n' "$cert" >> "$bundle"
+    exit 0
+  fi
+done
+echo "no CA trust store found" >&2
+exit 1`
+
+// installCA adds the silibox CA to the trust store of the named container
+func installCA(name string) error {
+	certPath, err := ca.CertPath()
+	if err != nil {
+		return err
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	cmd := exec.Command("limactl", "shell", lima.Instance, "--",
+		"podman", "exec", "-i", "--user", "0", name, "sh", "-c", installCAScript)
+	cmd.Stdin = bytes.NewReader(certPEM)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w (output: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// caGuestPath is where the CA certificate shows up in containers, through the
+// read-only mount of the host home directory at /home/host
+func caGuestPath(homeDir string) (string, error) {
+	certPath, err := ca.CertPath()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(homeDir, certPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("CA certificate %s is outside the home directory", certPath)
+	}
+	return filepath.ToSlash(filepath.Join("/home/host", rel)), nil
+}
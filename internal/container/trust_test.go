@@ -0,0 +1,20 @@
+package container
+
+import "testing"
+
+func TestCAGuestPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	got, err := caGuestPath(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/home/host/.sili/ca/ca.pem"; got != want {
+		t.Errorf("caGuestPath() = %q, want %q", got, want)
+	}
+
+	if _, err := caGuestPath(t.TempDir()); err == nil {
+		t.Error("expected an error for a CA outside the mounted home directory")
+	}
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/coheez/silibox/internal/lima"
+)
+
+// ExportVolume streams the contents of a Podman volume as a tar archive to w
+func ExportVolume(volumeName string, w io.Writer) error {
+	cmd := exec.Command("limactl", "shell", lima.Instance, "--", "podman", "volume", "export", volumeName)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to export volume %s: %w (output: %s)", volumeName, err, stderr.String())
+	}
+	return nil
+}
+
+// ImportVolume creates a Podman volume and fills it from a tar archive read from r
+// The volume is created if it doesn't exist yet; existing contents are overwritten
+func ImportVolume(volumeName string, r io.Reader) error {
+	exists := exec.Command("limactl", "shell", lima.Instance, "--", "podman", "volume", "exists", volumeName)
+	if err := exists.Run(); err != nil {
+		if err := createVolume(volumeName); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command("limactl", "shell", lima.Instance, "--", "podman", "volume", "import", volumeName, "-")
+	var stderr bytes.Buffer
+	cmd.Stdin = r
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to import volume %s: %w (output: %s)", volumeName, err, stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/config"
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/portable"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// maxLogBytes caps how much of each log file goes into a bundle (the tail is kept)
+const maxLogBytes = 2 * 1024 * 1024
+
+// redactedValue replaces secrets in collected files
+const redactedValue = "[REDACTED]"
+
+// BundleOptions configures a support bundle
+type BundleOptions struct {
+	Version string  // sili version string recorded in bundle.json
+	Checks  Options // Checks included in report.json (Fix is ignored)
+}
+
+// BundleInfo is written to bundle.json and describes what was collected
+type BundleInfo struct {
+	CreatedAt time.Time `json:"created_at"`
+	Version   string    `json:"version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	GoVersion string    `json:"go_version"`
+	Files     []string  `json:"files"`
+	Errors    []string  `json:"errors"` // Items that couldn't be collected
+}
+
+// bundleWriter adds files to a bundle, recording what was written and what failed
+type bundleWriter struct {
+	w    *portable.Writer
+	info *BundleInfo
+	home string
+	user string
+}
+
+func (b *bundleWriter) add(name string, data []byte) error {
+	if err := b.w.WriteFile(name, redact(data, b.home, b.user)); err != nil {
+		return err
+	}
+	b.info.Files = append(b.info.Files, name)
+	return nil
+}
+
+func (b *bundleWriter) fail(name string, err error) {
+	b.info.Errors = append(b.info.Errors, fmt.Sprintf("%s: %v", name, err))
+}
+
+// collect adds the output of fn, recording an error instead if fn fails
+func (b *bundleWriter) collect(name string, fn func() ([]byte, error)) error {
+	data, err := fn()
+	if err != nil {
+		b.fail(name, err)
+		if len(data) == 0 {
+			return nil
+		}
+	}
+	return b.add(name, data)
+}
+
+// WriteBundle runs the doctor checks and writes a redacted support bundle to path
+// Items that can't be collected (e.g. podman output with the VM stopped) are listed in
+// bundle.json instead of failing the whole bundle
+func WriteBundle(path string, opts BundleOptions) (*BundleInfo, error) {
+	checks, err := selectChecks(opts.Checks.Only, opts.Checks.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer f.Close()
+
+	home, _ := os.UserHomeDir()
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	info := &BundleInfo{
+		CreatedAt: time.Now().UTC(),
+		Version:   opts.Version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Files:     []string{},
+		Errors:    []string{},
+	}
+	b := &bundleWriter{w: portable.NewWriter(f), info: info, home: home, user: username}
+
+	ctx := NewContext()
+	report := runChecks(ctx, checks, Options{})
+	if err := b.collect("report.json", func() ([]byte, error) {
+		return json.MarshalIndent(report, "", "  ")
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := collectHost(b); err != nil {
+		return nil, err
+	}
+	if err := collectSili(b, home); err != nil {
+		return nil, err
+	}
+	if err := collectLima(b, home); err != nil {
+		return nil, err
+	}
+	if err := collectPodman(b, ctx); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := b.w.WriteFile("bundle.json", data); err != nil {
+		return nil, err
+	}
+	if err := b.w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	return info, f.Close()
+}
+
+func collectHost(b *bundleWriter) error {
+	return b.collect("host/versions.txt", func() ([]byte, error) {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "sili: %s\n", b.info.Version)
+		fmt.Fprintf(&sb, "os/arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		fmt.Fprintf(&sb, "go: %s\n", runtime.Version())
+		fmt.Fprintf(&sb, "shell: %s\n", os.Getenv("SHELL"))
+		for _, cmd := range [][]string{{"limactl", "--version"}, {"sw_vers"}, {"uname", "-a"}} {
+			out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&sb, "\n$ %s\n%s", strings.Join(cmd, " "), out)
+		}
+		return []byte(sb.String()), nil
+	})
+}
+
+// collectSili adds silibox's own files from ~/.sili
+func collectSili(b *bundleWriter, home string) error {
+	if err := b.collect("sili/state.json", func() ([]byte, error) {
+		s, err := state.Load()
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(s, "", "  ")
+	}); err != nil {
+		return err
+	}
+
+	configPath, err := config.Path()
+	if err != nil {
+		b.fail("sili/config.yaml", err)
+	} else if err := addFileIfExists(b, "sili/config.yaml", configPath); err != nil {
+		return err
+	}
+
+	if err := addFileIfExists(b, "sili/lima.yaml", filepath.Join(home, ".sili", "lima.yaml")); err != nil {
+		return err
+	}
+
+	eventsPath, err := events.Path()
+	if err != nil {
+		b.fail("sili/events.log", err)
+		return nil
+	}
+	for _, p := range []string{eventsPath + ".1", eventsPath} {
+		if err := addFileIfExists(b, "sili/"+filepath.Base(p), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limaDir returns the directory of the silibox instance, honoring LIMA_HOME
+func limaDir(home string) string {
+	if limaHome := os.Getenv("LIMA_HOME"); limaHome != "" {
+		return filepath.Join(limaHome, lima.Instance)
+	}
+	return filepath.Join(home, ".lima", lima.Instance)
+}
+
+func collectLima(b *bundleWriter, home string) error {
+	if err := b.collect("lima/list.json", func() ([]byte, error) {
+		return exec.Command("limactl", "list", "--json").Output()
+	}); err != nil {
+		return err
+	}
+
+	logs, _ := filepath.Glob(filepath.Join(limaDir(home), "*.log"))
+	for _, p := range logs {
+		if err := addFileIfExists(b, "lima/logs/"+filepath.Base(p), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collectPodman(b *bundleWriter, ctx *Context) error {
+	commands := []struct {
+		name string
+		args []string
+	}{
+		{"podman/info.txt", []string{"podman", "info"}},
+		{"podman/ps.txt", []string{"podman", "ps", "--all", "--size"}},
+		{"podman/volumes.txt", []string{"podman", "volume", "ls"}},
+		{"podman/images.txt", []string{"podman", "images"}},
+		{"podman/df.txt", []string{"df", "-h"}},
+	}
+
+	if !ctx.VMRunning() {
+		b.fail("podman", fmt.Errorf("VM is not running"))
+		return nil
+	}
+	for _, c := range commands {
+		args := c.args
+		if err := b.collect(c.name, func() ([]byte, error) {
+			out, err := ctx.VMExec(args...)
+			return []byte(out), err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFileIfExists adds the tail of a file on the host; missing files are skipped silently
+func addFileIfExists(b *bundleWriter, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			b.fail(name, err)
+		}
+		return nil
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err == nil && fi.Size() > maxLogBytes {
+		if _, err := f.Seek(-maxLogBytes, io.SeekEnd); err != nil {
+			b.fail(name, err)
+			return nil
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		b.fail(name, err)
+		return nil
+	}
+	return b.add(name, data)
+}
+
+// secretPattern matches "key": "value" (JSON) and key: value (YAML) where the key looks
+// like it holds a credential
+var secretPattern = regexp.MustCompile(`(?im)^(\s*"?[\w.-]*(?:token|secret|password|passwd|api_?key|auth|credential|webhook)[\w.-]*"?\s*[:=]\s*)("[^"]*"|[^\s,#][^,#\n]*)`)
+
+// redact strips credentials, the home directory and the user name from collected data
+func redact(data []byte, home, username string) []byte {
+	out := secretPattern.ReplaceAllString(string(data), `${1}"`+redactedValue+`"`)
+	if home != "" && home != "/" {
+		out = strings.ReplaceAll(out, home, "~")
+	}
+	if username != "" && username != "root" {
+		userPattern := regexp.MustCompile(`\b` + regexp.QuoteMeta(username) + `\b`)
+		out = userPattern.ReplaceAllString(out, "<user>")
+	}
+	return []byte(out)
+}
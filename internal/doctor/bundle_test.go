@@ -0,0 +1,116 @@
+package doctor
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "json secret",
+			input: `  "api_token": "abc123",`,
+			want:  `  "api_token": "[REDACTED]",`,
+		},
+		{
+			name:  "yaml secret",
+			input: "  webhook_url: https://hooks.example.com/T000/B000",
+			want:  `  webhook_url: "[REDACTED]"`,
+		},
+		{
+			name:  "home directory",
+			input: `"project_path": "/Users/alex/code/web"`,
+			want:  `"project_path": "~/code/web"`,
+		},
+		{
+			name:  "user name",
+			input: `"name": "alex"`,
+			want:  `"name": "<user>"`,
+		},
+		{
+			name:  "unrelated",
+			input: "container_timeout: 15m",
+			want:  "container_timeout: 15m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(redact([]byte(tt.input), "/Users/alex", "alex"))
+			if got != tt.want {
+				t.Errorf("redact() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	home := os.Getenv("HOME")
+	siliDir := filepath.Join(home, ".sili")
+	if err := os.MkdirAll(siliDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siliDir, "config.yaml"), []byte("autosleep:\n  container_timeout: 10m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	info, err := WriteBundle(out, BundleOptions{Version: "test", Checks: Options{Only: []string{"platform", "config"}}})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+
+	for _, name := range []string{"report.json", "host/versions.txt", "sili/state.json", "sili/config.yaml"} {
+		found := false
+		for _, f := range info.Files {
+			if f == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s in bundle, got %v", name, info.Files)
+		}
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("bundle is not gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	entries := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		entries[hdr.Name] = string(data)
+	}
+
+	if _, ok := entries["bundle.json"]; !ok {
+		t.Error("expected bundle.json in archive")
+	}
+	if strings.Contains(entries["sili/state.json"], home) {
+		t.Error("home directory should be redacted from state.json")
+	}
+}
@@ -0,0 +1,294 @@
+package doctor
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// simpleCheck adapts plain functions to the Check interface
+type simpleCheck struct {
+	id          string
+	description string
+	severity    Severity
+	run         func(*Context) Result
+}
+
+func (c *simpleCheck) ID() string              { return c.id }
+func (c *simpleCheck) Description() string     { return c.description }
+func (c *simpleCheck) Severity() Severity      { return c.severity }
+func (c *simpleCheck) Run(ctx *Context) Result { return c.run(ctx) }
+
+// fixableCheck is a simpleCheck with a repair action
+type fixableCheck struct {
+	simpleCheck
+	fix func(*Context, bool) ([]FixAction, error)
+}
+
+func (c *fixableCheck) Fix(ctx *Context, dryRun bool) ([]FixAction, error) {
+	return c.fix(ctx, dryRun)
+}
+
+func init() {
+	Register(&simpleCheck{
+		id:          "platform",
+		description: "Host platform",
+		severity:    SeverityInfo,
+		run:         checkPlatform,
+	})
+	Register(&simpleCheck{
+		id:          "lima",
+		description: "Lima is installed",
+		severity:    SeverityError,
+		run:         checkLimaInstallation,
+	})
+	Register(&simpleCheck{
+		id:          "vm",
+		description: "VM status",
+		severity:    SeverityError,
+		run:         checkVMStatus,
+	})
+	Register(&simpleCheck{
+		id:          "podman",
+		description: "Podman works inside the VM",
+		severity:    SeverityWarning,
+		run:         checkPodmanInVM,
+	})
+	Register(&fixableCheck{
+		simpleCheck: simpleCheck{
+			id:          "vm-state",
+			description: "VM state matches Lima",
+			severity:    SeverityWarning,
+			run:         checkStateConsistency,
+		},
+		fix: fixStateConsistency,
+	})
+	Register(&fixableCheck{
+		simpleCheck: simpleCheck{
+			id:          "env-desync",
+			description: "Environment status matches Podman",
+			severity:    SeverityWarning,
+			run:         checkContainerDesync,
+		},
+		fix: fixContainerDesync,
+	})
+}
+
+func listContainers() ([]string, error) {
+	return container.List()
+}
+
+func checkPlatform(ctx *Context) Result {
+	if runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" {
+		return Pass("%s %s - Apple Silicon detected, Virtualization.framework (vz) required", runtime.GOOS, runtime.GOARCH)
+	}
+	return Pass("%s %s", runtime.GOOS, runtime.GOARCH)
+}
+
+func checkLimaInstallation(ctx *Context) Result {
+	if _, err := exec.LookPath("limactl"); err != nil {
+		return Fail("lima not found - install with: brew install lima")
+	}
+	return Pass("Lima is installed")
+}
+
+func checkVMStatus(ctx *Context) Result {
+	inst, found, err := ctx.Instance()
+	if err != nil {
+		return Fail("failed to check VM status: %v", err)
+	}
+
+	if !found {
+		return Pass("VM not found - Run 'sili vm up' to create it")
+	}
+
+	switch inst.Status {
+	case "Running":
+		return Pass("VM is running")
+	case "Stopped":
+		return Pass("VM exists but is stopped - Run 'sili vm up' to start it")
+	case "Error", "Broken":
+		return Fail("VM is in %s state - try 'sili vm stop' then 'sili vm up' to recreate", inst.Status)
+	default:
+		return Pass("VM status: %s", inst.Status)
+	}
+}
+
+func checkPodmanInVM(ctx *Context) Result {
+	if !ctx.VMRunning() {
+		return Skip("VM is not running")
+	}
+
+	// Check if podman is installed inside VM
+	cmd := exec.Command("limactl", "shell", lima.Instance, "--", "which", "podman")
+	if err := cmd.Run(); err != nil {
+		return Fail("podman not found in VM - run 'sili vm up' to install it")
+	}
+
+	// Check if podman works
+	cmd = exec.Command("limactl", "shell", lima.Instance, "--", "podman", "--version")
+	if err := cmd.Run(); err != nil {
+		return Fail("podman in VM is not working - run 'sili vm up' to reinstall")
+	}
+
+	return Pass("Podman is installed and working in VM")
+}
+
+// vmStateDrift returns the status state should have, or "" if state is consistent
+func vmStateDrift(ctx *Context) (stateStatus, actualStatus string, err error) {
+	s, err := ctx.State()
+	if err != nil {
+		return "", "", fmt.Errorf("state file corrupted - run 'sili state show' to check")
+	}
+
+	vm := s.GetVM()
+	if vm == nil {
+		return "", "", nil // No VM in state, that's ok
+	}
+
+	inst, found, err := ctx.Instance()
+	if err != nil {
+		return "", "", fmt.Errorf("cannot verify state consistency - lima error: %v", err)
+	}
+
+	if !found {
+		if vm.Status == "running" {
+			return vm.Status, "stopped", nil
+		}
+		return "", "", nil
+	}
+
+	// Normalize status for comparison
+	if strings.ToLower(vm.Status) != strings.ToLower(inst.Status) {
+		return vm.Status, strings.ToLower(inst.Status), nil
+	}
+	return "", "", nil
+}
+
+func checkStateConsistency(ctx *Context) Result {
+	stateStatus, actualStatus, err := vmStateDrift(ctx)
+	if err != nil {
+		return Fail("%v", err)
+	}
+	if actualStatus == "" {
+		return Pass("State is consistent with lima")
+	}
+	if _, found, _ := ctx.Instance(); !found {
+		return Fail("state says VM is running but lima shows no VM - state may be stale (run with --fix to repair)")
+	}
+	return Fail("state inconsistency - state says '%s' but lima shows '%s' (run with --fix to repair)", stateStatus, actualStatus)
+}
+
+func fixStateConsistency(ctx *Context, dryRun bool) ([]FixAction, error) {
+	stateStatus, actualStatus, err := vmStateDrift(ctx)
+	if err != nil || actualStatus == "" {
+		return nil, err
+	}
+
+	action := FixAction{Message: fmt.Sprintf("update VM state from '%s' to '%s'", stateStatus, actualStatus)}
+	if dryRun {
+		return []FixAction{action}, nil
+	}
+	if err := state.WithLockedState(func(s *state.State) error {
+		s.UpdateVMStatus(actualStatus)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to fix state: %w", err)
+	}
+	return []FixAction{action}, nil
+}
+
+// envDesync is an environment whose state status disagrees with Podman
+type envDesync struct {
+	name   string
+	status string // Status state should be updated to
+}
+
+func findContainerDesync(ctx *Context) ([]envDesync, int, error) {
+	s, err := ctx.State()
+	if err != nil {
+		return nil, 0, err
+	}
+	envs := s.ListEnvs()
+	if len(envs) == 0 {
+		return nil, 0, nil
+	}
+
+	running, err := ctx.RunningContainers()
+	if err != nil {
+		return nil, len(envs), fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+	desynced := make([]envDesync, 0)
+	for _, env := range envs {
+		isRunning := running[env.Name]
+		// Case 1: State says running but container doesn't exist or is stopped
+		if env.Status == "running" && !isRunning {
+			desynced = append(desynced, envDesync{name: env.Name, status: "stopped"})
+		}
+		// Case 2: Container is running but state says stopped (less critical)
+		if env.Status == "stopped" && isRunning {
+			desynced = append(desynced, envDesync{name: env.Name, status: "running"})
+		}
+	}
+	return desynced, len(envs), nil
+}
+
+func checkContainerDesync(ctx *Context) Result {
+	if !ctx.VMRunning() {
+		return Skip("VM is not running")
+	}
+
+	desynced, total, err := findContainerDesync(ctx)
+	if err != nil {
+		return Fail("%v", err)
+	}
+	if total == 0 {
+		return Pass("No environments to check")
+	}
+	if len(desynced) == 0 {
+		return Pass("All %d environment(s) in sync with Podman", total)
+	}
+
+	res := Fail("%d environment(s) out of sync with Podman (run with --fix to repair)", len(desynced))
+	for _, d := range desynced {
+		if d.status == "stopped" {
+			res.Details = append(res.Details, fmt.Sprintf("'%s' marked as running in state but not found in Podman", d.name))
+		} else {
+			res.Details = append(res.Details, fmt.Sprintf("'%s' is running but marked as stopped in state", d.name))
+		}
+	}
+	return res
+}
+
+func fixContainerDesync(ctx *Context, dryRun bool) ([]FixAction, error) {
+	desynced, _, err := findContainerDesync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]FixAction, 0, len(desynced))
+	for _, d := range desynced {
+		actions = append(actions, FixAction{Env: d.name, Message: fmt.Sprintf("mark '%s' as %s", d.name, d.status)})
+	}
+	if dryRun || len(desynced) == 0 {
+		return actions, nil
+	}
+
+	if err := state.WithLockedState(func(s *state.State) error {
+		for _, d := range desynced {
+			s.UpdateEnvStatus(d.name, d.status)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to fix desync: %w", err)
+	}
+	return actions, nil
+}
@@ -0,0 +1,196 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+func TestParseDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    diskUsage
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			output: "    1B-blocks        Used       Avail\n 105089261568 94580335411 10508926157\n",
+			want:   diskUsage{Size: 105089261568, Used: 94580335411, Avail: 10508926157},
+		},
+		{name: "header only", output: "1B-blocks Used Avail\n", wantErr: true},
+		{name: "not a number", output: "1B-blocks Used Avail\n10 x 5\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDF(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseDF() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if pct := (diskUsage{Size: 200, Used: 190}).UsedPercent(); pct != 95 {
+		t.Errorf("UsedPercent() = %d, want 95", pct)
+	}
+}
+
+func TestOrphanVolumes(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "web", Volumes: map[string]string{"node_modules": "web-node_modules"}})
+
+	got := orphanVolumes([]string{"web-node_modules", "old-cache", "api-venv"}, s)
+	want := []string{"api-venv", "old-cache"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orphanVolumes() = %v, want %v", got, want)
+	}
+
+	// Volumes still attached to a container aren't listed at all
+	cleanup := setupTestHome(t)
+	defer cleanup()
+	err := state.WithLockedState(func(s *state.State) error {
+		s.UpsertEnv(&state.EnvInfo{Name: "web", Volumes: map[string]string{"node_modules": "web-node_modules"}})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3f9a0c2e is the anonymous data volume of a database container
+	ctx := &Context{
+		found:    true,
+		instance: lima.LimaInstance{Status: "Running"},
+		vmExecFn: func(args ...string) (string, error) {
+			if !slices.Contains(args, "dangling=true") {
+				return "web-node_modules\n3f9a0c2e\nold-cache\n", nil
+			}
+			return "web-node_modules\nold-cache\n", nil
+		},
+	}
+	ctx.instOnce.Do(func() {})
+
+	res := checkOrphanVolumes(ctx)
+	if res.Status != StatusFail || !reflect.DeepEqual(res.Details, []string{"old-cache"}) {
+		t.Errorf("checkOrphanVolumes() = %+v, want only old-cache", res)
+	}
+}
+
+func TestFindShimDrift(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "web"})
+	s.RegisterShim("node", "web", "node")
+	s.RegisterShim("npm", "web", "npm")
+	s.RegisterShim("python", "gone", "python")
+
+	files := map[string]bool{
+		"node":   true,
+		"yarn":   true,  // generated but not in state
+		"mytool": false, // user's own file
+	}
+
+	d := findShimDrift(files, s)
+	if !reflect.DeepEqual(d.untracked, []string{"yarn"}) {
+		t.Errorf("untracked = %v", d.untracked)
+	}
+	if !reflect.DeepEqual(d.foreign, []string{"mytool"}) {
+		t.Errorf("foreign = %v", d.foreign)
+	}
+	if !reflect.DeepEqual(d.missing, []string{"npm"}) {
+		t.Errorf("missing = %v", d.missing)
+	}
+	if !reflect.DeepEqual(d.stale, []string{"python"}) {
+		t.Errorf("stale = %v", d.stale)
+	}
+	if d.count() != 3 {
+		t.Errorf("count() = %d, want 3", d.count())
+	}
+}
+
+func TestMissingProjectPaths(t *testing.T) {
+	existing := t.TempDir()
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "here", ProjectPath: existing})
+	s.UpsertEnv(&state.EnvInfo{Name: "gone", ProjectPath: filepath.Join(existing, "deleted")})
+
+	got := missingProjectPaths(s)
+	want := []string{"gone: " + filepath.Join(existing, "deleted")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("missingProjectPaths() = %v, want %v", got, want)
+	}
+}
+
+func TestFindPortConflicts(t *testing.T) {
+	s := state.NewState()
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "stopped", Ports: []state.PortMapping{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}})
+	s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running", Ports: []state.PortMapping{
+		{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"},
+		{HostPort: 8080, ContainerPort: 8080},
+	}})
+
+	busy := map[int]bool{8080: true, 3000: true}
+	inUse := func(port int, protocol string) bool { return busy[port] }
+
+	got := findPortConflicts(s, inUse, nil)
+	want := []string{
+		"api: host port 8080/tcp is already in use on this machine",
+		"web: host port 8080/tcp is also mapped by 'api'",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findPortConflicts() = %v, want %v", got, want)
+	}
+
+	// The agent listening on a sleeping env's port to wake it isn't a conflict
+	got = findPortConflicts(s, inUse, map[string][]int{"api": {8080}})
+	want = []string{"web: host port 8080/tcp is also mapped by 'api'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findPortConflicts() with wake ports = %v, want %v", got, want)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	if res := checkConfig(NewContext()); res.Status != StatusPass {
+		t.Fatalf("expected pass without config file, got %+v", res)
+	}
+
+	dir := filepath.Join(os.Getenv("HOME"), ".sili")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("autosleep: [broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res := checkConfig(NewContext()); res.Status != StatusFail {
+		t.Fatalf("expected fail for broken config, got %+v", res)
+	}
+
+	if _, err := fixConfig(NewContext(), true); err != nil {
+		t.Fatalf("dry run error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("dry run must not move the config")
+	}
+
+	if _, err := fixConfig(NewContext(), false); err != nil {
+		t.Fatalf("fixConfig() error = %v", err)
+	}
+	if res := checkConfig(NewContext()); res.Status != StatusPass {
+		t.Errorf("expected pass after fix, got %+v", res)
+	}
+	backups, _ := filepath.Glob(path + ".bak-*")
+	if len(backups) != 1 {
+		t.Errorf("expected one backup, got %v", backups)
+	}
+}
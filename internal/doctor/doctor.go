@@ -0,0 +1,323 @@
+package doctor
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/coheez/silibox/internal/agent"
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// Severity describes how serious a failing check is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // Silibox won't work until fixed
+	SeverityWarning Severity = "warning" // Silibox works but something is off
+	SeverityInfo    Severity = "info"    // Informational only
+)
+
+// Status is the outcome of running a check
+type Status string
+
+const (
+	StatusPass  Status = "pass"
+	StatusFail  Status = "fail"
+	StatusSkip  Status = "skip"
+	StatusFixed Status = "fixed"
+)
+
+// Result is what a check reports after running
+type Result struct {
+	Status  Status
+	Message string
+	Details []string // One line per affected item
+}
+
+// Pass returns a passing result
+func Pass(format string, args ...any) Result {
+	return Result{Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+// Fail returns a failing result
+func Fail(format string, args ...any) Result {
+	return Result{Status: StatusFail, Message: fmt.Sprintf(format, args...)}
+}
+
+// Skip returns a result for a check that couldn't run (e.g. VM not running)
+func Skip(format string, args ...any) Result {
+	return Result{Status: StatusSkip, Message: fmt.Sprintf(format, args...)}
+}
+
+// Check is a single diagnostic
+type Check interface {
+	ID() string
+	Description() string
+	Severity() Severity
+	Run(ctx *Context) Result
+}
+
+// Fixer is implemented by checks that can repair what they detect
+// With dryRun set, Fix only describes the actions it would take
+type Fixer interface {
+	Fix(ctx *Context, dryRun bool) ([]FixAction, error)
+}
+
+// FixAction is a repair taken, or planned in a dry run, by a Fixer
+type FixAction struct {
+	Env     string // Environment the repair is about; empty for the VM and host
+	Message string
+}
+
+// Context caches expensive probes shared between checks during a single run
+type Context struct {
+	instOnce  sync.Once
+	instance  lima.LimaInstance
+	found     bool
+	instErr   error
+	listOnce  sync.Once
+	running   map[string]bool
+	listErr   error
+	runningFn func() ([]string, error)
+	vmExecFn  func(args ...string) (string, error)
+	agentFn   func() (*agent.Status, error)
+}
+
+// NewContext returns an empty probe cache
+func NewContext() *Context {
+	return &Context{runningFn: listContainers, vmExecFn: vmExec, agentFn: agentStatus}
+}
+
+// agentStatus asks a running autosleep agent for its status
+func agentStatus() (*agent.Status, error) {
+	client, err := agent.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Status()
+}
+
+// WakePorts returns the host ports the autosleep agent listens on to wake sleeping
+// environments, by environment; nil without a running agent
+func (c *Context) WakePorts() map[string][]int {
+	if c.agentFn == nil {
+		return nil
+	}
+	st, err := c.agentFn()
+	if err != nil {
+		return nil
+	}
+	return st.WakePorts
+}
+
+// VMExec runs a command inside the VM and returns its stdout
+func (c *Context) VMExec(args ...string) (string, error) {
+	return c.vmExecFn(args...)
+}
+
+// Instance returns the Lima instance, probing limactl at most once
+func (c *Context) Instance() (lima.LimaInstance, bool, error) {
+	c.instOnce.Do(func() {
+		c.instance, c.found, c.instErr = lima.GetInstance()
+	})
+	return c.instance, c.found, c.instErr
+}
+
+// VMRunning reports whether the VM is up according to Lima
+func (c *Context) VMRunning() bool {
+	inst, found, err := c.Instance()
+	return err == nil && found && inst.Status == "Running"
+}
+
+// State loads the current state; it is not cached since fixes modify it
+func (c *Context) State() (*state.State, error) {
+	return state.Load()
+}
+
+// RunningContainers returns the set of running containers in the VM
+func (c *Context) RunningContainers() (map[string]bool, error) {
+	c.listOnce.Do(func() {
+		names, err := c.runningFn()
+		if err != nil {
+			c.listErr = err
+			return
+		}
+		c.running = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.running[name] = true
+		}
+	})
+	return c.running, c.listErr
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Check
+)
+
+// Register adds a check to the registry; checks run in registration order
+func Register(c Check) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.ID() == c.ID() {
+			panic(fmt.Sprintf("doctor: duplicate check id %q", c.ID()))
+		}
+	}
+	registry = append(registry, c)
+}
+
+// Checks returns all registered checks
+func Checks() []Check {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]Check(nil), registry...)
+}
+
+// Lookup returns the check with the given ID
+func Lookup(id string) (Check, bool) {
+	for _, c := range Checks() {
+		if c.ID() == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Options selects which checks run and whether to fix problems
+type Options struct {
+	Only   []string // Run only these check IDs (all if empty)
+	Skip   []string // Don't run these check IDs
+	Fix    bool     // Apply fixes for failing fixable checks
+	DryRun bool     // With Fix, only report what would be done
+}
+
+// FixReport describes a fix attempt
+type FixReport struct {
+	DryRun  bool     `json:"dry_run"`
+	Actions []string `json:"actions"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// CheckReport is the outcome of a single check
+type CheckReport struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Severity    Severity   `json:"severity"`
+	Status      Status     `json:"status"`
+	Message     string     `json:"message"`
+	Details     []string   `json:"details,omitempty"`
+	Fixable     bool       `json:"fixable"`
+	Fix         *FixReport `json:"fix,omitempty"`
+}
+
+// Report is the outcome of a doctor run
+type Report struct {
+	OS       string        `json:"os"`
+	Arch     string        `json:"arch"`
+	Healthy  bool          `json:"healthy"`
+	Issues   []string      `json:"issues"`   // Messages of failing error-severity checks
+	Warnings []string      `json:"warnings"` // Messages of failing warning-severity checks
+	Checks   []CheckReport `json:"checks"`
+}
+
+// Run executes the selected checks and returns a report
+func Run(opts Options) (*Report, error) {
+	checks, err := selectChecks(opts.Only, opts.Skip)
+	if err != nil {
+		return nil, err
+	}
+	return runChecks(NewContext(), checks, opts), nil
+}
+
+func selectChecks(only, skip []string) ([]Check, error) {
+	for _, id := range append(append([]string{}, only...), skip...) {
+		if _, ok := Lookup(id); !ok {
+			return nil, fmt.Errorf("unknown check %q (see 'sili doctor --list')", id)
+		}
+	}
+
+	skipped := make(map[string]bool, len(skip))
+	for _, id := range skip {
+		skipped[id] = true
+	}
+	selected := make(map[string]bool, len(only))
+	for _, id := range only {
+		selected[id] = true
+	}
+
+	checks := make([]Check, 0)
+	for _, c := range Checks() {
+		if skipped[c.ID()] || (len(only) > 0 && !selected[c.ID()]) {
+			continue
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+func runChecks(ctx *Context, checks []Check, opts Options) *Report {
+	report := &Report{
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Issues:   []string{},
+		Warnings: []string{},
+		Checks:   make([]CheckReport, 0, len(checks)),
+	}
+
+	for _, c := range checks {
+		res := c.Run(ctx)
+		fixer, fixable := c.(Fixer)
+		cr := CheckReport{
+			ID:          c.ID(),
+			Description: c.Description(),
+			Severity:    c.Severity(),
+			Status:      res.Status,
+			Message:     res.Message,
+			Details:     res.Details,
+			Fixable:     fixable,
+		}
+
+		if res.Status == StatusFail && fixable && opts.Fix {
+			actions, err := fixer.Fix(ctx, opts.DryRun)
+			cr.Fix = &FixReport{DryRun: opts.DryRun, Actions: make([]string, 0, len(actions))}
+			for _, action := range actions {
+				cr.Fix.Actions = append(cr.Fix.Actions, action.Message)
+			}
+			if err != nil {
+				cr.Fix.Error = err.Error()
+			} else if !opts.DryRun {
+				cr.Status = StatusFixed
+				for _, action := range actions {
+					events.Record(events.Event{
+						Type:    events.DoctorFix,
+						Source:  "doctor",
+						Env:     action.Env,
+						Message: fmt.Sprintf("%s: %s", c.ID(), action.Message),
+					})
+				}
+			}
+		}
+
+		if cr.Status == StatusFail {
+			msg := cr.Message
+			if len(cr.Details) > 0 {
+				msg += ": " + strings.Join(cr.Details, "; ")
+			}
+			switch cr.Severity {
+			case SeverityError:
+				report.Issues = append(report.Issues, msg)
+			case SeverityWarning:
+				report.Warnings = append(report.Warnings, msg)
+			}
+		}
+		report.Checks = append(report.Checks, cr)
+	}
+
+	report.Healthy = len(report.Issues) == 0
+	return report
+}
@@ -0,0 +1,171 @@
+package doctor
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/coheez/silibox/internal/events"
+)
+
+type fakeCheck struct {
+	id       string
+	severity Severity
+	result   Result
+}
+
+func (c *fakeCheck) ID() string              { return c.id }
+func (c *fakeCheck) Description() string     { return "fake " + c.id }
+func (c *fakeCheck) Severity() Severity      { return c.severity }
+func (c *fakeCheck) Run(ctx *Context) Result { return c.result }
+
+type fakeFixer struct {
+	fakeCheck
+	fixed  bool
+	fixErr error
+}
+
+func (c *fakeFixer) Fix(ctx *Context, dryRun bool) ([]FixAction, error) {
+	if c.fixErr != nil {
+		return nil, c.fixErr
+	}
+	if !dryRun {
+		c.fixed = true
+	}
+	return []FixAction{{Env: "web", Message: "repair " + c.id}}, nil
+}
+
+func setupTestHome(t *testing.T) func() {
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	return func() {
+		os.Setenv("HOME", oldHome)
+	}
+}
+
+func TestBuiltinChecksRegistered(t *testing.T) {
+	for _, id := range []string{
+		"platform", "lima", "vm", "podman", "vm-state", "env-desync",
+		"vm-disk", "dangling-images", "orphan-volumes",
+		"shims", "shim-path", "project-paths", "port-conflicts", "config",
+	} {
+		if _, ok := Lookup(id); !ok {
+			t.Errorf("expected check %q to be registered", id)
+		}
+	}
+
+	for _, id := range []string{"vm-state", "env-desync", "dangling-images", "shims", "config"} {
+		c, _ := Lookup(id)
+		if _, ok := c.(Fixer); !ok {
+			t.Errorf("expected check %q to be fixable", id)
+		}
+	}
+}
+
+func TestSelectChecks(t *testing.T) {
+	all := len(Checks())
+
+	checks, err := selectChecks(nil, nil)
+	if err != nil || len(checks) != all {
+		t.Fatalf("expected all %d checks, got %d (err %v)", all, len(checks), err)
+	}
+
+	checks, err = selectChecks([]string{"podman"}, nil)
+	if err != nil || len(checks) != 1 || checks[0].ID() != "podman" {
+		t.Errorf("expected only podman, got %v (err %v)", checks, err)
+	}
+
+	checks, err = selectChecks(nil, []string{"podman", "lima"})
+	if err != nil || len(checks) != all-2 {
+		t.Errorf("expected %d checks after skipping, got %d (err %v)", all-2, len(checks), err)
+	}
+
+	if _, err := selectChecks([]string{"nope"}, nil); err == nil {
+		t.Error("expected error for unknown check")
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	broken := &fakeCheck{id: "broken", severity: SeverityError, result: Fail("broken")}
+	flaky := &fakeCheck{id: "flaky", severity: SeverityWarning, result: Result{Status: StatusFail, Message: "flaky", Details: []string{"a", "b"}}}
+	fine := &fakeCheck{id: "fine", severity: SeverityWarning, result: Pass("fine")}
+	skipped := &fakeCheck{id: "skipped", severity: SeverityError, result: Skip("vm stopped")}
+
+	report := runChecks(NewContext(), []Check{broken, flaky, fine, skipped}, Options{})
+
+	if report.Healthy {
+		t.Error("expected unhealthy report")
+	}
+	if len(report.Issues) != 1 || report.Issues[0] != "broken" {
+		t.Errorf("unexpected issues: %v", report.Issues)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0] != "flaky: a; b" {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+	if len(report.Checks) != 4 || report.Checks[3].Status != StatusSkip {
+		t.Errorf("unexpected checks: %+v", report.Checks)
+	}
+}
+
+func TestRunChecksFix(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	newFixer := func() *fakeFixer {
+		return &fakeFixer{fakeCheck: fakeCheck{id: "drift", severity: SeverityWarning, result: Fail("drift")}}
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		c := newFixer()
+		report := runChecks(NewContext(), []Check{c}, Options{Fix: true, DryRun: true})
+		cr := report.Checks[0]
+		if c.fixed {
+			t.Error("dry run must not apply the fix")
+		}
+		if cr.Status != StatusFail || cr.Fix == nil || !cr.Fix.DryRun || len(cr.Fix.Actions) != 1 {
+			t.Errorf("unexpected dry run report: %+v", cr)
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		c := newFixer()
+		report := runChecks(NewContext(), []Check{c}, Options{Fix: true})
+		cr := report.Checks[0]
+		if !c.fixed || cr.Status != StatusFixed {
+			t.Errorf("expected fix to be applied, got %+v", cr)
+		}
+		if len(report.Warnings) != 0 {
+			t.Errorf("fixed checks should not be reported as warnings: %v", report.Warnings)
+		}
+		// Repairs show up in `sili events --env` for the env they touched
+		logged, err := events.Read(events.Filter{Env: "web"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logged) != 1 || logged[0].Type != events.DoctorFix || logged[0].Message != "drift: repair drift" {
+			t.Errorf("events for web = %+v, want the doctor fix", logged)
+		}
+	})
+
+	t.Run("fix error", func(t *testing.T) {
+		c := newFixer()
+		c.fixErr = errors.New("locked")
+		report := runChecks(NewContext(), []Check{c}, Options{Fix: true})
+		cr := report.Checks[0]
+		if cr.Status != StatusFail || cr.Fix == nil || cr.Fix.Error != "locked" {
+			t.Errorf("expected failed fix to be reported, got %+v", cr)
+		}
+	})
+
+	t.Run("without --fix", func(t *testing.T) {
+		c := newFixer()
+		report := runChecks(NewContext(), []Check{c}, Options{})
+		if c.fixed || report.Checks[0].Fix != nil {
+			t.Error("fix must only run with --fix")
+		}
+	})
+}
@@ -0,0 +1,355 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/coheez/silibox/internal/config"
+	"github.com/coheez/silibox/internal/hostport"
+	"github.com/coheez/silibox/internal/shim"
+	"github.com/coheez/silibox/internal/state"
+)
+
+func init() {
+	Register(&fixableCheck{
+		simpleCheck: simpleCheck{
+			id:          "shims",
+			description: "Shims on disk match state",
+			severity:    SeverityWarning,
+			run:         checkShims,
+		},
+		fix: fixShims,
+	})
+	Register(&simpleCheck{
+		id:          "shim-path",
+		description: "Shim directory is on PATH",
+		severity:    SeverityWarning,
+		run:         checkShimPath,
+	})
+	Register(&simpleCheck{
+		id:          "project-paths",
+		description: "Environment project paths exist",
+		severity:    SeverityWarning,
+		run:         checkProjectPaths,
+	})
+	Register(&simpleCheck{
+		id:          "port-conflicts",
+		description: "Host ports are free for environments",
+		severity:    SeverityWarning,
+		run:         checkPortConflicts,
+	})
+	Register(&fixableCheck{
+		simpleCheck: simpleCheck{
+			id:          "config",
+			description: "Config file parses",
+			severity:    SeverityError,
+			run:         checkConfig,
+		},
+		fix: fixConfig,
+	})
+}
+
+// shimDrift describes disagreements between the shim directory and state
+type shimDrift struct {
+	untracked []string // Silibox shims on disk that state doesn't know about
+	foreign   []string // Files in the shim directory not written by silibox
+	missing   []string // Shims in state whose file is gone; env still exists
+	stale     []string // Shims in state whose env no longer exists
+}
+
+// count returns the number of shims that --fix can repair
+func (d shimDrift) count() int {
+	return len(d.untracked) + len(d.missing) + len(d.stale)
+}
+
+// findShimDrift compares shim files (name -> written by silibox) with state
+func findShimDrift(files map[string]bool, s *state.State) shimDrift {
+	var d shimDrift
+	for name, generated := range files {
+		if _, ok := s.Shims[name]; ok {
+			continue
+		}
+		if generated {
+			d.untracked = append(d.untracked, name)
+		} else {
+			d.foreign = append(d.foreign, name)
+		}
+	}
+	for name, info := range s.Shims {
+		if s.GetEnv(info.Env) == nil {
+			d.stale = append(d.stale, name)
+		} else if _, ok := files[name]; !ok {
+			d.missing = append(d.missing, name)
+		}
+	}
+	sort.Strings(d.untracked)
+	sort.Strings(d.foreign)
+	sort.Strings(d.missing)
+	sort.Strings(d.stale)
+	return d
+}
+
+// readShimDir returns the files in the shim directory and whether silibox wrote them
+func readShimDir() (map[string]bool, error) {
+	shimDir, err := shim.ShimDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(shimDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, fmt.Errorf("failed to read shim directory: %w", err)
+	}
+
+	files := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		files[entry.Name()] = shim.IsGenerated(filepath.Join(shimDir, entry.Name()))
+	}
+	return files, nil
+}
+
+func loadShimDrift(ctx *Context) (shimDrift, *state.State, error) {
+	s, err := ctx.State()
+	if err != nil {
+		return shimDrift{}, nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	files, err := readShimDir()
+	if err != nil {
+		return shimDrift{}, nil, err
+	}
+	return findShimDrift(files, s), s, nil
+}
+
+func checkShims(ctx *Context) Result {
+	d, s, err := loadShimDrift(ctx)
+	if err != nil {
+		return Fail("%v", err)
+	}
+	if d.count() == 0 {
+		if len(d.foreign) > 0 {
+			return Pass("Shims on disk match state (ignoring %d file(s) not created by silibox)", len(d.foreign))
+		}
+		return Pass("Shims on disk match state")
+	}
+
+	res := Fail("%d shim(s) out of sync with state (run with --fix to repair)", d.count())
+	for _, name := range d.untracked {
+		res.Details = append(res.Details, fmt.Sprintf("'%s' exists on disk but is not registered in state", name))
+	}
+	for _, name := range d.missing {
+		res.Details = append(res.Details, fmt.Sprintf("'%s' is registered in state but its file is missing", name))
+	}
+	for _, name := range d.stale {
+		res.Details = append(res.Details, fmt.Sprintf("'%s' belongs to environment '%s' which no longer exists", name, s.Shims[name].Env))
+	}
+	return res
+}
+
+// fixShims removes untracked and stale silibox shims and regenerates missing ones
+// Files not written by silibox are never touched
+func fixShims(ctx *Context, dryRun bool) ([]FixAction, error) {
+	d, s, err := loadShimDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shimEnv := func(name string) string {
+		if info := s.Shims[name]; info != nil {
+			return info.Env
+		}
+		return ""
+	}
+
+	actions := make([]FixAction, 0)
+	for _, name := range d.untracked {
+		actions = append(actions, FixAction{Message: fmt.Sprintf("remove untracked shim '%s'", name)})
+	}
+	for _, name := range d.missing {
+		actions = append(actions, FixAction{Env: shimEnv(name), Message: fmt.Sprintf("regenerate shim '%s'", name)})
+	}
+	for _, name := range d.stale {
+		actions = append(actions, FixAction{Env: shimEnv(name), Message: fmt.Sprintf("unregister stale shim '%s'", name)})
+	}
+	if dryRun || len(actions) == 0 {
+		return actions, nil
+	}
+
+	for _, name := range d.untracked {
+		if err := shim.RemoveShim(name); err != nil {
+			return nil, err
+		}
+	}
+
+	err = state.WithLockedState(func(s *state.State) error {
+		for _, name := range d.missing {
+			info := s.Shims[name]
+			if info == nil {
+				continue
+			}
+			if err := shim.GenerateShim(info.Env, name, true); err != nil {
+				return fmt.Errorf("failed to regenerate shim '%s': %w", name, err)
+			}
+		}
+		for _, name := range d.stale {
+			dir, err := shim.ShimDir()
+			if err != nil {
+				return err
+			}
+			if path := filepath.Join(dir, name); shim.IsGenerated(path) {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("failed to remove shim '%s': %w", name, err)
+				}
+			}
+			s.UnregisterShim(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fix shims: %w", err)
+	}
+	return actions, nil
+}
+
+func checkShimPath(ctx *Context) Result {
+	s, err := ctx.State()
+	if err != nil {
+		return Fail("failed to load state: %v", err)
+	}
+	if len(s.Shims) == 0 {
+		return Skip("No shims exported")
+	}
+
+	inPath, err := shim.IsInPATH()
+	if err != nil {
+		return Fail("failed to check PATH: %v", err)
+	}
+	if inPath {
+		return Pass("Shim directory is on PATH")
+	}
+
+	res := Fail("shim directory is not on PATH - exported commands won't be found")
+	if instructions, err := shim.GetPATHInstructions(); err == nil {
+		res.Details = []string{instructions}
+	}
+	return res
+}
+
+// missingProjectPaths returns "env: path" for environments whose project directory is gone
+func missingProjectPaths(s *state.State) []string {
+	missing := make([]string, 0)
+	for _, env := range s.ListEnvs() {
+		if env.ProjectPath == "" {
+			continue
+		}
+		if _, err := os.Stat(env.ProjectPath); os.IsNotExist(err) {
+			missing = append(missing, fmt.Sprintf("%s: %s", env.Name, env.ProjectPath))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// A missing project path can mean the directory was moved or is on an unmounted disk,
+// so removing the environment is left to the user
+func checkProjectPaths(ctx *Context) Result {
+	s, err := ctx.State()
+	if err != nil {
+		return Fail("failed to load state: %v", err)
+	}
+	missing := missingProjectPaths(s)
+	if len(missing) == 0 {
+		return Pass("All project paths exist")
+	}
+	res := Fail("%d environment(s) point to a project path that no longer exists (remove with 'sili rm <name>')", len(missing))
+	res.Details = missing
+	return res
+}
+
+// portInUse reports whether something on the host is already bound to the port
+func portInUse(port int, protocol string) bool {
+	return !hostport.Free(port, protocol)
+}
+
+// findPortConflicts returns port mappings that can't be bound when their env starts
+// Running environments already own their host ports, so only stopped ones are probed,
+// except for ports the agent holds for the env itself to wake it on connect
+func findPortConflicts(s *state.State, inUse func(port int, protocol string) bool, wakePorts map[string][]int) []string {
+	envs := s.ListEnvs()
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+	conflicts := make([]string, 0)
+	owners := make(map[string]string)
+	for _, env := range envs {
+		for _, p := range env.Ports {
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			key := fmt.Sprintf("%d/%s", p.HostPort, protocol)
+			if owner, ok := owners[key]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%s: host port %s is also mapped by '%s'", env.Name, key, owner))
+				continue
+			}
+			owners[key] = env.Name
+
+			if env.Status != "running" && !slices.Contains(wakePorts[env.Name], p.HostPort) && inUse(p.HostPort, protocol) {
+				conflicts = append(conflicts, fmt.Sprintf("%s: host port %s is already in use on this machine", env.Name, key))
+			}
+		}
+	}
+	return conflicts
+}
+
+func checkPortConflicts(ctx *Context) Result {
+	s, err := ctx.State()
+	if err != nil {
+		return Fail("failed to load state: %v", err)
+	}
+	conflicts := findPortConflicts(s, portInUse, ctx.WakePorts())
+	if len(conflicts) == 0 {
+		return Pass("No host port conflicts")
+	}
+	res := Fail("%d port mapping(s) collide with other listeners", len(conflicts))
+	res.Details = conflicts
+	return res
+}
+
+func checkConfig(ctx *Context) Result {
+	path, err := config.Path()
+	if err != nil {
+		return Fail("%v", err)
+	}
+	if _, err := config.Load(); err != nil {
+		return Fail("%s is invalid: %v (run with --fix to move it aside and use defaults)", path, err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return Pass("No config file, using defaults")
+	}
+	return Pass("Config file is valid")
+}
+
+// fixConfig moves a broken config aside so defaults apply; the original is kept as a backup
+func fixConfig(ctx *Context, dryRun bool) ([]FixAction, error) {
+	path, err := config.Path()
+	if err != nil {
+		return nil, err
+	}
+	backup := fmt.Sprintf("%s.bak-%s", path, time.Now().Format("20060102-150405"))
+
+	actions := []FixAction{{Message: fmt.Sprintf("move %s to %s", path, backup)}}
+	if dryRun {
+		return actions, nil
+	}
+	if err := os.Rename(path, backup); err != nil {
+		return nil, fmt.Errorf("failed to back up config: %w", err)
+	}
+	return actions, nil
+}
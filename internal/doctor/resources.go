@@ -0,0 +1,200 @@
+package doctor
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+const (
+	// diskMinFreeBytes is the free space below which the VM disk is reported
+	diskMinFreeBytes = 5 * 1024 * 1024 * 1024
+	// diskMaxUsedPercent is the usage above which the VM disk is reported
+	diskMaxUsedPercent = 90
+)
+
+func init() {
+	Register(&simpleCheck{
+		id:          "vm-disk",
+		description: "VM disk has free space",
+		severity:    SeverityWarning,
+		run:         checkVMDisk,
+	})
+	Register(&fixableCheck{
+		simpleCheck: simpleCheck{
+			id:          "dangling-images",
+			description: "No dangling images in the VM",
+			severity:    SeverityInfo,
+			run:         checkDanglingImages,
+		},
+		fix: fixDanglingImages,
+	})
+	Register(&simpleCheck{
+		id:          "orphan-volumes",
+		description: "Every volume belongs to an environment",
+		severity:    SeverityInfo,
+		run:         checkOrphanVolumes,
+	})
+}
+
+func vmExec(args ...string) (string, error) {
+	cmd := exec.Command("limactl", append([]string{"shell", lima.Instance, "--"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w (output: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// diskUsage is the usage of a filesystem in bytes
+type diskUsage struct {
+	Size  int64
+	Used  int64
+	Avail int64
+}
+
+// UsedPercent returns the share of the filesystem in use
+func (d diskUsage) UsedPercent() int {
+	if d.Size == 0 {
+		return 0
+	}
+	return int(d.Used * 100 / d.Size)
+}
+
+// parseDF parses the output of `df -B1 --output=size,used,avail <path>`
+func parseDF(output string) (diskUsage, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return diskUsage{}, fmt.Errorf("unexpected df output: %q", output)
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) != 3 {
+		return diskUsage{}, fmt.Errorf("unexpected df output: %q", output)
+	}
+
+	values := make([]int64, 3)
+	for i, field := range fields {
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return diskUsage{}, fmt.Errorf("unexpected df value %q: %w", field, err)
+		}
+		values[i] = v
+	}
+	return diskUsage{Size: values[0], Used: values[1], Avail: values[2]}, nil
+}
+
+func checkVMDisk(ctx *Context) Result {
+	if !ctx.VMRunning() {
+		return Skip("VM is not running")
+	}
+
+	out, err := ctx.VMExec("df", "-B1", "--output=size,used,avail", "/")
+	if err != nil {
+		return Fail("failed to check VM disk usage: %v", err)
+	}
+	usage, err := parseDF(out)
+	if err != nil {
+		return Fail("%v", err)
+	}
+
+	summary := fmt.Sprintf("%s free of %s (%d%% used)",
+		container.FormatBytes(usage.Avail), container.FormatBytes(usage.Size), usage.UsedPercent())
+	if usage.Avail < diskMinFreeBytes || usage.UsedPercent() >= diskMaxUsedPercent {
+		res := Fail("VM disk is almost full: %s", summary)
+		res.Details = []string{"run 'sili doctor --check dangling-images --fix' or remove unused environments with 'sili rm'"}
+		return res
+	}
+	return Pass("VM disk: %s", summary)
+}
+
+// nonEmptyLines splits command output into trimmed, non-empty lines
+func nonEmptyLines(output string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func checkDanglingImages(ctx *Context) Result {
+	if !ctx.VMRunning() {
+		return Skip("VM is not running")
+	}
+
+	out, err := ctx.VMExec("podman", "images", "--filter", "dangling=true", "--quiet")
+	if err != nil {
+		return Fail("failed to list images: %v", err)
+	}
+	ids := nonEmptyLines(out)
+	if len(ids) == 0 {
+		return Pass("No dangling images")
+	}
+	return Fail("%d dangling image(s) are using disk space (run with --fix to prune)", len(ids))
+}
+
+func fixDanglingImages(ctx *Context, dryRun bool) ([]FixAction, error) {
+	action := FixAction{Message: "prune dangling images with 'podman image prune'"}
+	if dryRun {
+		return []FixAction{action}, nil
+	}
+	if _, err := ctx.VMExec("podman", "image", "prune", "--force"); err != nil {
+		return nil, fmt.Errorf("failed to prune images: %w", err)
+	}
+	return []FixAction{action}, nil
+}
+
+// orphanVolumes returns volumes not referenced by any environment in state
+func orphanVolumes(volumes []string, s *state.State) []string {
+	owned := make(map[string]bool)
+	for _, env := range s.ListEnvs() {
+		for _, volumeName := range env.Volumes {
+			owned[volumeName] = true
+		}
+	}
+
+	orphans := make([]string, 0)
+	for _, volumeName := range volumes {
+		if !owned[volumeName] {
+			orphans = append(orphans, volumeName)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// Orphan volumes may hold data the user still wants, so they are reported but never removed
+// Only dangling volumes are considered: anonymous volumes of an image's VOLUME, such as a
+// database's data, belong to their container even though state doesn't list them
+func checkOrphanVolumes(ctx *Context) Result {
+	if !ctx.VMRunning() {
+		return Skip("VM is not running")
+	}
+
+	s, err := ctx.State()
+	if err != nil {
+		return Fail("failed to load state: %v", err)
+	}
+	out, err := ctx.VMExec("podman", "volume", "ls", "--quiet", "--filter", "dangling=true")
+	if err != nil {
+		return Fail("failed to list volumes: %v", err)
+	}
+
+	orphans := orphanVolumes(nonEmptyLines(out), s)
+	if len(orphans) == 0 {
+		return Pass("All volumes belong to an environment")
+	}
+	res := Fail("%d volume(s) aren't used by any container or environment (remove with 'limactl shell %s -- podman volume rm <name>')", len(orphans), lima.Instance)
+	res.Details = orphans
+	return res
+}
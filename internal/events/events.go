@@ -0,0 +1,306 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+const (
+	LogFile  = "events.log"
+	lockFile = "events.lock"
+
+	// MaxSize is the size at which the log is rotated
+	MaxSize = 5 * 1024 * 1024
+	// MaxBackups is how many rotated logs are kept (events.log.1 ... events.log.N)
+	MaxBackups = 3
+)
+
+// Event types
+const (
+	EnvCreate       = "env.create"
+	EnvStart        = "env.start"
+	EnvWake         = "env.wake" // Started by a connection on a sleeping env's port
+	EnvStop         = "env.stop"
+	EnvRemove       = "env.remove"
+	EnvHook         = "env.hook"        // A pre_stop or post_start hook from silibox.yaml ran
+	EnvTouch        = "env.touch"       // Idle timer reset, e.g. with `sili env touch`
+	EnvForward      = "env.forward"     // A port the container listens on was forwarded automatically
+	EnvUnforward    = "env.unforward"   // An automatic forward was removed
+	EnvPortAdd      = "env.port_add"    // Port mapped with `sili ports add`
+	EnvPortRemove   = "env.port_remove" // Port unmapped with `sili ports rm`
+	EnvExpose       = "env.expose"      // Hostname routed with `sili expose`
+	EnvUnexpose     = "env.unexpose"    // Hostname removed with `sili expose --rm`
+	EnvConnect      = "env.connect"     // Moved to another network group with `sili network connect`
+	VMUp            = "vm.up"
+	VMStop          = "vm.stop"
+	AutosleepStop   = "autosleep.stop"
+	AutosleepVM     = "autosleep.vm_stop"
+	AutosleepActive = "autosleep.active"  // Past the idle timeout but kept awake by live signals
+	AutosleepWarn   = "autosleep.warning" // Heads-up sent before a planned stop
+	AutosleepPause  = "autosleep.pause"
+	AutosleepResume = "autosleep.resume"
+	DoctorFix       = "doctor.fix"
+)
+
+// Event is a single entry in the append-only event log
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	Source  string            `json:"source"`
+	Env     string            `json:"env,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	PID     int               `json:"pid"`
+}
+
+// Filter selects events when reading the log
+type Filter struct {
+	Env   string    // Only events for this environment
+	Since time.Time // Only events at or after this time
+}
+
+// Match reports whether the event passes the filter
+func (f Filter) Match(e Event) bool {
+	if f.Env != "" && e.Env != f.Env {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// source identifies what part of silibox is recording events in this process
+var source = "cli"
+
+// SetSource sets the source recorded with subsequent events (e.g. "autosleep")
+func SetSource(s string) {
+	source = s
+}
+
+// Path returns the location of the event log
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sili", LogFile), nil
+}
+
+// Record appends an event to the log
+// Recording is best-effort: failures are reported on stderr but never fail the caller
+func Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Source == "" {
+		e.Source = source
+	}
+	e.PID = os.Getpid()
+
+	if err := appendEvent(e); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record event: %v\n", err)
+	}
+}
+
+// RecordResult records an event of the given type, capturing err if the operation failed
+func RecordResult(eventType, env, message string, err error) {
+	e := Event{Type: eventType, Env: env, Message: message}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	Record(e)
+}
+
+func appendEvent(e Event) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	// Serialize writers across processes so rotation can't interleave with appends
+	lock := flock.New(filepath.Join(filepath.Dir(path), lockFile))
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock event log: %w", err)
+	}
+	defer lock.Unlock()
+
+	if err := rotateIfNeeded(path, int64(len(data))); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+// rotateIfNeeded shifts events.log -> events.log.1 -> ... when the next write would exceed MaxSize
+func rotateIfNeeded(path string, incoming int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size()+incoming <= MaxSize {
+		return nil
+	}
+
+	os.Remove(backupPath(path, MaxBackups))
+	for i := MaxBackups - 1; i >= 1; i-- {
+		if _, err := os.Stat(backupPath(path, i)); err == nil {
+			if err := os.Rename(backupPath(path, i), backupPath(path, i+1)); err != nil {
+				return fmt.Errorf("failed to rotate event log: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(path, backupPath(path, 1)); err != nil {
+		return fmt.Errorf("failed to rotate event log: %w", err)
+	}
+	return nil
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Read returns all logged events matching the filter, oldest first
+// Rotated logs are included
+func Read(filter Filter) ([]Event, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, MaxBackups+1)
+	for i := MaxBackups; i >= 1; i-- {
+		files = append(files, backupPath(path, i))
+	}
+	files = append(files, path)
+
+	result := make([]Event, 0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		_, err = scanEvents(f, func(e Event) {
+			if filter.Match(e) {
+				result = append(result, e)
+			}
+		})
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// scanEvents decodes one event per line, skipping malformed lines
+// Returns the number of bytes consumed, excluding a trailing partial line
+func scanEvents(r io.Reader, fn func(Event)) (int64, error) {
+	var consumed int64
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return consumed, nil
+		}
+		if err != nil {
+			return consumed, err
+		}
+		consumed += int64(len(line))
+
+		var e Event
+		if json.Unmarshal(line, &e) == nil {
+			fn(e)
+		}
+	}
+}
+
+// Follow calls fn for each new event appended to the log until ctx is cancelled
+// It starts at the current end of the log and survives rotation
+func Follow(ctx context.Context, filter Filter, interval time.Duration, fn func(Event)) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				offset = 0
+				continue
+			}
+			return err
+		}
+		// File shrank: it was rotated, start from the beginning of the new log
+		if info.Size() < offset {
+			offset = 0
+		}
+		if info.Size() == offset {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+		n, err := scanEvents(f, func(e Event) {
+			if filter.Match(e) {
+				fn(e)
+			}
+		})
+		f.Close()
+		if err != nil {
+			return err
+		}
+		offset += n
+	}
+}
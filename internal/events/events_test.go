@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupTestHome(t *testing.T) func() {
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	return func() {
+		os.Setenv("HOME", oldHome)
+	}
+}
+
+func TestRecordAndRead(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	RecordResult(EnvCreate, "web", "image node:20", nil)
+	RecordResult(EnvStop, "api", "", errors.New("boom"))
+	Record(Event{Type: AutosleepStop, Env: "web", Source: "autosleep", Message: "idle for 16 minutes"})
+
+	all, err := Read(Filter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(all))
+	}
+	if all[0].Type != EnvCreate || all[0].Source != "cli" || all[0].PID == 0 {
+		t.Errorf("unexpected first event: %+v", all[0])
+	}
+	if all[1].Error != "boom" {
+		t.Errorf("expected error to be recorded, got %+v", all[1])
+	}
+	if all[2].Source != "autosleep" {
+		t.Errorf("expected explicit source to be kept, got %q", all[2].Source)
+	}
+
+	web, err := Read(Filter{Env: "web"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(web) != 2 {
+		t.Errorf("expected 2 events for web, got %d", len(web))
+	}
+}
+
+func TestFilterSince(t *testing.T) {
+	now := time.Now()
+	f := Filter{Since: now.Add(-time.Hour)}
+
+	if f.Match(Event{Time: now.Add(-2 * time.Hour)}) {
+		t.Error("expected old event to be filtered out")
+	}
+	if !f.Match(Event{Time: now.Add(-30 * time.Minute)}) {
+		t.Error("expected recent event to match")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	path, err := Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(strings.TrimSuffix(path, LogFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the log up to the rotation threshold
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", MaxSize)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Record(Event{Type: EnvCreate, Env: "web"})
+
+	if _, err := os.Stat(backupPath(path, 1)); err != nil {
+		t.Fatalf("expected rotated log: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= MaxSize {
+		t.Errorf("expected new log to be small after rotation, got %d bytes", info.Size())
+	}
+
+	all, err := Read(Filter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 1 || all[0].Env != "web" {
+		t.Errorf("expected only the new event to parse, got %+v", all)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	Record(Event{Type: EnvCreate, Env: "old"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	got := make(chan Event, 1)
+	go Follow(ctx, Filter{}, 10*time.Millisecond, func(e Event) {
+		got <- e
+	})
+
+	// Give Follow time to record the starting offset
+	time.Sleep(50 * time.Millisecond)
+	Record(Event{Type: EnvStop, Env: "new"})
+
+	select {
+	case e := <-got:
+		if e.Env != "new" {
+			t.Errorf("expected only new events, got %+v", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for followed event")
+	}
+}
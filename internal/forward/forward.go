@@ -0,0 +1,291 @@
+// Package forward forwards ports that containers start listening on to the host
+package forward
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/hostport"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// Options configures automatic port forwarding
+type Options struct {
+	SyncInterval time.Duration // How often containers are checked for new listening sockets
+}
+
+// DefaultOptions checks every 5 seconds
+func DefaultOptions() Options {
+	return Options{SyncInterval: 5 * time.Second}
+}
+
+// Forwarder watches running environments for listening TCP sockets and forwards
+// each one that isn't declared with -p to a host port
+//
+// A forward is a socat process in the VM that listens on the host port and connects
+// into the container's network namespace; Lima then forwards the VM port to the host.
+// Forwards are recorded in state as PortMapping entries marked Auto and removed again
+// once the socket closes or the environment stops
+type Forwarder struct {
+	opts Options
+
+	failed map[string]bool // "env/port" forwards that failed to start, to log only once
+
+	runner   runner
+	hostFree func(port int) bool
+}
+
+// runner inspects containers and manages forwards in the VM; replaced in tests
+type runner interface {
+	listeners(env string) ([]Listener, error)
+	start(env, bind string, hostPort int, l Listener) error
+	stop(hostPort int) error
+}
+
+// New returns a forwarder that works through the VM and Podman
+func New(opts Options) *Forwarder {
+	return &Forwarder{
+		opts:     opts,
+		failed:   make(map[string]bool),
+		runner:   limaRunner{},
+		hostFree: HostPortFree,
+	}
+}
+
+// HostPortFree reports whether nothing on the host listens on TCP port
+func HostPortFree(port int) bool {
+	return hostport.Free(port, "tcp")
+}
+
+// Run keeps forwards in sync with the containers' sockets until ctx is cancelled
+func (f *Forwarder) Run(ctx context.Context) error {
+	ticker := time.NewTicker(f.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if s, err := state.Load(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: port forwarding failed to load state: %v\n", err)
+		} else {
+			f.sync(s)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync adds forwards for new listeners and removes those whose env or socket is gone
+func (f *Forwarder) sync(s *state.State) {
+	vmRunning := s.GetVM() != nil && s.GetVM().Status == "running"
+
+	envs := s.ListEnvs()
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+	for _, env := range envs {
+		if !vmRunning || env.Status != "running" {
+			// With the VM down its forwards are gone already
+			f.removeStale(env.Name, autoMappings(env), vmRunning)
+			continue
+		}
+
+		listening, err := f.runner.listeners(env.Name)
+		if err != nil {
+			// The container may be stopping; try again on the next sync
+			continue
+		}
+		add, stale := plan(env, listening)
+		f.removeStale(env.Name, stale, true)
+		for _, l := range add {
+			f.add(env.Name, l)
+		}
+	}
+}
+
+// plan returns the listeners that need a forward and the auto mappings whose socket is gone
+func plan(env *state.EnvInfo, listening []Listener) (add []Listener, stale []state.PortMapping) {
+	open := make(map[int]bool, len(listening))
+	for _, l := range listening {
+		open[l.Port] = true
+	}
+
+	mapped := make(map[int]bool, len(env.Ports))
+	for _, p := range env.Ports {
+		if p.Protocol == "udp" {
+			continue
+		}
+		if p.Auto && !open[p.ContainerPort] {
+			stale = append(stale, p)
+			continue
+		}
+		mapped[p.ContainerPort] = true
+	}
+
+	for _, l := range listening {
+		if !mapped[l.Port] {
+			add = append(add, l)
+		}
+	}
+	return add, stale
+}
+
+// autoMappings returns the env's automatically forwarded ports
+func autoMappings(env *state.EnvInfo) []state.PortMapping {
+	var auto []state.PortMapping
+	for _, p := range env.Ports {
+		if p.Auto {
+			auto = append(auto, p)
+		}
+	}
+	return auto
+}
+
+// add reserves a host port for l, starts the forward and records the mapping
+func (f *Forwarder) add(envName string, l Listener) {
+	key := envName + "/" + strconv.Itoa(l.Port)
+	var mapping state.PortMapping
+
+	err := state.WithLockedState(func(s *state.State) error {
+		env := s.GetEnv(envName)
+		if env == nil || env.Status != "running" {
+			return nil
+		}
+		for _, p := range env.Ports {
+			if p.ContainerPort == l.Port && p.Protocol != "udp" {
+				return nil // Mapped since the listeners were read
+			}
+		}
+
+		hostPort, err := allocate(s, envName, l.Port, f.hostFree)
+		if err != nil {
+			return err
+		}
+		if err := f.runner.start(envName, "127.0.0.1", hostPort, l); err != nil {
+			s.ReleasePort(envName, hostPort)
+			return err
+		}
+		mapping = state.PortMapping{HostPort: hostPort, ContainerPort: l.Port, Protocol: "tcp", Auto: true}
+		env.Ports = append(env.Ports, mapping)
+		return nil
+	})
+	if err != nil {
+		if !f.failed[key] {
+			f.failed[key] = true
+			fmt.Fprintf(os.Stderr, "Warning: failed to forward port %d of '%s': %v\n", l.Port, envName, err)
+			events.RecordResult(events.EnvForward, envName, fmt.Sprintf("port %d", l.Port), err)
+		}
+		return
+	}
+	if mapping.HostPort == 0 {
+		return
+	}
+
+	delete(f.failed, key)
+	msg := fmt.Sprintf("port %d -> localhost:%d", mapping.ContainerPort, mapping.HostPort)
+	fmt.Printf("🔌 Forwarding '%s' %s\n", envName, msg)
+	events.Record(events.Event{Type: events.EnvForward, Env: envName, Message: msg})
+}
+
+// allocate reserves a host port for containerPort, preferring the same number
+// Privileged ports and ports that are mapped, reserved or busy on the host fall back
+// to the next ephemeral port
+func allocate(s *state.State, envName string, containerPort int, hostFree func(int) bool) (int, error) {
+	if containerPort >= 1024 && !s.PortTaken(containerPort) && hostFree(containerPort) {
+		return s.ReservePort(envName, containerPort)
+	}
+	return s.AllocatePort(envName, hostFree)
+}
+
+// removeStale stops forwards and drops their mappings from state
+// stopForwards is false when the VM is down and the socat processes are gone with it
+func (f *Forwarder) removeStale(envName string, stale []state.PortMapping, stopForwards bool) {
+	if len(stale) == 0 {
+		return
+	}
+	if stopForwards {
+		for _, p := range stale {
+			if err := f.runner.stop(p.HostPort); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to stop forward of localhost:%d: %v\n", p.HostPort, err)
+			}
+		}
+	}
+
+	err := state.WithLockedState(func(s *state.State) error {
+		if env := s.GetEnv(envName); env != nil {
+			Drop(s, env, stale)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update state: %v\n", err)
+		return
+	}
+	for _, p := range stale {
+		msg := fmt.Sprintf("port %d -> localhost:%d", p.ContainerPort, p.HostPort)
+		fmt.Printf("🔌 Stopped forwarding '%s' %s\n", envName, msg)
+		events.Record(events.Event{Type: events.EnvUnforward, Env: envName, Message: msg})
+	}
+}
+
+// Drop removes mappings from env and releases their host ports
+func Drop(s *state.State, env *state.EnvInfo, mappings []state.PortMapping) {
+	drop := make(map[int]bool, len(mappings))
+	for _, p := range mappings {
+		drop[p.HostPort] = true
+	}
+	kept := env.Ports[:0]
+	for _, p := range env.Ports {
+		if p.Auto && drop[p.HostPort] {
+			s.ReleasePort(env.Name, p.HostPort)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	env.Ports = kept
+}
+
+// StopAll stops env's forwards and drops the automatic ones from state
+// Called when the environment stops or is removed; stopForwards is false when the VM is down
+func StopAll(s *state.State, env *state.EnvInfo, stopForwards bool) {
+	if stopForwards {
+		for _, p := range env.Ports {
+			if p.Auto || p.Proxied {
+				// Best effort: a leftover socat only refuses connections
+				limaRunner{}.stop(p.HostPort)
+			}
+		}
+	}
+	Drop(s, env, autoMappings(env))
+}
+
+// Start forwards pm's host port to its container port in env's running container
+// Used for ports added with `sili ports add`, which podman can't publish after creation
+func Start(env string, pm state.PortMapping) error {
+	r := limaRunner{}
+	l := Listener{Port: pm.ContainerPort}
+	// Connect over IPv6 if that's all the container listens on already
+	if listening, err := r.listeners(env); err == nil {
+		for _, found := range listening {
+			if found.Port == pm.ContainerPort {
+				l = found
+			}
+		}
+	}
+	bind := pm.HostIP
+	if bind == "" {
+		bind = "127.0.0.1"
+	}
+	return r.start(env, bind, pm.HostPort, l)
+}
+
+// Stop stops the forward listening on hostPort
+func Stop(hostPort int) error {
+	return limaRunner{}.stop(hostPort)
+}
@@ -0,0 +1,195 @@
+package forward
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+func setupTestHome(t *testing.T) func() {
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	state.ResetForTesting()
+	return func() {
+		os.Setenv("HOME", oldHome)
+		state.ResetForTesting()
+	}
+}
+
+type fakeRunner struct {
+	listening map[string][]Listener
+	startErr  error
+	started   map[int]Listener // Host port -> forwarded listener
+	stopped   []int
+}
+
+func (f *fakeRunner) listeners(env string) ([]Listener, error) {
+	return f.listening[env], nil
+}
+
+func (f *fakeRunner) start(env, bind string, hostPort int, l Listener) error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.started[hostPort] = l
+	return nil
+}
+
+func (f *fakeRunner) stop(hostPort int) error {
+	f.stopped = append(f.stopped, hostPort)
+	delete(f.started, hostPort)
+	return nil
+}
+
+func TestParseListeners(t *testing.T) {
+	tcp := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0BB8 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 2 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:0BB8 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 3 1 0000000000000000 20 4 30 10 -1
+`
+	tcp6 := `  sl  local_address                         remote_address                        st
+   0: 00000000000000000000000001000000:1435 00000000000000000000000000000000:0000 0A 00000000:00000000
+   1: 00000000000000000000000000000000:0BB8 00000000000000000000000000000000:0000 0A 00000000:00000000
+`
+	want := []Listener{{Port: 3000}, {Port: 5173, IPv6: true}, {Port: 8080}}
+	if got := parseListeners(tcp, tcp6); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseListeners() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	env := &state.EnvInfo{Name: "web", Ports: []state.PortMapping{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp", Auto: true},
+		{HostPort: 9229, ContainerPort: 9229, Protocol: "tcp", Auto: true},
+	}}
+	listening := []Listener{{Port: 80}, {Port: 3000}, {Port: 5173}}
+
+	add, stale := plan(env, listening)
+	if want := []Listener{{Port: 5173}}; !reflect.DeepEqual(add, want) {
+		t.Errorf("add = %+v, want %+v", add, want)
+	}
+	if len(stale) != 1 || stale[0].HostPort != 9229 {
+		t.Errorf("stale = %+v, want the 9229 forward", stale)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	busy := map[int]bool{51000: true}
+	hostFree := func(port int) bool { return !busy[port] }
+
+	tests := []struct {
+		name          string
+		containerPort int
+		want          int
+	}{
+		{"same port when free", 3000, 3000},
+		{"mapped already", 3000, 51001}, // 51000 is busy on the host
+		{"privileged port", 80, 51002},
+	}
+
+	s := state.NewState()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allocate(s, "web", tt.containerPort, hostFree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("allocate(%d) = %d, want %d", tt.containerPort, got, tt.want)
+			}
+		})
+	}
+	if got := s.Ports.Reserved["web"]; !reflect.DeepEqual(got, []int{3000, 51001, 51002}) {
+		t.Errorf("reserved = %v, busy host ports shouldn't stay reserved", got)
+	}
+}
+
+func TestSync(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	err := state.WithLockedState(func(s *state.State) error {
+		s.SetVM(&state.VMInfo{Status: "running"})
+		s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running", Ports: []state.PortMapping{
+			{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		}})
+		s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "running"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &fakeRunner{
+		listening: map[string][]Listener{
+			"web": {{Port: 80}, {Port: 5173, IPv6: true}},
+			"api": {{Port: 5173}},
+		},
+		started: make(map[int]Listener),
+	}
+	f := New(DefaultOptions())
+	f.runner = runner
+	f.hostFree = func(int) bool { return true }
+
+	sync := func() *state.State {
+		t.Helper()
+		s, err := state.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.sync(s)
+		s, err = state.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// api is synced first and gets 5173; web falls back to an ephemeral port
+	s := sync()
+	if got := autoMappings(s.GetEnv("api")); len(got) != 1 || got[0].HostPort != 5173 {
+		t.Errorf("api forwards = %+v", got)
+	}
+	webAuto := autoMappings(s.GetEnv("web"))
+	if len(webAuto) != 1 || webAuto[0].ContainerPort != 5173 || webAuto[0].HostPort != 51000 {
+		t.Fatalf("web forwards = %+v", webAuto)
+	}
+	if !runner.started[51000].IPv6 {
+		t.Error("web's IPv6-only listener wasn't forwarded over IPv6")
+	}
+
+	// A second sync with the same sockets changes nothing
+	sync()
+	if len(runner.started) != 2 {
+		t.Errorf("started = %v, want 2 forwards", runner.started)
+	}
+
+	// The socket closes in web and api stops
+	runner.listening["web"] = []Listener{{Port: 80}}
+	state.WithLockedState(func(s *state.State) error {
+		s.UpdateEnvStatus("api", "stopped")
+		return nil
+	})
+	s = sync()
+	if len(s.GetEnv("web").Ports) != 1 || len(s.GetEnv("api").Ports) != 0 {
+		t.Errorf("stale forwards kept: web %+v, api %+v", s.GetEnv("web").Ports, s.GetEnv("api").Ports)
+	}
+	if len(runner.started) != 0 {
+		t.Errorf("forwards still running: %v", runner.started)
+	}
+	if len(s.Ports.Reserved) != 0 {
+		t.Errorf("reserved = %v, want released", s.Ports.Reserved)
+	}
+
+	// A failing forward isn't recorded
+	runner.listening["web"] = []Listener{{Port: 80}, {Port: 4000}}
+	runner.startErr = errors.New("socat is not installed")
+	s = sync()
+	if got := autoMappings(s.GetEnv("web")); len(got) != 0 {
+		t.Errorf("failed forward recorded: %+v", got)
+	}
+}
@@ -0,0 +1,153 @@
+package forward
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coheez/silibox/internal/lima"
+)
+
+// Listener is a TCP port a container listens on
+type Listener struct {
+	Port int
+	IPv6 bool // Only listening on IPv6, so the forward has to connect to [::1]
+}
+
+// tcpListen is the state code of a listening socket in /proc/net/tcp
+const tcpListen = "0A"
+
+// parseListeners returns the listening ports in /proc/net/tcp and /proc/net/tcp6 content
+// IPv4 and IPv6 sockets on the same port are reported once, preferring IPv4
+func parseListeners(tcp, tcp6 string) []Listener {
+	ports := make(map[int]bool) // Port -> IPv6 only
+	read := func(table string, ipv6 bool) {
+		for _, line := range strings.Split(table, "\n") {
+			fields := strings.Fields(line)
+			// sl local_address rem_address st ...
+			if len(fields) < 4 || fields[3] != tcpListen {
+				continue
+			}
+			_, portHex, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			port, err := strconv.ParseInt(portHex, 16, 32)
+			if err != nil || port == 0 {
+				continue
+			}
+			if v6only, seen := ports[int(port)]; !seen || v6only {
+				ports[int(port)] = ipv6
+			}
+		}
+	}
+	read(tcp, false)
+	read(tcp6, true)
+
+	listeners := make([]Listener, 0, len(ports))
+	for port, ipv6 := range ports {
+		listeners = append(listeners, Listener{Port: port, IPv6: ipv6})
+	}
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].Port < listeners[j].Port })
+	return listeners
+}
+
+// socatTarget is the address a forward connects to inside the container's network namespace
+func socatTarget(l Listener) string {
+	if l.IPv6 {
+		return fmt.Sprintf("TCP6:[::1]:%d", l.Port)
+	}
+	return fmt.Sprintf("TCP4:127.0.0.1:%d", l.Port)
+}
+
+// listenAddress is the socat address type for listening on bind
+func listenAddress(bind string) string {
+	if strings.Contains(bind, ":") {
+		return "TCP6-LISTEN"
+	}
+	return "TCP-LISTEN"
+}
+
+// bindAddress brackets IPv6 addresses for socat's bind option
+func bindAddress(bind string) string {
+	if strings.Contains(bind, ":") {
+		return "[" + bind + "]"
+	}
+	return bind
+}
+
+// listenPattern matches the forward's socat process for pkill
+// The bracket keeps the pattern from matching the shell running pkill
+func listenPattern(hostPort int) string {
+	return fmt.Sprintf("[s]ocat TCP6?-LISTEN:%d,", hostPort)
+}
+
+// limaRunner runs socat in the VM and enters containers through their init process
+type limaRunner struct{}
+
+func shell(args ...string) (string, error) {
+	cmd := exec.Command("limactl", append([]string{"shell", lima.Instance, "--"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w (output: %s)", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func containerPID(env string) (string, error) {
+	out, err := shell("podman", "inspect", "--format", "{{.State.Pid}}", env)
+	if err != nil {
+		return "", err
+	}
+	pid := strings.TrimSpace(out)
+	if pid == "" || pid == "0" {
+		return "", fmt.Errorf("container '%s' is not running", env)
+	}
+	return pid, nil
+}
+
+// The tables are separated by a marker line so IPv4 and IPv6 sockets can be told apart
+func (limaRunner) listeners(env string) ([]Listener, error) {
+	pid, err := containerPID(env)
+	if err != nil {
+		return nil, err
+	}
+	out, err := shell("podman", "unshare", "sh", "-c",
+		fmt.Sprintf("cat /proc/%s/net/tcp 2>/dev/null; echo ---; cat /proc/%s/net/tcp6 2>/dev/null; true", pid, pid))
+	if err != nil {
+		return nil, err
+	}
+	tcp, tcp6, _ := strings.Cut(out, "---\n")
+	return parseListeners(tcp, tcp6), nil
+}
+
+// start runs socat in the background: it listens on bind in the VM, which Lima
+// forwards to the host, and execs a second socat inside the container's network
+// namespace for each connection
+func (limaRunner) start(env, bind string, hostPort int, l Listener) error {
+	pid, err := containerPID(env)
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`command -v socat >/dev/null || { echo "socat is not installed in the VM (sudo apt-get install -y socat)" >&2; exit 1; }
+nohup setsid socat %s:%d,bind=%s,fork,reuseaddr EXEC:'podman unshare nsenter -t %s -n socat STDIO %s' </dev/null >/dev/null 2>&1 &`,
+		listenAddress(bind), hostPort, bindAddress(bind), pid, socatTarget(l))
+	_, err = shell("sh", "-c", script)
+	return err
+}
+
+// stop kills the forward listening on hostPort; a missing process isn't an error
+func (limaRunner) stop(hostPort int) error {
+	_, err := shell("pkill", "-f", listenPattern(hostPort))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	return err
+}
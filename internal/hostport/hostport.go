@@ -0,0 +1,80 @@
+// Package hostport checks host ports for processes outside silibox
+package hostport
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialTimeout bounds the connect probe; listeners on loopback answer immediately
+const dialTimeout = 200 * time.Millisecond
+
+// Free reports whether nothing on the host uses port
+// Binding alone misses a process listening on all interfaces on macOS, where
+// SO_REUSEADDR lets a loopback bind succeed next to it, so TCP ports are dialed too
+func Free(port int, protocol string) bool {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	if protocol == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	if conn, err := net.DialTimeout("tcp", addr, dialTimeout); err == nil {
+		conn.Close()
+		return false
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// Owner names the process using port, like "postgres (pid 812)"
+// It returns "" when lsof isn't installed or can't tell, e.g. for another user's process
+func Owner(port int, protocol string) string {
+	args := []string{"-nP", "-Fpc"}
+	if protocol == "udp" {
+		args = append(args, fmt.Sprintf("-iUDP:%d", port))
+	} else {
+		args = append(args, fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN")
+	}
+	// lsof exits 1 when nothing matches
+	out, _ := exec.Command("lsof", args...).Output()
+	return parseLsof(string(out))
+}
+
+// parseLsof reads the first process from lsof -F pc output
+func parseLsof(out string) string {
+	var pid, command string
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		if line[0] == 'p' {
+			if pid != "" {
+				break // The next process
+			}
+			pid = line[1:]
+		} else if line[0] == 'c' && command == "" {
+			command = line[1:]
+		}
+	}
+	switch {
+	case pid == "":
+		return ""
+	case command == "":
+		return "pid " + pid
+	default:
+		return fmt.Sprintf("%s (pid %s)", command, pid)
+	}
+}
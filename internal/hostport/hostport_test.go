@@ -0,0 +1,47 @@
+package hostport
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseLsof(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"", ""},
+		{"p812\ncpostgres\nf7\n", "postgres (pid 812)"},
+		{"p812\ncpostgres\np900\ncnode\n", "postgres (pid 812)"},
+		{"p812\n", "pid 812"},
+	}
+	for _, tt := range tests {
+		if got := parseLsof(tt.out); got != tt.want {
+			t.Errorf("parseLsof(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestFree(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if Free(port, "tcp") {
+		t.Errorf("port %d is listened on but reported free", port)
+	}
+	ln.Close()
+	if !Free(port, "tcp") {
+		t.Errorf("port %d was closed but reported in use", port)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if Free(conn.LocalAddr().(*net.UDPAddr).Port, "udp") {
+		t.Error("bound UDP port reported free")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/coheez/silibox/internal/events"
 	"github.com/coheez/silibox/internal/state"
 )
 
@@ -50,7 +51,7 @@ type StatusInfo struct {
 }
 
 func Up(cfg Config) error {
-	return state.WithLockedState(func(s *state.State) error {
+	err := state.WithLockedState(func(s *state.State) error {
 		if err := ensureTemplate(cfg); err != nil {
 			return err
 		}
@@ -101,6 +102,8 @@ func Up(cfg Config) error {
 
 		return nil
 	})
+	events.RecordResult(events.VMUp, "", fmt.Sprintf("%d CPUs, %s memory, %s disk", cfg.CPUs, cfg.Memory, cfg.Disk), err)
+	return err
 }
 
 func Status() (string, error) {
@@ -162,7 +165,7 @@ func GetInstance() (LimaInstance, bool, error) {
 }
 
 func Stop() error {
-	return state.WithLockedState(func(s *state.State) error {
+	err := state.WithLockedState(func(s *state.State) error {
 		// Check current state
 		inst, found, err := getInstance()
 		if err != nil {
@@ -190,6 +193,8 @@ func Stop() error {
 		s.UpdateVMStatus("stopped")
 		return nil
 	})
+	events.RecordResult(events.VMStop, "", "", err)
+	return err
 }
 
 func instanceExists() (bool, error) {
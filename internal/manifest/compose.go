@@ -0,0 +1,312 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeFiles are the Compose file names looked up in a project directory, in order
+var ComposeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// FindCompose returns the Compose file of a project directory, or "" if it has none
+func FindCompose(projectDir string) string {
+	for _, name := range ComposeFiles {
+		path := filepath.Join(projectDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadServices reads the services of a project: from silibox.yaml, or else from its
+// Compose file. It returns the file they came from and warnings about settings a
+// Compose file had that silibox skips
+func LoadServices(projectDir string) (map[string]Service, string, []string, error) {
+	m, err := Load(projectDir)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if m != nil && len(m.Services) > 0 {
+		return m.Services, Path(projectDir), nil, nil
+	}
+	path := FindCompose(projectDir)
+	if path == "" {
+		return nil, "", nil, fmt.Errorf("%s has no services: and no Compose file was found in %s", FileName, projectDir)
+	}
+	services, warnings, err := ImportCompose(path)
+	return services, path, warnings, err
+}
+
+// composeFile is the part of the Compose format that maps onto services
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image           string              `yaml:"image"`
+	Build           yaml.Node           `yaml:"build"`
+	Command         Command             `yaml:"command"`
+	Environment     yaml.Node           `yaml:"environment"`
+	Ports           []yaml.Node         `yaml:"ports"`
+	DependsOn       yaml.Node           `yaml:"depends_on"`
+	Healthcheck     *composeHealthcheck `yaml:"healthcheck"`
+	Volumes         []yaml.Node         `yaml:"volumes"`
+	StopGracePeriod string              `yaml:"stop_grace_period"`
+}
+
+type composeHealthcheck struct {
+	Test     yaml.Node `yaml:"test"`
+	Interval string    `yaml:"interval"`
+	Disable  bool      `yaml:"disable"`
+}
+
+// ImportCompose converts the services of a Compose file
+// Settings silibox can't carry over are skipped and reported as warnings
+func ImportCompose(path string) (map[string]Service, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var f composeFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(f.Services) == 0 {
+		return nil, nil, fmt.Errorf("%s has no services", path)
+	}
+
+	services := make(map[string]Service, len(f.Services))
+	var warnings []string
+	for _, name := range sortedKeys(f.Services) {
+		svc, warns, err := convertComposeService(f.Services[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: service %s: %w", path, name, err)
+		}
+		for _, w := range warns {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", name, w))
+		}
+		services[name] = svc
+	}
+
+	m := Manifest{Services: services}
+	if err := m.validateServices(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return services, warnings, nil
+}
+
+func convertComposeService(cs composeService) (Service, []string, error) {
+	var warnings []string
+	svc := Service{Image: cs.Image, Command: cs.Command}
+
+	if !cs.Build.IsZero() {
+		if cs.Image == "" {
+			return svc, nil, fmt.Errorf("builds its image; silibox needs an image: to pull")
+		}
+		warnings = append(warnings, fmt.Sprintf("build: isn't supported, pulling %s instead", cs.Image))
+	}
+
+	env, err := composeEnvironment(cs.Environment)
+	if err != nil {
+		return svc, nil, err
+	}
+	svc.Environment = env
+
+	for _, p := range cs.Ports {
+		spec, err := composePort(p)
+		if err != nil {
+			return svc, nil, err
+		}
+		svc.Ports = append(svc.Ports, spec)
+	}
+
+	if svc.DependsOn, err = composeDependsOn(cs.DependsOn); err != nil {
+		return svc, nil, err
+	}
+
+	if hc := cs.Healthcheck; hc != nil && !hc.Disable {
+		command, err := composeTest(hc.Test)
+		if err != nil {
+			return svc, nil, err
+		}
+		if command != "" {
+			svc.Healthcheck = &Healthcheck{Command: command}
+			if hc.Interval != "" {
+				if svc.Healthcheck.Interval, err = time.ParseDuration(hc.Interval); err != nil {
+					return svc, nil, fmt.Errorf("healthcheck.interval: %w", err)
+				}
+			}
+		}
+	}
+
+	for _, v := range cs.Volumes {
+		source, target := composeVolume(v)
+		if source == "." || source == "./" {
+			svc.Workspace = true
+			if target != "/workspace" {
+				warnings = append(warnings, fmt.Sprintf("the project is mounted at /workspace instead of %s", target))
+			}
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("volume %s isn't imported", source))
+	}
+
+	if cs.StopGracePeriod != "" {
+		if svc.StopGrace, err = time.ParseDuration(cs.StopGracePeriod); err != nil {
+			return svc, nil, fmt.Errorf("stop_grace_period: %w", err)
+		}
+	}
+	return svc, warnings, nil
+}
+
+// composeEnvironment reads environment: as a map or a list of KEY=value
+func composeEnvironment(node yaml.Node) (map[string]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.MappingNode:
+		env := make(map[string]string, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := node.Content[i+1]
+			if value.Tag == "!!null" {
+				continue // Taken from the shell by Compose; silibox has no shell to take it from
+			}
+			env[node.Content[i].Value] = value.Value
+		}
+		return env, nil
+	case yaml.SequenceNode:
+		env := make(map[string]string, len(node.Content))
+		for _, item := range node.Content {
+			if key, value, ok := strings.Cut(item.Value, "="); ok {
+				env[key] = value
+			}
+		}
+		return env, nil
+	}
+	return nil, fmt.Errorf("environment must be a map or a list")
+}
+
+// composePort converts a port to a silibox port spec
+// Compose publishes a bare container port on a random host port, like silibox's :port
+func composePort(node yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		spec := node.Value
+		port, _, _ := strings.Cut(spec, "/")
+		if _, err := strconv.Atoi(port); err == nil {
+			spec = ":" + spec
+		}
+		return spec, nil
+	case yaml.MappingNode:
+		var long struct {
+			Target    int    `yaml:"target"`
+			Published string `yaml:"published"`
+			HostIP    string `yaml:"host_ip"`
+			Protocol  string `yaml:"protocol"`
+		}
+		if err := node.Decode(&long); err != nil || long.Target == 0 {
+			return "", fmt.Errorf("ports: target is required")
+		}
+		spec := fmt.Sprintf("%s:%d", long.Published, long.Target)
+		if long.HostIP != "" {
+			spec = long.HostIP + ":" + spec
+		}
+		if long.Protocol != "" {
+			spec += "/" + long.Protocol
+		}
+		return spec, nil
+	}
+	return "", fmt.Errorf("ports must be strings or mappings")
+}
+
+// composeDependsOn reads depends_on: as a list or a map of conditions
+// Every dependency is waited for until healthy, which covers all conditions
+func composeDependsOn(node yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.SequenceNode:
+		var deps []string
+		err := node.Decode(&deps)
+		return deps, err
+	case yaml.MappingNode:
+		var deps []string
+		for i := 0; i < len(node.Content); i += 2 {
+			deps = append(deps, node.Content[i].Value)
+		}
+		sort.Strings(deps)
+		return deps, nil
+	}
+	return nil, fmt.Errorf("depends_on must be a list or a map")
+}
+
+// composeTest converts a healthcheck test to a shell command
+func composeTest(node yaml.Node) (string, error) {
+	switch node.Kind {
+	case 0:
+		return "", nil
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		var test []string
+		if err := node.Decode(&test); err != nil || len(test) == 0 {
+			return "", fmt.Errorf("healthcheck.test must be a string or a list of strings")
+		}
+		switch test[0] {
+		case "NONE":
+			return "", nil
+		case "CMD-SHELL":
+			return strings.Join(test[1:], " "), nil
+		case "CMD":
+			quoted := make([]string, 0, len(test)-1)
+			for _, arg := range test[1:] {
+				quoted = append(quoted, shellQuote(arg))
+			}
+			return strings.Join(quoted, " "), nil
+		}
+		return "", fmt.Errorf("healthcheck.test must start with CMD, CMD-SHELL or NONE")
+	}
+	return "", fmt.Errorf("healthcheck.test must be a string or a list of strings")
+}
+
+// composeVolume returns the source and target of a volume in short or long syntax
+func composeVolume(node yaml.Node) (string, string) {
+	if node.Kind == yaml.MappingNode {
+		var long struct {
+			Source string `yaml:"source"`
+			Target string `yaml:"target"`
+		}
+		node.Decode(&long)
+		return long.Source, long.Target
+	}
+	parts := strings.Split(node.Value, ":")
+	if len(parts) == 1 {
+		return parts[0], parts[0] // Anonymous volume
+	}
+	return parts[0], parts[1]
+}
+
+// shellQuote quotes s for sh unless it only has safe characters
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportCompose(t *testing.T) {
+	dir := t.TempDir()
+	content := `services:
+  app:
+    build: .
+    image: shop-app
+    command: npm run dev
+    volumes:
+      - .:/app
+      - node_modules:/app/node_modules
+    ports:
+      - "3000:3000"
+      - 9229
+    environment:
+      - DATABASE_URL=postgres://db:5432/shop
+    depends_on:
+      db:
+        condition: service_healthy
+      cache:
+        condition: service_started
+  db:
+    image: postgres:16
+    environment:
+      POSTGRES_PASSWORD: dev
+      PGUSER:
+    healthcheck:
+      test: ["CMD", "pg_isready", "-d", "shop db"]
+      interval: 2s
+    stop_grace_period: 30s
+  cache:
+    image: redis:7
+    ports:
+      - target: 6379
+        published: "6380"
+    healthcheck:
+      test: ["CMD-SHELL", "redis-cli ping | grep PONG"]
+`
+	path := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindCompose(dir); got != path {
+		t.Fatalf("FindCompose() = %q, want %q", got, path)
+	}
+
+	services, warnings, err := ImportCompose(path)
+	if err != nil {
+		t.Fatalf("ImportCompose() error = %v", err)
+	}
+
+	app := services["app"]
+	if !app.Workspace || !slices.Equal(app.Command, Command{"sh", "-c", "npm run dev"}) {
+		t.Errorf("app = %+v, want a workspace service running npm run dev", app)
+	}
+	if !slices.Equal(app.Ports, []string{"3000:3000", ":9229"}) {
+		t.Errorf("app.Ports = %v", app.Ports)
+	}
+	if !slices.Equal(app.DependsOn, []string{"cache", "db"}) {
+		t.Errorf("app.DependsOn = %v", app.DependsOn)
+	}
+	if app.Environment["DATABASE_URL"] != "postgres://db:5432/shop" {
+		t.Errorf("app.Environment = %v", app.Environment)
+	}
+
+	db := services["db"]
+	if _, ok := db.Environment["PGUSER"]; ok || db.Environment["POSTGRES_PASSWORD"] != "dev" {
+		t.Errorf("db.Environment = %v", db.Environment)
+	}
+	if db.Healthcheck == nil || db.Healthcheck.Command != "pg_isready -d 'shop db'" || db.Healthcheck.Interval != 2*time.Second {
+		t.Errorf("db.Healthcheck = %+v", db.Healthcheck)
+	}
+	if db.StopGrace != 30*time.Second {
+		t.Errorf("db.StopGrace = %v", db.StopGrace)
+	}
+
+	cache := services["cache"]
+	if !slices.Equal(cache.Ports, []string{"6380:6379"}) {
+		t.Errorf("cache.Ports = %v", cache.Ports)
+	}
+	if cache.Healthcheck == nil || cache.Healthcheck.Command != "redis-cli ping | grep PONG" {
+		t.Errorf("cache.Healthcheck = %+v", cache.Healthcheck)
+	}
+
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"app: build:", "app: the project is mounted at /workspace instead of /app", "app: volume node_modules"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("warnings = %q, want one containing %q", warnings, want)
+		}
+	}
+}
+
+func TestImportComposeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "no services", content: "version: '3'\n", wantErr: "has no services"},
+		{name: "build only", content: "services:\n  app:\n    build: .\n", wantErr: "needs an image"},
+		{name: "unknown dependency", content: "services:\n  app:\n    image: x\n    depends_on: [db]\n", wantErr: `unknown service "db"`},
+		{name: "bad test", content: "services:\n  db:\n    image: x\n    healthcheck:\n      test: [RUN, x]\n", wantErr: "must start with CMD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "compose.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err := ImportCompose(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ImportCompose() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the project manifest looked up in an environment's project directory
+const FileName = "silibox.yaml"
+
+// DefaultHookTimeout is how long a hook may run when it doesn't set a timeout
+const DefaultHookTimeout = 30 * time.Second
+
+// Manifest is the per-project silibox configuration checked into the repository
+type Manifest struct {
+	Autosleep Autosleep     `yaml:"autosleep"`
+	Hooks     Hooks         `yaml:"hooks"`
+	StopGrace time.Duration `yaml:"stop_grace"` // Time podman waits after SIGTERM before killing; 0 keeps the default
+	Expose    []Expose      `yaml:"expose"`     // Hostnames served by the silibox proxy
+
+	// Services make the project a stack of linked environments, brought up with `sili up`
+	Services map[string]Service `yaml:"services"`
+}
+
+// Expose serves a container port on <host>.<env>.localhost, or <env>.localhost without a host
+type Expose struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+// Autosleep holds project-level autosleep overrides
+type Autosleep struct {
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // 0 keeps the default
+	Persistent  *bool         `yaml:"persistent"`   // nil keeps the default
+}
+
+// Hooks are commands run inside the container around its lifecycle
+type Hooks struct {
+	PreStop   *Hook `yaml:"pre_stop"`   // Before the container is stopped, e.g. to flush a database
+	PostStart *Hook `yaml:"post_start"` // After the container has started or woken up
+}
+
+// Hook is a shell command run with sh -c in the container
+type Hook struct {
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"` // 0 uses DefaultHookTimeout
+}
+
+// EffectiveTimeout returns the hook's timeout or the default
+func (h *Hook) EffectiveTimeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return DefaultHookTimeout
+}
+
+// ValidateHost checks that host can be used as a DNS label in a .localhost hostname
+func ValidateHost(host string) error {
+	if len(host) > 63 {
+		return fmt.Errorf("host %q is longer than 63 characters", host)
+	}
+	for i, c := range host {
+		alnum := c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+		if !alnum && (c != '-' || i == 0 || i == len(host)-1) {
+			return fmt.Errorf("host %q must be lowercase letters, digits and inner hyphens", host)
+		}
+	}
+	return nil
+}
+
+// Path returns the manifest path for a project directory
+func Path(projectDir string) string {
+	return filepath.Join(projectDir, FileName)
+}
+
+// LoadService reads the manifest from projectDir as it applies to service, or to the
+// whole project when service is empty
+func LoadService(projectDir, service string) (*Manifest, error) {
+	m, err := Load(projectDir)
+	if err != nil || m == nil || service == "" {
+		return m, err
+	}
+	return m.ForService(service), nil
+}
+
+// ForProject reads the manifest of an environment's project as LoadService does
+// Returns nil without error for an environment without a project directory
+func ForProject(projectDir, service string) (*Manifest, error) {
+	if projectDir == "" {
+		return nil, nil
+	}
+	return LoadService(projectDir, service)
+}
+
+// Load reads the manifest from projectDir
+// Returns nil without error if the project has no manifest
+func Load(projectDir string) (*Manifest, error) {
+	path := Path(projectDir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+func (m *Manifest) validate() error {
+	if m.Autosleep.IdleTimeout < 0 {
+		return fmt.Errorf("autosleep.idle_timeout must not be negative")
+	}
+	if m.StopGrace < 0 {
+		return fmt.Errorf("stop_grace must not be negative")
+	}
+	if err := validateExpose(m.Expose); err != nil {
+		return err
+	}
+	if err := validateHooks(m.Hooks); err != nil {
+		return err
+	}
+	return m.validateServices()
+}
+
+func validateExpose(expose []Expose) error {
+	hosts := make(map[string]bool, len(expose))
+	for i, e := range expose {
+		if err := ValidateHost(e.Host); err != nil {
+			return fmt.Errorf("expose[%d]: %w", i, err)
+		}
+		if e.Port < 1 || e.Port > 65535 {
+			return fmt.Errorf("expose[%d].port must be between 1 and 65535", i)
+		}
+		if hosts[e.Host] {
+			return fmt.Errorf("expose[%d]: host %q is exposed twice", i, e.Host)
+		}
+		hosts[e.Host] = true
+	}
+	return nil
+}
+
+func validateHooks(h Hooks) error {
+	hooks := []struct {
+		name string
+		hook *Hook
+	}{{"pre_stop", h.PreStop}, {"post_start", h.PostStart}}
+	for _, h := range hooks {
+		if h.hook == nil {
+			continue
+		}
+		if strings.TrimSpace(h.hook.Command) == "" {
+			return fmt.Errorf("hooks.%s.command is required", h.name)
+		}
+		if h.hook.Timeout < 0 {
+			return fmt.Errorf("hooks.%s.timeout must not be negative", h.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package manifest
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		wantNil        bool
+		wantErr        bool
+		wantTimeout    time.Duration
+		wantPersistent *bool
+	}{
+		{name: "missing", wantNil: true},
+		{
+			name:        "idle timeout",
+			content:     "autosleep:\n  idle_timeout: 2h\n",
+			wantTimeout: 2 * time.Hour,
+		},
+		{
+			name:           "persistent",
+			content:        "autosleep:\n  persistent: true\n",
+			wantPersistent: boolPtr(true),
+		},
+		{name: "empty", content: "", wantTimeout: 0},
+		{name: "invalid yaml", content: "autosleep: [", wantErr: true},
+		{name: "negative timeout", content: "autosleep:\n  idle_timeout: -5m\n", wantErr: true},
+		{name: "hooks", content: "hooks:\n  pre_stop:\n    command: pg_ctl stop\n    timeout: 1m\nstop_grace: 30s\n"},
+		{name: "hook without command", content: "hooks:\n  post_start:\n    timeout: 1m\n", wantErr: true},
+		{name: "negative stop grace", content: "stop_grace: -1s\n", wantErr: true},
+		{name: "expose", content: "expose:\n  - host: api\n    port: 3000\n  - host: \"\"\n    port: 5173\n"},
+		{name: "expose bad host", content: "expose:\n  - host: Api_1\n    port: 3000\n", wantErr: true},
+		{name: "expose bad port", content: "expose:\n  - host: api\n    port: 70000\n", wantErr: true},
+		{name: "expose duplicate host", content: "expose:\n  - host: api\n    port: 3000\n  - host: api\n    port: 3001\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if !tt.wantNil {
+				if err := os.WriteFile(Path(dir), []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m, err := Load(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if m != nil {
+					t.Errorf("expected nil manifest, got %+v", m)
+				}
+				return
+			}
+			if m.Autosleep.IdleTimeout != tt.wantTimeout {
+				t.Errorf("IdleTimeout = %v, want %v", m.Autosleep.IdleTimeout, tt.wantTimeout)
+			}
+			if (m.Autosleep.Persistent == nil) != (tt.wantPersistent == nil) ||
+				(tt.wantPersistent != nil && *m.Autosleep.Persistent != *tt.wantPersistent) {
+				t.Errorf("Persistent = %v, want %v", m.Autosleep.Persistent, tt.wantPersistent)
+			}
+		})
+	}
+}
+
+func TestLoadHooks(t *testing.T) {
+	dir := t.TempDir()
+	content := `stop_grace: 30s
+hooks:
+  pre_stop:
+    command: pg_ctl stop -m fast
+    timeout: 1m
+  post_start:
+    command: ./bin/migrate
+`
+	if err := os.WriteFile(Path(dir), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if m.StopGrace != 30*time.Second {
+		t.Errorf("StopGrace = %v, want 30s", m.StopGrace)
+	}
+	if m.Hooks.PreStop == nil || m.Hooks.PreStop.Command != "pg_ctl stop -m fast" || m.Hooks.PreStop.EffectiveTimeout() != time.Minute {
+		t.Errorf("PreStop = %+v, want pg_ctl with a 1m timeout", m.Hooks.PreStop)
+	}
+	if m.Hooks.PostStart == nil || m.Hooks.PostStart.EffectiveTimeout() != DefaultHookTimeout {
+		t.Errorf("PostStart = %+v, want the default timeout", m.Hooks.PostStart)
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
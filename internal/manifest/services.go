@@ -0,0 +1,188 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Healthcheck defaults
+const (
+	DefaultHealthInterval = time.Second
+	DefaultHealthTimeout  = 2 * time.Minute
+)
+
+// Service is one container of a multi-container stack, declared under services:
+// Each service becomes an environment named <stack>-<service>, reachable by the
+// service name from the other services of the stack
+type Service struct {
+	Image       string            `yaml:"image"`
+	Command     Command           `yaml:"command"`     // Replaces the image's command, or the idle shell of a workspace service
+	Workspace   bool              `yaml:"workspace"`   // Mount the project at /workspace and run as you, like `sili create`
+	Ports       []string          `yaml:"ports"`       // Port specs as for `sili create --ports`
+	Environment map[string]string `yaml:"environment"` // Set in the container
+	DependsOn   []string          `yaml:"depends_on"`  // Services started, and healthy, before this one
+	Healthcheck *Healthcheck      `yaml:"healthcheck"`
+	Expose      []Expose          `yaml:"expose"` // Hostnames served by the silibox proxy, on <host>.<stack>-<service>.localhost
+	Hooks       Hooks             `yaml:"hooks"`
+	StopGrace   time.Duration     `yaml:"stop_grace"`
+}
+
+// Command is a service command: a list runs as is, a string with sh -c
+type Command []string
+
+// UnmarshalYAML accepts both forms
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if strings.TrimSpace(node.Value) == "" {
+			*c = nil
+			return nil
+		}
+		*c = Command{"sh", "-c", node.Value}
+		return nil
+	}
+	var args []string
+	if err := node.Decode(&args); err != nil {
+		return fmt.Errorf("command must be a string or a list of strings")
+	}
+	*c = args
+	return nil
+}
+
+// Healthcheck tells `sili up` when a service is ready for the services that depend on it
+type Healthcheck struct {
+	Command  string        `yaml:"command"`  // Run with sh -c in the container; healthy once it exits 0
+	Interval time.Duration `yaml:"interval"` // Between attempts; 0 uses DefaultHealthInterval
+	Timeout  time.Duration `yaml:"timeout"`  // How long to wait overall; 0 uses DefaultHealthTimeout
+}
+
+// EffectiveInterval returns the healthcheck's interval or the default
+func (h *Healthcheck) EffectiveInterval() time.Duration {
+	if h.Interval > 0 {
+		return h.Interval
+	}
+	return DefaultHealthInterval
+}
+
+// EffectiveTimeout returns the healthcheck's timeout or the default
+func (h *Healthcheck) EffectiveTimeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return DefaultHealthTimeout
+}
+
+// ForService returns the manifest as it applies to the environment of a service
+// The project's autosleep settings cover the whole stack; hooks, stop_grace and
+// expose come from the service. A service that was removed from the manifest keeps
+// only the autosleep settings
+func (m *Manifest) ForService(name string) *Manifest {
+	scoped := &Manifest{Autosleep: m.Autosleep}
+	if svc, ok := m.Services[name]; ok {
+		scoped.Hooks = svc.Hooks
+		scoped.StopGrace = svc.StopGrace
+		scoped.Expose = svc.Expose
+	}
+	return scoped
+}
+
+// ServiceOrder lists the services so each comes after the ones it depends on
+func (m *Manifest) ServiceOrder() ([]string, error) {
+	deps := make(map[string][]string, len(m.Services))
+	for name, svc := range m.Services {
+		deps[name] = svc.DependsOn
+	}
+	return Order(deps)
+}
+
+// Order sorts the keys of deps so each comes after its dependencies, and
+// alphabetically otherwise. Dependencies that aren't keys are ignored
+func Order(deps map[string][]string) ([]string, error) {
+	pending := make(map[string]int, len(deps)) // Unmet dependencies
+	dependents := make(map[string][]string)
+	for name, ds := range deps {
+		pending[name] += 0
+		for _, d := range ds {
+			if _, ok := deps[d]; !ok {
+				continue
+			}
+			pending[name]++
+			dependents[d] = append(dependents[d], name)
+		}
+	}
+
+	var ready, order []string
+	for name, n := range pending {
+		if n == 0 {
+			ready = append(ready, name)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		for _, d := range dependents[name] {
+			if pending[d]--; pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if len(order) < len(deps) {
+		var cycle []string
+		for name, n := range pending {
+			if n > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("services %s depend on each other", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+func (m *Manifest) validateServices() error {
+	for _, name := range sortedKeys(m.Services) {
+		svc := m.Services[name]
+		if name == "" {
+			return fmt.Errorf("services: a service name is empty")
+		}
+		if err := ValidateHost(name); err != nil {
+			return fmt.Errorf("services.%s: invalid name: %w", name, err)
+		}
+		if strings.TrimSpace(svc.Image) == "" {
+			return fmt.Errorf("services.%s.image is required", name)
+		}
+		for _, d := range svc.DependsOn {
+			if d == name {
+				return fmt.Errorf("services.%s depends on itself", name)
+			}
+			if _, ok := m.Services[d]; !ok {
+				return fmt.Errorf("services.%s depends on unknown service %q", name, d)
+			}
+		}
+		if hc := svc.Healthcheck; hc != nil {
+			if strings.TrimSpace(hc.Command) == "" {
+				return fmt.Errorf("services.%s.healthcheck.command is required", name)
+			}
+			if hc.Interval < 0 || hc.Timeout < 0 {
+				return fmt.Errorf("services.%s.healthcheck durations must not be negative", name)
+			}
+		}
+		if svc.StopGrace < 0 {
+			return fmt.Errorf("services.%s.stop_grace must not be negative", name)
+		}
+		if err := validateExpose(svc.Expose); err != nil {
+			return fmt.Errorf("services.%s.%w", name, err)
+		}
+		if err := validateHooks(svc.Hooks); err != nil {
+			return fmt.Errorf("services.%s.%w", name, err)
+		}
+	}
+	_, err := m.ServiceOrder()
+	return err
+}
@@ -0,0 +1,142 @@
+package manifest
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServices(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "stack",
+			content: `services:
+  db:
+    image: postgres:16
+    healthcheck:
+      command: pg_isready
+  app:
+    image: node:20
+    workspace: true
+    depends_on: [db]
+`,
+		},
+		{name: "no image", content: "services:\n  db: {}\n", wantErr: "services.db.image is required"},
+		{name: "bad name", content: "services:\n  My_DB:\n    image: postgres\n", wantErr: "invalid name"},
+		{name: "unknown dependency", content: "services:\n  app:\n    image: node\n    depends_on: [db]\n", wantErr: `unknown service "db"`},
+		{name: "self dependency", content: "services:\n  app:\n    image: node\n    depends_on: [app]\n", wantErr: "depends on itself"},
+		{
+			name:    "cycle",
+			content: "services:\n  a:\n    image: x\n    depends_on: [b]\n  b:\n    image: x\n    depends_on: [a]\n",
+			wantErr: "services a, b depend on each other",
+		},
+		{name: "healthcheck without command", content: "services:\n  db:\n    image: x\n    healthcheck:\n      interval: 1s\n", wantErr: "healthcheck.command is required"},
+		{name: "bad expose", content: "services:\n  web:\n    image: x\n    expose:\n      - host: api\n        port: 0\n", wantErr: "services.web.expose"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(Path(dir), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(dir)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want []string
+	}{
+		{"independent", map[string][]string{"web": nil, "db": nil, "cache": nil}, []string{"cache", "db", "web"}},
+		{"chain", map[string][]string{"app": {"api"}, "api": {"db"}, "db": nil}, []string{"db", "api", "app"}},
+		{"diamond", map[string][]string{"app": {"db", "cache"}, "db": nil, "cache": nil, "worker": {"db"}}, []string{"cache", "db", "app", "worker"}},
+		{"missing dependency ignored", map[string][]string{"app": {"gone"}}, []string{"app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Order(tt.deps)
+			if err != nil {
+				t.Fatalf("Order() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Order() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Order(map[string][]string{"a": {"b"}, "b": {"a"}, "c": nil}); err == nil {
+		t.Error("Order() with a cycle: expected an error")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	content := `services:
+  worker:
+    image: node:20
+    command: npm run worker && echo done
+  cache:
+    image: redis:7
+    command: [redis-server, --appendonly, "yes"]
+  db:
+    image: postgres:16
+`
+	if err := os.WriteFile(Path(dir), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := map[string]Command{
+		"worker": {"sh", "-c", "npm run worker && echo done"},
+		"cache":  {"redis-server", "--appendonly", "yes"},
+		"db":     nil,
+	}
+	for name, cmd := range want {
+		if got := m.Services[name].Command; !slices.Equal(got, cmd) {
+			t.Errorf("%s: Command = %q, want %q", name, got, cmd)
+		}
+	}
+}
+
+func TestForService(t *testing.T) {
+	timeout := time.Hour
+	m := &Manifest{
+		Autosleep: Autosleep{IdleTimeout: timeout},
+		StopGrace: time.Minute,
+		Services: map[string]Service{
+			"db": {Image: "postgres", StopGrace: 30 * time.Second, Hooks: Hooks{PreStop: &Hook{Command: "pg_ctl stop"}}},
+		},
+	}
+
+	db := m.ForService("db")
+	if db.Autosleep.IdleTimeout != timeout {
+		t.Errorf("IdleTimeout = %v, want the stack's %v", db.Autosleep.IdleTimeout, timeout)
+	}
+	if db.StopGrace != 30*time.Second || db.Hooks.PreStop == nil {
+		t.Errorf("db = %+v, want the service's stop_grace and hooks", db)
+	}
+	if gone := m.ForService("gone"); gone.StopGrace != 0 || gone.Hooks.PreStop != nil {
+		t.Errorf("removed service = %+v, want only autosleep settings", gone)
+	}
+}
@@ -0,0 +1,372 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// ContainerStats is the live usage of one container
+type ContainerStats struct {
+	CPUPercent float64
+	MemUsage   uint64
+	MemLimit   uint64
+	NetRx      uint64
+	NetTx      uint64
+}
+
+// VMStats is the live usage of the VM
+type VMStats struct {
+	Uptime       time.Duration
+	Load1        float64
+	MemTotal     uint64
+	MemAvailable uint64
+}
+
+// usageProbe reads live usage through the VM; replaced in tests
+type usageProbe interface {
+	containerStats(names []string) (map[string]ContainerStats, error)
+	vmStats() (VMStats, error)
+}
+
+var probe usageProbe = limaProbe{}
+
+// Collect gathers every metric family from state, this process's counters and live probes
+// Live usage is only probed while the VM runs; a failed probe is reported in
+// silibox_collector_success rather than failing the scrape
+func Collect() ([]Family, error) {
+	st, err := state.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	return collect(st, autosleepCounted.snapshot(), time.Now()), nil
+}
+
+func collect(st *state.State, counts autosleepCounts, now time.Time) []Family {
+	running := Family{Name: "silibox_env_running", Help: "Whether the environment is running (1) or stopped (0).", Type: Gauge}
+	persistent := Family{Name: "silibox_env_persistent", Help: "Whether the environment is exempt from autosleep.", Type: Gauge}
+	idle := Family{Name: "silibox_env_idle_seconds", Help: "Time since the running environment was last used.", Type: Gauge}
+	cpu := Family{Name: "silibox_env_cpu_percent", Help: "CPU usage of the environment from podman stats.", Type: Gauge}
+	mem := Family{Name: "silibox_env_memory_usage_bytes", Help: "Memory used by the environment.", Type: Gauge}
+	memLimit := Family{Name: "silibox_env_memory_limit_bytes", Help: "Memory limit of the environment.", Type: Gauge}
+	netRx := Family{Name: "silibox_env_network_receive_bytes_total", Help: "Bytes received by the environment since it started.", Type: Counter}
+	netTx := Family{Name: "silibox_env_network_transmit_bytes_total", Help: "Bytes sent by the environment since it started.", Type: Counter}
+
+	vmRunning := Family{Name: "silibox_vm_running", Help: "Whether the VM is running (1) or stopped (0).", Type: Gauge}
+	vmIdle := Family{Name: "silibox_vm_idle_seconds", Help: "Time since the running VM was last used.", Type: Gauge}
+	vmCPUs := Family{Name: "silibox_vm_cpus", Help: "vCPUs configured for the VM.", Type: Gauge}
+	vmUptime := Family{Name: "silibox_vm_uptime_seconds", Help: "Time since the VM booted.", Type: Gauge}
+	vmLoad := Family{Name: "silibox_vm_load1", Help: "One-minute load average inside the VM.", Type: Gauge}
+	vmMemTotal := Family{Name: "silibox_vm_memory_total_bytes", Help: "Memory available to the VM's kernel.", Type: Gauge}
+	vmMemAvail := Family{Name: "silibox_vm_memory_available_bytes", Help: "Memory the VM's kernel can still hand out.", Type: Gauge}
+
+	collectorOK := Family{Name: "silibox_collector_success", Help: "Whether a live probe succeeded during this scrape.", Type: Gauge}
+
+	envs := st.ListEnvs()
+	names := make([]string, 0, len(envs))
+	byName := make(map[string]*state.EnvInfo, len(envs))
+	for _, env := range envs {
+		byName[env.Name] = env
+	}
+	for _, name := range sortedKeys(byName) {
+		env := byName[name]
+		up := 0.0
+		if env.Status == "running" {
+			up = 1
+			names = append(names, name)
+			idle.Add(now.Sub(env.LastActive).Seconds(), "env", name)
+		}
+		running.Add(up, "env", name)
+		persistent.Add(boolValue(env.Persistent), "env", name)
+	}
+
+	vm := st.GetVM()
+	if vm != nil {
+		up := 0.0
+		if vm.Status == "running" {
+			up = 1
+			vmIdle.Add(now.Sub(vm.LastActive).Seconds())
+		}
+		vmRunning.Add(up)
+		vmCPUs.Add(float64(vm.CPUs))
+	}
+
+	if vm != nil && vm.Status == "running" {
+		if stats, err := probe.vmStats(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read VM usage: %v\n", err)
+			collectorOK.Add(0, "collector", "vm")
+		} else {
+			collectorOK.Add(1, "collector", "vm")
+			vmUptime.Add(stats.Uptime.Seconds())
+			vmLoad.Add(stats.Load1)
+			vmMemTotal.Add(float64(stats.MemTotal))
+			vmMemAvail.Add(float64(stats.MemAvailable))
+		}
+
+		if len(names) > 0 {
+			if stats, err := probe.containerStats(names); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to read container usage: %v\n", err)
+				collectorOK.Add(0, "collector", "podman")
+			} else {
+				collectorOK.Add(1, "collector", "podman")
+				for _, name := range names {
+					s, ok := stats[name]
+					if !ok {
+						continue
+					}
+					cpu.Add(s.CPUPercent, "env", name)
+					mem.Add(float64(s.MemUsage), "env", name)
+					memLimit.Add(float64(s.MemLimit), "env", name)
+					netRx.Add(float64(s.NetRx), "env", name)
+					netTx.Add(float64(s.NetTx), "env", name)
+				}
+			}
+		}
+	}
+
+	families := []Family{
+		running, persistent, idle, cpu, mem, memLimit, netRx, netTx,
+		vmRunning, vmIdle, vmCPUs, vmUptime, vmLoad, vmMemTotal, vmMemAvail,
+	}
+	families = append(families, autosleepFamilies(counts)...)
+	families = append(families, lockWaitFamilies(state.LockWaits())...)
+	return append(families, collectorOK)
+}
+
+// Reasons an autosleep stop is counted under
+const (
+	reasonIdle           = "idle"
+	reasonSchedule       = "schedule"
+	reasonMemoryPressure = "memory_pressure"
+)
+
+// stopReason classifies an autosleep.stop event by its message
+func stopReason(message string) string {
+	switch {
+	case strings.HasPrefix(message, "memory pressure"):
+		return reasonMemoryPressure
+	case strings.HasPrefix(message, "schedule"):
+		return reasonSchedule
+	default:
+		return reasonIdle
+	}
+}
+
+// autosleepKey labels silibox_autosleep_stops_total
+type autosleepKey struct{ env, reason string }
+
+// autosleepCounts are the agent's stops and heads-ups since it started
+type autosleepCounts struct {
+	stops    map[autosleepKey]int
+	vmStops  int
+	warnings int
+}
+
+func (c *autosleepCounts) count(e events.Event) {
+	switch e.Type {
+	case events.AutosleepStop:
+		if c.stops == nil {
+			c.stops = make(map[autosleepKey]int)
+		}
+		c.stops[autosleepKey{e.Env, stopReason(e.Message)}]++
+	case events.AutosleepVM:
+		c.vmStops++
+	case events.AutosleepWarn:
+		c.warnings++
+	}
+}
+
+var (
+	autosleepMu      sync.Mutex
+	autosleepCounted autosleepCounts
+)
+
+// CountAutosleep counts an autosleep stop, VM stop or heads-up event of this process
+// The counters only grow while the process runs, however the event log rotates;
+// other event types are ignored
+func CountAutosleep(e events.Event) {
+	autosleepMu.Lock()
+	defer autosleepMu.Unlock()
+	autosleepCounted.count(e)
+}
+
+// snapshot copies the counters for a scrape
+func (c *autosleepCounts) snapshot() autosleepCounts {
+	autosleepMu.Lock()
+	defer autosleepMu.Unlock()
+	copied := *c
+	copied.stops = make(map[autosleepKey]int, len(c.stops))
+	for k, n := range c.stops {
+		copied.stops[k] = n
+	}
+	return copied
+}
+
+// autosleepFamilies reports the agent's stops and heads-ups since it started
+func autosleepFamilies(counts autosleepCounts) []Family {
+	stops := Family{Name: "silibox_autosleep_stops_total", Help: "Environments stopped by autosleep since the agent started.", Type: Counter}
+	vmStops := Family{Name: "silibox_autosleep_vm_stops_total", Help: "VM stops by autosleep since the agent started.", Type: Counter}
+	warnings := Family{Name: "silibox_autosleep_warnings_total", Help: "Heads-ups sent before planned stops since the agent started.", Type: Counter}
+
+	byLabel := make(map[string]autosleepKey, len(counts.stops))
+	for k := range counts.stops {
+		byLabel[k.env+"\x00"+k.reason] = k
+	}
+	for _, label := range sortedKeys(byLabel) {
+		k := byLabel[label]
+		stops.Add(float64(counts.stops[k]), "env", k.env, "reason", k.reason)
+	}
+	vmStops.Add(float64(counts.vmStops))
+	warnings.Add(float64(counts.warnings))
+	return []Family{stops, vmStops, warnings}
+}
+
+// lockWaitFamilies reports how long this process waited for the state lock
+func lockWaitFamilies(stats state.LockWaitStats) []Family {
+	waits := Family{Name: "silibox_state_lock_wait_seconds", Help: "Time this process waited to acquire the state lock.", Type: Histogram}
+	for i, le := range state.LockWaitBuckets {
+		waits.AddSuffixed("_bucket", float64(stats.Buckets[i]), "le", formatValue(le.Seconds()))
+	}
+	waits.AddSuffixed("_bucket", float64(stats.Count), "le", "+Inf")
+	waits.AddSuffixed("_sum", stats.Sum.Seconds())
+	waits.AddSuffixed("_count", float64(stats.Count))
+
+	timeouts := Family{Name: "silibox_state_lock_timeouts_total", Help: "State lock acquisitions by this process that timed out.", Type: Counter}
+	timeouts.Add(float64(stats.Timeouts))
+	return []Family{waits, timeouts}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// limaProbe reads usage through limactl shell
+type limaProbe struct{}
+
+func vmOutput(args ...string) (string, error) {
+	cmd := exec.Command("limactl", append([]string{"shell", lima.Instance, "--"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w (output: %s)", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// podmanStats is the subset of podman's ContainerStats we read
+// Podman 4 reports NetInput/NetOutput, podman 5 per-interface Network counters
+type podmanStats struct {
+	Name      string
+	CPU       float64
+	MemUsage  uint64
+	MemLimit  uint64
+	NetInput  uint64
+	NetOutput uint64
+	Network   map[string]struct {
+		RxBytes uint64
+		TxBytes uint64
+	}
+}
+
+func (limaProbe) containerStats(names []string) (map[string]ContainerStats, error) {
+	args := append([]string{"podman", "stats", "--no-stream", "--format", "{{json .ContainerStats}}"}, names...)
+	out, err := vmOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseContainerStats(out)
+}
+
+// parseContainerStats parses one JSON object per line
+func parseContainerStats(out string) (map[string]ContainerStats, error) {
+	stats := make(map[string]ContainerStats)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var ps podmanStats
+		if err := json.Unmarshal([]byte(line), &ps); err != nil {
+			return nil, fmt.Errorf("unexpected podman stats output %q: %w", line, err)
+		}
+		cs := ContainerStats{
+			CPUPercent: ps.CPU,
+			MemUsage:   ps.MemUsage,
+			MemLimit:   ps.MemLimit,
+			NetRx:      ps.NetInput,
+			NetTx:      ps.NetOutput,
+		}
+		for _, n := range ps.Network {
+			cs.NetRx += n.RxBytes
+			cs.NetTx += n.TxBytes
+		}
+		stats[ps.Name] = cs
+	}
+	return stats, nil
+}
+
+func (limaProbe) vmStats() (VMStats, error) {
+	out, err := vmOutput("cat", "/proc/uptime", "/proc/loadavg", "/proc/meminfo")
+	if err != nil {
+		return VMStats{}, err
+	}
+	return parseVMStats(out)
+}
+
+// parseVMStats parses /proc/uptime, /proc/loadavg and /proc/meminfo, in that order
+func parseVMStats(out string) (VMStats, error) {
+	var vs VMStats
+	sc := bufio.NewScanner(strings.NewReader(out))
+
+	for i := 0; i < 2; i++ {
+		if !sc.Scan() {
+			return VMStats{}, fmt.Errorf("unexpected /proc output: too short")
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			return VMStats{}, fmt.Errorf("unexpected /proc output %q", sc.Text())
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return VMStats{}, fmt.Errorf("unexpected /proc output %q", sc.Text())
+		}
+		if i == 0 {
+			vs.Uptime = time.Duration(v * float64(time.Second))
+		} else {
+			vs.Load1 = v
+		}
+	}
+
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			vs.MemTotal = kb * 1024
+		case "MemAvailable:":
+			vs.MemAvailable = kb * 1024
+		}
+	}
+	return vs, nil
+}
@@ -0,0 +1,130 @@
+// Package metrics exposes silibox resource usage in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric types
+const (
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+)
+
+// Label is one name/value pair; labels keep the order they are added in
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a family
+// Suffix is appended to the family name, e.g. "_bucket" for histograms
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named group of samples of the same type
+// Counter names end in _total; the suffix is dropped from the OpenMetrics family name
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Add appends a sample with labels given as name/value pairs
+func (f *Family) Add(value float64, labels ...string) {
+	f.AddSuffixed("", value, labels...)
+}
+
+// AddSuffixed appends a sample whose name carries a suffix
+func (f *Family) AddSuffixed(suffix string, value float64, labels ...string) {
+	s := Sample{Suffix: suffix, Value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		s.Labels = append(s.Labels, Label{Name: labels[i], Value: labels[i+1]})
+	}
+	f.Samples = append(f.Samples, s)
+}
+
+// Content types of the two supported formats
+const (
+	ContentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Write renders families in the Prometheus text format, or in OpenMetrics when openMetrics is set
+// Families without samples are skipped
+func Write(w io.Writer, families []Family, openMetrics bool) error {
+	var b strings.Builder
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		name := f.Name
+		if openMetrics && f.Type == Counter {
+			name = strings.TrimSuffix(name, "_total")
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, escapeHelp(f.Help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.Type)
+		for _, s := range f.Samples {
+			b.WriteString(f.Name)
+			b.WriteString(s.Suffix)
+			if len(s.Labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", l.Name, escapeLabel(l.Value))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(formatValue(s.Value))
+			b.WriteByte('\n')
+		}
+	}
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// sortedKeys returns the keys of m in order, so output is stable between scrapes
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/state"
+)
+
+type fakeProbe struct {
+	containers map[string]ContainerStats
+	vm         VMStats
+	err        error
+}
+
+func (f fakeProbe) containerStats(names []string) (map[string]ContainerStats, error) {
+	return f.containers, f.err
+}
+func (f fakeProbe) vmStats() (VMStats, error) { return f.vm, f.err }
+
+func TestWrite(t *testing.T) {
+	stops := Family{Name: "silibox_autosleep_stops_total", Help: "Stops.", Type: Counter}
+	stops.Add(3, "env", "web", "reason", "idle")
+	empty := Family{Name: "silibox_empty", Help: "Nothing.", Type: Gauge}
+	idle := Family{Name: "silibox_env_idle_seconds", Help: "Idle \"time\".", Type: Gauge}
+	idle.Add(90.5, "env", `we"b`)
+
+	var text strings.Builder
+	if err := Write(&text, []Family{stops, empty, idle}, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP silibox_autosleep_stops_total Stops.
+# TYPE silibox_autosleep_stops_total counter
+silibox_autosleep_stops_total{env="web",reason="idle"} 3
+# HELP silibox_env_idle_seconds Idle "time".
+# TYPE silibox_env_idle_seconds gauge
+silibox_env_idle_seconds{env="we\"b"} 90.5
+`
+	if text.String() != want {
+		t.Errorf("text format:\n%s\nwant:\n%s", text.String(), want)
+	}
+
+	var om strings.Builder
+	if err := Write(&om, []Family{stops}, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(om.String(), "# TYPE silibox_autosleep_stops counter\n") || !strings.HasSuffix(om.String(), "# EOF\n") {
+		t.Errorf("OpenMetrics format:\n%s", om.String())
+	}
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Now()
+	st := state.NewState()
+	st.SetVM(&state.VMInfo{Status: "running", CPUs: 4, LastActive: now.Add(-time.Minute)})
+	st.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running", LastActive: now.Add(-10 * time.Minute)})
+	st.UpsertEnv(&state.EnvInfo{Name: "db", Status: "stopped", Persistent: true})
+
+	evs := []events.Event{
+		{Type: events.AutosleepStop, Env: "web", Message: "idle for 16 minutes (timeout 15m0s)"},
+		{Type: events.AutosleepStop, Env: "web", Message: "memory pressure: host memory 93% >= 90%"},
+		{Type: events.AutosleepStop, Env: "web", Message: "idle for 20 minutes (timeout 15m0s)"},
+		{Type: events.AutosleepVM, Message: "all environments stopped"},
+		{Type: events.EnvStop, Env: "web"},
+	}
+	var counts autosleepCounts
+	for _, e := range evs {
+		counts.count(e)
+	}
+
+	old := probe
+	defer func() { probe = old }()
+	probe = fakeProbe{
+		containers: map[string]ContainerStats{"web": {CPUPercent: 2.5, MemUsage: 1 << 20, NetRx: 100}},
+		vm:         VMStats{Uptime: time.Hour, MemTotal: 8 << 30},
+	}
+
+	var out strings.Builder
+	Write(&out, collect(st, counts, now), false)
+	for _, line := range []string{
+		`silibox_env_running{env="db"} 0`,
+		`silibox_env_running{env="web"} 1`,
+		`silibox_env_persistent{env="db"} 1`,
+		`silibox_env_idle_seconds{env="web"} 600`,
+		`silibox_env_cpu_percent{env="web"} 2.5`,
+		`silibox_env_memory_usage_bytes{env="web"} 1.048576e+06`,
+		`silibox_vm_uptime_seconds 3600`,
+		`silibox_vm_cpus 4`,
+		`silibox_autosleep_stops_total{env="web",reason="idle"} 2`,
+		`silibox_autosleep_stops_total{env="web",reason="memory_pressure"} 1`,
+		`silibox_autosleep_vm_stops_total 1`,
+		`silibox_state_lock_wait_seconds_bucket{le="+Inf"}`,
+		`silibox_collector_success{collector="podman"} 1`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("missing %q in:\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `silibox_env_idle_seconds{env="db"}`) {
+		t.Error("stopped env reported an idle time")
+	}
+
+	// A failing probe is reported, not fatal
+	probe = fakeProbe{err: errors.New("limactl failed")}
+	out.Reset()
+	Write(&out, collect(st, counts, now), false)
+	if !strings.Contains(out.String(), `silibox_collector_success{collector="vm"} 0`) || !strings.Contains(out.String(), "silibox_env_running") {
+		t.Errorf("unexpected output with a failing probe:\n%s", out.String())
+	}
+}
+
+func TestParseContainerStats(t *testing.T) {
+	out := `{"Name":"web","CPU":1.5,"MemUsage":2048,"MemLimit":4096,"NetInput":10,"NetOutput":20}
+{"Name":"api","CPU":0,"MemUsage":1,"MemLimit":2,"Network":{"eth0":{"RxBytes":5,"TxBytes":6},"eth1":{"RxBytes":1,"TxBytes":1}}}`
+	stats, err := parseContainerStats(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats["web"]; got.CPUPercent != 1.5 || got.MemUsage != 2048 || got.NetRx != 10 || got.NetTx != 20 {
+		t.Errorf("web = %+v", got)
+	}
+	if got := stats["api"]; got.NetRx != 6 || got.NetTx != 7 {
+		t.Errorf("api = %+v, want summed per-interface counters", got)
+	}
+	if _, err := parseContainerStats("not json"); err == nil {
+		t.Error("expected an error for unexpected output")
+	}
+}
+
+func TestParseVMStats(t *testing.T) {
+	out := "3600.50 7000.00\n0.42 0.30 0.20 1/120 999\nMemTotal:       8000 kB\nMemFree:  1000 kB\nMemAvailable:    6000 kB\n"
+	vs, err := parseVMStats(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs.Uptime != 3600500*time.Millisecond || vs.Load1 != 0.42 || vs.MemTotal != 8000*1024 || vs.MemAvailable != 6000*1024 {
+		t.Errorf("parseVMStats() = %+v", vs)
+	}
+	if _, err := parseVMStats("garbage"); err == nil {
+		t.Error("expected an error for unexpected output")
+	}
+}
+
+func TestServe(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	state.ResetForTesting()
+	defer state.ResetForTesting()
+
+	addr, stop, err := Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr.String()+"/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != ContentTypeOpenMetrics {
+		t.Fatalf("status %s, content type %q: %s", resp.Status, resp.Header.Get("Content-Type"), body)
+	}
+	if !strings.Contains(string(body), "silibox_state_lock_wait_seconds_count") || !strings.HasSuffix(string(body), "# EOF\n") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+}
+
+func TestCountAutosleep(t *testing.T) {
+	old := autosleepCounted
+	defer func() { autosleepCounted = old }()
+	autosleepCounted = autosleepCounts{}
+
+	CountAutosleep(events.Event{Type: events.AutosleepStop, Env: "web", Message: "schedule: outside 09:00-18:00"})
+	CountAutosleep(events.Event{Type: events.AutosleepWarn, Env: "web"})
+	CountAutosleep(events.Event{Type: events.EnvStart, Env: "web"})
+	snap := autosleepCounted.snapshot()
+	CountAutosleep(events.Event{Type: events.AutosleepStop, Env: "web", Message: "schedule: outside 09:00-18:00"})
+
+	if n := snap.stops[autosleepKey{"web", reasonSchedule}]; n != 1 {
+		t.Errorf("snapshot counted %d schedule stops, want 1", n)
+	}
+	if snap.warnings != 1 || snap.vmStops != 0 {
+		t.Errorf("snapshot = %d warnings, %d VM stops, want 1, 0", snap.warnings, snap.vmStops)
+	}
+	if n := autosleepCounted.stops[autosleepKey{"web", reasonSchedule}]; n != 2 {
+		t.Errorf("counted %d schedule stops, want 2", n)
+	}
+}
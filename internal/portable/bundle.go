@@ -0,0 +1,286 @@
+package portable
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+const (
+	// FormatVersion is the bundle layout version written into the manifest
+	FormatVersion = 1
+
+	manifestName = "manifest.json"
+	volumesDir   = "volumes"
+)
+
+// Manifest describes everything needed to recreate a silibox setup on another machine
+type Manifest struct {
+	Format     int        `json:"format"`
+	CreatedAt  time.Time  `json:"created_at"`
+	SourceHome string     `json:"source_home"`
+	VM         *VMSpec    `json:"vm,omitempty"`
+	Envs       []EnvSpec  `json:"envs"`
+	Shims      []ShimSpec `json:"shims"`
+}
+
+// VMSpec holds the VM resources to recreate
+type VMSpec struct {
+	CPUs   int    `json:"cpus"`
+	Memory string `json:"memory"`
+	Disk   string `json:"disk"`
+}
+
+// EnvSpec holds the definition of a single environment
+type EnvSpec struct {
+	Name        string              `json:"name"`
+	Image       string              `json:"image"`
+	ProjectPath string              `json:"project_path"`
+	WorkingDir  string              `json:"working_dir"`
+	User        string              `json:"user,omitempty"`
+	Ports       []state.PortMapping `json:"ports,omitempty"`
+	Volumes     map[string]string   `json:"volumes,omitempty"` // Hot dir -> volume name
+	Persistent  bool                `json:"persistent"`
+	IdleTimeout time.Duration       `json:"idle_timeout,omitempty"`
+	Routes      []state.Route       `json:"routes,omitempty"` // Hostnames added with `sili expose`
+	TrustCA     bool                `json:"trust_ca,omitempty"`
+	Network     string              `json:"network,omitempty"` // Network group
+	Stack       string              `json:"stack,omitempty"`   // Stack brought up with `sili up`; imports leave it to `sili up`
+	// VolumeData lists volumes whose contents are included in the bundle
+	VolumeData []string `json:"volume_data,omitempty"`
+}
+
+// ShimSpec holds a single exported shim
+type ShimSpec struct {
+	Name   string `json:"name"`
+	Env    string `json:"env"`
+	Target string `json:"target"`
+}
+
+// BuildManifest converts the current state into a portable manifest
+func BuildManifest(s *state.State) *Manifest {
+	home, _ := os.UserHomeDir()
+	m := &Manifest{
+		Format:     FormatVersion,
+		CreatedAt:  time.Now(),
+		SourceHome: home,
+		Envs:       make([]EnvSpec, 0, len(s.Envs)),
+		Shims:      make([]ShimSpec, 0, len(s.Shims)),
+	}
+
+	if vm := s.GetVM(); vm != nil {
+		m.VM = &VMSpec{CPUs: vm.CPUs, Memory: vm.Memory, Disk: vm.Disk}
+	}
+
+	for _, env := range s.ListEnvs() {
+		workDir := "/workspace"
+		if mount, ok := env.Mounts["work"]; ok && mount.Guest != "" {
+			workDir = mount.Guest
+		}
+		m.Envs = append(m.Envs, EnvSpec{
+			Name:        env.Name,
+			Image:       env.Image,
+			ProjectPath: env.ProjectPath,
+			WorkingDir:  workDir,
+			User:        env.User.Name,
+			Ports:       declaredPorts(env.Ports),
+			Volumes:     env.Volumes,
+			Persistent:  env.Persistent,
+			IdleTimeout: env.IdleTimeout,
+			Routes:      env.Routes,
+			TrustCA:     env.TrustCA,
+			Network:     env.Network,
+			Stack:       env.Stack,
+		})
+	}
+	sort.Slice(m.Envs, func(i, j int) bool {
+		return m.Envs[i].Name < m.Envs[j].Name
+	})
+
+	for name, info := range s.ListShims() {
+		m.Shims = append(m.Shims, ShimSpec{Name: name, Env: info.Env, Target: info.Target})
+	}
+	sort.Slice(m.Shims, func(i, j int) bool {
+		return m.Shims[i].Name < m.Shims[j].Name
+	})
+
+	return m
+}
+
+// declaredPorts drops automatic forwards, which only live as long as the container's sockets
+func declaredPorts(ports []state.PortMapping) []state.PortMapping {
+	var declared []state.PortMapping
+	for _, p := range ports {
+		if !p.Auto {
+			declared = append(declared, p)
+		}
+	}
+	return declared
+}
+
+// VolumeEntry returns the path of a volume archive inside the bundle
+func VolumeEntry(volumeName string) string {
+	return volumesDir + "/" + volumeName + ".tar"
+}
+
+// Writer writes a bundle as a gzip-compressed tar archive
+type Writer struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+// NewWriter returns a bundle writer on top of w
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// WriteManifest adds the manifest to the bundle
+func (w *Writer) WriteManifest(m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return w.WriteFile(manifestName, data)
+}
+
+// WriteFile adds a regular file with the given contents to the bundle
+func (w *Writer) WriteFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteFileFrom adds a file to the bundle, copying size bytes from r
+func (w *Writer) WriteFileFrom(name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	if _, err := io.CopyN(w.tw, r, size); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close flushes the archive
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// Extract unpacks a bundle into dir and returns its manifest
+// Volume archives are left on disk under dir for the caller to import
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a silibox bundle: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Reject entries escaping the extraction directory
+		name := filepath.Clean(hdr.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("invalid entry in bundle: %s", hdr.Name)
+		}
+
+		if name == manifestName {
+			var m Manifest
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %w", err)
+			}
+			manifest = &m
+			continue
+		}
+
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+		f.Close()
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("bundle has no %s", manifestName)
+	}
+	if manifest.Format > FormatVersion {
+		return nil, fmt.Errorf("bundle format %d is newer than supported (%d) - update sili", manifest.Format, FormatVersion)
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// volumeNamePattern is the volume names Podman accepts
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// validate rejects names from the manifest that would be used as paths outside the
+// shim directory or the extracted bundle
+func (m *Manifest) validate() error {
+	for _, spec := range m.Shims {
+		if spec.Name == "" || spec.Name == "." || spec.Name == ".." || filepath.Base(spec.Name) != spec.Name {
+			return fmt.Errorf("invalid shim name %q", spec.Name)
+		}
+	}
+	for _, env := range m.Envs {
+		volumes := slices.Collect(maps.Values(env.Volumes))
+		for _, name := range append(volumes, env.VolumeData...) {
+			if !volumeNamePattern.MatchString(name) {
+				return fmt.Errorf("invalid volume name %q of %s", name, env.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package portable
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+func TestPathMapApply(t *testing.T) {
+	pm, err := ParsePathMap([]string{
+		"/Users/old=/Users/new",
+		"/Users/old/work=/src",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "exact match", path: "/Users/old", want: "/Users/new"},
+		{name: "nested path", path: "/Users/old/code/app", want: "/Users/new/code/app"},
+		{name: "longest prefix wins", path: "/Users/old/work/api", want: "/src/api"},
+		{name: "no partial segment match", path: "/Users/older/app", want: "/Users/older/app"},
+		{name: "unmapped path", path: "/opt/project", want: "/opt/project"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pm.Apply(tt.path); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePathMapInvalid(t *testing.T) {
+	for _, spec := range []string{"", "/only", "=/new", "/old="} {
+		if _, err := ParsePathMap([]string{spec}); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Name: "silibox", CPUs: 4, Memory: "8GiB", Disk: "60GiB"})
+	s.UpsertEnv(&state.EnvInfo{
+		Name:        "web",
+		Image:       "node:20",
+		ProjectPath: "/Users/old/web",
+		Mounts: map[string]state.Mount{
+			"work": {Host: "/Users/old/web", Guest: "/app", RW: true},
+		},
+		Ports:      []state.PortMapping{{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"}, {HostPort: 5173, ContainerPort: 5173, Protocol: "tcp", Auto: true}},
+		Volumes:    map[string]string{"node_modules": "web-node-modules"},
+		Persistent: true,
+	})
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Image: "golang:1.22", ProjectPath: "/Users/old/api"})
+	s.RegisterShim("node", "web", "node")
+
+	m := BuildManifest(s)
+
+	if m.Format != FormatVersion {
+		t.Errorf("expected format %d, got %d", FormatVersion, m.Format)
+	}
+	if m.VM == nil || m.VM.CPUs != 4 || m.VM.Memory != "8GiB" {
+		t.Errorf("unexpected VM spec: %+v", m.VM)
+	}
+	if len(m.Envs) != 2 || m.Envs[0].Name != "api" || m.Envs[1].Name != "web" {
+		t.Fatalf("expected envs sorted by name, got %+v", m.Envs)
+	}
+	if m.Envs[0].WorkingDir != "/workspace" {
+		t.Errorf("expected default working dir, got %q", m.Envs[0].WorkingDir)
+	}
+	web := m.Envs[1]
+	if web.WorkingDir != "/app" || !web.Persistent || len(web.Ports) != 1 {
+		t.Errorf("unexpected web spec: %+v", web)
+	}
+	if len(m.Shims) != 1 || m.Shims[0].Env != "web" {
+		t.Errorf("unexpected shims: %+v", m.Shims)
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	manifest := &Manifest{
+		Format: FormatVersion,
+		Envs:   []EnvSpec{{Name: "web", Image: "node:20", VolumeData: []string{"web-cache"}}},
+	}
+	volume := []byte("volume-archive")
+	if err := w.WriteFileFrom(VolumeEntry("web-cache"), int64(len(volume)), bytes.NewReader(volume)); err != nil {
+		t.Fatalf("failed to write volume: %v", err)
+	}
+	if err := w.WriteManifest(manifest); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close bundle: %v", err)
+	}
+
+	dir := t.TempDir()
+	got, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if len(got.Envs) != 1 || got.Envs[0].Name != "web" {
+		t.Errorf("unexpected manifest: %+v", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, VolumeEntry("web-cache")))
+	if err != nil {
+		t.Fatalf("volume not extracted: %v", err)
+	}
+	if !bytes.Equal(data, volume) {
+		t.Errorf("volume contents mismatch: %q", data)
+	}
+}
+
+func TestExtractRejectsNewerFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteManifest(&Manifest{Format: FormatVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Extract(&buf, t.TempDir()); err == nil {
+		t.Error("expected error for newer bundle format")
+	}
+}
+
+func TestExtractRejectsUnsafeShimNames(t *testing.T) {
+	for _, name := range []string{"../../.zshrc", "bin/node", "..", "."} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		manifest := &Manifest{
+			Format: FormatVersion,
+			Envs:   []EnvSpec{{Name: "web", Image: "node:20"}},
+			Shims:  []ShimSpec{{Name: name, Env: "web", Target: "node"}},
+		}
+		if err := w.WriteManifest(manifest); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Extract(&buf, t.TempDir()); err == nil {
+			t.Errorf("expected error for shim name %q", name)
+		}
+	}
+}
+
+func TestExtractRejectsUnsafeVolumeNames(t *testing.T) {
+	for _, env := range []EnvSpec{
+		{Name: "web", Image: "node:20", VolumeData: []string{"../../../../home/u/x"}},
+		{Name: "web", Image: "node:20", VolumeData: []string{".cache"}},
+		{Name: "web", Image: "node:20", Volumes: map[string]string{"node_modules": "../web"}},
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := w.WriteManifest(&Manifest{Format: FormatVersion, Envs: []EnvSpec{env}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Extract(&buf, t.TempDir()); err == nil {
+			t.Errorf("expected error for volumes %v %v", env.VolumeData, env.Volumes)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package portable
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PathRule rewrites paths under From to live under To
+type PathRule struct {
+	From string
+	To   string
+}
+
+// PathMap is an ordered set of path rewrite rules
+type PathMap []PathRule
+
+// ParsePathMap parses rules in the form "old=new"
+func ParsePathMap(specs []string) (PathMap, error) {
+	pm := make(PathMap, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid path mapping %q (expected old=new)", spec)
+		}
+		pm = append(pm, PathRule{
+			From: filepath.Clean(parts[0]),
+			To:   filepath.Clean(parts[1]),
+		})
+	}
+	return pm, nil
+}
+
+// Apply rewrites path using the rule with the longest matching prefix
+// Paths that match no rule are returned unchanged
+func (pm PathMap) Apply(path string) string {
+	path = filepath.Clean(path)
+	best := -1
+	for i, rule := range pm {
+		if path != rule.From && !strings.HasPrefix(path, rule.From+string(filepath.Separator)) {
+			continue
+		}
+		if best == -1 || len(rule.From) > len(pm[best].From) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return path
+	}
+	rule := pm[best]
+	return filepath.Join(rule.To, strings.TrimPrefix(path, rule.From))
+}
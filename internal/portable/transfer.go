@@ -0,0 +1,298 @@
+package portable
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/lima"
+	"github.com/coheez/silibox/internal/shim"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/coheez/silibox/internal/vm"
+)
+
+// ExportOptions configures bundle creation
+type ExportOptions struct {
+	IncludeVolumes bool // Include the contents of each env's volumes
+}
+
+// ImportOptions configures bundle restoration
+type ImportOptions struct {
+	PathMap     PathMap           // Rewrites ProjectPaths from the source machine
+	Environment map[string]string // Environment passed to recreated containers
+	SkipVolumes bool              // Don't restore volume contents even if bundled
+}
+
+// Export writes the current setup to a bundle at path
+func Export(path string, opts ExportOptions) error {
+	st, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	manifest := BuildManifest(st)
+
+	if opts.IncludeVolumes && hasVolumes(manifest) {
+		if err := vm.EnsureVMRunning(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer f.Close()
+
+	w := NewWriter(f)
+
+	if opts.IncludeVolumes {
+		for i := range manifest.Envs {
+			env := &manifest.Envs[i]
+			for _, volumeName := range env.Volumes {
+				fmt.Printf("Exporting volume %s...\n", volumeName)
+				if err := addVolume(w, volumeName); err != nil {
+					return err
+				}
+				env.VolumeData = append(env.VolumeData, volumeName)
+			}
+		}
+	}
+
+	if err := w.WriteManifest(manifest); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+
+	fmt.Printf("Exported %d environment(s) and %d shim(s) to %s\n", len(manifest.Envs), len(manifest.Shims), path)
+	return nil
+}
+
+// addVolume spools a volume export to a temp file so its size is known for the tar header
+func addVolume(w *Writer, volumeName string) error {
+	tmp, err := os.CreateTemp("", "sili-volume-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := container.ExportVolume(volumeName, tmp); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.WriteFileFrom(VolumeEntry(volumeName), size, tmp)
+}
+
+func hasVolumes(m *Manifest) bool {
+	for _, env := range m.Envs {
+		if len(env.Volumes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Import recreates the setup described by the bundle at path
+// Environments that already exist in state are skipped
+func Import(path string, opts ImportOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+
+	workDir, err := os.MkdirTemp("", "sili-import-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	manifest, err := Extract(f, workDir)
+	if err != nil {
+		return err
+	}
+
+	// Map the source home to ours unless the user provided a more specific rule
+	pathMap := opts.PathMap
+	if home, err := os.UserHomeDir(); err == nil && manifest.SourceHome != "" && manifest.SourceHome != home {
+		pathMap = append(pathMap, PathRule{From: filepath.Clean(manifest.SourceHome), To: home})
+	}
+
+	if err := ensureVM(manifest.VM); err != nil {
+		return err
+	}
+
+	st, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	created := make(map[string]bool)
+	stacks := make(map[string]bool)
+	for _, env := range manifest.Envs {
+		if st.GetEnv(env.Name) != nil {
+			fmt.Printf("Skipping %s: environment already exists\n", env.Name)
+			continue
+		}
+
+		// Stacks are recreated from their project's services, which hold settings
+		// like environment variables that the bundle doesn't
+		if env.Stack != "" {
+			if !stacks[env.Stack] {
+				fmt.Printf("Skipping stack %s: recreate it with 'sili up' in %s\n", env.Stack, pathMap.Apply(env.ProjectPath))
+				stacks[env.Stack] = true
+			}
+			continue
+		}
+
+		projectPath := pathMap.Apply(env.ProjectPath)
+		if _, err := os.Stat(projectPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: project path %s for %s does not exist (use --map-path to rewrite it)\n", projectPath, env.Name)
+		}
+
+		if !opts.SkipVolumes {
+			for _, volumeName := range env.VolumeData {
+				if err := restoreVolume(workDir, volumeName); err != nil {
+					return err
+				}
+			}
+		}
+
+		fmt.Printf("Creating environment %s (%s)...\n", env.Name, env.Image)
+		cfg := container.CreateConfig{
+			Name:        env.Name,
+			Image:       env.Image,
+			ProjectDir:  projectPath,
+			WorkingDir:  env.WorkingDir,
+			User:        env.User,
+			Environment: opts.Environment,
+			Ports:       portSpecs(env.Ports),
+			Persistent:  env.Persistent,
+			IdleTimeout: env.IdleTimeout,
+			Volumes:     env.Volumes,
+			TrustCA:     env.TrustCA,
+			Network:     env.Network,
+		}
+		if env.TrustCA {
+			// The CA of this machine replaces the exported one
+			if _, _, err := ca.Ensure(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s won't trust the silibox CA: %v\n", env.Name, err)
+				cfg.TrustCA = false
+			}
+		}
+		if err := container.Create(cfg); err != nil {
+			return fmt.Errorf("failed to create %s: %w", env.Name, err)
+		}
+		if err := restoreRoutes(env); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to restore routes of %s: %v\n", env.Name, err)
+		}
+		created[env.Name] = true
+	}
+
+	return restoreShims(manifest.Shims, created)
+}
+
+// ensureVM starts the VM, creating it from the bundled resources if needed
+func ensureVM(spec *VMSpec) error {
+	st, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if st.GetVM() != nil {
+		return vm.EnsureVMRunning()
+	}
+
+	cfg := lima.Config{CPUs: 4, Memory: "8GiB", Disk: "60GiB"}
+	if spec != nil {
+		cfg = lima.Config{CPUs: spec.CPUs, Memory: spec.Memory, Disk: spec.Disk}
+	}
+	fmt.Println("⏳ Creating VM...")
+	return lima.Up(cfg)
+}
+
+func restoreVolume(workDir, volumeName string) error {
+	archive, err := os.Open(filepath.Join(workDir, VolumeEntry(volumeName)))
+	if err != nil {
+		return fmt.Errorf("volume %s missing from bundle: %w", volumeName, err)
+	}
+	defer archive.Close()
+
+	fmt.Printf("Restoring volume %s...\n", volumeName)
+	return container.ImportVolume(volumeName, archive)
+}
+
+// restoreRoutes records the routes of an environment created by this import
+func restoreRoutes(spec EnvSpec) error {
+	if len(spec.Routes) == 0 {
+		return nil
+	}
+	return state.WithLockedState(func(s *state.State) error {
+		if env := s.GetEnv(spec.Name); env != nil {
+			env.Routes = spec.Routes
+		}
+		return nil
+	})
+}
+
+// restoreShims re-exports shims belonging to environments created by this import
+func restoreShims(shims []ShimSpec, created map[string]bool) error {
+	restored := make([]ShimSpec, 0, len(shims))
+	for _, spec := range shims {
+		if !created[spec.Env] {
+			continue
+		}
+		if err := shim.GenerateShim(spec.Env, spec.Name, true); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to create shim %s: %v\n", spec.Name, err)
+			continue
+		}
+		restored = append(restored, spec)
+	}
+	if len(restored) == 0 {
+		return nil
+	}
+
+	if err := state.WithLockedState(func(s *state.State) error {
+		for _, spec := range restored {
+			if env := s.GetEnv(spec.Env); env != nil {
+				env.ExportedShims = append(env.ExportedShims, spec.Name)
+			}
+			s.RegisterShim(spec.Name, spec.Env, spec.Target)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to register shims: %w", err)
+	}
+
+	fmt.Printf("Restored %d shim(s)\n", len(restored))
+	return nil
+}
+
+// portSpecs converts port mappings back into the spec strings accepted by create
+func portSpecs(mappings []state.PortMapping) []string {
+	specs := make([]string, 0, len(mappings))
+	for _, pm := range mappings {
+		spec := fmt.Sprintf("%d:%d", pm.HostPort, pm.ContainerPort)
+		if strings.Contains(pm.HostIP, ":") {
+			spec = fmt.Sprintf("[%s]:%s", pm.HostIP, spec)
+		} else if pm.HostIP != "" {
+			spec = pm.HostIP + ":" + spec
+		}
+		if pm.Protocol == "udp" {
+			spec += "/udp"
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
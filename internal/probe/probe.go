@@ -0,0 +1,134 @@
+// Package probe checks whether the services behind host ports answer, and what they speak
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultTimeout bounds each step of a probe; local services answer well within it
+const DefaultTimeout = time.Second
+
+// Result is what a probe found on a port
+type Result struct {
+	Listening bool
+	Scheme    string        // "http", "https" or "tcp"; empty when nothing listens
+	Status    int           // HTTP status code, 0 for services that don't speak HTTP
+	Latency   time.Duration // Until the HTTP response headers, or the TCP connect otherwise
+}
+
+// Healthy reports whether the port accepts connections and, for HTTP, doesn't answer
+// with a server error
+func (r Result) Healthy() bool {
+	return r.Listening && r.Status < 500
+}
+
+// String summarizes the result, e.g. "200 (12ms)", "listening" or "closed"
+func (r Result) String() string {
+	switch {
+	case !r.Listening:
+		return "closed"
+	case r.Status != 0:
+		return fmt.Sprintf("%d (%s)", r.Status, formatLatency(r.Latency))
+	default:
+		return "listening"
+	}
+}
+
+func formatLatency(d time.Duration) string {
+	if d < time.Millisecond {
+		return "<1ms"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// URL is the address of a service on host and port, by the scheme a probe found
+// Services that didn't answer HTTP get a tcp:// URL
+func URL(scheme, host string, port int) string {
+	if scheme == "" {
+		scheme = "tcp"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Port probes the TCP service on addr: it connects, then tries a TLS handshake and an
+// HTTP request, so the scheme comes from what the service actually speaks
+// TLS goes first because plain HTTP servers answer a ClientHello with a 400 that
+// doesn't parse as TLS, while TLS servers answer plain HTTP with a 400 that does
+func Port(addr string, timeout time.Duration) Result {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return Result{}
+	}
+	connected := time.Since(start)
+	conn.Close()
+
+	for _, scheme := range []string{"https", "http"} {
+		if status, latency, ok := request(addr, scheme == "https", timeout); ok {
+			return Result{Listening: true, Scheme: scheme, Status: status, Latency: latency}
+		}
+	}
+	return Result{Listening: true, Scheme: "tcp", Latency: connected}
+}
+
+// request sends GET / and returns the response status, if the service answered HTTP
+func request(addr string, useTLS bool, timeout time.Duration) (int, time.Duration, bool) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(2 * timeout))
+
+	if useTLS {
+		// Development services use self-signed certificates; only the protocol matters here
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: "localhost"})
+		if err := tlsConn.Handshake(); err != nil {
+			return 0, 0, false
+		}
+		conn = tlsConn
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return 0, 0, false
+	}
+	req.Host = "localhost"
+	req.Close = true
+	req.Header.Set("User-Agent", "silibox-probe")
+	if err := req.Write(conn); err != nil {
+		return 0, 0, false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return 0, 0, false
+	}
+	resp.Body.Close()
+	return resp.StatusCode, time.Since(start), true
+}
+
+// Wait probes addr every interval until it is healthy or ctx is done
+// It returns the last result, and ctx's error if the port never became healthy
+func Wait(ctx context.Context, addr string, interval, timeout time.Duration) (Result, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r := Port(addr, timeout)
+		if r.Healthy() {
+			return r, nil
+		}
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
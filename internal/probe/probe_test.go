@@ -0,0 +1,118 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPort(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer httpSrv.Close()
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	// A service with its own protocol that greets first, like SSH or MySQL
+	banner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer banner.Close()
+	go func() {
+		for {
+			conn, err := banner.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name        string
+		addr        string
+		wantScheme  string
+		wantStatus  int
+		wantHealthy bool
+	}{
+		{"http", httpSrv.Listener.Addr().String(), "http", http.StatusNoContent, true},
+		{"https", tlsSrv.Listener.Addr().String(), "https", http.StatusOK, true},
+		{"server error", failing.Listener.Addr().String(), "http", http.StatusBadGateway, false},
+		{"other protocol", banner.Addr().String(), "tcp", 0, true},
+		{"closed", closedAddr, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Port(tt.addr, time.Second)
+			if r.Scheme != tt.wantScheme || r.Status != tt.wantStatus || r.Healthy() != tt.wantHealthy {
+				t.Errorf("Port() = %+v (healthy %v), want scheme %q, status %d, healthy %v",
+					r, r.Healthy(), tt.wantScheme, tt.wantStatus, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestResultString(t *testing.T) {
+	tests := []struct {
+		r    Result
+		want string
+	}{
+		{Result{}, "closed"},
+		{Result{Listening: true, Scheme: "tcp"}, "listening"},
+		{Result{Listening: true, Scheme: "http", Status: 200, Latency: 12300 * time.Microsecond}, "200 (12ms)"},
+		{Result{Listening: true, Scheme: "http", Status: 404, Latency: 300 * time.Microsecond}, "404 (<1ms)"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := Wait(ctx, addr, 50*time.Millisecond, 100*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() on a closed port = %v, want a deadline error", err)
+	}
+
+	// The service comes up while waiting
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		srv := &http.Server{Handler: http.NotFoundHandler()}
+		if ln, err := net.Listen("tcp", addr); err == nil {
+			srv.Serve(ln)
+		}
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := Wait(ctx, addr, 50*time.Millisecond, time.Second)
+	if err != nil || r.Status != http.StatusNotFound {
+		t.Errorf("Wait() = %+v, %v, want a 404 once the server is up", r, err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package proxy serves environments on <host>.<env>.localhost hostnames
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+// Addresses the proxy is served on unless configured otherwise
+// Ports 80 and 443 keep the port out of the URLs
+const (
+	DefaultListen    = "127.0.0.1:80"
+	DefaultTLSListen = "127.0.0.1:443"
+)
+
+// Domain is the suffix of every hostname; browsers resolve *.localhost to loopback
+const Domain = "localhost"
+
+// Route sources
+const (
+	SourceManifest = "manifest" // expose: in the project's silibox.yaml
+	SourceExpose   = "expose"   // Added with `sili expose`
+)
+
+// Route maps a hostname to a container port of an environment
+type Route struct {
+	Env    string
+	Host   string // Empty for <env>.localhost
+	Port   int
+	Source string
+}
+
+// Hostname is the name the route is served on
+func (r Route) Hostname() string {
+	if r.Host == "" {
+		return r.Env + "." + Domain
+	}
+	return r.Host + "." + r.Env + "." + Domain
+}
+
+// URL is the route's address through a proxy listening on listen
+func (r Route) URL(listen string) string {
+	return routeURL("http", "80", r.Hostname(), listen)
+}
+
+// TLSURL is the route's address through a proxy terminating TLS on listen
+func (r Route) TLSURL(listen string) string {
+	return routeURL("https", "443", r.Hostname(), listen)
+}
+
+func routeURL(scheme, defaultPort, hostname, listen string) string {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil || port == defaultPort {
+		return scheme + "://" + hostname
+	}
+	return scheme + "://" + net.JoinHostPort(hostname, port)
+}
+
+// Routes returns the routes of every environment, sorted by hostname
+func Routes(s *state.State) []Route {
+	var routes []Route
+	for _, env := range s.ListEnvs() {
+		// A broken manifest contributes no routes
+		m, _ := manifest.ForProject(env.ProjectPath, env.Service)
+		routes = append(routes, EnvRoutes(env, m)...)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Hostname() < routes[j].Hostname() })
+	return routes
+}
+
+// EnvRoutes returns env's routes from its manifest and `sili expose`
+// An exposed host replaces the manifest's route for the same host
+func EnvRoutes(env *state.EnvInfo, m *manifest.Manifest) []Route {
+	var routes []Route
+	exposed := make(map[string]bool, len(env.Routes))
+	for _, r := range env.Routes {
+		exposed[r.Host] = true
+		routes = append(routes, Route{Env: env.Name, Host: r.Host, Port: r.Port, Source: SourceExpose})
+	}
+	if m != nil {
+		for _, e := range m.Expose {
+			if !exposed[e.Host] {
+				routes = append(routes, Route{Env: env.Name, Host: e.Host, Port: e.Port, Source: SourceManifest})
+			}
+		}
+	}
+	return routes
+}
+
+// match finds the route served on the request's Host header
+func match(routes []Route, hostHeader string) (Route, bool) {
+	host := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, r := range routes {
+		if r.Hostname() == host {
+			return r, true
+		}
+	}
+	return Route{}, false
+}
+
+// upstream returns the host address a container port of env is mapped to
+// Declared ports win over automatic forwards, which come and go with their socket
+func upstream(env *state.EnvInfo, containerPort int) (string, bool) {
+	var found *state.PortMapping
+	for i, p := range env.Ports {
+		if p.ContainerPort != containerPort || p.Protocol == "udp" {
+			continue
+		}
+		if found == nil || found.Auto && !p.Auto {
+			found = &env.Ports[i]
+		}
+	}
+	if found == nil {
+		return "", false
+	}
+	ip := "127.0.0.1"
+	if found.HostIP == "::1" {
+		ip = found.HostIP
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(found.HostPort)), true
+}
+
+// Handler proxies requests to the environment their Host header names
+// Routes are read from state and the manifests on every request, so they never go stale
+func Handler() http.Handler {
+	return handler(state.Load)
+}
+
+func handler(load func() (*state.State, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := load()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("silibox: failed to load state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		routes := Routes(s)
+		route, ok := match(routes, r.Host)
+		if !ok {
+			notFound(w, r.Host, routes)
+			return
+		}
+		env := s.GetEnv(route.Env)
+		addr, ok := upstream(env, route.Port)
+		if !ok {
+			http.Error(w, fmt.Sprintf("silibox: port %d of '%s' isn't mapped to the host\nMap it with: sili ports add --name %s %d",
+				route.Port, route.Env, route.Env, route.Port), http.StatusBadGateway)
+			return
+		}
+
+		target := &url.URL{Scheme: "http", Host: addr}
+		rp := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.Host = pr.In.Host // Apps see the hostname they're served on, e.g. for cookies
+				pr.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				msg := fmt.Sprintf("silibox: '%s' port %d isn't answering: %v", route.Env, route.Port, err)
+				if env.Status != "running" {
+					msg += fmt.Sprintf("\nThe environment is %s; start it with: sili start --name %s", env.Status, route.Env)
+				}
+				http.Error(w, msg, http.StatusBadGateway)
+			},
+		}
+		rp.ServeHTTP(w, r)
+	})
+}
+
+// notFound lists the known routes for a hostname nothing is served on
+func notFound(w http.ResponseWriter, host string, routes []Route) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "silibox: no route for %s\n", host)
+	if len(routes) == 0 {
+		b.WriteString("Add one with: sili expose --name <env> --port <port> --host <host>\n")
+	} else {
+		b.WriteString("\nRoutes:\n")
+		for _, r := range routes {
+			fmt.Fprintf(&b, "  %s -> '%s' port %d\n", r.Hostname(), r.Env, r.Port)
+		}
+	}
+	http.Error(w, b.String(), http.StatusNotFound)
+}
+
+// Start serves the proxy on addr in the background
+// It returns the address actually bound (addr may use port 0) and a func that stops the server
+func Start(addr string) (net.Addr, func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return serve(ln, &http.Server{Handler: Handler(), ReadHeaderTimeout: 5 * time.Second})
+}
+
+// StartTLS serves the proxy over HTTPS on addr in the background, with certificates
+// from issuer for the hostnames of known routes
+func StartTLS(addr string, issuer *ca.Issuer) (net.Addr, func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: getCertificate(state.Load, issuer),
+	}
+	srv := &http.Server{Handler: Handler(), ReadHeaderTimeout: 5 * time.Second, TLSConfig: tlsConfig}
+	return serve(tls.NewListener(ln, tlsConfig), srv)
+}
+
+// getCertificate issues certificates only for hostnames a route is served on
+func getCertificate(load func() (*state.State, error), issuer *ca.Issuer) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		s, err := load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load state: %w", err)
+		}
+		route, ok := match(Routes(s), hello.ServerName)
+		if !ok {
+			return nil, fmt.Errorf("no route for %q", hello.ServerName)
+		}
+		return issuer.Certificate(route.Hostname())
+	}
+}
+
+func serve(ln net.Listener, srv *http.Server) (net.Addr, func(), error) {
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "Warning: proxy stopped: %v\n", err)
+		}
+	}()
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+	return ln.Addr(), stop, nil
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/coheez/silibox/internal/ca"
+	"github.com/coheez/silibox/internal/manifest"
+	"github.com/coheez/silibox/internal/state"
+)
+
+func TestRouteURL(t *testing.T) {
+	tests := []struct {
+		route  Route
+		listen string
+		want   string
+	}{
+		{Route{Env: "web", Host: "api"}, "127.0.0.1:80", "http://api.web.localhost"},
+		{Route{Env: "web"}, "127.0.0.1:80", "http://web.localhost"},
+		{Route{Env: "web", Host: "api"}, "127.0.0.1:8080", "http://api.web.localhost:8080"},
+		{Route{Env: "web", Host: "api"}, "", "http://api.web.localhost"},
+	}
+	for _, tt := range tests {
+		if got := tt.route.URL(tt.listen); got != tt.want {
+			t.Errorf("%+v.URL(%q) = %q, want %q", tt.route, tt.listen, got, tt.want)
+		}
+	}
+
+	r := Route{Env: "web", Host: "api"}
+	if got := r.TLSURL("127.0.0.1:443"); got != "https://api.web.localhost" {
+		t.Errorf("TLSURL() = %q", got)
+	}
+	if got := r.TLSURL("127.0.0.1:8443"); got != "https://api.web.localhost:8443" {
+		t.Errorf("TLSURL() = %q", got)
+	}
+}
+
+func TestEnvRoutes(t *testing.T) {
+	env := &state.EnvInfo{Name: "web", Routes: []state.Route{{Host: "api", Port: 4000}}}
+	m := &manifest.Manifest{Expose: []manifest.Expose{{Host: "api", Port: 3000}, {Host: "", Port: 5173}}}
+
+	routes := EnvRoutes(env, m)
+	want := []Route{
+		{Env: "web", Host: "api", Port: 4000, Source: SourceExpose},
+		{Env: "web", Host: "", Port: 5173, Source: SourceManifest},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("EnvRoutes() = %+v, want %+v", routes, want)
+	}
+	for i := range want {
+		if routes[i] != want[i] {
+			t.Errorf("route %d = %+v, want %+v", i, routes[i], want[i])
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	routes := []Route{{Env: "web", Host: "api", Port: 3000}, {Env: "web", Port: 5173}}
+	tests := []struct {
+		host     string
+		wantPort int
+	}{
+		{"api.web.localhost", 3000},
+		{"API.Web.localhost:8080", 3000},
+		{"web.localhost.", 5173},
+		{"db.web.localhost", 0},
+		{"localhost", 0},
+	}
+	for _, tt := range tests {
+		r, ok := match(routes, tt.host)
+		if ok != (tt.wantPort != 0) || r.Port != tt.wantPort {
+			t.Errorf("match(%q) = %+v, %v, want port %d", tt.host, r, ok, tt.wantPort)
+		}
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	env := &state.EnvInfo{Ports: []state.PortMapping{
+		{HostPort: 51000, ContainerPort: 3000, Protocol: "tcp", Auto: true},
+		{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"},
+		{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+		{HostIP: "::1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		{HostIP: "0.0.0.0", HostPort: 9000, ContainerPort: 9000, Protocol: "tcp"},
+	}}
+	tests := []struct {
+		port int
+		want string
+	}{
+		{3000, "127.0.0.1:3000"},
+		{80, "[::1]:8080"},
+		{9000, "127.0.0.1:9000"},
+		{53, ""},
+		{4000, ""},
+	}
+	for _, tt := range tests {
+		got, ok := upstream(env, tt.port)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("upstream(%d) = %q, %v, want %q", tt.port, got, ok, tt.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+" "+r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer backend.Close()
+	_, portStr, _ := net.SplitHostPort(backend.Listener.Addr().String())
+	backendPort, _ := strconv.Atoi(portStr)
+
+	st := state.NewState()
+	st.UpsertEnv(&state.EnvInfo{
+		Name:   "web",
+		Status: "running",
+		Ports:  []state.PortMapping{{HostPort: backendPort, ContainerPort: 3000, Protocol: "tcp"}},
+		Routes: []state.Route{{Host: "api", Port: 3000}, {Host: "admin", Port: 4000}},
+	})
+	h := handler(func() (*state.State, error) { return st, nil })
+
+	tests := []struct {
+		host       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"api.web.localhost", http.StatusOK, "api.web.localhost api.web.localhost"},
+		{"admin.web.localhost", http.StatusBadGateway, "sili ports add --name web 4000"},
+		{"db.web.localhost", http.StatusNotFound, "api.web.localhost -> 'web' port 3000"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("%s: status %d, body %q; want %d containing %q", tt.host, rec.Code, rec.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	state.ResetForTesting()
+	defer state.ResetForTesting()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer backend.Close()
+	_, portStr, _ := net.SplitHostPort(backend.Listener.Addr().String())
+	backendPort, _ := strconv.Atoi(portStr)
+
+	err := state.WithLockedState(func(s *state.State) error {
+		s.UpsertEnv(&state.EnvInfo{
+			Name:   "web",
+			Status: "running",
+			Ports:  []state.PortMapping{{HostPort: backendPort, ContainerPort: 3000, Protocol: "tcp"}},
+			Routes: []state.Route{{Host: "api", Port: 3000}},
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authority, _, err := ca.Ensure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop, err := StartTLS("127.0.0.1:0", ca.NewIssuer(authority))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Cert)
+	client := func(serverName string) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: serverName},
+		}}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://"+addr.String()+"/", nil)
+	req.Host = "api.web.localhost"
+	resp, err := client("api.web.localhost").Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "https" {
+		t.Errorf("status %s, body %q; want 200 with X-Forwarded-Proto https", resp.Status, body)
+	}
+
+	// No certificate is issued for hostnames without a route
+	if _, err := client("db.web.localhost").Get("https://" + addr.String() + "/"); err == nil {
+		t.Error("expected a handshake error for an unknown hostname")
+	}
+}
@@ -8,8 +8,9 @@ import (
 )
 
 const (
+	shimHeader   = "# Silibox shim for "
 	shimTemplate = `#!/bin/bash
-# Silibox shim for %s in environment %s
+` + shimHeader + `%s in environment %s
 exec sili run --name %s -- %s "$@"
 `
 )
@@ -80,6 +81,15 @@ func RemoveShim(command string) error {
 	return nil
 }
 
+// IsGenerated reports whether the file at path is a shim written by silibox
+func IsGenerated(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(data), "\n"+shimHeader)
+}
+
 // IsInPATH checks if the shim directory is in the user's PATH
 func IsInPATH() (bool, error) {
 	shimDir, err := ShimDir()
@@ -182,3 +182,29 @@ func TestGetPATHInstructions(t *testing.T) {
 		})
 	}
 }
+
+func TestIsGenerated(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", originalHome)
+
+	if err := GenerateShim("test-env", "node", false); err != nil {
+		t.Fatalf("GenerateShim() error = %v", err)
+	}
+	shimDir, _ := ShimDir()
+	if !IsGenerated(filepath.Join(shimDir, "node")) {
+		t.Error("IsGenerated() = false for a generated shim")
+	}
+
+	own := filepath.Join(shimDir, "mytool")
+	if err := os.WriteFile(own, []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if IsGenerated(own) {
+		t.Error("IsGenerated() = true for a user file")
+	}
+	if IsGenerated(filepath.Join(shimDir, "missing")) {
+		t.Error("IsGenerated() = true for a missing file")
+	}
+}
@@ -0,0 +1,62 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// LockTimeout is how long WithLockedState waits for another process to release the lock
+var LockTimeout = 30 * time.Second
+
+// lockRetryDelay is how often a waiting process retries the lock
+const lockRetryDelay = 20 * time.Millisecond
+
+// LockWaitBuckets are the upper bounds of the lock wait histogram
+var LockWaitBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// LockWaitStats summarizes how long this process waited for the state lock
+type LockWaitStats struct {
+	Count    uint64        // Successful acquisitions
+	Sum      time.Duration // Total time waited by successful acquisitions
+	Buckets  []uint64      // Cumulative counts per LockWaitBuckets entry
+	Timeouts uint64        // Acquisitions that gave up after LockTimeout
+}
+
+var (
+	lockWaitMu sync.Mutex
+	lockWaits  = LockWaitStats{Buckets: make([]uint64, len(LockWaitBuckets))}
+)
+
+// recordLockWait adds one acquisition to the stats
+func recordLockWait(waited time.Duration, timedOut bool) {
+	lockWaitMu.Lock()
+	defer lockWaitMu.Unlock()
+
+	if timedOut {
+		lockWaits.Timeouts++
+		return
+	}
+	lockWaits.Count++
+	lockWaits.Sum += waited
+	for i, le := range LockWaitBuckets {
+		if waited <= le {
+			lockWaits.Buckets[i]++
+		}
+	}
+}
+
+// LockWaits returns a snapshot of this process's state lock waits
+func LockWaits() LockWaitStats {
+	lockWaitMu.Lock()
+	defer lockWaitMu.Unlock()
+
+	snapshot := lockWaits
+	snapshot.Buckets = append([]uint64(nil), lockWaits.Buckets...)
+	return snapshot
+}
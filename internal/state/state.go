@@ -1,12 +1,15 @@
 package state
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -61,9 +64,18 @@ type EnvInfo struct {
 	User          UserInfo          `json:"user"`
 	Status        string            `json:"status"`
 	Persistent    bool              `json:"persistent"`
+	IdleTimeout   time.Duration     `json:"idle_timeout,omitempty"` // Overrides the autosleep timeout; 0 uses the default
+	TrustCA       bool              `json:"trust_ca,omitempty"`     // The silibox CA was added to the container's trust store
 	LastActive    time.Time         `json:"last_active"`
 	ExportedShims []string          `json:"exported_shims"`
 	MigratedDirs  map[string]string `json:"migrated_dirs,omitempty"` // Maps dir name to backup path
+	Routes        []Route           `json:"routes,omitempty"`        // Hostnames added with `sili expose`
+	Network       string            `json:"network,omitempty"`       // Network group; empty for containers created before silibox networks
+	Stack         string            `json:"stack,omitempty"`         // Stack brought up with `sili up`; its envs sleep and wake together
+	Service       string            `json:"service,omitempty"`       // Service of the stack, from services: in silibox.yaml
+	DependsOn     []string          `json:"depends_on,omitempty"`    // Envs of the stack started before this one
+	ImageCommand  bool              `json:"image_command,omitempty"` // Runs the image's own command and user instead of an idle shell
+	Command       []string          `json:"command,omitempty"`       // Replaces the image's command or the idle shell
 }
 
 type Mount struct {
@@ -73,9 +85,18 @@ type Mount struct {
 }
 
 type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"` // Host address the port is bound to; empty is loopback
 	HostPort      int    `json:"host_port"`
 	ContainerPort int    `json:"container_port"`
-	Protocol      string `json:"protocol"` // "tcp" or "udp"
+	Protocol      string `json:"protocol"`          // "tcp" or "udp"
+	Auto          bool   `json:"auto,omitempty"`    // Forwarded because the container started listening, not declared
+	Proxied       bool   `json:"proxied,omitempty"` // Added with `sili ports add`; forwarded while the env runs instead of published by podman
+}
+
+// Route serves a container port on a .localhost hostname through the silibox proxy
+type Route struct {
+	Host string `json:"host,omitempty"` // Label before the env name, e.g. "api" for api.web.localhost; empty serves web.localhost
+	Port int    `json:"port"`           // Container port
 }
 
 type UserInfo struct {
@@ -120,6 +141,7 @@ func ResetForTesting() {
 }
 
 // WithLockedState executes a function with exclusive access to the state
+// It waits up to LockTimeout for another process holding the lock
 func WithLockedState(fn func(*State) error) error {
 	// Ensure state directory exists
 	if err := ensureStateDir(); err != nil {
@@ -128,13 +150,21 @@ func WithLockedState(fn func(*State) error) error {
 
 	// Acquire file lock
 	lock := flock.New(lockPath)
-	locked, err := lock.TryLock()
+	ctx, cancel := context.WithTimeout(context.Background(), LockTimeout)
+	defer cancel()
+	start := time.Now()
+	locked, err := lock.TryLockContext(ctx, lockRetryDelay)
+	if errors.Is(err, context.DeadlineExceeded) {
+		recordLockWait(0, true)
+		return fmt.Errorf("state is locked by another process (waited %s)", LockTimeout)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to acquire state lock: %w", err)
 	}
 	if !locked {
 		return fmt.Errorf("state is locked by another process")
 	}
+	recordLockWait(time.Since(start), false)
 	defer lock.Unlock()
 
 	// Load state
@@ -304,12 +334,33 @@ func (s *State) UpdateEnvStatus(name string, status string) {
 	}
 }
 
+// TouchEnvActivity resets the idle timer of an env, and of the rest of its stack
 func (s *State) TouchEnvActivity(name string) {
-	if env := s.Envs[name]; env != nil {
-		env.LastActive = time.Now()
+	env := s.Envs[name]
+	if env == nil {
+		return
+	}
+	now := time.Now()
+	env.LastActive = now
+	if env.Stack != "" {
+		for _, member := range s.StackEnvs(env.Stack) {
+			member.LastActive = now
+		}
 	}
 }
 
+// StackEnvs returns the envs of a stack, sorted by name
+func (s *State) StackEnvs(stack string) []*EnvInfo {
+	var envs []*EnvInfo
+	for _, env := range s.Envs {
+		if env.Stack == stack {
+			envs = append(envs, env)
+		}
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+	return envs
+}
+
 func (s *State) FindEnvByProject(path string) *EnvInfo {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -325,31 +376,90 @@ func (s *State) FindEnvByProject(path string) *EnvInfo {
 }
 
 // Port management
+// ReservePort reserves suggested for name, or the next ephemeral port when suggested
+// is already reserved or mapped by an environment
 func (s *State) ReservePort(name string, suggested int) (int, error) {
-	// Check if suggested port is available
-	for _, ports := range s.Ports.Reserved {
-		for _, port := range ports {
-			if port == suggested {
-				// Port is taken, allocate next available
-				suggested = s.Ports.NextEphemeral
-				s.Ports.NextEphemeral++
-			}
+	for s.PortTaken(suggested) {
+		suggested = s.Ports.NextEphemeral
+		s.Ports.NextEphemeral++
+		if suggested > 65535 {
+			return 0, fmt.Errorf("no free ephemeral ports left")
 		}
 	}
 
 	// Reserve the port
-	if s.Ports.Reserved[name] == nil {
-		s.Ports.Reserved[name] = make([]int, 0)
+	if s.Ports.Reserved == nil {
+		s.Ports.Reserved = make(map[string][]int)
 	}
 	s.Ports.Reserved[name] = append(s.Ports.Reserved[name], suggested)
 
 	return suggested, nil
 }
 
+// AllocatePort reserves the next ephemeral port for name
+// Ports that are reserved, mapped by an environment or busy according to hostFree are skipped
+func (s *State) AllocatePort(name string, hostFree func(port int) bool) (int, error) {
+	for s.Ports.NextEphemeral <= 65535 {
+		port := s.Ports.NextEphemeral
+		s.Ports.NextEphemeral++
+		if s.PortTaken(port) || (hostFree != nil && !hostFree(port)) {
+			continue
+		}
+		return s.ReservePort(name, port)
+	}
+	return 0, fmt.Errorf("no free ephemeral ports left")
+}
+
+// SuggestPort returns the ephemeral port AllocatePort would hand out next, without
+// reserving it, or 0 if none is left
+func (s *State) SuggestPort(hostFree func(port int) bool) int {
+	for port := s.Ports.NextEphemeral; port <= 65535; port++ {
+		if !s.PortTaken(port) && (hostFree == nil || hostFree(port)) {
+			return port
+		}
+	}
+	return 0
+}
+
+// PortTaken reports whether a host port is reserved or mapped by any environment
+func (s *State) PortTaken(port int) bool {
+	if s.ReservedBy(port) != "" {
+		return true
+	}
+	inUse, _ := s.IsPortInUse(port)
+	return inUse
+}
+
+// ReservedBy returns the environment a host port is reserved for, or "" if none
+func (s *State) ReservedBy(port int) string {
+	for name, ports := range s.Ports.Reserved {
+		for _, p := range ports {
+			if p == port {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
 func (s *State) ReleasePorts(name string) {
 	delete(s.Ports.Reserved, name)
 }
 
+// ReleasePort releases a single port reserved for name
+func (s *State) ReleasePort(name string, port int) {
+	ports := s.Ports.Reserved[name]
+	for i, p := range ports {
+		if p == port {
+			s.Ports.Reserved[name] = append(ports[:i:i], ports[i+1:]...)
+			break
+		}
+	}
+	if len(s.Ports.Reserved[name]) == 0 {
+		delete(s.Ports.Reserved, name)
+	}
+}
+
 // IsPortInUse checks if a host port is already in use by any environment
 // Returns true and the environment name if in use, false and empty string otherwise
 func (s *State) IsPortInUse(hostPort int) (bool, string) {
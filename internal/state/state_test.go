@@ -2,6 +2,9 @@ package state
 
 import (
 	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
 )
 
 func TestIsPortInUse(t *testing.T) {
@@ -99,3 +102,106 @@ func TestRemoveEnvReleasesPort(t *testing.T) {
 		t.Error("Port 8080 should not be in use after environment removal")
 	}
 }
+
+func TestReservePort(t *testing.T) {
+	s := NewState()
+	s.UpsertEnv(&EnvInfo{Name: "api", Ports: []PortMapping{{HostPort: 3000, ContainerPort: 3000, Protocol: "tcp"}}})
+	s.Ports.Reserved["db"] = []int{51000}
+
+	tests := []struct {
+		name      string
+		suggested int
+		want      int
+	}{
+		{"free port", 8080, 8080},
+		{"mapped by an env", 3000, 51001},
+		{"reserved earlier", 8080, 51002},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ReservePort("web", tt.suggested)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ReservePort(%d) = %d, want %d", tt.suggested, got, tt.want)
+			}
+		})
+	}
+
+	s.ReleasePort("web", 8080)
+	if got := s.Ports.Reserved["web"]; len(got) != 2 || got[0] != 51001 || got[1] != 51002 {
+		t.Errorf("after ReleasePort reserved = %v", got)
+	}
+}
+
+func TestWithLockedStateWaitsForLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ResetForTesting()
+	defer func() { LockTimeout = 30 * time.Second }()
+	if err := ensureStateDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process holds the lock for a moment
+	other := flock.New(lockPath)
+	if err := other.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		other.Unlock()
+	}()
+
+	before := LockWaits()
+	if err := WithLockedState(func(s *State) error { return nil }); err != nil {
+		t.Fatalf("WithLockedState: %v", err)
+	}
+	after := LockWaits()
+	if after.Count != before.Count+1 || after.Sum-before.Sum < 100*time.Millisecond {
+		t.Errorf("lock waits = %+v, want one more wait of at least 100ms since %+v", after, before)
+	}
+
+	// A lock that isn't released in time
+	if err := other.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Unlock()
+	LockTimeout = 50 * time.Millisecond
+	if err := WithLockedState(func(s *State) error { return nil }); err == nil {
+		t.Fatal("expected a timeout while the lock is held")
+	}
+	if got := LockWaits().Timeouts; got != after.Timeouts+1 {
+		t.Errorf("timeouts = %d, want %d", got, after.Timeouts+1)
+	}
+}
+
+func TestSuggestPort(t *testing.T) {
+	s := NewState()
+	s.UpsertEnv(&EnvInfo{Name: "api", Ports: []PortMapping{{HostPort: 51000, ContainerPort: 80, Protocol: "tcp"}}})
+	s.Ports.Reserved["db"] = []int{51001}
+
+	if got := s.SuggestPort(func(port int) bool { return port != 51002 }); got != 51003 {
+		t.Errorf("SuggestPort() = %d, want 51003", got)
+	}
+	if s.Ports.NextEphemeral != 51000 {
+		t.Errorf("SuggestPort() advanced NextEphemeral to %d", s.Ports.NextEphemeral)
+	}
+}
+
+func TestTouchEnvActivityStack(t *testing.T) {
+	s := NewState()
+	old := time.Now().Add(-time.Hour)
+	s.UpsertEnv(&EnvInfo{Name: "shop-app", Stack: "shop", LastActive: old})
+	s.UpsertEnv(&EnvInfo{Name: "shop-db", Stack: "shop", LastActive: old})
+	s.UpsertEnv(&EnvInfo{Name: "blog-db", Stack: "blog", LastActive: old})
+	s.UpsertEnv(&EnvInfo{Name: "solo", LastActive: old})
+
+	s.TouchEnvActivity("shop-app")
+
+	for name, touched := range map[string]bool{"shop-app": true, "shop-db": true, "blog-db": false, "solo": false} {
+		if got := s.GetEnv(name).LastActive.After(old); got != touched {
+			t.Errorf("%s touched = %v, want %v", name, got, touched)
+		}
+	}
+}
@@ -2,11 +2,17 @@ package vm
 
 import (
 	"fmt"
+	"os"
+	"sort"
 
+	"github.com/coheez/silibox/internal/container"
 	"github.com/coheez/silibox/internal/lima"
 	"github.com/coheez/silibox/internal/state"
 )
 
+// startContainer starts a stopped environment; replaced in tests
+var startContainer = container.Start
+
 // EnsureVMRunning checks if the VM is running and starts it if stopped
 // This enables auto-wake functionality for all commands
 func EnsureVMRunning() error {
@@ -38,6 +44,7 @@ func EnsureVMRunning() error {
 
 	// VM is stopped or state is stale - start it
 	fmt.Println("⏳ VM is stopped. Starting VM...")
+	container.ReleaseHostPorts("")
 	
 	// Use lima.Up() with default config
 	// This will read existing config and start the VM
@@ -76,36 +83,40 @@ func EnsureContainerRunning(name string) (bool, error) {
 
 	// Container is stopped - start it
 	fmt.Printf("⏳ Container '%s' is stopped. Starting...\n", name)
-	
-	// Start the container via limactl/podman
 	if err := startContainer(name); err != nil {
-		return false, fmt.Errorf("failed to start container: %w", err)
-	}
-
-	// Update state
-	if err := state.WithLockedState(func(s *state.State) error {
-		s.UpdateEnvStatus(name, "running")
-		s.TouchEnvActivity(name)
-		s.TouchVMActivity()
-		return nil
-	}); err != nil {
-		// Don't fail if state update fails
-		fmt.Printf("Warning: failed to update state: %v\n", err)
+		return false, err
 	}
 
 	fmt.Printf("✅ Container '%s' started\n", name)
 	return true, nil
 }
 
-// startContainer starts a stopped container
-func startContainer(name string) error {
-	// For now, we'll skip auto-starting containers in MVP
-	// Containers that are stopped need to be explicitly started with 'podman start'
-	// or recreated. This is because:
-	// 1. We don't track enough info to auto-start (need to know if it was intentionally stopped)
-	// 2. Auto-starting containers could be surprising behavior
-	// 3. Most use cases have containers running continuously (sleep infinity)
-	
-	// Return a helpful error for MVP
-	return fmt.Errorf("container is stopped. Start it with 'sili rm --name %s --force && sili create --name %s' or manually with 'podman start %s'", name, name, name)
+// Stop stops every running environment, running its pre-stop hook, and then the VM
+// An environment that fails to stop is reported but doesn't keep the VM up
+func Stop(opts container.StopOptions) error {
+	st, err := state.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	if inst, found, err := lima.GetInstance(); err == nil && found && inst.Status == "Running" {
+		envs := st.ListEnvs()
+		sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+		for _, env := range envs {
+			if env.Status != "running" {
+				continue
+			}
+			fmt.Printf("⏳ Stopping '%s'...\n", env.Name)
+			if err := container.StopWithOptions(env.Name, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "   ⚠️  Failed to stop '%s': %v\n", env.Name, err)
+			}
+		}
+	}
+
+	unlock, err := container.LockStops()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return lima.Stop()
 }
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -116,13 +117,37 @@ func TestEnsureContainerRunning_Stopped(t *testing.T) {
 		t.Fatalf("failed to setup state: %v", err)
 	}
 
-	// Should return error explaining how to restart (MVP behavior)
-	_, err = EnsureContainerRunning("test")
+	// Never start a real container
+	old := startContainer
+	defer func() { startContainer = old }()
+	startContainer = func(name string) error {
+		return errors.New("podman not available")
+	}
+
+	started, err := EnsureContainerRunning("test")
 	if err == nil {
-		t.Errorf("EnsureContainerRunning() should fail for stopped container in MVP")
+		t.Fatal("EnsureContainerRunning() should fail when start fails")
 	}
-	// Check error message contains helpful instructions
-	if err != nil && err.Error() != "failed to start container: container is stopped. Start it with 'sili rm --name test --force && sili create --name test' or manually with 'podman start test'" {
-		t.Errorf("unexpected error message: %v", err)
+	if started {
+		t.Errorf("EnsureContainerRunning() should return false when start fails")
+	}
+
+	// A failed start must leave the environment marked as stopped
+	st, err := state.Load()
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	if got := st.GetEnv("test").Status; got != "stopped" {
+		t.Errorf("expected status to stay stopped, got %q", got)
+	}
+
+	var startedName string
+	startContainer = func(name string) error {
+		startedName = name
+		return nil
+	}
+	started, err = EnsureContainerRunning("test")
+	if err != nil || !started || startedName != "test" {
+		t.Errorf("EnsureContainerRunning() = %v, %v after starting %q, want true, nil after starting test", started, err, startedName)
 	}
 }
@@ -0,0 +1,360 @@
+package wake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coheez/silibox/internal/container"
+	"github.com/coheez/silibox/internal/events"
+	"github.com/coheez/silibox/internal/state"
+	"github.com/coheez/silibox/internal/vm"
+)
+
+// Options configures wake-on-connect
+type Options struct {
+	SyncInterval time.Duration // How often listeners are resynced with state
+	WakeTimeout  time.Duration // How long a connection waits for the env's port after a wake
+}
+
+// DefaultOptions resyncs every 5 seconds and waits up to 2 minutes for a cold VM
+func DefaultOptions() Options {
+	return Options{
+		SyncInterval: 5 * time.Second,
+		WakeTimeout:  2 * time.Minute,
+	}
+}
+
+// Waker listens on the host ports of sleeping environments and wakes an environment
+// when a connection arrives on one of them
+//
+// Listeners are closed before the environment starts so Lima's port forwarder can bind
+// the port again; connections accepted before that are proxied once the port answers
+type Waker struct {
+	opts Options
+
+	mu        sync.Mutex
+	listeners map[int]*listener    // Host port -> listener
+	wakeups   map[string]*wakeup   // Env name -> wake in progress
+	failed    map[int]bool         // Ports that couldn't be bound, to log only once
+	held      map[string]time.Time // Env name, or "" for all, -> until when its ports stay released
+
+	startEnv func(name string) error
+	listen   func(addr string) (net.Listener, error)
+	dial     func(addr string) (net.Conn, error)
+}
+
+type listener struct {
+	sleeper
+	ln net.Listener
+}
+
+// sleeper is a host port of a sleeping environment
+type sleeper struct {
+	env    string
+	hostIP string // Host IP of the mapping; empty is loopback
+}
+
+type wakeup struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns a waker that starts environments through the VM and Podman
+func New(opts Options) *Waker {
+	return &Waker{
+		opts:      opts,
+		listeners: make(map[int]*listener),
+		wakeups:   make(map[string]*wakeup),
+		failed:    make(map[int]bool),
+		held:      make(map[string]time.Time),
+		startEnv:  startEnv,
+		listen: func(addr string) (net.Listener, error) {
+			return net.Listen("tcp", addr)
+		},
+		dial: func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, time.Second)
+		},
+	}
+}
+
+// startEnv boots the VM if needed and starts the container, with the rest of its stack
+func startEnv(name string) error {
+	if err := vm.EnsureVMRunning(); err != nil {
+		return err
+	}
+	return container.StartStack(name)
+}
+
+// Run keeps listeners in sync with state until ctx is cancelled
+func (w *Waker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+	defer w.closeAll()
+
+	for {
+		if s, err := state.Load(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: wake-on-connect failed to load state: %v\n", err)
+		} else {
+			w.sync(s)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// listenAddress is where a port is bound on the host: the mapping's host IP, as Lima
+// forwards it, or loopback
+func listenAddress(hostIP string, port int) string {
+	if hostIP == "" {
+		hostIP = "127.0.0.1"
+	}
+	return net.JoinHostPort(hostIP, strconv.Itoa(port))
+}
+
+// dialAddress reaches a port bound with listenAddress; ports bound to all interfaces
+// are reached through loopback
+func dialAddress(hostIP string, port int) string {
+	switch hostIP {
+	case "", "0.0.0.0":
+		hostIP = "127.0.0.1"
+	case "::":
+		hostIP = "::1"
+	}
+	return net.JoinHostPort(hostIP, strconv.Itoa(port))
+}
+
+// sleepingPorts returns the TCP host ports of environments that aren't running
+// With the VM stopped every environment is asleep, whatever its recorded status
+func sleepingPorts(s *state.State) map[int]sleeper {
+	vmStopped := s.GetVM() == nil || s.GetVM().Status != "running"
+
+	ports := make(map[int]sleeper)
+	for _, env := range s.ListEnvs() {
+		if env.Status == "running" && !vmStopped {
+			continue
+		}
+		for _, p := range env.Ports {
+			// Automatic forwards only exist while the env runs
+			if p.Protocol == "udp" || p.Auto {
+				continue
+			}
+			ports[p.HostPort] = sleeper{env: env.Name, hostIP: p.HostIP}
+		}
+	}
+	return ports
+}
+
+// Release closes the listeners of env, or of every env for "", and keeps them closed
+// while it starts, so Lima's port forwarder can bind the ports. It's how starts that
+// don't go through a wake, e.g. `sili start` or a VM boot, get their ports back
+func (w *Waker) Release(env string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for port, l := range w.listeners {
+		if env == "" || l.env == env {
+			l.ln.Close()
+			delete(w.listeners, port)
+		}
+	}
+	w.held[env] = time.Now().Add(w.opts.WakeTimeout)
+}
+
+// sync opens listeners for sleeping environments and closes those no longer needed
+func (w *Waker) sync(s *state.State) {
+	desired := sleepingPorts(s)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// A release lasts until the env runs, or the VM for a release of every env; a
+	// start that failed gets its listeners back after the wake timeout
+	sleeping := make(map[string]bool)
+	for _, sl := range desired {
+		sleeping[sl.env] = true
+	}
+	vmRunning := s.GetVM() != nil && s.GetVM().Status == "running"
+	for env, until := range w.held {
+		if time.Now().After(until) || (env == "" && vmRunning) || (env != "" && !sleeping[env]) {
+			delete(w.held, env)
+		}
+	}
+
+	for port, l := range w.listeners {
+		if sl, ok := desired[port]; !ok || sl != l.sleeper {
+			l.ln.Close()
+			delete(w.listeners, port)
+		}
+	}
+
+	ports := make([]int, 0, len(desired))
+	for port := range desired {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	for _, port := range ports {
+		sl := desired[port]
+		if _, ok := w.listeners[port]; ok {
+			continue
+		}
+		if _, waking := w.wakeups[sl.env]; waking {
+			continue
+		}
+		if _, ok := w.held[sl.env]; ok {
+			continue
+		}
+		if _, ok := w.held[""]; ok {
+			continue
+		}
+
+		addr := listenAddress(sl.hostIP, port)
+		ln, err := w.listen(addr)
+		if err != nil {
+			if !w.failed[port] {
+				fmt.Fprintf(os.Stderr, "⚠️  Wake-on-connect can't listen on %s for '%s': %v\n", addr, sl.env, err)
+				w.failed[port] = true
+			}
+			continue
+		}
+		delete(w.failed, port)
+		w.listeners[port] = &listener{sleeper: sl, ln: ln}
+		go w.accept(sl, port, ln)
+	}
+}
+
+// Ports returns the host ports currently listened on, by environment
+func (w *Waker) Ports() map[string][]int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ports := make(map[string][]int)
+	for port, l := range w.listeners {
+		ports[l.env] = append(ports[l.env], port)
+	}
+	for _, p := range ports {
+		sort.Ints(p)
+	}
+	return ports
+}
+
+func (w *Waker) accept(sl sleeper, port int, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// Listener closed by sync or a wake
+			return
+		}
+		wk := w.wake(sl.env, port)
+		go w.handoff(conn, dialAddress(sl.hostIP, port), wk)
+	}
+}
+
+// wake starts env once, however many connections arrive while it's starting
+func (w *Waker) wake(env string, port int) *wakeup {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if wk, ok := w.wakeups[env]; ok {
+		return wk
+	}
+
+	wk := &wakeup{done: make(chan struct{})}
+	w.wakeups[env] = wk
+
+	// Free every port of the env so the container's forwards can bind them
+	for p, l := range w.listeners {
+		if l.env == env {
+			l.ln.Close()
+			delete(w.listeners, p)
+		}
+	}
+
+	go func() {
+		fmt.Fprintf(os.Stderr, "🔔 Connection on port %d - waking '%s'...\n", port, env)
+		wk.err = w.startEnv(env)
+		events.RecordResult(events.EnvWake, env, fmt.Sprintf("connection on port %d", port), wk.err)
+		if wk.err != nil {
+			fmt.Fprintf(os.Stderr, "   ⚠️  Failed to wake '%s': %v\n", env, wk.err)
+		} else {
+			fmt.Fprintf(os.Stderr, "   ✅ '%s' is awake\n", env)
+		}
+
+		w.mu.Lock()
+		delete(w.wakeups, env)
+		w.mu.Unlock()
+		close(wk.done)
+	}()
+	return wk
+}
+
+// handoff waits for the woken env to answer on addr and proxies conn to it
+func (w *Waker) handoff(conn net.Conn, addr string, wk *wakeup) {
+	<-wk.done
+	if wk.err != nil {
+		conn.Close()
+		return
+	}
+
+	upstream, err := w.waitForPort(addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "   ⚠️  %v\n", err)
+		conn.Close()
+		return
+	}
+	proxy(conn, upstream)
+}
+
+func (w *Waker) waitForPort(addr string) (net.Conn, error) {
+	deadline := time.Now().Add(w.opts.WakeTimeout)
+	for {
+		conn, err := w.dial(addr)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s did not come up within %s: %w", addr, w.opts.WakeTimeout, err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// proxy copies data both ways until either side closes
+func proxy(client, upstream net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+	wg.Wait()
+	client.Close()
+	upstream.Close()
+}
+
+func (w *Waker) closeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for port, l := range w.listeners {
+		l.ln.Close()
+		delete(w.listeners, port)
+	}
+}
@@ -0,0 +1,255 @@
+package wake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coheez/silibox/internal/state"
+)
+
+func setupTestHome(t *testing.T) func() {
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	state.ResetForTesting()
+	return func() {
+		os.Setenv("HOME", oldHome)
+		state.ResetForTesting()
+	}
+}
+
+// freePort returns a port that is free right now
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestSleepingPorts(t *testing.T) {
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Status: "running"})
+	s.UpsertEnv(&state.EnvInfo{Name: "db", Status: "stopped", Ports: []state.PortMapping{
+		{HostPort: 5432, ContainerPort: 5432, Protocol: "tcp"},
+		{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+		{HostIP: "::1", HostPort: 8080, ContainerPort: 80},
+	}})
+	s.UpsertEnv(&state.EnvInfo{Name: "web", Status: "running", Ports: []state.PortMapping{
+		{HostPort: 3000, ContainerPort: 3000},
+		{HostPort: 5173, ContainerPort: 5173, Auto: true},
+	}})
+
+	if got, want := sleepingPorts(s), map[int]sleeper{5432: {env: "db"}, 8080: {env: "db", hostIP: "::1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sleepingPorts() = %v, want %v", got, want)
+	}
+
+	// With the VM stopped, running envs are asleep too
+	s.UpdateVMStatus("stopped")
+	want := map[int]sleeper{5432: {env: "db"}, 8080: {env: "db", hostIP: "::1"}, 3000: {env: "web"}}
+	if got := sleepingPorts(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("sleepingPorts() with VM stopped = %v, want %v", got, want)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	tests := []struct {
+		hostIP string
+		listen string
+		dial   string
+	}{
+		{"", "127.0.0.1:80", "127.0.0.1:80"},
+		{"127.0.0.1", "127.0.0.1:80", "127.0.0.1:80"},
+		{"::1", "[::1]:80", "[::1]:80"},
+		{"0.0.0.0", "0.0.0.0:80", "127.0.0.1:80"},
+		{"::", "[::]:80", "[::1]:80"},
+	}
+	for _, tt := range tests {
+		if got := listenAddress(tt.hostIP, 80); got != tt.listen {
+			t.Errorf("listenAddress(%q) = %s, want %s", tt.hostIP, got, tt.listen)
+		}
+		if got := dialAddress(tt.hostIP, 80); got != tt.dial {
+			t.Errorf("dialAddress(%q) = %s, want %s", tt.hostIP, got, tt.dial)
+		}
+	}
+}
+
+// echoServer answers each line with the same line
+func echoServer(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			line, _ := r.ReadString('\n')
+			fmt.Fprint(conn, line)
+		}()
+	}
+}
+
+func TestWakeOnConnect(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	port := freePort(t)
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Status: "running"})
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "stopped", Ports: []state.PortMapping{{HostPort: port, ContainerPort: 8080, Protocol: "tcp"}}})
+
+	var backend net.Listener
+	starts := 0
+	w := New(Options{SyncInterval: time.Hour, WakeTimeout: 5 * time.Second})
+	w.startEnv = func(name string) error {
+		starts++
+		// Stand in for the container's forwarded port coming up after the wake
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return err
+		}
+		backend = ln
+		go echoServer(ln)
+		return nil
+	}
+	defer func() {
+		w.closeAll()
+		if backend != nil {
+			backend.Close()
+		}
+	}()
+
+	w.sync(s)
+	if got := w.Ports(); !reflect.DeepEqual(got, map[string][]int{"api": {port}}) {
+		t.Fatalf("expected to listen for api on %d, got %v", port, got)
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "ping\n")
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if reply != "ping\n" {
+		t.Errorf("expected proxied echo, got %q", reply)
+	}
+	if starts != 1 {
+		t.Errorf("expected one start, got %d", starts)
+	}
+	if got := w.Ports(); len(got) != 0 {
+		t.Errorf("expected listeners to be released after wake, got %v", got)
+	}
+}
+
+func TestWakeFailure(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	port := freePort(t)
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Status: "stopped"})
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "stopped", Ports: []state.PortMapping{{HostPort: port, ContainerPort: 8080}}})
+
+	w := New(Options{SyncInterval: time.Hour, WakeTimeout: time.Second})
+	w.startEnv = func(name string) error { return errors.New("VM failed to boot") }
+	defer w.closeAll()
+
+	w.sync(s)
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The connection is closed without data when the wake fails
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+		t.Error("expected connection to be closed")
+	}
+
+	// The env is still asleep, so the next sync listens again
+	w.sync(s)
+	if got := w.Ports(); !reflect.DeepEqual(got, map[string][]int{"api": {port}}) {
+		t.Errorf("expected to listen again after failed wake, got %v", got)
+	}
+}
+
+func TestListenOnHostIP(t *testing.T) {
+	cleanup := setupTestHome(t)
+	defer cleanup()
+
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Status: "running"})
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "stopped", Ports: []state.PortMapping{{HostIP: "::1", HostPort: port, ContainerPort: 80}}})
+
+	w := New(Options{SyncInterval: time.Hour, WakeTimeout: time.Second})
+	w.startEnv = func(name string) error { return errors.New("not in this test") }
+	defer w.closeAll()
+	w.sync(s)
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("[::1]:%d", port), time.Second)
+	if err != nil {
+		t.Fatalf("expected a listener on [::1]:%d: %v", port, err)
+	}
+	conn.Close()
+}
+
+func TestRelease(t *testing.T) {
+	port := freePort(t)
+	s := state.NewState()
+	s.SetVM(&state.VMInfo{Status: "running"})
+	s.UpsertEnv(&state.EnvInfo{Name: "api", Status: "stopped", Ports: []state.PortMapping{{HostPort: port, ContainerPort: 8080}}})
+
+	w := New(Options{SyncInterval: time.Hour, WakeTimeout: time.Hour})
+	defer w.closeAll()
+	w.sync(s)
+
+	// `sili start` releases the ports, which stay released while the env starts
+	w.Release("api")
+	w.sync(s)
+	if got := w.Ports(); len(got) != 0 {
+		t.Fatalf("expected no listeners after release, got %v", got)
+	}
+
+	// Once the env has run, sleeping again brings the listener back
+	s.UpdateEnvStatus("api", "running")
+	w.sync(s)
+	s.UpdateEnvStatus("api", "stopped")
+	w.sync(s)
+	if got := w.Ports(); !reflect.DeepEqual(got, map[string][]int{"api": {port}}) {
+		t.Errorf("expected to listen again once api slept, got %v", got)
+	}
+
+	// Releasing every env lasts until the VM runs
+	s.UpdateVMStatus("stopped")
+	w.Release("")
+	w.sync(s)
+	if got := w.Ports(); len(got) != 0 {
+		t.Fatalf("expected no listeners while the VM boots, got %v", got)
+	}
+	s.UpdateVMStatus("running")
+	w.sync(s)
+	if got := w.Ports(); !reflect.DeepEqual(got, map[string][]int{"api": {port}}) {
+		t.Errorf("expected to listen again once the VM ran, got %v", got)
+	}
+}